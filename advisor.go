@@ -0,0 +1,267 @@
+package rdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Thresholds mirrors the redis configs which control compact encodings.
+type Thresholds struct {
+	HashEntries      int // hash-max-ziplist-entries
+	HashValue        int // hash-max-ziplist-value
+	SetEntries       int // set-max-intset-entries
+	SortedSetEntries int // zset-max-ziplist-entries
+	SortedSetValue   int // zset-max-ziplist-value
+}
+
+// DefaultThresholds are the default redis configs.
+var DefaultThresholds = Thresholds{
+	HashEntries:      512,
+	HashValue:        64,
+	SetEntries:       512,
+	SortedSetEntries: 128,
+	SortedSetValue:   64,
+}
+
+// Set sets the threshold of redis config name.
+func (t *Thresholds) Set(name string, value int) error {
+	switch name {
+	case "hash-max-ziplist-entries", "hash-max-listpack-entries":
+		t.HashEntries = value
+	case "hash-max-ziplist-value", "hash-max-listpack-value":
+		t.HashValue = value
+	case "set-max-intset-entries":
+		t.SetEntries = value
+	case "zset-max-ziplist-entries", "zset-max-listpack-entries":
+		t.SortedSetEntries = value
+	case "zset-max-ziplist-value", "zset-max-listpack-value":
+		t.SortedSetValue = value
+	default:
+		return fmt.Errorf("unknown config: %q", name)
+	}
+	return nil
+}
+
+// Advice represents a key which is stored with a heavyweight encoding although it fits a compact one.
+type Advice struct {
+	Key       Key
+	Encoding  string // current encoding
+	Suggested string // compact encoding the key fits
+	Memory    uint64 // memory used by the value with current encoding
+	Estimated uint64 // estimated memory used by the value with suggested encoding
+
+	// Configs are the minimum values of redis configs the key needs to be compactly encoded.
+	Configs map[string]int
+}
+
+// Saving reports the estimated memory saved by the suggested encoding.
+func (a Advice) Saving() uint64 {
+	if a.Estimated > a.Memory {
+		return 0
+	}
+	return a.Memory - a.Estimated
+}
+
+// Advisor flags keys stored with heavyweight encodings which would fit compact ones under Thresholds.
+//
+// Values must be decoded, keys parsed with SkipValue strategy are ignored.
+// Advisor is safe for concurrent use, its methods can be called directly from Filter's callbacks.
+type Advisor struct {
+	Thresholds Thresholds
+
+	mu      sync.Mutex
+	advices []Advice
+}
+
+// NewAdvisor returns an Advisor using t.
+func NewAdvisor(t Thresholds) *Advisor {
+	return &Advisor{Thresholds: t}
+}
+
+// Hash checks hash h.
+func (a *Advisor) Hash(h *Hash) {
+	if h.Key.Encoding != EncodingHash || len(h.Values) == 0 {
+		return
+	}
+	var value int
+	zl := newZiplistEstimator()
+	for k, v := range h.Values {
+		value = maxInt(value, len(k), len(v))
+		zl.add(k)
+		zl.add(v)
+	}
+	if len(h.Values) > a.Thresholds.HashEntries || value > a.Thresholds.HashValue {
+		return
+	}
+	a.add(Advice{
+		Key:       h.Key,
+		Encoding:  Encoding2String(h.Key.Encoding),
+		Suggested: "ziplist",
+		Memory:    h.memory,
+		Estimated: zl.size(),
+		Configs: map[string]int{
+			"hash-max-ziplist-entries": len(h.Values),
+			"hash-max-ziplist-value":   value,
+		},
+	})
+}
+
+// Set checks set s.
+func (a *Advisor) Set(s *Set) {
+	if s.Key.Encoding != EncodingSet || len(s.Values) == 0 || len(s.Values) > a.Thresholds.SetEntries {
+		return
+	}
+	width := uint64(2)
+	for v := range s.Values {
+		str, ok := v.(string)
+		if !ok {
+			return
+		}
+		i, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || strconv.FormatInt(i, 10) != str {
+			return
+		}
+		switch {
+		case i < -1<<31 || i > 1<<31-1:
+			width = 8
+		case (i < -1<<15 || i > 1<<15-1) && width < 4:
+			width = 4
+		}
+	}
+	a.add(Advice{
+		Key:       s.Key,
+		Encoding:  Encoding2String(s.Key.Encoding),
+		Suggested: "intset",
+		Memory:    s.memory,
+		Estimated: 8 + width*uint64(len(s.Values)),
+		Configs: map[string]int{
+			"set-max-intset-entries": len(s.Values),
+		},
+	})
+}
+
+// SortedSet checks sorted set ss.
+func (a *Advisor) SortedSet(ss *SortedSet) {
+	if ss.Key.Encoding == EncodingSortedSetZip || len(ss.Values) == 0 {
+		return
+	}
+	var value int
+	zl := newZiplistEstimator()
+	for member, score := range ss.Values {
+		value = maxInt(value, len(member))
+		zl.add(member)
+		zl.add(strconv.FormatFloat(score, 'g', 17, 64))
+	}
+	if len(ss.Values) > a.Thresholds.SortedSetEntries || value > a.Thresholds.SortedSetValue {
+		return
+	}
+	a.add(Advice{
+		Key:       ss.Key,
+		Encoding:  Encoding2String(ss.Key.Encoding),
+		Suggested: "ziplist",
+		Memory:    ss.memory,
+		Estimated: zl.size(),
+		Configs: map[string]int{
+			"zset-max-ziplist-entries": len(ss.Values),
+			"zset-max-ziplist-value":   value,
+		},
+	})
+}
+
+// List checks list l, linked lists are always flagged since quicklist replaced them.
+func (a *Advisor) List(l *List) {
+	if l.Key.Encoding != EncodingList || len(l.Values) == 0 {
+		return
+	}
+	zl := newZiplistEstimator()
+	for _, v := range l.Values {
+		zl.add(v)
+	}
+	a.add(Advice{
+		Key:       l.Key,
+		Encoding:  Encoding2String(l.Key.Encoding),
+		Suggested: "quicklist",
+		Memory:    l.memory,
+		Estimated: _overhead.quicklist(1) + zl.size(),
+	})
+}
+
+func (a *Advisor) add(advice Advice) {
+	a.mu.Lock()
+	a.advices = append(a.advices, advice)
+	a.mu.Unlock()
+}
+
+// Advices returns flagged keys, ordered by estimated saving descending.
+func (a *Advisor) Advices() []Advice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	advices := make([]Advice, len(a.advices))
+	copy(advices, a.advices)
+	sort.Slice(advices, func(i, j int) bool {
+		if advices[i].Saving() != advices[j].Saving() {
+			return advices[i].Saving() > advices[j].Saving()
+		}
+		return advices[i].Key.Key < advices[j].Key.Key
+	})
+	return advices
+}
+
+// ziplistEstimator estimates the size of a ziplist.
+type ziplistEstimator struct {
+	bytes int
+	prev  int
+}
+
+func newZiplistEstimator() *ziplistEstimator {
+	// <zlbytes><zltail><zllen> ... <zlend>
+	return &ziplistEstimator{bytes: 4 + 4 + 2 + 1}
+}
+
+func (z *ziplistEstimator) add(s string) {
+	entry := 1
+	if z.prev >= 254 {
+		entry = 5
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	switch {
+	case err == nil && strconv.FormatInt(i, 10) == s:
+		switch {
+		case i >= 0 && i <= 12:
+			entry++
+		case i >= -1<<7 && i < 1<<7:
+			entry += 1 + 1
+		case i >= -1<<15 && i < 1<<15:
+			entry += 1 + 2
+		case i >= -1<<23 && i < 1<<23:
+			entry += 1 + 3
+		case i >= -1<<31 && i < 1<<31:
+			entry += 1 + 4
+		default:
+			entry += 1 + 8
+		}
+	case len(s) <= 0x3f:
+		entry += 1 + len(s)
+	case len(s) <= 0x3fff:
+		entry += 2 + len(s)
+	default:
+		entry += 5 + len(s)
+	}
+	z.bytes += entry
+	z.prev = entry
+}
+
+func (z *ziplistEstimator) size() uint64 {
+	return uint64(z.bytes)
+}
+
+func maxInt(n int, values ...int) int {
+	for _, v := range values {
+		if v > n {
+			n = v
+		}
+	}
+	return n
+}
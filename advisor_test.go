@@ -0,0 +1,51 @@
+package rdb
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAdvisor(t *testing.T) {
+	a := NewAdvisor(DefaultThresholds)
+
+	small := &Hash{Key: Key{Key: "small", Encoding: EncodingHash}, Values: map[string]string{}, memory: 1000}
+	for i := 0; i < 20; i++ {
+		small.Values[strconv.Itoa(i)] = "value"
+	}
+	a.Hash(small)
+
+	big := &Hash{Key: Key{Key: "big", Encoding: EncodingHash}, Values: map[string]string{}, memory: 100000}
+	for i := 0; i < 1000; i++ {
+		big.Values[strconv.Itoa(i)] = "value"
+	}
+	a.Hash(big)
+
+	compact := &Hash{Key: Key{Key: "compact", Encoding: EncodingHashZip}, Values: map[string]string{"a": "b"}}
+	a.Hash(compact)
+
+	ints := &Set{Key: Key{Key: "ints", Encoding: EncodingSet}, Values: map[interface{}]struct{}{"1": {}, "70000": {}}, memory: 500}
+	a.Set(ints)
+	strs := &Set{Key: Key{Key: "strs", Encoding: EncodingSet}, Values: map[interface{}]struct{}{"1": {}, "a": {}}, memory: 500}
+	a.Set(strs)
+
+	advices := a.Advices()
+	if len(advices) != 2 {
+		t.Fatalf("want: 2 advices, got: %+v", advices)
+	}
+	if got := advices[0]; got.Key.Key != "small" || got.Suggested != "ziplist" || got.Configs["hash-max-ziplist-entries"] != 20 || got.Configs["hash-max-ziplist-value"] != 5 {
+		t.Fatalf("got: %+v", got)
+	}
+	// header and trailer, 13 4-bits integer fields, 7 8-bits integer fields, 20 5-bytes values
+	if want := uint64(11 + 13*2 + 7*3 + 20*(1+1+5)); advices[0].Estimated != want {
+		t.Fatalf("want: %v, got: %v", want, advices[0].Estimated)
+	}
+	if got := advices[1]; got.Key.Key != "ints" || got.Suggested != "intset" || got.Estimated != 8+2*4 {
+		t.Fatalf("got: %+v", got)
+	}
+
+	a.Thresholds.Set("hash-max-ziplist-entries", 1024)
+	a.Hash(big)
+	if got := a.Advices()[0]; got.Key.Key != "big" {
+		t.Fatalf("got: %+v", got)
+	}
+}
@@ -0,0 +1,65 @@
+package rdb
+
+// Bitmap summarizes a string value interpreted as a redis bitmap.
+//
+// Bit offsets follow SETBIT/GETBIT: offset 0 is the most significant bit of the first byte.
+type Bitmap struct {
+	Bits    int // total number of bits
+	Count   int // number of set bits
+	Highest int // offset of the highest set bit, -1 if no bit is set
+}
+
+// NewBitmap returns the bitmap summary of s.
+func NewBitmap(s string) Bitmap {
+	return Bitmap{
+		Bits:    len(s) * 8,
+		Count:   BitCount(s),
+		Highest: HighestBit(s),
+	}
+}
+
+// Density reports the ratio of set bits to total bits.
+func (b Bitmap) Density() float64 {
+	if b.Bits == 0 {
+		return 0
+	}
+	return float64(b.Count) / float64(b.Bits)
+}
+
+// Bitmap returns the bitmap summary of s's value.
+func (s String) Bitmap() Bitmap {
+	return NewBitmap(s.Value)
+}
+
+// popcount holds the number of set bits of every byte.
+var popcount [256]uint8
+
+func init() {
+	for i := 1; i < len(popcount); i++ {
+		popcount[i] = popcount[i/2] + uint8(i&1)
+	}
+}
+
+// BitCount returns the number of set bits in s, as BITCOUNT does.
+func BitCount(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n += int(popcount[s[i]])
+	}
+	return n
+}
+
+// HighestBit returns the offset of the highest set bit in s, or -1 if no bit is set.
+func HighestBit(s string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if b := s[i]; b != 0 {
+			// the least significant bit is the last one of the byte
+			off := i*8 + 7
+			for ; b&1 == 0; b >>= 1 {
+				off--
+			}
+			return off
+		}
+	}
+	return -1
+}
@@ -0,0 +1,25 @@
+package rdb
+
+import "testing"
+
+func TestBitmap(t *testing.T) {
+	tests := []struct {
+		value   string
+		count   int
+		highest int
+		density float64
+	}{
+		{"", 0, -1, 0},
+		{"\x00\x00", 0, -1, 0},
+		{"\x80", 1, 0, 0.125},
+		{"\x01", 1, 7, 0.125},
+		{"\xff\x00\x40", 9, 17, 0.375},
+		{"\xff\xff", 16, 15, 1},
+	}
+	for i, test := range tests {
+		b := NewBitmap(test.value)
+		if b.Count != test.count || b.Highest != test.highest || b.Density() != test.density {
+			t.Fatalf("index: %v, got: %+v %v, want: %v %v %v", i, b, b.Density(), test.count, test.highest, test.density)
+		}
+	}
+}
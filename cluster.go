@@ -0,0 +1,101 @@
+package rdb
+
+import (
+	"strings"
+	"sync"
+)
+
+// SlotCount is the number of hash slots of a redis cluster.
+const SlotCount = 16384
+
+// Slot returns the cluster hash slot of key.
+//
+// Like redis cluster, only the substring between the first '{' and the following '}'
+// is hashed if it is not empty.
+func Slot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key) % SlotCount)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) used by redis cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Usage represents the aggregated key count and memory of a group of keys.
+type Usage struct {
+	Keys   int
+	Memory uint64
+}
+
+// Average reports average memory used by a key.
+func (u Usage) Average() uint64 {
+	if u.Keys == 0 {
+		return 0
+	}
+	return u.Memory / uint64(u.Keys)
+}
+
+func (u *Usage) add(memory uint64) {
+	u.Keys++
+	u.Memory += memory
+}
+
+// SlotReport aggregates key count and memory per cluster hash slot.
+//
+// SlotReport is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type SlotReport struct {
+	mu    sync.Mutex
+	slots [SlotCount]Usage
+}
+
+// Add adds key which uses memory bytes to the report.
+func (r *SlotReport) Add(key Key, memory uint64) {
+	slot := Slot(key.Key)
+	r.mu.Lock()
+	r.slots[slot].add(memory)
+	r.mu.Unlock()
+}
+
+// Slots returns the usage of every slot, indexed by slot.
+func (r *SlotReport) Slots() []Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slots := make([]Usage, SlotCount)
+	copy(slots, r.slots[:])
+	return slots
+}
+
+// Nodes returns the usage of every node, nodes maps a slot to its node.
+// Slots which are not in nodes are reported under the empty node name.
+func (r *SlotReport) Nodes(nodes map[int]string) map[string]Usage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	usage := make(map[string]Usage)
+	for slot, u := range r.slots {
+		if u.Keys == 0 {
+			continue
+		}
+		node := nodes[slot]
+		n := usage[node]
+		n.Keys += u.Keys
+		n.Memory += u.Memory
+		usage[node] = n
+	}
+	return usage
+}
@@ -0,0 +1,45 @@
+package rdb
+
+import "testing"
+
+func TestSlot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot int
+	}{
+		{"", 0},
+		{"foo", 12182},
+		{"bar", 5061},
+		{"123456789", 12739},
+		{"{user1000}.following", 3443},
+		{"{user1000}.followers", 3443},
+		{"foo{}{bar}", 8363},
+		{"foo{{bar}}zap", 4015},
+		{"foo{bar}{zap}", 5061},
+	}
+	for _, test := range tests {
+		if got := Slot(test.key); got != test.slot {
+			t.Fatalf("key: %q, want: %v, got: %v", test.key, test.slot, got)
+		}
+	}
+}
+
+func TestSlotReport(t *testing.T) {
+	var r SlotReport
+	r.Add(Key{Key: "{user1000}.following"}, 10)
+	r.Add(Key{Key: "{user1000}.followers"}, 20)
+	r.Add(Key{Key: "foo"}, 5)
+
+	slots := r.Slots()
+	if got := slots[3443]; got.Keys != 2 || got.Memory != 30 || got.Average() != 15 {
+		t.Fatalf("want: 2 keys 30 bytes, got: %+v", got)
+	}
+
+	nodes := r.Nodes(map[int]string{3443: "a", 12182: "b"})
+	if got := nodes["a"]; got.Keys != 2 || got.Memory != 30 {
+		t.Fatalf("want: 2 keys 30 bytes, got: %+v", got)
+	}
+	if got := nodes["b"]; got.Keys != 1 || got.Memory != 5 {
+		t.Fatalf("want: 1 key 5 bytes, got: %+v", got)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const browseHelp = `Commands:
+
+  dbs                  list databases
+  select <db>          switch to database db
+  keys [pattern]       list keys of the database matching a glob pattern
+  sort <order>         order keys by mem, size, len, key or ttl
+  limit <n>            list at most n keys, 0 for all
+  get <key>            show a key and its value
+  stats                show the summary of keys
+  help                 show this help
+  quit                 exit
+`
+
+// browser is an interactive, redis-cli like prompt over an index.
+type browser struct {
+	*index
+
+	db    int
+	order string
+	limit int
+	out   io.Writer
+}
+
+// browseMain runs rmr browse, which indexes dumps and browses them interactively.
+func browseMain(args []string) {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "Number of keys listed by keys.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s browse [options] /path/to/dump.rdb [/path/to/dump.rdb ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n\n")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprint(os.Stderr, browseHelp)
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	b := &browser{index: newIndex(fs.Args(), true), order: "key", limit: *limit, out: os.Stdout}
+	fmt.Fprintf(b.out, "indexed %d keys, type help for commands\n", len(b.records))
+	b.run(os.Stdin)
+}
+
+func (b *browser) run(in io.Reader) {
+	s := bufio.NewScanner(in)
+	s.Buffer(nil, 1<<20)
+	for {
+		fmt.Fprintf(b.out, "db%d> ", b.db)
+		if !s.Scan() {
+			fmt.Fprintln(b.out)
+			return
+		}
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i > 0 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if err := b.exec(strings.ToLower(cmd), arg); err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Fprintf(b.out, "(error) %v\n", err)
+		}
+	}
+}
+
+func (b *browser) exec(cmd, arg string) error {
+	switch cmd {
+	case "help":
+		fmt.Fprint(b.out, browseHelp)
+	case "quit", "exit":
+		return io.EOF
+	case "dbs":
+		s := b.summary.Summary()
+		dbs := make([]int, 0, len(s.DBs))
+		for db := range s.DBs {
+			dbs = append(dbs, db)
+		}
+		sort.Ints(dbs)
+		w := tabwriter.NewWriter(b.out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "db\tkeys\tmem\t")
+		for _, db := range dbs {
+			fmt.Fprintf(w, "%d\t%d\t%d\t\n", db, s.DBs[db].Keys, s.DBs[db].Memory)
+		}
+		w.Flush()
+	case "select":
+		db, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid db: %q", arg)
+		}
+		b.db = db
+	case "sort":
+		if _, ok := orders[arg]; !ok {
+			return fmt.Errorf("invalid order: %q", arg)
+		}
+		b.order = arg
+	case "limit":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid limit: %q", arg)
+		}
+		b.limit = n
+	case "keys":
+		return b.keys(arg)
+	case "get":
+		return b.get(arg)
+	case "stats":
+		fmt.Fprint(b.out, summaryReport{Summarizer: b.summary}.rows()[0])
+	default:
+		return fmt.Errorf("unknown command %q, type help for commands", cmd)
+	}
+	return nil
+}
+
+func (b *browser) keys(pattern string) error {
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+	var records []*record
+	for _, r := range b.records {
+		if r.DB != b.db {
+			continue
+		}
+		if ok, _ := path.Match(pattern, r.Key); ok {
+			records = append(records, r.record)
+		}
+	}
+	less := orders[b.order]
+	sort.SliceStable(records, func(i, j int) bool { return less(records[i], records[j]) })
+
+	w := tabwriter.NewWriter(b.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "key\ttype\tencoding\tmem\tlen\tttl\t")
+	for i, r := range records {
+		if b.limit > 0 && i == b.limit {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t\n", strconv.Quote(r.Key), r.Type, r.Encoding, r.Memory, r.Len, r.TTL())
+	}
+	w.Flush()
+	if b.limit > 0 && len(records) > b.limit {
+		fmt.Fprintf(b.out, "(%d of %d keys)\n", b.limit, len(records))
+	}
+	return nil
+}
+
+func (b *browser) get(key string) error {
+	i := sort.Search(len(b.records), func(i int) bool {
+		r := b.records[i]
+		return r.DB > b.db || r.DB == b.db && r.Key >= key
+	})
+	if i == len(b.records) || b.records[i].DB != b.db || b.records[i].Key != key {
+		fmt.Fprintln(b.out, "(nil)")
+		return nil
+	}
+	data, err := json.MarshalIndent(newRecordJSON(b.records[i].record, true), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(b.out, string(data))
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cleanupFormatter formats records as commands which delete or expire keys.
+//
+// Every command is preceded by SELECT, since records of different databases may be interleaved.
+// If resp is true, commands are encoded in RESP which can be piped to redis-cli --pipe,
+// otherwise they are written as redis-cli inline commands.
+type cleanupFormatter struct {
+	cmd  string
+	ttl  int
+	resp bool
+}
+
+func newCleanupFormatter(cmd, format string, ttl int) (formatter, error) {
+	c := cleanupFormatter{cmd: strings.ToUpper(cmd), ttl: ttl}
+	switch c.cmd {
+	case "DEL", "UNLINK":
+	case "EXPIRE":
+		if ttl <= 0 {
+			return nil, fmt.Errorf("invalid -cleanup-ttl: %v", ttl)
+		}
+	default:
+		return nil, fmt.Errorf("invalid -cleanup: %q", cmd)
+	}
+	switch format {
+	case "resp":
+		c.resp = true
+	case "text":
+	default:
+		return nil, fmt.Errorf("invalid -cleanup-format: %q", format)
+	}
+	return c, nil
+}
+
+func (cleanupFormatter) header() string { return "" }
+func (cleanupFormatter) footer() string { return "" }
+
+func (c cleanupFormatter) sep() string {
+	if c.resp {
+		// commands are terminated by CRLF
+		return ""
+	}
+	return "\n"
+}
+
+func (c cleanupFormatter) format(r *record) string {
+	cmd := []string{c.cmd, r.Key}
+	if c.cmd == "EXPIRE" {
+		cmd = append(cmd, strconv.Itoa(c.ttl))
+	}
+	sel := []string{"SELECT", strconv.Itoa(r.DB)}
+	if c.resp {
+		return resp(sel) + resp(cmd)
+	}
+	return inline(sel) + "\n" + inline(cmd)
+}
+
+// resp encodes args as a RESP array of bulk strings.
+func resp(args []string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+// inline encodes args as a redis-cli inline command, args are quoted if needed.
+func inline(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quote quotes s the way redis-cli parses double quoted args, s is returned as is if it needs no quoting.
+func quote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '\'' || r == '\\' || r == 0x7f
+	}) < 0 {
+		return s
+	}
+	var b bytes.Buffer
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < ' ' || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// nodeName returns the node of a file parsed by -cluster, its base name without extension,
+// e.g. 127.0.0.1:7000 for nodes/127.0.0.1:7000.rdb.gz.
+func nodeName(file string) string {
+	base := filepath.Base(file)
+	for _, ext := range extensions {
+		if strings.HasSuffix(base, ext) {
+			return strings.TrimSuffix(base, ext)
+		}
+	}
+	return base
+}
+
+// misplacedKey is a key found on a node which doesn't own its slot.
+type misplacedKey struct {
+	node string
+	db   int
+	key  string
+	slot int
+	mem  uint64
+}
+
+// clusterReport attributes keys of a directory of node dumps to their slots, and reports per node
+// the keys found on it which belong to slots it doesn't own.
+//
+// Slots are owned as by -nodes if it's set, otherwise by the node holding most of their keys.
+type clusterReport struct {
+	mu    sync.Mutex
+	slots map[string]*[rdb.SlotCount]rdb.Usage // usage of slots per node
+	keys  []misplacedKey                       // all keys if misplaced ones are listed, they are only known once all nodes are parsed
+
+	owners map[int]string // set by -nodes
+	list   bool
+}
+
+func newClusterReport(owners map[int]string, list bool) *clusterReport {
+	return &clusterReport{
+		slots:  make(map[string]*[rdb.SlotCount]rdb.Usage),
+		owners: owners,
+		list:   list,
+	}
+}
+
+func (r *clusterReport) add(key rdb.Key, v value) {
+	r.addRecord(newRecord(key, v))
+}
+
+func (r *clusterReport) addRecord(rec *record) {
+	slot := rdb.Slot(rec.Key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slots, ok := r.slots[rec.File]
+	if !ok {
+		slots = new([rdb.SlotCount]rdb.Usage)
+		r.slots[rec.File] = slots
+	}
+	slots[slot].Keys++
+	slots[slot].Memory += rec.Memory
+	if r.list {
+		r.keys = append(r.keys, misplacedKey{node: rec.File, db: rec.DB, key: rec.Key, slot: slot, mem: rec.Memory})
+	}
+}
+
+// ownership returns the owner of every slot holding keys.
+func (r *clusterReport) ownership() map[int]string {
+	if r.owners != nil {
+		return r.owners
+	}
+	owners := make(map[int]string)
+	for slot := 0; slot < rdb.SlotCount; slot++ {
+		var owner string
+		var most int
+		for node, slots := range r.slots {
+			keys := slots[slot].Keys
+			if keys > most || keys == most && keys > 0 && node < owner {
+				owner, most = node, keys
+			}
+		}
+		if most > 0 {
+			owners[slot] = owner
+		}
+	}
+	return owners
+}
+
+func (r *clusterReport) header() string {
+	if r.list {
+		return "node,db,key,slot,owner,mem"
+	}
+	return "node,keys,mem,slots,misplaced,misplaced_mem"
+}
+
+func (r *clusterReport) rows() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	owners := r.ownership()
+	var rows []string
+	if r.list {
+		for _, k := range r.keys {
+			if owner := owners[k.slot]; owner != k.node {
+				rows = append(rows, fmt.Sprintf("%v,%v,%v,%v,%v,%v", strconv.Quote(k.node), k.db, strconv.Quote(k.key), k.slot, strconv.Quote(owner), k.mem))
+			}
+		}
+		return rows
+	}
+
+	nodes := make([]string, 0, len(r.slots))
+	for node := range r.slots {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		var all, misplaced rdb.Usage
+		owned := 0
+		for slot, u := range r.slots[node] {
+			if owners[slot] == node {
+				owned++
+			}
+			all.Keys += u.Keys
+			all.Memory += u.Memory
+			if u.Keys > 0 && owners[slot] != node {
+				misplaced.Keys += u.Keys
+				misplaced.Memory += u.Memory
+			}
+		}
+		rows = append(rows, fmt.Sprintf("%v,%v,%v,%v,%v,%v", strconv.Quote(node), all.Keys, all.Memory, owned, misplaced.Keys, misplaced.Memory))
+	}
+	return rows
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// recordSize is about the memory held by a sorted row, without its value.
+const recordSize = 256
+
+// estimateFiles writes the cost of the operation set by flags on each of files to w, estimated from
+// a sample of their first -dry-run-sample bytes, instead of running it.
+func estimateFiles(w io.Writer, files []string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	for i, file := range files {
+		e, err := estimateFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		writeEstimate(tw, file, e)
+	}
+	return nil
+}
+
+func estimateFile(file string) (*rdb.Estimate, error) {
+	// the size of compressed or remote files is unknown, RESIZEDB hints are used instead
+	var size int64
+	fd, err := seekable(file)
+	if err != nil {
+		return nil, err
+	}
+	if fd != nil {
+		fi, err := fd.Stat()
+		fd.Close()
+		if err != nil {
+			return nil, err
+		}
+		size = fi.Size()
+	}
+	r, err := open(file)
+	if err != nil {
+		return nil, err
+	}
+	return rdb.EstimateCost(r, size, int64(dryRunSample))
+}
+
+// retainedPerKey returns the bytes the operation retains for every key until the end of the parse.
+func retainedPerKey(e *rdb.Estimate) uint64 {
+	switch {
+	case *sortBy != "":
+		n := uint64(recordSize)
+		if f.values && e.Keys > 0 {
+			n += 2 * e.ValueBytes / uint64(e.Keys)
+		}
+		return n
+	case *dup:
+		// a value hash and a reference to the key
+		return 48
+	}
+	return 0
+}
+
+func writeEstimate(w io.Writer, file string, e *rdb.Estimate) {
+	about := "~"
+	if e.Complete {
+		about = ""
+	}
+	fmt.Fprintf(w, "file\t%s\n", file)
+	fmt.Fprintf(w, "version\t%d\n", e.Version)
+	if e.Size > 0 {
+		fmt.Fprintf(w, "size\t%s\n", humanBytes(uint64(e.Size)))
+	}
+	fmt.Fprintf(w, "sampled\t%s, %d keys in %v\n", humanBytes(uint64(e.Sampled)), e.SampledKeys, e.SampleTime.Round(time.Microsecond))
+	fmt.Fprintf(w, "keys\t%s%d", about, e.Keys)
+	if e.HintedKeys > 0 {
+		fmt.Fprintf(w, " (RESIZEDB hints: %d)", e.HintedKeys)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "memory\t%s%s", about, humanBytes(e.Memory))
+	if e.UsedMemory > 0 {
+		fmt.Fprintf(w, " (used-mem: %s)", humanBytes(e.UsedMemory))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "parse time\t%s%v\n", about, e.ParseTime.Round(time.Microsecond))
+	workers := runtime.NumCPU() * *segments
+	fmt.Fprintf(w, "peak memory\t%s%s\n", about, humanBytes(e.PeakMemory(workers, retainedPerKey(e))))
+}
+
+// humanBytes formats n with a binary unit, e.g. 1.5 GB.
+func humanBytes(n uint64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// expiryReport buckets keys by expiration time, with running totals of the keys and memory released.
+type expiryReport struct {
+	*rdb.ExpiryTimeline
+
+	sep string
+}
+
+// parseInterval returns the bucket width of -expiry-timeline: hour, day or a duration, e.g. 15m.
+func parseInterval(s string) (time.Duration, error) {
+	switch s {
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < time.Millisecond {
+		return 0, fmt.Errorf("invalid -expiry-timeline: %q", s)
+	}
+	return d, nil
+}
+
+func (r expiryReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory())
+}
+
+func (r expiryReport) header() string {
+	return strings.Join([]string{"expires", "keys", "mem", "cum_keys", "cum_mem"}, r.sep)
+}
+
+func (r expiryReport) rows() []string {
+	var (
+		rows []string
+		cum  rdb.Usage
+	)
+	row := func(expires string, u rdb.Usage) {
+		cum.Keys += u.Keys
+		cum.Memory += u.Memory
+		rows = append(rows, strings.Join([]string{
+			expires,
+			strconv.Itoa(u.Keys),
+			strconv.FormatUint(u.Memory, 10),
+			strconv.Itoa(cum.Keys),
+			strconv.FormatUint(cum.Memory, 10),
+		}, r.sep))
+	}
+	// keys already expired are dropped when the snapshot is loaded
+	if u := r.Expired(); u.Keys > 0 {
+		row("expired", u)
+	}
+	for _, b := range r.Buckets() {
+		row(b.Start.Format(time.RFC3339), b.Usage)
+	}
+	if u := r.Persistent(); u.Keys > 0 {
+		row("never", u)
+	}
+	return rows
+}
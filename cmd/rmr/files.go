@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// extensions are the extensions of files scanned by -r.
+var extensions = []string{".rdb", ".rdb.gz", ".rdb.bz2", ".rdb.zst", ".rdb.lz4"}
+
+// scan returns the rdb files under dir, compressed ones included.
+func scan(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		for _, ext := range extensions {
+			if strings.HasSuffix(path, ext) {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// open returns a reader of file, "-" reads stdin and URLs are streamed.
+// Compressed files are decompressed while read, files larger than -m are read through a buffer.
+func open(file string) (rdb.Reader, error) {
+	if file == "-" {
+		return rdb.NewCompressedReader(os.Stdin, *b)
+	}
+	if isRemote(file) {
+		body, err := openRemote(file)
+		if err != nil {
+			return nil, err
+		}
+		return rdb.NewCompressedReader(body, *b)
+	}
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(fd, magic)
+	if rdb.DetectCompression(magic[:n]) != rdb.CompressionNone {
+		fd.Seek(0, io.SeekStart)
+		return rdb.NewCompressedReader(fd, *b)
+	}
+	fi, err := fd.Stat()
+	fd.Close()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > *m {
+		return rdb.NewBufferReader(file, *b)
+	}
+	return rdb.NewMemReader(file)
+}
+
+// decrypter returns a reader wrapper which pipes data through the shell command cmd, e.g. -decrypt-cmd 'age -d -i key.txt'.
+func decrypter(cmd string) func(io.Reader) (io.Reader, error) {
+	return func(r io.Reader) (io.Reader, error) {
+		c := exec.Command("sh", "-c", cmd)
+		c.Stdin = r
+		c.Stderr = os.Stderr
+		out, err := c.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Start(); err != nil {
+			return nil, err
+		}
+		return &cmdReader{out: out, cmd: c}, nil
+	}
+}
+
+// cmdReader reads the output of a command, its exit status is reported at the end of the output.
+type cmdReader struct {
+	out io.Reader
+	cmd *exec.Cmd
+}
+
+func (r *cmdReader) Read(b []byte) (int, error) {
+	n, err := r.out.Read(b)
+	if err == io.EOF {
+		if werr := r.cmd.Wait(); werr != nil {
+			return n, fmt.Errorf("%s: %v", r.cmd.Args[2], werr)
+		}
+	}
+	return n, err
+}
+
+// parseFiles parses files, at most n of them concurrently.
+func parseFiles(files []string, n int, opts ...rdb.ParseOption) {
+	if n < 1 {
+		n = 1
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n)
+	for _, file := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(file string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := f.parse(file, opts...); err != nil {
+				f.error(err)
+			}
+		}(file)
+	}
+	wg.Wait()
+}
+
+// parse parses file with a copy of f, since filters keep per file state.
+// Files are parsed in -segments concurrently, each of them with another copy of f.
+func (f filter) parse(file string, opts ...rdb.ParseOption) error {
+	r, err := open(file)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	if *cluster != "" {
+		f.file = nodeName(file)
+	}
+	if *decryptCmd != "" {
+		opts = append(opts, rdb.WithReaderWrapper(decrypter(*decryptCmd)))
+	}
+	return rdb.ParseSegments(r, *segments, f.copy, opts...)
+}
+
+// copy returns a copy of f which keeps its own state.
+func (f filter) copy() rdb.Filter {
+	f.keys = append(strs(nil), f.keys...)
+	f.dbs = append(ints(nil), f.dbs...)
+
+	var filter rdb.Filter = &f
+	if threshold.minMem > 0 || threshold.maxMem > 0 || threshold.minKeyLen > 0 || threshold.maxKeyLen > 0 {
+		t := threshold
+		t.Filter = filter
+		filter = &t
+	}
+	return filter
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// getMain runs rmr get, which prints a single key of a file.
+//
+// The key is located by the sidecar skeleton of the file if there's one, see rmr skeleton,
+// otherwise by a scan which doesn't decode values.
+func getMain(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	file := fs.String("f", "", "Redis RDB file path.")
+	name := fs.String("k", "", "Key to print.")
+	db := fs.Int("db", 0, "Database of the key.")
+	raw := fs.Bool("raw", false, "Print the DUMP payload of the key instead of its value, e.g. for redis-cli -x RESTORE key 0.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s get [options] -f /path/to/dump.rdb -k key\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *file == "" || *name == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if err := get(os.Stdout, *file, *db, *name, *raw); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *file, err)
+		os.Exit(1)
+	}
+}
+
+var errKeyNotFound = errors.New("key not found")
+
+// get writes key of database db to w, decoded as JSON or as a DUMP payload if raw is set.
+func get(w io.Writer, file string, db int, key string, raw bool) error {
+	fd, err := seekable(file)
+	if err != nil {
+		return err
+	}
+	if fd == nil {
+		// compressed or remote files are parsed up to the key
+		if raw {
+			return errors.New("-raw needs an uncompressed local file")
+		}
+		r, err := open(file)
+		if err != nil {
+			return err
+		}
+		return printKey(w, r, nil, db, key)
+	}
+	defer fd.Close()
+
+	s, err := fileSkeleton(fd, file)
+	if err != nil {
+		return err
+	}
+	e, ok := s.Lookup(db, key)
+	if !ok {
+		return errKeyNotFound
+	}
+	if raw {
+		payload, err := s.Payload(fd, e)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(payload)
+		return err
+	}
+	rg := &rdb.Range{Start: e.Offset, Bytes: e.Length, DB: e.DB, Resumed: true, Version: s.Version}
+	return printKey(w, rdb.NewStreamReader(io.NewSectionReader(fd, e.Offset, e.Length), 0), rg, db, key)
+}
+
+// seekable opens file if it's a local uncompressed file, it returns nil otherwise.
+func seekable(file string) (*os.File, error) {
+	if file == "-" || isRemote(file) {
+		return nil, nil
+	}
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(fd, magic)
+	if rdb.DetectCompression(magic[:n]) != rdb.CompressionNone {
+		fd.Close()
+		return nil, nil
+	}
+	return fd, nil
+}
+
+// fileSkeleton returns the sidecar skeleton of file if it matches the file, fd, or scans it.
+func fileSkeleton(fd *os.File, file string) (*rdb.Skeleton, error) {
+	if s, ok, err := loadSkeleton(file); err != nil {
+		fmt.Fprintf(os.Stderr, "%s%s: %v, scanning\n", file, skeletonExt, err)
+	} else if ok && !stale(fd, s) {
+		return s, nil
+	}
+	return rdb.ScanSkeleton(rdb.NewStreamReader(io.NewSectionReader(fd, 0, 1<<62), *b))
+}
+
+// loadSkeleton reads the sidecar skeleton of file, it reports false if there's none.
+func loadSkeleton(file string) (*rdb.Skeleton, bool, error) {
+	fd, err := os.Open(file + skeletonExt)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer fd.Close()
+	s, err := rdb.ReadSkeleton(fd)
+	return s, err == nil, err
+}
+
+// stale reports whether s isn't the skeleton of the file fd, its size or stored checksum differ.
+func stale(fd *os.File, s *rdb.Skeleton) bool {
+	fi, err := fd.Stat()
+	if err != nil {
+		return true
+	}
+	size := s.Size
+	if s.Version >= 5 {
+		size += 8
+	}
+	if fi.Size() != size {
+		return true
+	}
+	if s.Version < 5 {
+		return false
+	}
+	var crc [8]byte
+	if _, err := fd.ReadAt(crc[:], s.Size); err != nil {
+		return true
+	}
+	return binary.LittleEndian.Uint64(crc[:]) != s.Checksum
+}
+
+// printKey parses r, the range rg of a file or the whole file if rg is nil, and writes key of database db to w.
+func printKey(w io.Writer, r rdb.Reader, rg *rdb.Range, db int, key string) error {
+	var (
+		mu    sync.Mutex
+		rec   *record
+		found bool
+	)
+	add := func(k rdb.Key, v value) {
+		mu.Lock()
+		defer mu.Unlock()
+		rec = newRecord(k, v)
+		rec.Value = decodedValue(v)
+	}
+	filter := rdb.FuncFilter{
+		OnKey: func(k rdb.Key) bool {
+			if found {
+				return true
+			}
+			if k.DB != db || k.Key != key {
+				k.Skip(rdb.SkipAll)
+				return false
+			}
+			found = true
+			return false
+		},
+		OnSet:       func(v *rdb.Set) { add(v.Key, v) },
+		OnList:      func(v *rdb.List) { add(v.Key, v) },
+		OnHash:      func(v *rdb.Hash) { add(v.Key, v) },
+		OnString:    func(v *rdb.String) { add(v.Key, v) },
+		OnSortedSet: func(v *rdb.SortedSet) { add(v.Key, v) },
+	}
+	opts := []rdb.ParseOption{rdb.WithFilter(filter), rdb.WithStrategy(rdb.SkipMeta)}
+	var err error
+	if rg != nil {
+		err = rdb.ParseRange(r, *rg, opts...)
+	} else {
+		err = rdb.Parse(r, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return errKeyNotFound
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newRecordJSON(rec, true))
+}
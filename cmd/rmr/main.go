@@ -1,6 +1,7 @@
 package main
 
 import (
+	"compress/gzip"
 	"flag"
 	"fmt"
 	"io"
@@ -8,28 +9,132 @@ import (
 	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/matthewjhe/rdb"
 )
 
 var (
-	f        filter
-	patterns strings
-
-	b = flag.Int("b", 0, "Read buffer size.")
-	m = flag.Int64("m", 1<<30, "Maximum memory mapping size.")
-	o = flag.String("o", "", "Output file.")
+	f           filter
+	files       strs
+	patterns    strs
+	notPatterns strs
+	threshold   thresholdFilter
+	rateLimit   bytesize
+	splitSize   bytesize
+
+	dryRunSample = bytesize(64 << 20)
+
+	b    = flag.Int("b", 0, "Read buffer size.")
+	m    = flag.Int64("m", 1<<30, "Maximum memory mapping size.")
+	o    = flag.String("o", "", "Output file, it's gzip compressed if its name ends with .gz.")
+	oRDB = flag.String("o-rdb", "", "Write matched keys with their expiries to a new rdb file, the number of keys is reported.")
+
+	compress   = flag.Bool("compress", false, "Gzip compress the output.")
+	splitKeys  = flag.Int("split-keys", 0, "Split -o into files of at most N rows, numbered before the extension: out-0001.csv.gz, out-0002.csv.gz...")
+	r          = flag.String("r", "", "Directory scanned recursively for *.rdb files, compressed ones included.")
+	j          = flag.Int("j", 1, "Number of files parsed in parallel.")
+	decryptCmd = flag.String("decrypt-cmd", "", "Shell command files are piped through before parsing, e.g. 'age -d -i key.txt'.")
+	segments   = flag.Int("segments", 1, "Number of segments a memory-mapped file is split into and parsed concurrently.")
+	resume     = flag.Int("resume", 3, "Number of times reading an URL is resumed with range requests after a failure.")
+	timeout    = flag.Duration("timeout", 0, "Abort parsing a file once it takes longer than this duration, e.g. 30m.")
+	dryRun     = flag.Bool("dry-run", false, "Estimate the keys, memory, parse time and peak memory of the operation from the header, RESIZEDB hints and the first -dry-run-sample bytes of files, instead of running it.")
+	watch      = flag.Bool("watch", false, "Run again whenever files are replaced, e.g. once redis completes a BGSAVE, until interrupted; -o is rewritten by every run.")
+	watchEvery = flag.Duration("watch-interval", time.Second, "Interval at which -watch polls files.")
+	strict     = flag.Bool("strict", false, "Fail on ziplists, zipmaps and intsets whose headers don't match their contents.")
+
+	format   = flag.String("format", "csv", "Output format: csv, json, jsonl, table, parquet, or sql which can be loaded by sqlite3.")
+	fields   = flag.String("fields", "", "Comma separated output columns: file,db,type,encoding,key,mem,size,len,expiry,ttl,value, and content and parsed which detect JSON, msgpack and PHP serialized strings.")
+	sortBy   = flag.String("sort", "", "Sort keys by mem, size, len (descending), key or ttl (ascending).")
+	limit    = flag.Int("limit", 0, "Write at most N keys, after sorting if -sort is set.")
+	escapeBy = flag.String("escape", "quote", "Encoding of keys and values: quote, or base64 and hex which are lossless for binary data.")
+	floatFmt = flag.String("float-format", "g", "Format of sorted set scores: g, the shortest representation; f, without exponent; f2, with 2 decimals; or int, integral scores without decimals.")
+	tmpl     = flag.String("template", "", "Go text/template used to write each key, overrides -format, e.g. '{{.Key}} {{.Memory}} {{.TTL}}'.")
+
+	cluster   = flag.String("cluster", "", "Directory of cluster node dumps parsed as one dataset, rows are tagged with nodes named after files; reports keys, memory, owned slots and keys misplaced on the wrong node unless another report is set.")
+	misplaced = flag.Bool("misplaced", false, "List the keys -cluster finds on nodes which don't own their slots.")
+
+	slots = flag.Bool("slots", false, "Report key count and memory per cluster hash slot.")
+	nodes = flag.String("nodes", "", "Slot to node mapping file, reports key count and memory per node.")
+
+	prefix        = flag.Bool("prefix", false, "Report key count, memory, TTL coverage and encodings per key prefix.")
+	groupByPrefix = flag.Bool("group-by-prefix", false, "Alias of -prefix.")
+	groupBy       = flag.String("group-by", "", "Report key count, memory and average memory per db, type or encoding; prefix is an alias of -prefix.")
+	prefixDepth   = flag.Int("prefix-depth", 1, "Number of key segments a prefix is made of.")
+	prefixRegexp  = flag.String("prefix-regexp", "", "Regexp whose capture groups make the prefix of a key, implies -prefix.")
+	delims        = flag.String("delims", ":", "Key segment delimiter characters used by -prefix, several can be separated by |, e.g. ':|/'.")
+
+	top   = flag.Int("top", 0, "Report the N biggest keys.")
+	topBy = flag.String("top-by", "mem", "Order of -top: mem, size or len.")
+	slow  = flag.Int("slow", 0, "Report the N keys which took the longest to decode, with their decode time in microseconds.")
+
+	advise       = flag.Bool("advise", false, "Report keys with heavyweight encodings which would fit compact ones.")
+	adviseConfig = flag.String("advise-config", "", "Redis configs used by -advise, e.g. hash-max-ziplist-entries=1024,zset-max-ziplist-value=128.")
+
+	upgradeCost = flag.Bool("upgrade-cost", false, "Report the memory compactly encoded keys would use once converted to hashtable or skiplist, -advise-config sets their thresholds.")
+
+	grep = flag.String("grep", "", "Report keys whose values, fields or members match the regexp.")
+
+	utf8Audit   = flag.Bool("utf8", false, "Report the number of keys and values which are valid UTF-8 and binary, with samples of binary ones.")
+	utf8Samples = flag.Int("utf8-samples", 10, "Number of binary keys and values sampled by -utf8.")
+
+	dup = flag.Bool("dup", false, "Report groups of keys holding identical values.")
+
+	stats       = flag.Bool("stats", false, "Report histograms of key lengths, memory usage, element counts and TTLs.")
+	statsFormat = flag.String("stats-format", "table", "Format of -stats: table or json.")
+
+	cleanup       = flag.String("cleanup", "", "Write del, unlink or expire commands of matched keys instead of listing them.")
+	cleanupFormat = flag.String("cleanup-format", "text", "Format of -cleanup: text, or resp which can be piped to redis-cli --pipe.")
+	cleanupTTL    = flag.Int("cleanup-ttl", 3600, "TTL in seconds set by -cleanup expire.")
+
+	restore        = flag.String("restore", "", "Write matched keys to the redis at host:port with native commands.")
+	restoreAuth    = flag.String("auth", "", "Password of the -restore and -verify targets.")
+	restoreReplace = flag.Bool("replace", false, "Replace existing keys of the -restore target, they are kept otherwise.")
+	restoreTTL     = flag.Bool("keep-ttl", true, "Keep expiries of keys written by -restore, expired keys are skipped.")
+	restoreDB      = flag.String("restore-db", "", "Database mapping of -restore and -o-rdb, e.g. 1=0,2=0 flattens databases for a cluster, unmapped databases are kept.")
+	pipeline       = flag.Int("pipeline", 100, "Number of keys -restore writes, or -verify checks, per round trip.")
+
+	verify       = flag.String("verify", "", "Compare a sample of keys with the redis at host:port, reports keys missing or whose type, TTL or value drifted.")
+	verifySample = flag.Int("verify-sample", 1000, "Number of keys sampled by -verify.")
+	verifySlack  = flag.Duration("verify-ttl-slack", 2*time.Second, "TTL difference tolerated by -verify.")
+
+	metrics         = flag.Bool("metrics", false, "Report keys, memory, TTL coverage per prefix and the biggest keys as Prometheus metrics.")
+	metricsPrefixes = flag.Int("metrics-prefixes", 50, "Number of prefixes with the most memory reported by -metrics, 0 for all.")
+	metricsTop      = flag.Int("metrics-top", 10, "Number of biggest keys reported by -metrics.")
+	metricsPush     = flag.String("metrics-push", "", "Pushgateway URL -metrics are pushed to, e.g. http://localhost:9091/metrics/job/rdb.")
+
+	expiryTimeline = flag.String("expiry-timeline", "", "Report keys and memory per expiration time bucket: hour, day or a duration, e.g. 15m.")
+
+	summary = flag.Bool("summary", false, "Report keys and memory per database, type and encoding, expiries and the biggest key; written as JSON if -format is json.")
 )
 
-type strings []string
+type strs []string
 
-func (s *strings) Set(v string) error {
+func (s *strs) Set(v string) error {
 	*s = append(*s, v)
 	return nil
 }
 
-func (s *strings) String() string {
+func (s *strs) String() string {
+	return ""
+}
+
+// valueTypes is a flag.Value of redis types, e.g. hash or zset.
+type valueTypes []rdb.ValueType
+
+func (t *valueTypes) Set(v string) error {
+	typ, err := rdb.ParseValueType(v)
+	if err != nil {
+		return err
+	}
+	*t = append(*t, typ)
+	return nil
+}
+
+func (t *valueTypes) String() string {
 	return ""
 }
 
@@ -50,14 +155,44 @@ func (i *ints) String() string {
 
 type filter struct {
 	dbs      ints
-	keys     strings
-	types    strings
+	keys     strs
+	types    valueTypes
 	patterns []*regexp.Regexp
 
-	debug   bool
-	file    string
+	// exclusions, they take precedence over inclusions
+	notDBs      ints
+	notKeys     strs
+	notTypes    valueTypes
+	notPatterns []*regexp.Regexp
+
+	// TTL audit, keys are matched by expiry
+	noTTLOnly   bool
+	expiredOnly bool
+
+	debug  bool
+	bitmap bool
+	values bool
+
+	// valuesNeeded reports whether values should be decoded
+	valuesNeeded bool
+	// expiryNeeded reports whether key's expiry should be decoded
+	expiryNeeded bool
+
+	// file is the parsed file, it is set on the copy of filter parsing it
+	file string
+	// tagged reports whether rows are tagged with their file
+	tagged bool
+
+	header  string
+	sep     string
+	format  formatter
+	fields  []column
+	sorter  *sorter
+	limiter *limiter
 	out     io.Writer
-	writeCh chan string
+	rows    *rowWriter
+
+	report report
 
 	dbAbort  bool
 	keyAbort bool
@@ -73,6 +208,13 @@ func (f *filter) error(err error) {
 }
 
 func (f *filter) Key(key rdb.Key) bool {
+	if f.limiter.reached() {
+		return true
+	}
+	if f.excludeKey(key.Key) || !f.matchExpiry(key.Expiry) {
+		key.Skip(rdb.SkipAll)
+		return false
+	}
 	if len(f.keys) == 0 && len(f.patterns) == 0 {
 		return f.keyAbort
 	}
@@ -94,7 +236,42 @@ func (f *filter) Key(key rdb.Key) bool {
 	return false
 }
 
+func (f *filter) excludeKey(key string) bool {
+	for _, k := range f.notKeys {
+		if k == key {
+			return true
+		}
+	}
+	for _, p := range f.notPatterns {
+		if p.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExpiry reports whether a key with expiry passes -no-ttl-only and -expired-only.
+func (f *filter) matchExpiry(expiry int) bool {
+	if f.noTTLOnly && expiry >= 0 {
+		return false
+	}
+	if f.expiredOnly && (expiry < 0 || int64(expiry) > now.UnixNano()/int64(time.Millisecond)) {
+		return false
+	}
+	return true
+}
+
 func (f *filter) Type(typ rdb.Type) bool {
+	if f.bitmap && rdb.Encoding2Type(typ.Encoding) != rdb.TypeString {
+		typ.Skip(rdb.SkipAll)
+		return false
+	}
+	for _, t := range f.notTypes {
+		if rdb.Encoding2Type(typ.Encoding) == t {
+			typ.Skip(rdb.SkipAll)
+			return false
+		}
+	}
 	if len(f.types) == 0 {
 		return false
 	}
@@ -108,6 +285,12 @@ func (f *filter) Type(typ rdb.Type) bool {
 }
 
 func (f *filter) Database(db rdb.DB) bool {
+	for _, d := range f.notDBs {
+		if db.Num == d {
+			db.Skip(rdb.SkipAll)
+			return false
+		}
+	}
 	if len(f.dbs) == 0 {
 		return f.dbAbort
 	}
@@ -125,117 +308,153 @@ func (f *filter) Database(db rdb.DB) bool {
 }
 
 func (f *filter) Set(v *rdb.Set) {
-	f.writeCh <- fmt.Sprintf(
-		"%v,%v,%v,%v,%v",
-		v.Key.DB,
-		rdb.Encoding2Type(v.Key.Encoding),
-		rdb.Encoding2String(v.Key.Encoding),
-		strconv.Quote(v.Key.Key),
-		v.Memory(),
-	)
+	f.write(v.Key, v)
 }
 
 func (f *filter) List(v *rdb.List) {
-	f.writeCh <- fmt.Sprintf(
-		"%v,%v,%v,%v,%v",
-		v.Key.DB,
-		rdb.Encoding2Type(v.Key.Encoding),
-		rdb.Encoding2String(v.Key.Encoding),
-		strconv.Quote(v.Key.Key),
-		v.Memory(),
-	)
+	f.write(v.Key, v)
 }
 
 func (f *filter) Hash(v *rdb.Hash) {
-	f.writeCh <- fmt.Sprintf(
-		"%v,%v,%v,%v,%v",
-		v.Key.DB,
-		rdb.Encoding2Type(v.Key.Encoding),
-		rdb.Encoding2String(v.Key.Encoding),
-		strconv.Quote(v.Key.Key),
-		v.Memory(),
-	)
+	f.write(v.Key, v)
 }
 
 func (f *filter) String(v *rdb.String) {
-	f.writeCh <- fmt.Sprintf(
-		"%v,%v,%v,%v,%v",
-		v.Key.DB,
-		rdb.Encoding2Type(v.Key.Encoding),
-		rdb.Encoding2String(v.Key.Encoding),
-		strconv.Quote(v.Key.Key),
-		v.Memory(),
-	)
+	if f.bitmap {
+		b := v.Bitmap()
+		var file string
+		if f.tagged {
+			file = strconv.Quote(f.file) + ","
+		}
+		f.rows.write(fmt.Sprintf(
+			"%v%v,%v,%v,%v,%v,%v",
+			file,
+			v.Key.DB,
+			strconv.Quote(v.Key.Key),
+			len(v.Value),
+			b.Count,
+			b.Highest,
+			strconv.FormatFloat(b.Density(), 'f', 6, 64),
+		))
+		return
+	}
+	f.write(v.Key, v)
 }
 
 func (f *filter) SortedSet(v *rdb.SortedSet) {
-	f.writeCh <- fmt.Sprintf(
-		"%v,%v,%v,%v,%v",
-		v.Key.DB,
-		rdb.Encoding2Type(v.Key.Encoding),
-		rdb.Encoding2String(v.Key.Encoding),
-		strconv.Quote(v.Key.Key),
-		v.Memory(),
-	)
+	f.write(v.Key, v)
 }
 
-func (f *filter) batchWrite() <-chan struct{} {
-	wait := make(chan struct{})
-	f.writeCh = make(chan string, 512)
-	f.writeCh <- "db,type,encoding,key,mem"
-	go func() {
-		timer := time.NewTimer(200 * time.Millisecond)
-		defer timer.Stop()
-
-		var ok bool
-		var str, next string
-		for {
-			if !timer.Stop() {
-				select {
-				case <-timer.C:
-				default:
-				}
-			}
-			timer.Reset(200 * time.Millisecond)
-
-		BATCH:
-			for i := 0; i < 100; i++ {
-				select {
-				case next, ok = <-f.writeCh:
-					if ok {
-						str += next + "\n"
-					} else {
-						break BATCH
-					}
-				default:
-					select {
-					case next, ok = <-f.writeCh:
-						if ok {
-							str += next + "\n"
-						} else {
-							break BATCH
-						}
-					case <-timer.C:
-						break BATCH
-					}
-				}
-			}
+// value is implemented by all rdb value types.
+type value interface {
+	Memory() uint64
+	Size() uint64
+	Len() int
+	Digest() rdb.Digest
+}
 
-			io.WriteString(f.out, str)
-			if !ok {
-				close(wait)
-				return
-			}
-			str, next = "", ""
-		}
-	}()
-	return wait
+func (f *filter) write(key rdb.Key, v value) {
+	if r, ok := f.report.(recordReport); ok {
+		r.addRecord(f.newRecord(key, v))
+		return
+	}
+	if f.report != nil {
+		f.report.add(key, v)
+		return
+	}
+	if f.sorter != nil {
+		f.sorter.add(f.newRecord(key, v))
+		return
+	}
+	if f.limiter.take() {
+		f.rows.write(f.format.format(f.newRecord(key, v)))
+	}
+}
+
+func (f *filter) newRecord(key rdb.Key, v value) *record {
+	r := newRecord(key, v)
+	r.File = f.file
+	return r
+}
+
+// rowWriter writes rows to a sink in the order they are written, separated by sep.
+// The last row is followed by a newline unless sep is empty, in which case rows are self terminated.
+type rowWriter struct {
+	sink rdb.Sink
+	sep  string
+
+	mu   sync.Mutex
+	rows int
+}
+
+func (w *rowWriter) write(row string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.sep == "\n" || w.sep == "":
+		// rows are terminated, so that a sink never holds a partial row
+		row += w.sep
+	case w.rows > 0:
+		row = w.sep + row
+	}
+	w.rows++
+	io.WriteString(w.sink, row)
+}
+
+// close terminates the last row, writes footer if it's not empty and closes the sink.
+func (w *rowWriter) close(footer string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.rows > 0 && w.sep != "\n" && w.sep != "" {
+		io.WriteString(w.sink, "\n")
+	}
+	if footer != "" {
+		io.WriteString(w.sink, footer+"\n")
+	}
+	return w.sink.Close()
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			validateMain(os.Args[2:])
+		case "serve":
+			serveMain(os.Args[2:])
+			return
+		case "browse":
+			browseMain(os.Args[2:])
+			return
+		case "skeleton":
+			skeletonMain(os.Args[2:])
+		case "get":
+			getMain(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
-	if f.file == "" {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] -f /path/to/dump.rdb\n", os.Args[0])
+	files = append(files, flag.Args()...)
+	if *r != "" {
+		found, err := scan(*r)
+		if err != nil {
+			f.error(err)
+		}
+		files = append(files, found...)
+	}
+	if *cluster != "" {
+		found, err := scan(*cluster)
+		if err != nil {
+			f.error(err)
+		}
+		files = append(files, found...)
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] -f /path/to/dump.rdb [/path/to/dump.rdb ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s validate /path/to/dump.rdb [/path/to/dump.rdb ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s serve [options] /path/to/dump.rdb [/path/to/dump.rdb ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s browse [options] /path/to/dump.rdb [/path/to/dump.rdb ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s skeleton /path/to/dump.rdb [/path/to/dump.rdb ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s get [options] -f /path/to/dump.rdb -k key\n", os.Args[0])
 		fmt.Fprintln(os.Stderr)
 		fmt.Fprintf(os.Stderr, "Options:\n\n")
 		flag.PrintDefaults()
@@ -246,23 +465,33 @@ func main() {
 			f.patterns = append(f.patterns, regexp.MustCompile(p))
 		}
 	}
+	for _, p := range notPatterns {
+		f.notPatterns = append(f.notPatterns, regexp.MustCompile(p))
+	}
 
-	var r rdb.Reader
-	fi, err := os.Stat(f.file)
-	if err != nil {
-		f.error(err)
+	for _, file := range files {
+		if file == "-" || isRemote(file) {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			f.error(err)
+		}
 	}
-	if fi.Size() > *m {
-		r, err = rdb.NewBufferReader(f.file, *b)
-	} else {
-		r, err = rdb.NewMemReader(f.file)
+	if watching() {
+		if err := watchFiles(files); err != nil {
+			f.error(err)
+		}
+		return
 	}
-	if err != nil {
-		f.error(err)
+	if *dryRun {
+		if err := estimateFiles(os.Stdout, files); err != nil {
+			f.error(err)
+		}
+		return
 	}
-
+	f.tagged = len(files) > 1 || *cluster != ""
 	f.out = os.Stdout
-	if *o != "" {
+	if *o != "" && !splitting() {
 		of, err := os.OpenFile(*o, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
 		if err != nil {
 			f.error(err)
@@ -271,23 +500,160 @@ func main() {
 
 		f.out = of
 	}
+	if (*compress || strings.HasSuffix(*o, ".gz")) && !splitting() {
+		gz := gzip.NewWriter(f.out)
+		defer gz.Close()
+
+		f.out = gz
+	}
 
-	wait := f.batchWrite()
-	strategy := rdb.WithStrategy(rdb.SkipExpiry | rdb.SkipMeta | rdb.SkipValue)
-	if err := rdb.Parse(r, rdb.WithFilter(&f), strategy); err != nil {
+	var err error
+	if *fields == "" {
+		*fields = defaultFields
+		if f.tagged {
+			*fields = "file," + *fields
+		}
+		if f.noTTLOnly || f.expiredOnly {
+			*fields += ",ttl"
+		}
+		if f.values {
+			*fields += ",value"
+		}
+	}
+	f.fields, err = parseFields(*fields)
+	if err != nil {
+		f.error(err)
+	}
+	if strings.Contains(*fields, "value") || strings.Contains(*tmpl, ".Value") || *format == "sql" {
+		f.values = true
+	}
+	contents := strings.Contains(*fields, "content") || strings.Contains(*fields, "parsed") || strings.Contains(*tmpl, ".Content")
+	if contents {
+		f.valuesNeeded = true
+	}
+	var ok bool
+	if escape, ok = escapes[*escapeBy]; !ok {
+		f.error(fmt.Errorf("invalid -escape: %q", *escapeBy))
+	}
+	if formatFloat, err = parseFloatFormat(*floatFmt); err != nil {
+		f.error(err)
+	}
+	f.format, err = newFormatter(*format, *tmpl)
+	if *cleanup != "" {
+		f.format, err = newCleanupFormatter(*cleanup, *cleanupFormat, *cleanupTTL)
+	}
+	if err != nil {
+		f.error(err)
+	}
+	f.limiter = new(limiter)
+	if *sortBy != "" {
+		f.sorter, err = newSorter(*sortBy, *limit)
+		if err != nil {
+			f.error(err)
+		}
+	} else {
+		f.limiter.limit = int64(*limit)
+	}
+	f.header = f.format.header()
+	f.sep = f.format.sep()
+	if f.bitmap {
+		f.header = "db,key,bytes,bitcount,highest,density"
+		if f.tagged {
+			f.header = "file," + f.header
+		}
+	}
+	f.initReport()
+	if f.report != nil {
+		f.header = f.report.header()
+		f.sep = "\n"
+	}
+	if *format == "table" && *tmpl == "" && *cleanup == "" {
+		w := tabwriter.NewWriter(f.out, 0, 8, 2, ' ', 0)
+		defer w.Flush()
+		f.out = w
+	}
+
+	var footer string
+	if f.report == nil && !f.bitmap {
+		footer = f.format.footer()
+	}
+	if splitting() {
+		// every part has the header and the footer
+		sink, err := newSplitSink(f.header, footer)
+		if err != nil {
+			f.error(err)
+		}
+		f.rows = &rowWriter{sink: sink, sep: f.sep}
+		footer = ""
+	} else {
+		// rows are flushed periodically, so that slow parses still stream their output
+		f.rows = &rowWriter{sink: rdb.NewBufferedSink(f.out, 64<<10, 200*time.Millisecond), sep: f.sep}
+		if f.header != "" {
+			io.WriteString(f.rows.sink, f.header+"\n")
+		}
+	}
+	skip := rdb.SkipMeta | rdb.SkipValue
+	if f.bitmap || f.values || f.valuesNeeded {
+		skip &^= rdb.SkipValue
+	}
+	if f.report != nil && !f.expiryNeeded && !f.noTTLOnly && !f.expiredOnly {
+		skip |= rdb.SkipExpiry
+	}
+	opts := []rdb.ParseOption{rdb.WithStrategy(skip)}
+	if rateLimit > 0 {
+		opts = append(opts, rdb.WithRateLimit(int(rateLimit)))
+	}
+	if *strict {
+		opts = append(opts, rdb.WithStrict())
+	}
+	if *timeout > 0 {
+		opts = append(opts, rdb.WithTimeout(*timeout))
+	}
+	if contents {
+		opts = append(opts, rdb.WithContentDecoder(rdb.JSONContent, rdb.MsgpackContent, rdb.PHPContent))
+	}
+	if r, ok := f.report.(slowReport); ok {
+		opts = append(opts, rdb.WithDecodeTiming(r.TopKeys))
+	}
+	parseFiles(files, *j, opts...)
+	if f.report != nil {
+		for _, row := range f.report.rows() {
+			f.rows.write(row)
+		}
+	}
+	if f.sorter != nil {
+		for _, r := range f.sorter.sorted() {
+			f.rows.write(f.format.format(r))
+		}
+	}
+	if err := f.rows.close(footer); err != nil {
 		f.error(err)
 	}
-	close(f.writeCh)
-	<-wait
 }
 
 func init() {
-	flag.StringVar(&f.file, "f", "", "Redis RDB file path.")
+	flag.Var(&files, "f", "Redis RDB file path, - reads stdin, http(s)://, s3:// and gs:// URLs are streamed. Multiple files can provided, as well as positional arguments.")
 	flag.BoolVar(&f.debug, "d", false, "Enable debug output.")
+	flag.BoolVar(&f.values, "values", false, "Write decoded values along with keys.")
+	flag.BoolVar(&f.bitmap, "bitmap", false, "Report string values as bitmaps: bit count, highest set bit and density.")
 	flag.Var(&f.keys, "k", "Keys to inspect. Multiple keys can provided.")
 	flag.Var(&f.types, "t", "Types to inspect. Multiple types can provided.")
 	flag.Var(&f.dbs, "db", "Databases to inspect. Multiple databases can provided.")
 	flag.Var(&patterns, "p", "Key match patterns. Multiple patterns can provided.")
+	flag.Var(&f.notKeys, "not-k", "Keys to exclude. Multiple keys can provided.")
+	flag.Var(&f.notTypes, "not-t", "Types to exclude. Multiple types can provided.")
+	flag.Var(&f.notDBs, "not-db", "Databases to exclude. Multiple databases can provided.")
+	flag.Var(&notPatterns, "not-p", "Key patterns to exclude. Multiple patterns can provided.")
+	flag.BoolVar(&f.noTTLOnly, "no-ttl-only", false, "Only inspect keys without expiry.")
+	flag.BoolVar(&f.expiredOnly, "expired-only", false, "Only inspect keys which have already expired, they expire immediately on restore.")
+	flag.Var(&renames, "rename", "Rename keys written by -o-rdb and -restore by prefix, e.g. prod:=staging:. Multiple renames can provided.")
+	flag.Var(&splitSize, "split-size", "Split -o into files of about this size before compression, e.g. 1GB, see -split-keys.")
+	flag.Var(&dryRunSample, "dry-run-sample", "Bytes of each file parsed by -dry-run, e.g. 256MB.")
+	flag.Var(&rateLimit, "rate-limit", "Maximum number of bytes read per second from all files, e.g. 50MB.")
+	flag.Var(&threshold.minMem, "min-mem", "Only inspect keys using at least this memory, e.g. 1MB.")
+	flag.Var(&threshold.maxMem, "max-mem", "Only inspect keys using at most this memory, e.g. 512k.")
+	flag.IntVar(&threshold.minKeyLen, "min-keylen", 0, "Only inspect keys whose names are at least this long.")
+	flag.IntVar(&threshold.maxKeyLen, "max-keylen", 0, "Only inspect keys whose names are at most this long.")
 
 	if cpu := runtime.NumCPU(); cpu == 1 {
 		runtime.GOMAXPROCS(3)
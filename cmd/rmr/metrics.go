@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// metricsReport reports metrics in the Prometheus text exposition format,
+// they can be written to a file read by node_exporter's textfile collector or pushed to a Pushgateway.
+type metricsReport struct {
+	summary  *rdb.Summarizer
+	prefixes *rdb.PrefixReport
+	top      *rdb.TopKeys
+
+	maxPrefixes int
+	push        string
+}
+
+func newMetricsReport(delims string, depth, maxPrefixes, top int, push string) metricsReport {
+	return metricsReport{
+		summary:     rdb.NewSummarizer(),
+		prefixes:    rdb.NewPrefixReport(delims, depth),
+		top:         rdb.NewTopKeys(top, rdb.ByMemory),
+		maxPrefixes: maxPrefixes,
+		push:        push,
+	}
+}
+
+func (r metricsReport) add(key rdb.Key, v value) {
+	r.summary.Add(key, v.Memory())
+	r.prefixes.Add(key, v.Memory())
+	r.top.Add(rdb.TopKey{Key: key, Memory: v.Memory(), Size: v.Size(), Length: v.Len()})
+}
+
+func (r metricsReport) header() string {
+	return ""
+}
+
+func (r metricsReport) rows() []string {
+	var buf bytes.Buffer
+	prefixes := r.prefixes.Prefixes()
+	if r.maxPrefixes > 0 && len(prefixes) > r.maxPrefixes {
+		prefixes = prefixes[:r.maxPrefixes]
+	}
+	writeMetrics(&buf, r.summary.Summary(), prefixes, r.top.Keys())
+	if r.push != "" {
+		resp, err := http.Post(r.push, "text/plain; version=0.0.4", bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			f.error(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			f.error(fmt.Errorf("push metrics: %s", resp.Status))
+		}
+	}
+	return []string{strings.TrimSuffix(buf.String(), "\n")}
+}
+
+// metricWriter writes metrics families, the HELP and TYPE lines are written once per family.
+type metricWriter struct {
+	w    io.Writer
+	last string
+}
+
+func (m *metricWriter) gauge(name, help string, value float64, labels ...string) {
+	if m.last != name {
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		m.last = name
+	}
+	fmt.Fprint(m.w, name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+		}
+		fmt.Fprintf(m.w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(m.w, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// writeMetrics writes metrics of a summary, prefixes and top keys.
+func writeMetrics(w io.Writer, s rdb.Summary, prefixes []rdb.Prefix, top []rdb.TopKey) {
+	m := &metricWriter{w: w}
+	m.gauge("rdb_keys", "Number of keys.", float64(s.Keys))
+	m.gauge("rdb_memory_bytes", "Estimated memory used by keys.", float64(s.Memory))
+
+	m.gauge("rdb_expiry_keys", "Number of keys by expiry state.", float64(s.Persistent), "state", "persistent")
+	m.gauge("rdb_expiry_keys", "Number of keys by expiry state.", float64(s.Volatile), "state", "volatile")
+	m.gauge("rdb_expiry_keys", "Number of keys by expiry state.", float64(s.Expired), "state", "expired")
+
+	dbs := make([]int, 0, len(s.DBs))
+	for db := range s.DBs {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	for _, db := range dbs {
+		m.gauge("rdb_db_keys", "Number of keys per database.", float64(s.DBs[db].Keys), "db", strconv.Itoa(db))
+	}
+	for _, db := range dbs {
+		m.gauge("rdb_db_memory_bytes", "Estimated memory used per database.", float64(s.DBs[db].Memory), "db", strconv.Itoa(db))
+	}
+
+	usages := func(name, help, label string, usages map[string]rdb.Usage, memory bool) {
+		names := make([]string, 0, len(usages))
+		for n := range usages {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			v := float64(usages[n].Keys)
+			if memory {
+				v = float64(usages[n].Memory)
+			}
+			m.gauge(name, help, v, label, n)
+		}
+	}
+	usages("rdb_type_keys", "Number of keys per type.", "type", typeUsages(s.Types), false)
+	usages("rdb_type_memory_bytes", "Estimated memory used per type.", "type", typeUsages(s.Types), true)
+	usages("rdb_encoding_keys", "Number of keys per encoding.", "encoding", s.Encodings, false)
+	usages("rdb_encoding_memory_bytes", "Estimated memory used per encoding.", "encoding", s.Encodings, true)
+
+	for _, p := range prefixes {
+		m.gauge("rdb_prefix_keys", "Number of keys per prefix.", float64(p.Keys), "prefix", p.Prefix)
+	}
+	for _, p := range prefixes {
+		m.gauge("rdb_prefix_memory_bytes", "Estimated memory used per prefix.", float64(p.Memory), "prefix", p.Prefix)
+	}
+	for _, p := range prefixes {
+		m.gauge("rdb_prefix_ttl_coverage", "Ratio of keys with an expiry per prefix.", p.TTLCoverage(), "prefix", p.Prefix)
+	}
+
+	for _, k := range top {
+		m.gauge("rdb_top_key_memory_bytes", "Estimated memory used by the biggest keys.", float64(k.Memory),
+			"db", strconv.Itoa(k.Key.DB), "type", string(rdb.Encoding2Type(k.Key.Encoding)), "key", k.Key.Key)
+	}
+}
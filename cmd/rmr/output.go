@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// record represents a key written by rmr, it is also the data of -template.
+type record struct {
+	File     string // set if multiple files are parsed
+	DB       int
+	Type     string
+	Encoding string
+	Key      string
+	Memory   uint64
+	Size     uint64
+	Len      int
+	Expiry   int
+
+	// Value is set if values are written
+	Value interface{}
+
+	// ContentType and Content are set if string contents are detected, see -fields content and parsed
+	ContentType string
+	Content     interface{}
+}
+
+func newRecord(key rdb.Key, v value) *record {
+	r := &record{
+		DB:       key.DB,
+		Type:     string(rdb.Encoding2Type(key.Encoding)),
+		Encoding: rdb.Encoding2String(key.Encoding),
+		Key:      key.Key,
+		Memory:   v.Memory(),
+		Size:     v.Size(),
+		Len:      v.Len(),
+		Expiry:   key.Expiry,
+	}
+	if f.values {
+		r.Value = decodedValue(v)
+	}
+	if s, ok := v.(*rdb.String); ok {
+		r.ContentType = s.ContentType
+		r.Content = s.Content
+	}
+	return r
+}
+
+// decodedValue returns the JSON friendly format of v's value.
+func decodedValue(v value) interface{} {
+	switch v := v.(type) {
+	case *rdb.String:
+		return escaped(v.Value)
+	case *rdb.List:
+		// values are copied since the parser may reuse them
+		values := make([]string, len(v.Values))
+		for i, e := range v.Values {
+			values[i] = escaped(e)
+		}
+		return values
+	case *rdb.Set:
+		members := make([]string, 0, len(v.Values))
+		for m := range v.Values {
+			members = append(members, escaped(fmt.Sprint(m)))
+		}
+		sort.Strings(members)
+		return members
+	case *rdb.Hash:
+		values := make(map[string]string, len(v.Values))
+		for field, value := range v.Values {
+			values[escaped(field)] = escaped(value)
+		}
+		return values
+	case *rdb.SortedSet:
+		members := make([]member, 0, len(v.Values))
+		for m, s := range v.Values {
+			members = append(members, member{escaped(m), score(s)})
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if members[i].Score != members[j].Score {
+				return members[i].Score < members[j].Score
+			}
+			return members[i].Member < members[j].Member
+		})
+		return members
+	}
+	return nil
+}
+
+// escape encodes keys and values as selected by -escape, it's nil if they are written as is.
+var escape func(string) string
+
+var escapes = map[string]func(string) string{
+	"quote":  nil,
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"hex":    func(s string) string { return hex.EncodeToString([]byte(s)) },
+}
+
+// escaped returns s encoded by escape.
+func escaped(s string) string {
+	if escape == nil {
+		return s
+	}
+	return escape(s)
+}
+
+// quoted returns s encoded by escape, or quoted if escape is nil.
+func quoted(s string) string {
+	if escape == nil {
+		return strconv.Quote(s)
+	}
+	return escape(s)
+}
+
+// member represents a sorted set member.
+type member struct {
+	Member string `json:"member"`
+	Score  score  `json:"score"`
+}
+
+// score is a sorted set score, infinities are encoded as strings since JSON can't represent them.
+type score float64
+
+func (s score) MarshalJSON() ([]byte, error) {
+	f := float64(s)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return []byte(strconv.Quote(strconv.FormatFloat(f, 'g', -1, 64))), nil
+	}
+	return []byte(formatFloat(f)), nil
+}
+
+// formatFloat formats finite scores as selected by -float-format.
+var formatFloat = shortestFloat
+
+func shortestFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseFloatFormat returns the formatter of -float-format: g, the shortest representation, which may have
+// an exponent; f, the shortest one without exponent; f followed by a number of decimals, e.g. f2;
+// or int, which writes integral scores without decimals and others as f does.
+func parseFloatFormat(s string) (func(float64) string, error) {
+	switch s {
+	case "g":
+		return shortestFloat, nil
+	case "f":
+		return func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }, nil
+	case "int":
+		return func(f float64) string {
+			if f == math.Trunc(f) {
+				return strconv.FormatFloat(f, 'f', 0, 64)
+			}
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}, nil
+	}
+	if strings.HasPrefix(s, "f") {
+		if prec, err := strconv.Atoi(s[1:]); err == nil && prec >= 0 {
+			return func(f float64) string { return strconv.FormatFloat(f, 'f', prec, 64) }, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid -float-format: %q", s)
+}
+
+// column represents an output column of a record.
+type column struct {
+	name string
+	text func(r *record) string      // used by csv and table formats
+	json func(r *record) interface{} // used by json formats
+}
+
+var columns = []column{
+	{"file", func(r *record) string { return strconv.Quote(r.File) }, func(r *record) interface{} { return r.File }},
+	{"db", func(r *record) string { return strconv.Itoa(r.DB) }, func(r *record) interface{} { return r.DB }},
+	{"type", func(r *record) string { return r.Type }, func(r *record) interface{} { return r.Type }},
+	{"encoding", func(r *record) string { return r.Encoding }, func(r *record) interface{} { return r.Encoding }},
+	{"key", func(r *record) string { return quoted(r.Key) }, func(r *record) interface{} { return escaped(r.Key) }},
+	{"mem", func(r *record) string { return strconv.FormatUint(r.Memory, 10) }, func(r *record) interface{} { return r.Memory }},
+	{"size", func(r *record) string { return strconv.FormatUint(r.Size, 10) }, func(r *record) interface{} { return r.Size }},
+	{"len", func(r *record) string { return strconv.Itoa(r.Len) }, func(r *record) interface{} { return r.Len }},
+	{"expiry", func(r *record) string { return strconv.Itoa(r.Expiry) }, func(r *record) interface{} { return r.Expiry }},
+	{"ttl", func(r *record) string { return strconv.FormatInt(r.TTL(), 10) }, func(r *record) interface{} { return r.TTL() }},
+	{"value", func(r *record) string { return strconv.Quote(r.text()) }, func(r *record) interface{} { return r.Value }},
+	{"content", func(r *record) string { return r.ContentType }, func(r *record) interface{} { return r.ContentType }},
+	{"parsed", func(r *record) string { return strconv.Quote(r.parsed()) }, func(r *record) interface{} { return r.Content }},
+}
+
+// defaultFields are the columns written if -fields is not set, value is appended if -values is set.
+const defaultFields = "db,type,encoding,key,mem,size,len,expiry"
+
+// parseFields returns the columns of a comma separated fields list.
+func parseFields(fields string) ([]column, error) {
+	var selected []column
+NEXT:
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		for _, c := range columns {
+			if c.name == name {
+				selected = append(selected, c)
+				continue NEXT
+			}
+		}
+		return nil, fmt.Errorf("invalid field: %q", name)
+	}
+	return selected, nil
+}
+
+// now is the time TTLs are computed against.
+var now = time.Now()
+
+// TTL returns the remaining time to live in seconds like redis TTL command,
+// 0 if the key is already expired, -1 if the key has no expiry.
+func (r *record) TTL() int64 {
+	if r.Expiry < 0 {
+		return -1
+	}
+	ttl := (int64(r.Expiry) - now.UnixNano()/int64(time.Millisecond)) / 1000
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+func (r *record) columns() []string {
+	columns := make([]string, len(f.fields))
+	for i, c := range f.fields {
+		columns[i] = c.text(r)
+	}
+	return columns
+}
+
+// text returns the text format of r's value, strings are kept as is, other types are JSON encoded.
+func (r *record) text() string {
+	if s, ok := r.Value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(r.Value)
+	if err != nil {
+		f.error(err)
+	}
+	return string(b)
+}
+
+// parsed returns the JSON format of the decoded content of a string, empty if there's none.
+func (r *record) parsed() string {
+	if r.Content == nil {
+		return ""
+	}
+	b, err := json.Marshal(r.Content)
+	if err != nil {
+		f.error(err)
+	}
+	return string(b)
+}
+
+func header(sep string) string {
+	names := make([]string, len(f.fields))
+	for i, c := range f.fields {
+		names[i] = c.name
+	}
+	return strings.Join(names, sep)
+}
+
+// formatter formats records.
+//
+// Rows are separated by sep, header and footer are written as is if they are not empty.
+// The last row is followed by a newline unless sep is empty, in which case rows are self terminated.
+type formatter interface {
+	header() string
+	footer() string
+	sep() string
+	format(r *record) string
+}
+
+func newFormatter(format, tmpl string) (formatter, error) {
+	if tmpl != "" {
+		t, err := template.New("record").Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		return templateFormatter{t}, nil
+	}
+	switch format {
+	case "csv":
+		return csvFormatter{}, nil
+	case "json":
+		return jsonFormatter{array: true}, nil
+	case "jsonl":
+		return jsonFormatter{}, nil
+	case "table":
+		return tableFormatter{}, nil
+	case "sql":
+		return sqlFormatter{}, nil
+	case "parquet":
+		// records are written by parquetReport, see initReport
+		return csvFormatter{}, nil
+	}
+	return nil, fmt.Errorf("invalid -format: %q", format)
+}
+
+// csvFormatter formats records as CSV rows, fields are quoted as needed by encoding/csv.
+type csvFormatter struct{}
+
+// csvColumns override the text of columns which are quoted in other formats.
+var csvColumns = map[string]func(r *record) string{
+	"file":   func(r *record) string { return r.File },
+	"key":    func(r *record) string { return escaped(r.Key) },
+	"value":  func(r *record) string { return r.text() },
+	"parsed": func(r *record) string { return r.parsed() },
+}
+
+func (csvFormatter) header() string {
+	names := make([]string, len(f.fields))
+	for i, c := range f.fields {
+		names[i] = c.name
+	}
+	return csvRow(names)
+}
+
+func (csvFormatter) footer() string { return "" }
+func (csvFormatter) sep() string    { return "\n" }
+
+func (csvFormatter) format(r *record) string {
+	columns := make([]string, len(f.fields))
+	for i, c := range f.fields {
+		if text, ok := csvColumns[c.name]; ok {
+			columns[i] = text(r)
+		} else {
+			columns[i] = c.text(r)
+		}
+	}
+	return csvRow(columns)
+}
+
+// csvRow returns the CSV row of fields, without line terminator.
+func csvRow(fields []string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(fields)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonFormatter formats a record as a JSON object,
+// if array is true, records are written as a JSON array, otherwise as JSON lines.
+type jsonFormatter struct {
+	array bool
+}
+
+func (j jsonFormatter) header() string {
+	if j.array {
+		return "["
+	}
+	return ""
+}
+
+func (j jsonFormatter) footer() string {
+	if j.array {
+		return "]"
+	}
+	return ""
+}
+
+func (j jsonFormatter) sep() string {
+	if j.array {
+		return ",\n"
+	}
+	return "\n"
+}
+
+func (jsonFormatter) format(r *record) string {
+	// keep the order of fields
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range f.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(c.json(r))
+		if err != nil {
+			f.error(err)
+		}
+		buf.WriteString(strconv.Quote(c.name))
+		buf.WriteByte(':')
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// tableFormatter formats records as tab separated columns, the output should be aligned by a tabwriter.
+type tableFormatter struct{}
+
+func (tableFormatter) header() string { return header("\t") }
+func (tableFormatter) footer() string { return "" }
+func (tableFormatter) sep() string    { return "\n" }
+
+func (tableFormatter) format(r *record) string {
+	return strings.Join(r.columns(), "\t")
+}
+
+// templateFormatter formats records with a text/template.
+type templateFormatter struct {
+	*template.Template
+}
+
+func (templateFormatter) header() string { return "" }
+func (templateFormatter) footer() string { return "" }
+func (templateFormatter) sep() string    { return "\n" }
+
+func (t templateFormatter) format(r *record) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, r); err != nil {
+		f.error(err)
+	}
+	return buf.String()
+}
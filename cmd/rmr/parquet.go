@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// Parquet physical types, repetition types, converted types, encodings and page types used by parquetWriter.
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+	parquetRequired  = 0
+	parquetUTF8      = 0
+	parquetPlain     = 0
+	parquetRLE       = 3
+	parquetDataPage  = 0
+)
+
+// parquetRowGroup is the number of rows of a row group.
+const parquetRowGroup = 1 << 16
+
+// stringColumns are the columns stored as byte arrays, others are stored as int64.
+// They map to whether the column is UTF-8, keys and values may be binary unless they are escaped.
+var stringColumns = map[string]bool{
+	"file":     true,
+	"type":     true,
+	"encoding": true,
+	"key":      false,
+	"value":    false,
+	"content":  true,
+	"parsed":   true,
+}
+
+// parquetReport writes records as a Parquet file, each column is PLAIN encoded and uncompressed,
+// a row group is written every parquetRowGroup records.
+type parquetReport struct {
+	*parquetWriter
+}
+
+func (r parquetReport) add(key rdb.Key, v value) {
+	r.write(newRecord(key, v))
+}
+
+func (r parquetReport) addRecord(rec *record) {
+	r.write(rec)
+}
+
+func (r parquetReport) header() string {
+	return ""
+}
+
+func (r parquetReport) rows() []string {
+	if err := r.close(); err != nil {
+		f.error(err)
+	}
+	return nil
+}
+
+type parquetColumn struct {
+	column
+
+	typ    int32
+	utf8   bool
+	values bytes.Buffer // PLAIN encoded values of the current row group
+}
+
+type parquetChunk struct {
+	offset int64 // offset of the page header
+	size   int64 // size of the page header and values
+}
+
+type parquetWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	offset  int64
+	columns []*parquetColumn
+	rows    int   // rows of the current row group
+	total   int64 // rows written
+	groups  [][]parquetChunk
+	sizes   []int64 // rows of the row groups
+	err     error
+}
+
+func newParquetWriter(w io.Writer, columns []column) *parquetWriter {
+	pw := &parquetWriter{w: w}
+	for _, c := range columns {
+		pc := &parquetColumn{column: c, typ: parquetInt64}
+		if utf8, ok := stringColumns[c.name]; ok {
+			pc.typ = parquetByteArray
+			pc.utf8 = utf8 || escape != nil
+		}
+		pw.columns = append(pw.columns, pc)
+	}
+	pw.writeRaw([]byte("PAR1"))
+	return pw
+}
+
+func (pw *parquetWriter) writeRaw(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	pw.err = err
+}
+
+func (pw *parquetWriter) write(r *record) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	var buf [8]byte
+	for _, c := range pw.columns {
+		if c.typ == parquetByteArray {
+			var s string
+			switch c.name {
+			case "value":
+				s = r.text()
+			case "parsed":
+				s = r.parsed()
+			default:
+				s = fmt.Sprint(c.json(r))
+			}
+			binary.LittleEndian.PutUint32(buf[:4], uint32(len(s)))
+			c.values.Write(buf[:4])
+			c.values.WriteString(s)
+			continue
+		}
+		var n int64
+		switch v := c.json(r).(type) {
+		case int:
+			n = int64(v)
+		case int64:
+			n = v
+		case uint64:
+			n = int64(v)
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		c.values.Write(buf[:])
+	}
+	pw.rows++
+	if pw.rows == parquetRowGroup {
+		pw.flush()
+	}
+}
+
+// flush writes the current row group, a column chunk is made of a single data page.
+func (pw *parquetWriter) flush() {
+	if pw.rows == 0 {
+		return
+	}
+	chunks := make([]parquetChunk, len(pw.columns))
+	for i, c := range pw.columns {
+		var t thrift
+		t.begin()
+		t.i32(1, parquetDataPage)
+		t.i32(2, int32(c.values.Len()))
+		t.i32(3, int32(c.values.Len()))
+		t.struct_(5)
+		t.i32(1, int32(pw.rows))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.end()
+		t.end()
+
+		chunks[i] = parquetChunk{offset: pw.offset, size: int64(t.buf.Len() + c.values.Len())}
+		pw.writeRaw(t.buf.Bytes())
+		pw.writeRaw(c.values.Bytes())
+		c.values.Reset()
+	}
+	pw.groups = append(pw.groups, chunks)
+	pw.sizes = append(pw.sizes, int64(pw.rows))
+	pw.total += int64(pw.rows)
+	pw.rows = 0
+}
+
+// close writes the last row group and the file metadata.
+func (pw *parquetWriter) close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.flush()
+
+	var t thrift
+	t.begin()
+	t.i32(1, 1)
+	t.list(2, tStruct, len(pw.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.end()
+	for _, c := range pw.columns {
+		t.begin()
+		t.i32(1, c.typ)
+		t.i32(3, parquetRequired)
+		t.binary(4, c.name)
+		if c.utf8 {
+			t.i32(6, parquetUTF8)
+		}
+		t.end()
+	}
+	t.i64(3, pw.total)
+	t.list(4, tStruct, len(pw.groups))
+	for g, chunks := range pw.groups {
+		t.begin()
+		t.list(1, tStruct, len(chunks))
+		var total int64
+		for i, chunk := range chunks {
+			c := pw.columns[i]
+			total += chunk.size
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.struct_(3)
+			t.i32(1, c.typ)
+			t.list(2, tI32, 2)
+			t.elemI32(parquetPlain)
+			t.elemI32(parquetRLE)
+			t.list(3, tBinary, 1)
+			t.elemBinary(c.name)
+			t.i32(4, 0) // uncompressed
+			t.i64(5, pw.sizes[g])
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, total)
+		t.i64(3, pw.sizes[g])
+		t.end()
+	}
+	t.binary(6, "rmr")
+	t.end()
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(t.buf.Len()))
+	pw.writeRaw(t.buf.Bytes())
+	pw.writeRaw(size[:])
+	pw.writeRaw([]byte("PAR1"))
+	return pw.err
+}
+
+// Thrift compact protocol types.
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// thrift encodes structs with the Thrift compact protocol, which Parquet metadata is serialized with.
+type thrift struct {
+	buf  bytes.Buffer
+	id   int16   // last field id of the current struct
+	last []int16 // last field ids of the enclosing structs
+}
+
+// begin begins a struct which is a list element or the top level struct.
+func (t *thrift) begin() {
+	t.last = append(t.last, t.id)
+	t.id = 0
+}
+
+// struct_ begins a struct field.
+func (t *thrift) struct_(id int16) {
+	t.field(id, tStruct)
+	t.begin()
+}
+
+// end ends a struct.
+func (t *thrift) end() {
+	t.buf.WriteByte(0)
+	t.id = t.last[len(t.last)-1]
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if delta := id - t.id; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.id = id
+}
+
+func (t *thrift) varint(v uint64) {
+	for v >= 0x80 {
+		t.buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	t.buf.WriteByte(byte(v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1 ^ v>>63)
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, tI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, tI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, tBinary)
+	t.elemBinary(s)
+}
+
+// list begins a list field of n elements of type typ.
+func (t *thrift) list(id int16, typ byte, n int) {
+	t.field(id, tList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	t.buf.WriteByte(0xf0 | typ)
+	t.varint(uint64(n))
+}
+
+func (t *thrift) elemI32(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) elemBinary(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// rdbReport writes matched keys along with their expiries as a new rdb file, it reports the number of keys written.
+type rdbReport struct {
+	file *os.File
+	enc  *rdb.Encoder
+
+	mu   sync.Mutex
+	keys int
+	err  error
+}
+
+// newRDBReport returns a rdbReport writing to the file name, keys are renamed by rewrite unless it's nil,
+// moved to the databases dbs maps theirs to, and their expiries adjusted by policies.
+func newRDBReport(name string, rewrite func(key string) (string, bool), dbs map[int]int, policies []rdb.ExpiryPolicy) (*rdbReport, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+	opts := []rdb.EncoderOption{rdb.WithDBMap(dbs), rdb.WithExpiryPolicy(policies...)}
+	if rewrite != nil {
+		opts = append(opts, rdb.WithKeyRewrite(rewrite))
+	}
+	return &rdbReport{file: file, enc: rdb.NewEncoder(file, opts...)}, nil
+}
+
+func (r *rdbReport) add(key rdb.Key, v value) {
+	var err error
+	switch v := v.(type) {
+	case *rdb.String:
+		err = r.enc.String(v)
+	case *rdb.List:
+		err = r.enc.List(v)
+	case *rdb.Set:
+		err = r.enc.Set(v)
+	case *rdb.Hash:
+		err = r.enc.Hash(v)
+	case *rdb.SortedSet:
+		err = r.enc.SortedSet(v)
+	default:
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.keys++
+}
+
+func (r *rdbReport) header() string {
+	return "keys"
+}
+
+func (r *rdbReport) rows() []string {
+	err := r.enc.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	if r.err != nil {
+		err = r.err
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return []string{fmt.Sprint(r.keys)}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// schemes are the URL schemes of remote files.
+var schemes = []string{"http://", "https://", "s3://", "gs://"}
+
+// isRemote reports whether file is an URL.
+func isRemote(file string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(file, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteReader streams a remote file, it resumes with range requests from where it failed
+// at most -resume times if the server supports them.
+type remoteReader struct {
+	url    string
+	body   io.ReadCloser
+	ranges bool
+	off    int64
+	resume int
+}
+
+// openRemote returns a reader of the http, https, s3 or gs URL file.
+//
+// s3 objects are read from AWS_ENDPOINT_URL or the AWS_REGION endpoint, requests are signed
+// if AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are set.
+// gs objects are read from storage.googleapis.com, with GOOGLE_OAUTH_ACCESS_TOKEN if it's set.
+func openRemote(file string) (io.ReadCloser, error) {
+	r := &remoteReader{url: file, resume: *resume}
+	resp, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	r.body = resp.Body
+	r.ranges = resp.Header.Get("Accept-Ranges") == "bytes"
+	return r, nil
+}
+
+func (r *remoteReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	if err == nil || err == io.EOF || !r.ranges || r.resume <= 0 {
+		return n, err
+	}
+	r.resume--
+	r.body.Close()
+	resp, rerr := r.get()
+	if rerr != nil {
+		return n, fmt.Errorf("%v, resuming: %v", err, rerr)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return n, fmt.Errorf("%v, resuming: %s", err, resp.Status)
+	}
+	r.body = resp.Body
+	return n, nil
+}
+
+func (r *remoteReader) Close() error {
+	return r.body.Close()
+}
+
+// get requests the file from r.off.
+func (r *remoteReader) get() (*http.Response, error) {
+	req, err := newRemoteRequest(r.url)
+	if err != nil {
+		return nil, err
+	}
+	if r.off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.off))
+	}
+	if strings.HasPrefix(r.url, "s3://") {
+		signS3(req, time.Now())
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", r.url, resp.Status)
+	}
+	return resp, nil
+}
+
+// newRemoteRequest returns the GET request of the file URL.
+func newRemoteRequest(file string) (*http.Request, error) {
+	u, err := url.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	object := uriEncode(strings.TrimPrefix(u.Path, "/"))
+	switch u.Scheme {
+	case "s3":
+		if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+			file = strings.TrimSuffix(endpoint, "/") + "/" + u.Host + "/" + object
+		} else {
+			file = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.Host, awsRegion(), object)
+		}
+	case "gs":
+		file = fmt.Sprintf("https://storage.googleapis.com/%s/%s", u.Host, object)
+	}
+	req, err := http.NewRequest("GET", file, nil)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "gs" {
+		if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	return req, nil
+}
+
+func awsRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// signS3 signs req with AWS signature version 4, if credentials are set.
+func signS3(req *http.Request, now time.Time) {
+	key, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if key == "" || secret == "" {
+		return
+	}
+	date := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-amz-date:" + date + "\n"
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		signed = append(signed, "x-amz-security-token")
+		headers += "x-amz-security-token:" + token + "\n"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		headers,
+		strings.Join(signed, ";"),
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+
+	region := awsRegion()
+	scope := date[:8] + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	k := hmacSHA256([]byte("AWS4"+secret), date[:8])
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		key, scope, strings.Join(signed, ";"), hmacSHA256(k, toSign)))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	io.WriteString(h, s)
+	return h.Sum(nil)
+}
+
+// uriEncode escapes the object name s as required by AWS signatures, slashes are kept.
+func uriEncode(s string) string {
+	const hexdigits = "0123456789ABCDEF"
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexdigits[c>>4])
+		b.WriteByte(hexdigits[c&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renames are the key prefix renames of -rename.
+var renames strs
+
+// parseRenames returns the key rewrite function of -o-rdb and -restore, keys are renamed by the first
+// rename whose prefix they start with, e.g. prod:=staging:, others are kept.
+// It returns nil if there is no rename.
+func parseRenames(renames []string) (func(key string) (string, bool), error) {
+	if len(renames) == 0 {
+		return nil, nil
+	}
+	var from, to []string
+	for _, r := range renames {
+		kv := strings.SplitN(r, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid -rename: %q", r)
+		}
+		from = append(from, kv[0])
+		to = append(to, kv[1])
+	}
+	return func(key string) (string, bool) {
+		for i, prefix := range from {
+			if strings.HasPrefix(key, prefix) {
+				return to[i] + key[len(prefix):], true
+			}
+		}
+		return key, true
+	}, nil
+}
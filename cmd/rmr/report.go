@@ -0,0 +1,587 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// report aggregates keys instead of writing a row per key.
+type report interface {
+	add(key rdb.Key, v value)
+
+	header() string
+	rows() []string
+}
+
+// recordReport is a report which is fed records instead of keys, so that they are tagged with their file.
+type recordReport interface {
+	report
+
+	addRecord(r *record)
+}
+
+// initReport sets the report selected by flags, if any. Reports can't be combined, only one of them
+// may be selected; -cluster reports on nodes unless another report is selected.
+func (f *filter) initReport() {
+	var selected []string
+	set := func(flag string, r report) {
+		selected = append(selected, flag)
+		f.report = r
+	}
+	defer func() {
+		if len(selected) > 1 {
+			f.error(fmt.Errorf("only one report can be selected, got: %s", strings.Join(selected, ", ")))
+		}
+	}()
+	if *cluster != "" {
+		var owners map[int]string
+		if *nodes != "" {
+			var err error
+			if owners, err = readNodes(*nodes); err != nil {
+				f.error(err)
+			}
+		}
+		f.report = newClusterReport(owners, *misplaced)
+	}
+	if *slots || *nodes != "" && *cluster == "" {
+		r := slotReport{SlotReport: new(rdb.SlotReport)}
+		if *nodes != "" {
+			var err error
+			r.nodes, err = readNodes(*nodes)
+			if err != nil {
+				f.error(err)
+			}
+		}
+		set("-slots", r)
+	}
+	sep := ","
+	if *format == "table" {
+		sep = "\t"
+	}
+	switch *groupBy {
+	case "":
+	case "db", "type", "encoding":
+		set("-group-by", groupReport{Summarizer: rdb.NewSummarizer(), by: *groupBy, sep: sep})
+	case "prefix":
+		*groupByPrefix = true
+	default:
+		f.error(fmt.Errorf("invalid -group-by: %q", *groupBy))
+	}
+	if *prefix || *groupByPrefix || *prefixRegexp != "" {
+		r := prefixReport{PrefixReport: rdb.NewPrefixReport(parseDelims(*delims), *prefixDepth), sep: sep}
+		if *prefixRegexp != "" {
+			r.PrefixReport = rdb.NewPatternPrefixReport(regexp.MustCompile(*prefixRegexp))
+		}
+		f.expiryNeeded = true
+		set("-prefix", r)
+	}
+	if *top > 0 {
+		by, ok := topOrders[*topBy]
+		if !ok {
+			f.error(fmt.Errorf("invalid -top-by: %q", *topBy))
+		}
+		set("-top", topReport{rdb.NewTopKeys(*top, by)})
+	}
+	if *slow > 0 {
+		f.valuesNeeded = true
+		set("-slow", slowReport{rdb.NewTopKeys(*slow, rdb.ByDuration)})
+	}
+	if *advise || *adviseConfig != "" {
+		f.valuesNeeded = true
+		set("-advise", adviseReport{rdb.NewAdvisor(f.thresholds())})
+	}
+	if *upgradeCost {
+		f.valuesNeeded = true
+		set("-upgrade-cost", upgradeReport{rdb.NewUpgradeEstimator(f.thresholds())})
+	}
+	if *grep != "" {
+		f.valuesNeeded = true
+		set("-grep", searchReport{rdb.NewSearch(regexp.MustCompile(*grep))})
+	}
+	if *utf8Audit {
+		f.valuesNeeded = true
+		set("-utf8", utf8Report{rdb.NewUTF8Audit(*utf8Samples)})
+	}
+	if *dup {
+		f.valuesNeeded = true
+		set("-dup", dupReport{rdb.NewDuplicates()})
+	}
+	if *stats {
+		if *statsFormat != "table" && *statsFormat != "json" {
+			f.error(fmt.Errorf("invalid -stats-format: %q", *statsFormat))
+		}
+		f.expiryNeeded = true
+		set("-stats", statsReport{Stats: rdb.NewStats(), format: *statsFormat})
+	}
+	if *expiryTimeline != "" {
+		interval, err := parseInterval(*expiryTimeline)
+		if err != nil {
+			f.error(err)
+		}
+		f.expiryNeeded = true
+		set("-expiry-timeline", expiryReport{ExpiryTimeline: rdb.NewExpiryTimeline(interval), sep: sep})
+	}
+	if *restore != "" {
+		dbs, err := parseDBMap(*restoreDB)
+		if err != nil {
+			f.error(err)
+		}
+		r, err := newRestoreReport(*restore, *restoreAuth, dbs, *restoreReplace, *restoreTTL, *pipeline)
+		if err != nil {
+			f.error(err)
+		}
+		if r.rewrite, err = parseRenames(renames); err != nil {
+			f.error(err)
+		}
+		if r.expiry, err = parseExpiryPolicies(); err != nil {
+			f.error(err)
+		}
+		f.valuesNeeded = true
+		f.expiryNeeded = true
+		set("-restore", r)
+	}
+	if *verify != "" {
+		if *verifySample < 1 {
+			f.error(fmt.Errorf("invalid -verify-sample: %d", *verifySample))
+		}
+		f.valuesNeeded = true
+		f.expiryNeeded = true
+		set("-verify", newVerifyReport(*verify, *restoreAuth, *verifySample, *verifySlack, *pipeline))
+	}
+	if *metrics || *metricsPush != "" {
+		f.expiryNeeded = true
+		set("-metrics", newMetricsReport(parseDelims(*delims), *prefixDepth, *metricsPrefixes, *metricsTop, *metricsPush))
+	}
+	if *format == "parquet" {
+		f.expiryNeeded = true
+		set("-format parquet", parquetReport{newParquetWriter(f.out, f.fields)})
+	}
+	if *oRDB != "" {
+		rewrite, err := parseRenames(renames)
+		if err != nil {
+			f.error(err)
+		}
+		dbs, err := parseDBMap(*restoreDB)
+		if err != nil {
+			f.error(err)
+		}
+		policies, err := parseExpiryPolicies()
+		if err != nil {
+			f.error(err)
+		}
+		r, err := newRDBReport(*oRDB, rewrite, dbs, policies)
+		if err != nil {
+			f.error(err)
+		}
+		f.valuesNeeded = true
+		f.expiryNeeded = true
+		set("-o-rdb", r)
+	}
+	if *summary {
+		f.expiryNeeded = true
+		set("-summary", summaryReport{Summarizer: rdb.NewSummarizer(), json: *format == "json"})
+	}
+}
+
+// thresholds returns the thresholds of -advise-config.
+func (f *filter) thresholds() rdb.Thresholds {
+	t := rdb.DefaultThresholds
+	if *adviseConfig == "" {
+		return t
+	}
+	for _, config := range strings.Split(*adviseConfig, ",") {
+		kv := strings.SplitN(config, "=", 2)
+		if len(kv) != 2 {
+			f.error(fmt.Errorf("invalid -advise-config: %q", config))
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil {
+			f.error(fmt.Errorf("invalid -advise-config: %q", config))
+		}
+		if err := t.Set(strings.TrimSpace(kv[0]), n); err != nil {
+			f.error(err)
+		}
+	}
+	return t
+}
+
+// parseDelims returns the delimiter characters of -delims, "|" separates them if there are several, e.g. ":|/".
+func parseDelims(delims string) string {
+	if len(delims) > 1 {
+		return strings.Replace(delims, "|", "", -1)
+	}
+	return delims
+}
+
+// prefixReport reports key count, memory, TTL coverage and encodings per key prefix.
+type prefixReport struct {
+	*rdb.PrefixReport
+
+	sep string
+}
+
+func (r prefixReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory())
+}
+
+func (r prefixReport) header() string {
+	return strings.Join([]string{"prefix", "keys", "mem", "avg", "expires", "ttl_coverage", "encodings"}, r.sep)
+}
+
+func (r prefixReport) rows() []string {
+	var rows []string
+	for _, p := range r.Prefixes() {
+		encodings := make([]string, 0, len(p.Encodings))
+		for encoding, n := range p.Encodings {
+			encodings = append(encodings, encoding+"="+strconv.Itoa(n))
+		}
+		sort.Strings(encodings)
+		rows = append(rows, strings.Join([]string{
+			strconv.Quote(p.Prefix),
+			strconv.Itoa(p.Keys),
+			strconv.FormatUint(p.Memory, 10),
+			strconv.FormatUint(p.Average(), 10),
+			strconv.Itoa(p.Expires),
+			strconv.FormatFloat(p.TTLCoverage(), 'f', 4, 64),
+			strings.Join(encodings, " "),
+		}, r.sep))
+	}
+	return rows
+}
+
+// groupReport reports key count, memory and average memory per database, type or encoding.
+type groupReport struct {
+	*rdb.Summarizer
+
+	by  string
+	sep string
+}
+
+func (r groupReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory())
+}
+
+func (r groupReport) header() string {
+	return strings.Join([]string{r.by, "keys", "mem", "avg"}, r.sep)
+}
+
+func (r groupReport) rows() []string {
+	s := r.Summary()
+	var groups map[string]rdb.Usage
+	switch r.by {
+	case "db":
+		dbs := make([]int, 0, len(s.DBs))
+		for db := range s.DBs {
+			dbs = append(dbs, db)
+		}
+		sort.Ints(dbs)
+		var rows []string
+		for _, db := range dbs {
+			rows = append(rows, r.row(strconv.Itoa(db), s.DBs[db]))
+		}
+		return rows
+	case "type":
+		groups = typeUsages(s.Types)
+	case "encoding":
+		groups = s.Encodings
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if groups[names[i]].Memory != groups[names[j]].Memory {
+			return groups[names[i]].Memory > groups[names[j]].Memory
+		}
+		return names[i] < names[j]
+	})
+	var rows []string
+	for _, name := range names {
+		rows = append(rows, r.row(name, groups[name]))
+	}
+	return rows
+}
+
+func (r groupReport) row(name string, u rdb.Usage) string {
+	return strings.Join([]string{
+		name,
+		strconv.Itoa(u.Keys),
+		strconv.FormatUint(u.Memory, 10),
+		strconv.FormatUint(u.Average(), 10),
+	}, r.sep)
+}
+
+var topOrders = map[string]int{
+	"mem":  rdb.ByMemory,
+	"size": rdb.BySize,
+	"len":  rdb.ByLength,
+}
+
+// topReport reports the biggest keys.
+type topReport struct {
+	*rdb.TopKeys
+}
+
+func (r topReport) add(key rdb.Key, v value) {
+	r.Add(rdb.TopKey{
+		Key:    key,
+		Memory: v.Memory(),
+		Size:   v.Size(),
+		Length: v.Len(),
+	})
+}
+
+func (r topReport) header() string {
+	return "db,type,encoding,key,mem,size,len"
+}
+
+func (r topReport) rows() []string {
+	var rows []string
+	for _, k := range r.Keys() {
+		rows = append(rows, fmt.Sprintf(
+			"%v,%v,%v,%v,%v,%v,%v",
+			k.Key.DB,
+			rdb.Encoding2Type(k.Key.Encoding),
+			rdb.Encoding2String(k.Key.Encoding),
+			strconv.Quote(k.Key.Key),
+			k.Memory,
+			k.Size,
+			k.Length,
+		))
+	}
+	return rows
+}
+
+// slowReport reports the keys which took the longest to decode, it's fed by the parser instead of the filter.
+type slowReport struct {
+	*rdb.TopKeys
+}
+
+func (r slowReport) add(key rdb.Key, v value) {}
+
+func (r slowReport) header() string {
+	return "db,type,encoding,key,mem,size,len,decode_us"
+}
+
+func (r slowReport) rows() []string {
+	var rows []string
+	for _, k := range r.Keys() {
+		rows = append(rows, fmt.Sprintf(
+			"%v,%v,%v,%v,%v,%v,%v,%v",
+			k.Key.DB,
+			rdb.Encoding2Type(k.Key.Encoding),
+			rdb.Encoding2String(k.Key.Encoding),
+			strconv.Quote(k.Key.Key),
+			k.Memory,
+			k.Size,
+			k.Length,
+			k.Duration.Nanoseconds()/1000,
+		))
+	}
+	return rows
+}
+
+// dupReport reports groups of keys holding identical values.
+type dupReport struct {
+	*rdb.Duplicates
+}
+
+func (r dupReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory(), v.Digest())
+}
+
+func (r dupReport) header() string {
+	return "digest,group_keys,group_mem,db,type,key"
+}
+
+func (r dupReport) rows() []string {
+	var rows []string
+	for _, g := range r.Groups() {
+		for _, k := range g.Keys {
+			rows = append(rows, fmt.Sprintf(
+				"%v,%v,%v,%v,%v,%v",
+				g.Digest,
+				len(g.Keys),
+				g.Memory,
+				k.DB,
+				rdb.Encoding2Type(k.Encoding),
+				strconv.Quote(k.Key),
+			))
+		}
+	}
+	return rows
+}
+
+// adviseReport reports keys with heavyweight encodings which would fit compact ones.
+type adviseReport struct {
+	*rdb.Advisor
+}
+
+func (r adviseReport) add(key rdb.Key, v value) {
+	switch v := v.(type) {
+	case *rdb.Hash:
+		r.Hash(v)
+	case *rdb.Set:
+		r.Set(v)
+	case *rdb.SortedSet:
+		r.SortedSet(v)
+	case *rdb.List:
+		r.List(v)
+	}
+}
+
+func (r adviseReport) header() string {
+	return "db,type,key,encoding,suggested,mem,estimated,saving,configs"
+}
+
+func (r adviseReport) rows() []string {
+	var rows []string
+	for _, a := range r.Advices() {
+		configs := make([]string, 0, len(a.Configs))
+		for name, v := range a.Configs {
+			configs = append(configs, name+"="+strconv.Itoa(v))
+		}
+		sort.Strings(configs)
+		rows = append(rows, fmt.Sprintf(
+			"%v,%v,%v,%v,%v,%v,%v,%v,%v",
+			a.Key.DB,
+			rdb.Encoding2Type(a.Key.Encoding),
+			strconv.Quote(a.Key.Key),
+			a.Encoding,
+			a.Suggested,
+			a.Memory,
+			a.Estimated,
+			a.Saving(),
+			strings.Join(configs, " "),
+		))
+	}
+	return rows
+}
+
+// upgradeReport reports the memory compactly encoded keys would use with heavyweight encodings, the last row is the total.
+type upgradeReport struct {
+	*rdb.UpgradeEstimator
+}
+
+func (r upgradeReport) add(key rdb.Key, v value) {
+	switch v := v.(type) {
+	case *rdb.Hash:
+		r.Hash(v)
+	case *rdb.Set:
+		r.Set(v)
+	case *rdb.SortedSet:
+		r.SortedSet(v)
+	}
+}
+
+func (r upgradeReport) header() string {
+	return "db,type,key,encoding,upgraded,mem,estimated,cost,headroom"
+}
+
+func (r upgradeReport) rows() []string {
+	var rows []string
+	for _, u := range r.Upgrades() {
+		rows = append(rows, fmt.Sprintf(
+			"%v,%v,%v,%v,%v,%v,%v,%v,%v",
+			u.Key.DB,
+			rdb.Encoding2Type(u.Key.Encoding),
+			strconv.Quote(u.Key.Key),
+			u.Encoding,
+			u.Upgraded,
+			u.Memory,
+			u.Estimated,
+			u.Cost(),
+			u.Headroom,
+		))
+	}
+	memory, estimated := r.Total()
+	cost := uint64(0)
+	if estimated > memory {
+		cost = estimated - memory
+	}
+	rows = append(rows, fmt.Sprintf(",,,total,,%v,%v,%v,", memory, estimated, cost))
+	return rows
+}
+
+// utf8Report reports the number of keys and values which are valid UTF-8 and binary, followed by samples of binary ones.
+type utf8Report struct {
+	*rdb.UTF8Audit
+}
+
+func (r utf8Report) add(key rdb.Key, v value) {
+	switch v := v.(type) {
+	case *rdb.String:
+		r.String(v)
+	case *rdb.List:
+		r.List(v)
+	case *rdb.Set:
+		r.Set(v)
+	case *rdb.Hash:
+		r.Hash(v)
+	case *rdb.SortedSet:
+		r.SortedSet(v)
+	}
+}
+
+func (r utf8Report) header() string {
+	return "scope,text,binary,key,field,value"
+}
+
+func (r utf8Report) rows() []string {
+	report := r.Report()
+	rows := []string{
+		fmt.Sprintf("keys,%v,%v,,,", report.Keys.Text, report.Keys.Binary),
+		fmt.Sprintf("values,%v,%v,,,", report.Values.Text, report.Values.Binary),
+	}
+	for _, s := range report.KeySamples {
+		rows = append(rows, fmt.Sprintf("key-sample,,,%v,,", strconv.Quote(s.Key.Key)))
+	}
+	for _, s := range report.ValueSamples {
+		rows = append(rows, fmt.Sprintf("value-sample,,,%v,%v,%v", strconv.Quote(s.Key.Key), strconv.Quote(s.Field), strconv.Quote(s.Value)))
+	}
+	return rows
+}
+
+// searchReport reports values, fields and members which match a pattern.
+type searchReport struct {
+	*rdb.Search
+}
+
+func (r searchReport) add(key rdb.Key, v value) {
+	switch v := v.(type) {
+	case *rdb.String:
+		r.String(v)
+	case *rdb.List:
+		r.List(v)
+	case *rdb.Set:
+		r.Set(v)
+	case *rdb.Hash:
+		r.Hash(v)
+	case *rdb.SortedSet:
+		r.SortedSet(v)
+	}
+}
+
+func (r searchReport) header() string {
+	return "db,type,key,field,value"
+}
+
+func (r searchReport) rows() []string {
+	var rows []string
+	for _, m := range r.Matches() {
+		rows = append(rows, fmt.Sprintf(
+			"%v,%v,%v,%v,%v",
+			m.Key.DB,
+			rdb.Encoding2Type(m.Key.Encoding),
+			strconv.Quote(m.Key.Key),
+			strconv.Quote(m.Field),
+			strconv.Quote(m.Value),
+		))
+	}
+	return rows
+}
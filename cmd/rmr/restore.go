@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// chunk is the maximum number of args sent by a single command after the key,
+// it's even so that field value pairs aren't split.
+const chunk = 512
+
+// restoreKey represents a key and the commands which write it.
+type restoreKey struct {
+	db   int
+	key  string
+	cmds [][]string
+}
+
+// restoreReport writes keys to a live redis with native commands, it reports the number of keys
+// restored, skipped because they exist or have expired, and failed.
+type restoreReport struct {
+	*client
+
+	replace  bool
+	keepTTL  bool
+	pipeline int
+	dbs      map[int]int
+	rewrite  func(key string) (string, bool) // renames keys, set by -rename
+	expiry   []rdb.ExpiryPolicy              // set by -ttl-policy, -ttl-min and -ttl-max
+
+	ch   chan restoreKey
+	done chan struct{}
+
+	restored, skipped, failed int
+}
+
+func newRestoreReport(addr, auth string, dbs map[int]int, replace, keepTTL bool, pipeline int) (*restoreReport, error) {
+	c, err := dial(addr, auth)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline < 1 {
+		pipeline = 1
+	}
+	r := &restoreReport{
+		client:   c,
+		replace:  replace,
+		keepTTL:  keepTTL,
+		pipeline: pipeline,
+		dbs:      dbs,
+		ch:       make(chan restoreKey, pipeline),
+		done:     make(chan struct{}),
+	}
+	go r.loop()
+	return r, nil
+}
+
+// client is a minimal pipelining redis client.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+
+	db     int // selected database, -1 if none is selected yet
+	owners []int
+}
+
+// dial connects to the redis at addr, authenticating with auth if it isn't empty.
+func dial(addr, auth string) (*client, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+		db:   -1,
+	}
+	if auth != "" {
+		c.send(-1, "AUTH", auth)
+		if _, err := c.receive(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// parseDBMap parses a database mapping like 0=1,2=3.
+func parseDBMap(s string) (map[int]int, error) {
+	dbs := make(map[int]int)
+	if s == "" {
+		return dbs, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid database mapping: %q", pair)
+		}
+		src, err := strconv.Atoi(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid database mapping: %q", pair)
+		}
+		dst, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid database mapping: %q", pair)
+		}
+		dbs[src] = dst
+	}
+	return dbs, nil
+}
+
+func (r *restoreReport) add(key rdb.Key, v value) {
+	if r.rewrite != nil {
+		var ok bool
+		if key.Key, ok = r.rewrite(key.Key); !ok {
+			return
+		}
+	}
+	for _, policy := range r.expiry {
+		key.Expiry = policy(key.Expiry)
+	}
+	k := restoreKey{db: key.DB, key: key.Key}
+	if db, ok := r.dbs[key.DB]; ok {
+		k.db = db
+	}
+	switch v := v.(type) {
+	case *rdb.String:
+		k.cmds = append(k.cmds, []string{"SET", key.Key, v.Value})
+	case *rdb.List:
+		k.cmds = chunked(k.cmds, []string{"RPUSH", key.Key}, v.Values)
+	case *rdb.Set:
+		members := make([]string, 0, len(v.Values))
+		for m := range v.Values {
+			members = append(members, fmt.Sprint(m))
+		}
+		k.cmds = chunked(k.cmds, []string{"SADD", key.Key}, members)
+	case *rdb.Hash:
+		pairs := make([]string, 0, 2*len(v.Values))
+		for field, value := range v.Values {
+			pairs = append(pairs, field, value)
+		}
+		k.cmds = chunked(k.cmds, []string{"HMSET", key.Key}, pairs)
+	case *rdb.SortedSet:
+		pairs := make([]string, 0, 2*len(v.Values))
+		for member, score := range v.Values {
+			pairs = append(pairs, strconv.FormatFloat(score, 'g', -1, 64), member)
+		}
+		k.cmds = chunked(k.cmds, []string{"ZADD", key.Key}, pairs)
+	}
+	if r.keepTTL && key.Expiry >= 0 {
+		if int64(key.Expiry) <= now.UnixNano()/int64(time.Millisecond) {
+			k.cmds = nil
+		} else {
+			k.cmds = append(k.cmds, []string{"PEXPIREAT", key.Key, strconv.Itoa(key.Expiry)})
+		}
+	}
+	r.ch <- k
+}
+
+// chunked appends commands made of cmd and at most chunk args each.
+func chunked(cmds [][]string, cmd []string, args []string) [][]string {
+	for len(args) > 0 {
+		n := chunk
+		if n > len(args) {
+			n = len(args)
+		}
+		c := make([]string, 0, len(cmd)+n)
+		c = append(c, cmd...)
+		cmds = append(cmds, append(c, args[:n]...))
+		args = args[n:]
+	}
+	return cmds
+}
+
+func (r *restoreReport) header() string {
+	return "restored,skipped,failed"
+}
+
+func (r *restoreReport) rows() []string {
+	close(r.ch)
+	<-r.done
+	r.conn.Close()
+	return []string{fmt.Sprintf("%d,%d,%d", r.restored, r.skipped, r.failed)}
+}
+
+func (r *restoreReport) loop() {
+	defer close(r.done)
+	batch := make([]restoreKey, 0, r.pipeline)
+	for k := range r.ch {
+		batch = append(batch[:0], k)
+	BATCH:
+		for len(batch) < r.pipeline {
+			select {
+			case k, ok := <-r.ch:
+				if !ok {
+					break BATCH
+				}
+				batch = append(batch, k)
+			default:
+				break BATCH
+			}
+		}
+		if err := r.flush(batch); err != nil {
+			f.error(err)
+		}
+	}
+}
+
+// flush writes batch in at most two round trips.
+func (r *restoreReport) flush(batch []restoreKey) error {
+	exists := make([]bool, len(batch))
+	if !r.replace {
+		for i, k := range batch {
+			if len(k.cmds) == 0 {
+				continue
+			}
+			r.selectDB(k.db)
+			r.send(i, "EXISTS", k.key)
+		}
+		replies, err := r.receive()
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if reply.owner >= 0 {
+				exists[reply.owner] = reply.value == int64(1)
+			}
+		}
+	}
+
+	for i, k := range batch {
+		if len(k.cmds) == 0 || exists[i] {
+			r.skipped++
+			continue
+		}
+		r.selectDB(k.db)
+		if r.replace {
+			r.send(i, "DEL", k.key)
+		}
+		for _, cmd := range k.cmds {
+			r.send(i, cmd...)
+		}
+	}
+	replies, err := r.receive()
+	if err != nil {
+		return err
+	}
+	failed := make([]error, len(batch))
+	for _, reply := range replies {
+		if reply.owner >= 0 && reply.err != nil && failed[reply.owner] == nil {
+			failed[reply.owner] = reply.err
+		}
+	}
+	for i, k := range batch {
+		if len(k.cmds) == 0 || exists[i] {
+			continue
+		}
+		if failed[i] != nil {
+			fmt.Fprintf(os.Stderr, "restore %q: %v\n", k.key, failed[i])
+			r.failed++
+			continue
+		}
+		r.restored++
+	}
+	return nil
+}
+
+func (c *client) selectDB(db int) {
+	if c.db != db {
+		c.send(-1, "SELECT", strconv.Itoa(db))
+		c.db = db
+	}
+}
+
+// send buffers a command, owner is the index of the key in the batch, -1 if it's not sent for a key.
+func (c *client) send(owner int, args ...string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	c.owners = append(c.owners, owner)
+}
+
+type reply struct {
+	owner int
+	value interface{}
+	err   error // error reply
+}
+
+// receive flushes buffered commands and reads their replies.
+// Error replies to commands not sent for a key are returned as error.
+func (c *client) receive() ([]reply, error) {
+	owners := c.owners
+	c.owners = nil
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]reply, 0, len(owners))
+	for _, owner := range owners {
+		value, err := readReply(c.r)
+		if err != nil {
+			return nil, err
+		}
+		rep := reply{owner: owner, value: value}
+		if e, ok := value.(replyError); ok {
+			if owner < 0 {
+				return nil, e
+			}
+			rep.err = e
+		}
+		replies = append(replies, rep)
+	}
+	return replies, nil
+}
+
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+var errProtocol = errors.New("invalid redis reply")
+
+// readReply reads a RESP reply.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return replyError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, errProtocol
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// index holds the keys of parsed dumps, it's served by rmr serve.
+type index struct {
+	mu      sync.Mutex
+	records []indexed
+	summary *rdb.Summarizer
+
+	values bool
+}
+
+// indexed is a record and the key it was made of.
+type indexed struct {
+	*record
+
+	key rdb.Key
+}
+
+func (x *index) add(key rdb.Key, v value) {
+	r := newRecord(key, v)
+	if x.values {
+		r.Value = decodedValue(v)
+	}
+	x.summary.Add(key, v.Memory())
+	x.mu.Lock()
+	x.records = append(x.records, indexed{r, key})
+	x.mu.Unlock()
+}
+
+// newIndex parses files into an index, whose records are ordered by database and key.
+func newIndex(files []string, values bool) *index {
+	x := &index{summary: rdb.NewSummarizer(), values: values}
+	skip := rdb.SkipMeta
+	if !x.values {
+		skip |= rdb.SkipValue
+	}
+	for _, file := range files {
+		r, err := open(file)
+		if err != nil {
+			f.error(err)
+		}
+		if err := rdb.Parse(r, rdb.WithFilter(indexFilter{x}), rdb.WithStrategy(skip)); err != nil {
+			f.error(err)
+		}
+	}
+	sort.Slice(x.records, func(i, j int) bool {
+		if x.records[i].DB != x.records[j].DB {
+			return x.records[i].DB < x.records[j].DB
+		}
+		return x.records[i].Key < x.records[j].Key
+	})
+	return x
+}
+
+// indexFilter adds every key to an index.
+type indexFilter struct {
+	*index
+}
+
+func (indexFilter) Key(rdb.Key) bool             { return false }
+func (indexFilter) Type(rdb.Type) bool           { return false }
+func (indexFilter) Database(rdb.DB) bool         { return false }
+func (x indexFilter) Set(v *rdb.Set)             { x.add(v.Key, v) }
+func (x indexFilter) List(v *rdb.List)           { x.add(v.Key, v) }
+func (x indexFilter) Hash(v *rdb.Hash)           { x.add(v.Key, v) }
+func (x indexFilter) String(v *rdb.String)       { x.add(v.Key, v) }
+func (x indexFilter) SortedSet(v *rdb.SortedSet) { x.add(v.Key, v) }
+
+// serveMain runs rmr serve, which indexes dumps and serves them over HTTP as JSON.
+func serveMain(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on.")
+	values := fs.Bool("values", true, "Keep decoded values in memory, so that /key can return them.")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [options] /path/to/dump.rdb [/path/to/dump.rdb ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n\n")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Endpoints:")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  /keys?pattern=&type=&db=&limit=  keys matching a glob pattern, type and database")
+		fmt.Fprintln(os.Stderr, "  /key/{name}?db=                  a key and its value")
+		fmt.Fprintln(os.Stderr, "  /stats                           summary of keys")
+		fmt.Fprintln(os.Stderr, "  /prefixes?delims=&depth=         key count, memory and TTL coverage per prefix")
+		fmt.Fprintln(os.Stderr, "  /metrics                         Prometheus metrics")
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	x := newIndex(fs.Args(), *values)
+	fmt.Fprintf(os.Stderr, "indexed %d keys, listening on %s\n", len(x.records), *addr)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", x.keys)
+	mux.HandleFunc("/key/", x.key)
+	mux.HandleFunc("/stats", x.stats)
+	mux.HandleFunc("/prefixes", x.prefixes)
+	mux.HandleFunc("/metrics", x.metrics)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		f.error(err)
+	}
+}
+
+// recordJSON is the JSON format of a record served by rmr serve.
+type recordJSON struct {
+	DB       int         `json:"db"`
+	Type     string      `json:"type"`
+	Encoding string      `json:"encoding"`
+	Key      string      `json:"key"`
+	Memory   uint64      `json:"mem"`
+	Size     uint64      `json:"size"`
+	Len      int         `json:"len"`
+	Expiry   int         `json:"expiry"`
+	TTL      int64       `json:"ttl"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+func newRecordJSON(r *record, value bool) recordJSON {
+	j := recordJSON{
+		DB:       r.DB,
+		Type:     r.Type,
+		Encoding: r.Encoding,
+		Key:      r.Key,
+		Memory:   r.Memory,
+		Size:     r.Size,
+		Len:      r.Len,
+		Expiry:   r.Expiry,
+		TTL:      r.TTL(),
+	}
+	if value {
+		j.Value = r.Value
+	}
+	return j
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// queryInt returns the int query parameter name, or def if it's not set.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return n, nil
+}
+
+func (x *index) keys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pattern, typ := q.Get("pattern"), q.Get("type")
+	if _, err := path.Match(pattern, ""); err != nil {
+		http.Error(w, "invalid pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	db, err := queryInt(r, "db", -1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", 1000)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys := make([]recordJSON, 0)
+	for _, rec := range x.records {
+		if limit > 0 && len(keys) >= limit {
+			break
+		}
+		if db >= 0 && rec.DB != db || typ != "" && rec.Type != typ {
+			continue
+		}
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, rec.Key); !ok {
+				continue
+			}
+		}
+		keys = append(keys, newRecordJSON(rec.record, false))
+	}
+	writeJSON(w, keys)
+}
+
+func (x *index) key(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/key/")
+	db, err := queryInt(r, "db", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	i := sort.Search(len(x.records), func(i int) bool {
+		rec := x.records[i]
+		return rec.DB > db || rec.DB == db && rec.Key >= name
+	})
+	if i == len(x.records) || x.records[i].DB != db || x.records[i].Key != name {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, newRecordJSON(x.records[i].record, true))
+}
+
+func (x *index) stats(w http.ResponseWriter, r *http.Request) {
+	rows := summaryReport{Summarizer: x.summary, json: true}.rows()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, rows[0])
+}
+
+func (x *index) prefixes(w http.ResponseWriter, r *http.Request) {
+	depth, err := queryInt(r, "depth", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report := rdb.NewPrefixReport(parseDelims(r.URL.Query().Get("delims")), depth)
+	for _, rec := range x.records {
+		report.Add(rec.key, rec.Memory)
+	}
+	prefixes := make([]prefixJSON, 0)
+	for _, p := range report.Prefixes() {
+		prefixes = append(prefixes, prefixJSON{
+			Prefix:      p.Prefix,
+			Keys:        p.Keys,
+			Memory:      p.Memory,
+			Avg:         p.Average(),
+			Expires:     p.Expires,
+			TTLCoverage: p.TTLCoverage(),
+			Encodings:   p.Encodings,
+		})
+	}
+	writeJSON(w, prefixes)
+}
+
+type prefixJSON struct {
+	Prefix      string         `json:"prefix"`
+	Keys        int            `json:"keys"`
+	Memory      uint64         `json:"mem"`
+	Avg         uint64         `json:"avg"`
+	Expires     int            `json:"expires"`
+	TTLCoverage float64        `json:"ttl_coverage"`
+	Encodings   map[string]int `json:"encodings"`
+}
+
+func (x *index) metrics(w http.ResponseWriter, r *http.Request) {
+	report := newMetricsReport(":", 1, 50, 10, "")
+	for _, rec := range x.records {
+		report.prefixes.Add(rec.key, rec.Memory)
+		report.top.Add(rdb.TopKey{Key: rec.key, Memory: rec.Memory, Size: rec.Size, Length: rec.Len})
+	}
+	prefixes := report.prefixes.Prefixes()
+	if len(prefixes) > report.maxPrefixes {
+		prefixes = prefixes[:report.maxPrefixes]
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, x.summary.Summary(), prefixes, report.top.Keys())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// skeletonExt is the extension of the sidecar skeleton of a rdb file, e.g. dump.rdb.skel.
+const skeletonExt = ".skel"
+
+// skeletonMain runs rmr skeleton, which writes the skeleton of every file next to it.
+func skeletonMain(args []string) {
+	fs := flag.NewFlagSet("skeleton", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s skeleton /path/to/dump.rdb [/path/to/dump.rdb ...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Writes the offsets, types and sizes of the keys of every file to /path/to/dump.rdb%s.\n", skeletonExt)
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	code := 0
+	for _, file := range fs.Args() {
+		s, err := writeSkeleton(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: %d keys\n", file+skeletonExt, len(s.Entries))
+	}
+	os.Exit(code)
+}
+
+// writeSkeleton scans file and writes its skeleton next to it.
+func writeSkeleton(file string) (*rdb.Skeleton, error) {
+	r, err := open(file)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	s, err := rdb.ScanSkeleton(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.Create(file + skeletonExt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.WriteTo(out); err != nil {
+		out.Close()
+		return nil, err
+	}
+	return s, out.Close()
+}
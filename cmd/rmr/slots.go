@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// readNodes reads a slot to node mapping file.
+//
+// Each line contains a node name followed by its slots or slot ranges, e.g.:
+//
+//	127.0.0.1:7000 0-5460
+//	127.0.0.1:7001 5461-10922 16383
+//
+// Empty lines and lines starting with '#' are ignored.
+func readNodes(file string) (map[int]string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	nodes := make(map[int]string)
+	scanner := bufio.NewScanner(fd)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, r := range fields[1:] {
+			start, end, err := parseSlotRange(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", file, line, err)
+			}
+			for slot := start; slot <= end; slot++ {
+				nodes[slot] = fields[0]
+			}
+		}
+	}
+	return nodes, scanner.Err()
+}
+
+func parseSlotRange(r string) (int, int, error) {
+	bounds := strings.SplitN(r, "-", 2)
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid slot range %q", r)
+	}
+	end := start
+	if len(bounds) == 2 {
+		end, err = strconv.Atoi(bounds[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid slot range %q", r)
+		}
+	}
+	if start < 0 || end >= rdb.SlotCount || start > end {
+		return 0, 0, fmt.Errorf("invalid slot range %q", r)
+	}
+	return start, end, nil
+}
+
+// slotReport reports key count and memory per slot, or per node if nodes is set.
+type slotReport struct {
+	*rdb.SlotReport
+
+	nodes map[int]string
+}
+
+func (r slotReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory())
+}
+
+func (r slotReport) header() string {
+	if r.nodes != nil {
+		return "node,keys,mem"
+	}
+	return "slot,keys,mem"
+}
+
+func (r slotReport) rows() []string {
+	var rows []string
+	if r.nodes == nil {
+		for slot, u := range r.Slots() {
+			if u.Keys > 0 {
+				rows = append(rows, fmt.Sprintf("%v,%v,%v", slot, u.Keys, u.Memory))
+			}
+		}
+		return rows
+	}
+
+	usage := r.Nodes(r.nodes)
+	names := make([]string, 0, len(usage))
+	for name := range usage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u := usage[name]
+		rows = append(rows, fmt.Sprintf("%v,%v,%v", strconv.Quote(name), u.Keys, u.Memory))
+	}
+	return rows
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// orders maps -sort values to their less functions, records are sorted by
+// memory, size and length descending, by key and TTL ascending.
+// Keys without expiry are sorted after keys with expiry.
+var orders = map[string]func(a, b *record) bool{
+	"mem":  func(a, b *record) bool { return a.Memory > b.Memory },
+	"size": func(a, b *record) bool { return a.Size > b.Size },
+	"len":  func(a, b *record) bool { return a.Len > b.Len },
+	"key":  func(a, b *record) bool { return a.Key < b.Key },
+	"ttl": func(a, b *record) bool {
+		if a.Expiry < 0 || b.Expiry < 0 {
+			return a.Expiry > b.Expiry
+		}
+		return a.Expiry < b.Expiry
+	},
+}
+
+// sorter buffers records and returns them sorted.
+// If limit > 0, only the first limit records are kept.
+type sorter struct {
+	mu    sync.Mutex
+	less  func(a, b *record) bool
+	limit int
+
+	// records is a heap whose top is the last record if limit > 0
+	records []*record
+}
+
+func newSorter(order string, limit int) (*sorter, error) {
+	less, ok := orders[order]
+	if !ok {
+		return nil, fmt.Errorf("invalid -sort: %q", order)
+	}
+	return &sorter{less: less, limit: limit}, nil
+}
+
+func (s *sorter) add(r *record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limit <= 0 {
+		s.records = append(s.records, r)
+		return
+	}
+	if len(s.records) < s.limit {
+		heap.Push(s, r)
+		return
+	}
+	if s.less(r, s.records[0]) {
+		s.records[0] = r
+		heap.Fix(s, 0)
+	}
+}
+
+func (s *sorter) sorted() []*record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.SliceStable(s.records, func(i, j int) bool { return s.less(s.records[i], s.records[j]) })
+	return s.records
+}
+
+// heap.Interface, the top of the heap is the greatest record.
+
+func (s *sorter) Len() int           { return len(s.records) }
+func (s *sorter) Less(i, j int) bool { return s.less(s.records[j], s.records[i]) }
+func (s *sorter) Swap(i, j int)      { s.records[i], s.records[j] = s.records[j], s.records[i] }
+func (s *sorter) Push(x interface{}) { s.records = append(s.records, x.(*record)) }
+func (s *sorter) Pop() interface{} {
+	n := len(s.records)
+	r := s.records[n-1]
+	s.records = s.records[:n-1]
+	return r
+}
+
+// limiter counts written records.
+type limiter struct {
+	limit   int64
+	written int64
+}
+
+// take reports whether one more record can be written.
+func (l *limiter) take() bool {
+	return l.limit <= 0 || atomic.AddInt64(&l.written, 1) <= l.limit
+}
+
+// reached reports whether limit records have been written.
+func (l *limiter) reached() bool {
+	return l.limit > 0 && atomic.LoadInt64(&l.written) >= l.limit
+}
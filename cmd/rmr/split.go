@@ -0,0 +1,54 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// splitting reports whether -o is split into several files by -split-size or -split-keys.
+func splitting() bool {
+	return splitSize > 0 || *splitKeys > 0
+}
+
+// splitPattern returns the file name pattern of the parts of output file o, numbered before its extension,
+// e.g. out-%04d.csv.gz for out.csv.gz.
+func splitPattern(o string) string {
+	o = strings.Replace(o, "%", "%%", -1)
+	name, gz := o, ""
+	if strings.HasSuffix(name, ".gz") {
+		name, gz = strings.TrimSuffix(name, ".gz"), ".gz"
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "-%04d" + ext + gz
+}
+
+// newSplitSink returns the sink writing rows to the parts of -o, each of them starting with header
+// and ending with footer if they are not empty.
+func newSplitSink(header, footer string) (*rdb.RotatingFileSink, error) {
+	if *o == "" {
+		return nil, errors.New("-split-size and -split-keys need -o")
+	}
+	switch {
+	case *format == "parquet" || *format == "table" && *tmpl == "" && *cleanup == "":
+		return nil, errors.New("-split-size and -split-keys can't split -format " + *format)
+	case f.sep != "\n" && f.sep != "":
+		// rows separated from the previous one, such as the elements of a JSON array, can't start a file
+		return nil, errors.New("-split-size and -split-keys can't split -format " + *format + ", use jsonl")
+	}
+	s := rdb.NewRotatingFileSink(splitPattern(*o), int64(splitSize), *splitKeys)
+	if header != "" {
+		s.Header = []byte(header + "\n")
+	}
+	if footer != "" {
+		s.Footer = []byte(footer + "\n")
+	}
+	if *compress || strings.HasSuffix(*o, ".gz") {
+		s.Wrap = func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	}
+	return s, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sqlSchema creates the tables written by sqlFormatter, values are stored in a table per type.
+const sqlSchema = `CREATE TABLE IF NOT EXISTS keys (file TEXT, db INTEGER, key BLOB, type TEXT, encoding TEXT, mem INTEGER, size INTEGER, len INTEGER, expiry INTEGER);
+CREATE TABLE IF NOT EXISTS strings (file TEXT, db INTEGER, key BLOB, value BLOB);
+CREATE TABLE IF NOT EXISTS lists (file TEXT, db INTEGER, key BLOB, idx INTEGER, value BLOB);
+CREATE TABLE IF NOT EXISTS sets (file TEXT, db INTEGER, key BLOB, member BLOB);
+CREATE TABLE IF NOT EXISTS hashes (file TEXT, db INTEGER, key BLOB, field BLOB, value BLOB);
+CREATE TABLE IF NOT EXISTS zsets (file TEXT, db INTEGER, key BLOB, member BLOB, score REAL);
+BEGIN;`
+
+// sqlIndexes are created after rows are inserted, which is faster than maintaining them.
+const sqlIndexes = `COMMIT;
+CREATE INDEX IF NOT EXISTS keys_key ON keys (db, key);
+CREATE INDEX IF NOT EXISTS strings_key ON strings (db, key);
+CREATE INDEX IF NOT EXISTS lists_key ON lists (db, key);
+CREATE INDEX IF NOT EXISTS sets_key ON sets (db, key);
+CREATE INDEX IF NOT EXISTS hashes_key ON hashes (db, key);
+CREATE INDEX IF NOT EXISTS zsets_key ON zsets (db, key);`
+
+// sqlRows is the maximum number of rows inserted by a single statement.
+const sqlRows = 500
+
+// sqlFormatter formats records as SQL statements, which can be loaded by sqlite3, e.g.
+// rmr -format sql dump.rdb | sqlite3 dump.db.
+type sqlFormatter struct{}
+
+func (sqlFormatter) header() string { return sqlSchema }
+func (sqlFormatter) footer() string { return sqlIndexes }
+func (sqlFormatter) sep() string    { return "\n" }
+
+func (sqlFormatter) format(r *record) string {
+	var b bytes.Buffer
+	prefix := []string{sqlString(r.File), strconv.Itoa(r.DB), sqlString(r.Key)}
+	insert(&b, "keys", [][]string{append(prefix,
+		sqlString(r.Type),
+		sqlString(r.Encoding),
+		strconv.FormatUint(r.Memory, 10),
+		strconv.FormatUint(r.Size, 10),
+		strconv.Itoa(r.Len),
+		strconv.Itoa(r.Expiry),
+	)})
+
+	var table string
+	var rows [][]string
+	row := func(values ...string) {
+		rows = append(rows, append(append([]string(nil), prefix...), values...))
+	}
+	switch v := r.Value.(type) {
+	case string:
+		table = "strings"
+		row(sqlString(v))
+	case []string:
+		// lists and sets are both decoded as []string
+		if r.Type == "list" {
+			table = "lists"
+			for i, e := range v {
+				row(strconv.Itoa(i), sqlString(e))
+			}
+		} else {
+			table = "sets"
+			for _, m := range v {
+				row(sqlString(m))
+			}
+		}
+	case map[string]string:
+		table = "hashes"
+		for field, value := range v {
+			row(sqlString(field), sqlString(value))
+		}
+	case []member:
+		table = "zsets"
+		for _, m := range v {
+			row(sqlString(m.Member), sqlFloat(float64(m.Score)))
+		}
+	}
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > sqlRows {
+			n = sqlRows
+		}
+		b.WriteByte('\n')
+		insert(&b, table, rows[:n])
+		rows = rows[n:]
+	}
+	return b.String()
+}
+
+func insert(b *bytes.Buffer, table string, rows [][]string) {
+	b.WriteString("INSERT INTO ")
+	b.WriteString(table)
+	b.WriteString(" VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('(')
+		b.WriteString(strings.Join(row, ","))
+		b.WriteByte(')')
+	}
+	b.WriteByte(';')
+}
+
+// sqlString returns the SQL literal of s, a blob literal if s isn't valid UTF-8 or contains NUL.
+func sqlString(s string) string {
+	if !utf8.ValidString(s) || strings.IndexByte(s, 0) >= 0 {
+		return "X'" + hex.EncodeToString([]byte(s)) + "'"
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// sqlFloat returns the SQL literal of f, SQLite parses out of range literals as infinities.
+func sqlFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NULL"
+	case math.IsInf(f, 1):
+		return "9e999"
+	case math.IsInf(f, -1):
+		return "-9e999"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
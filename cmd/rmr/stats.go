@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/matthewjhe/rdb"
+)
+
+var percentiles = []float64{50, 90, 99, 100}
+
+// statsReport reports histograms of key lengths, memory usage, element counts and TTLs.
+type statsReport struct {
+	*rdb.Stats
+
+	format string
+}
+
+func (r statsReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory(), v.Len())
+}
+
+func (r statsReport) header() string {
+	return ""
+}
+
+func (r statsReport) histograms() []struct {
+	name string
+	h    *rdb.Histogram
+} {
+	return []struct {
+		name string
+		h    *rdb.Histogram
+	}{
+		{"key_length", r.KeyLength},
+		{"memory", r.Memory},
+		{"length", r.Length},
+		{"ttl", r.TTL},
+	}
+}
+
+type histogramJSON struct {
+	Count       int              `json:"count"`
+	Sum         int64            `json:"sum"`
+	Min         int64            `json:"min"`
+	Max         int64            `json:"max"`
+	Mean        float64          `json:"mean"`
+	Percentiles map[string]int64 `json:"percentiles"`
+	Buckets     []bucketJSON     `json:"buckets"`
+}
+
+type bucketJSON struct {
+	LE    *int64 `json:"le"` // nil for the overflow bucket
+	Count int    `json:"count"`
+}
+
+func (r statsReport) rows() []string {
+	if r.format == "json" {
+		out := make(map[string]histogramJSON)
+		for _, hist := range r.histograms() {
+			h := hist.h
+			j := histogramJSON{
+				Count:       h.Count,
+				Sum:         h.Sum,
+				Min:         h.Min,
+				Max:         h.Max,
+				Mean:        h.Mean(),
+				Percentiles: make(map[string]int64),
+			}
+			for _, p := range percentiles {
+				j.Percentiles[fmt.Sprintf("p%v", p)] = h.Percentile(p)
+			}
+			for i, c := range h.Counts {
+				b := bucketJSON{Count: c}
+				if i < len(h.Bounds) {
+					b.LE = &h.Bounds[i]
+				}
+				j.Buckets = append(j.Buckets, b)
+			}
+			out[hist.name] = j
+		}
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			f.error(err)
+		}
+		return []string{string(b)}
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	for _, hist := range r.histograms() {
+		h := hist.h
+		fmt.Fprintf(w, "%s\tcount\tmin\tmean\tmax", hist.name)
+		for _, p := range percentiles {
+			fmt.Fprintf(w, "\tp%v", p)
+		}
+		fmt.Fprintf(w, "\t\n\t%d\t%d\t%.1f\t%d", h.Count, h.Min, h.Mean(), h.Max)
+		for _, p := range percentiles {
+			fmt.Fprintf(w, "\t%d", h.Percentile(p))
+		}
+		fmt.Fprintf(w, "\t\n\tle\tcount\t\t\t\t\t\t\t\n")
+		for i, c := range h.Counts {
+			if i < len(h.Bounds) {
+				fmt.Fprintf(w, "\t%d\t%d\t\t\t\t\t\t\t\n", h.Bounds[i], c)
+			} else {
+				fmt.Fprintf(w, "\t+inf\t%d\t\t\t\t\t\t\t\n", c)
+			}
+		}
+		fmt.Fprintln(w, "\t\t\t\t\t\t\t\t\t")
+	}
+	w.Flush()
+	return []string{buf.String()}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// summaryReport reports an overview of the dump.
+type summaryReport struct {
+	*rdb.Summarizer
+
+	json bool
+}
+
+func (r summaryReport) add(key rdb.Key, v value) {
+	r.Add(key, v.Memory())
+}
+
+func (r summaryReport) header() string {
+	return ""
+}
+
+type usageJSON struct {
+	Keys   int    `json:"keys"`
+	Memory uint64 `json:"mem"`
+	Avg    uint64 `json:"avg"`
+}
+
+func newUsageJSON(u rdb.Usage) usageJSON {
+	return usageJSON{Keys: u.Keys, Memory: u.Memory, Avg: u.Average()}
+}
+
+type summaryJSON struct {
+	usageJSON
+	Persistent int                  `json:"persistent"`
+	Volatile   int                  `json:"volatile"`
+	Expired    int                  `json:"expired"`
+	DBs        map[string]usageJSON `json:"dbs"`
+	Types      map[string]usageJSON `json:"types"`
+	Encodings  map[string]usageJSON `json:"encodings"`
+	Biggest    *biggestJSON         `json:"biggest"`
+}
+
+type biggestJSON struct {
+	DB     int    `json:"db"`
+	Type   string `json:"type"`
+	Key    string `json:"key"`
+	Memory uint64 `json:"mem"`
+}
+
+func (r summaryReport) rows() []string {
+	s := r.Summary()
+	if r.json {
+		out := summaryJSON{
+			usageJSON:  newUsageJSON(s.Usage),
+			Persistent: s.Persistent,
+			Volatile:   s.Volatile,
+			Expired:    s.Expired,
+			DBs:        make(map[string]usageJSON),
+			Types:      make(map[string]usageJSON),
+			Encodings:  make(map[string]usageJSON),
+		}
+		for db, u := range s.DBs {
+			out.DBs[strconv.Itoa(db)] = newUsageJSON(u)
+		}
+		for typ, u := range s.Types {
+			out.Types[string(typ)] = newUsageJSON(u)
+		}
+		for encoding, u := range s.Encodings {
+			out.Encodings[encoding] = newUsageJSON(u)
+		}
+		if s.Keys > 0 {
+			out.Biggest = &biggestJSON{
+				DB:     s.Biggest.Key.DB,
+				Type:   string(rdb.Encoding2Type(s.Biggest.Key.Encoding)),
+				Key:    s.Biggest.Key.Key,
+				Memory: s.Biggest.Memory,
+			}
+		}
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			f.error(err)
+		}
+		return []string{string(b)}
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "total\tkeys\tmem\tavg\t\n\t%d\t%d\t%d\t\n\n", s.Keys, s.Memory, s.Average())
+	fmt.Fprintf(w, "expiry\tpersistent\tvolatile\texpired\t\n\t%d\t%d\t%d\t\n\n", s.Persistent, s.Volatile, s.Expired)
+
+	dbs := make([]int, 0, len(s.DBs))
+	for db := range s.DBs {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+	fmt.Fprintf(w, "db\tkeys\tmem\tavg\t\n")
+	for _, db := range dbs {
+		u := s.DBs[db]
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t\n", db, u.Keys, u.Memory, u.Average())
+	}
+	fmt.Fprintln(w)
+	writeUsages(w, "type", typeUsages(s.Types))
+	writeUsages(w, "encoding", s.Encodings)
+
+	if s.Keys > 0 {
+		k := s.Biggest
+		fmt.Fprintf(w, "biggest\tdb\ttype\tkey\tmem\t\n\t%d\t%s\t%s\t%d\t\n",
+			k.Key.DB, rdb.Encoding2Type(k.Key.Encoding), strconv.Quote(k.Key.Key), k.Memory)
+	}
+	w.Flush()
+	return []string{buf.String()}
+}
+
+// typeUsages returns usages by type name.
+func typeUsages(usages map[rdb.ValueType]rdb.Usage) map[string]rdb.Usage {
+	names := make(map[string]rdb.Usage, len(usages))
+	for typ, u := range usages {
+		names[string(typ)] = u
+	}
+	return names
+}
+
+// writeUsages writes usages ordered by memory descending.
+func writeUsages(w *tabwriter.Writer, name string, usages map[string]rdb.Usage) {
+	names := make([]string, 0, len(usages))
+	for n := range usages {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if usages[names[i]].Memory != usages[names[j]].Memory {
+			return usages[names[i]].Memory > usages[names[j]].Memory
+		}
+		return names[i] < names[j]
+	})
+	fmt.Fprintf(w, "%s\tkeys\tmem\tavg\t\n", name)
+	for _, n := range names {
+		u := usages[n]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", n, u.Keys, u.Memory, u.Average())
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// bytesize is a flag.Value of a byte size, accepting units like 512k, 1MB or 2g.
+type bytesize uint64
+
+var units = []struct {
+	suffix string
+	n      uint64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"tb", 1 << 40},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+	{"b", 1},
+}
+
+func (b *bytesize) Set(v string) error {
+	s := strings.ToLower(strings.TrimSpace(v))
+	n := uint64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, n = strings.TrimSuffix(s, u.suffix), u.n
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return fmt.Errorf("invalid size: %q", v)
+	}
+	*b = bytesize(f * float64(n))
+	return nil
+}
+
+func (b *bytesize) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+// thresholdFilter wraps a Filter, keys whose memory usage or key length are out of range are dropped.
+// Zero max values mean no limit.
+type thresholdFilter struct {
+	rdb.Filter
+
+	minMem, maxMem       bytesize
+	minKeyLen, maxKeyLen int
+}
+
+func (t *thresholdFilter) Key(key rdb.Key) bool {
+	if len(key.Key) < t.minKeyLen || (t.maxKeyLen > 0 && len(key.Key) > t.maxKeyLen) {
+		key.Skip(rdb.SkipAll)
+		return false
+	}
+	return t.Filter.Key(key)
+}
+
+func (t *thresholdFilter) match(v value) bool {
+	m := v.Memory()
+	return m >= uint64(t.minMem) && (t.maxMem == 0 || m <= uint64(t.maxMem))
+}
+
+func (t *thresholdFilter) Set(v *rdb.Set) {
+	if t.match(v) {
+		t.Filter.Set(v)
+	}
+}
+
+func (t *thresholdFilter) List(v *rdb.List) {
+	if t.match(v) {
+		t.Filter.List(v)
+	}
+}
+
+func (t *thresholdFilter) Hash(v *rdb.Hash) {
+	if t.match(v) {
+		t.Filter.Hash(v)
+	}
+}
+
+func (t *thresholdFilter) String(v *rdb.String) {
+	if t.match(v) {
+		t.Filter.String(v)
+	}
+}
+
+func (t *thresholdFilter) SortedSet(v *rdb.SortedSet) {
+	if t.match(v) {
+		t.Filter.SortedSet(v)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/matthewjhe/rdb"
+)
+
+var (
+	ttlPolicy = flag.String("ttl-policy", "keep", "Expiries of keys written by -o-rdb and -restore: keep absolute ones, strip them, or relative which keeps TTLs as of -ttl-ref.")
+	ttlRef    = flag.String("ttl-ref", "", "Reference time of -ttl-policy relative, e.g. the time of the backup: RFC 3339 or unix seconds.")
+	ttlMin    = flag.Duration("ttl-min", 0, "Extend TTLs of keys written by -o-rdb and -restore to at least this duration.")
+	ttlMax    = flag.Duration("ttl-max", 0, "Shorten TTLs of keys written by -o-rdb and -restore to at most this duration.")
+)
+
+// parseExpiryPolicies returns the expiry policies of -ttl-policy, -ttl-min and -ttl-max.
+func parseExpiryPolicies() ([]rdb.ExpiryPolicy, error) {
+	var policies []rdb.ExpiryPolicy
+	switch *ttlPolicy {
+	case "keep":
+	case "strip":
+		policies = append(policies, rdb.StripExpiry)
+	case "relative":
+		ref, err := parseTime(*ttlRef)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, rdb.RelativeExpiry(ref, now))
+	default:
+		return nil, fmt.Errorf("invalid -ttl-policy: %q", *ttlPolicy)
+	}
+	if *ttlMin > 0 || *ttlMax > 0 {
+		if *ttlMax > 0 && *ttlMin > *ttlMax {
+			return nil, fmt.Errorf("invalid -ttl-min: %v is greater than -ttl-max", *ttlMin)
+		}
+		policies = append(policies, rdb.ClampExpiry(now, *ttlMin, *ttlMax))
+	}
+	return policies, nil
+}
+
+// parseTime parses a RFC 3339 time or unix seconds.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("-ttl-ref is required by -ttl-policy relative")
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -ttl-ref: %q", s)
+	}
+	return t, nil
+}
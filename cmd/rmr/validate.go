@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// anomaly represents a problem found by validate.
+type anomaly struct {
+	offset int64
+	err    error
+}
+
+func (a anomaly) String() string {
+	return fmt.Sprintf("offset %d: %v", a.offset, a.err)
+}
+
+// nopFilter decodes every value and ignores it.
+type nopFilter struct{}
+
+func (nopFilter) Key(rdb.Key) bool         { return false }
+func (nopFilter) Type(rdb.Type) bool       { return false }
+func (nopFilter) Database(rdb.DB) bool     { return false }
+func (nopFilter) Set(*rdb.Set)             {}
+func (nopFilter) List(*rdb.List)           {}
+func (nopFilter) Hash(*rdb.Hash)           {}
+func (nopFilter) String(*rdb.String)       {}
+func (nopFilter) SortedSet(*rdb.SortedSet) {}
+
+// validateMain runs rmr validate, it exits non-zero if any file has anomalies.
+func validateMain(files []string) {
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s validate /path/to/dump.rdb [/path/to/dump.rdb ...]\n", os.Args[0])
+		os.Exit(1)
+	}
+	code := 0
+	for _, file := range files {
+		anomalies, err := validate(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			code = 2
+			continue
+		}
+		if len(anomalies) == 0 {
+			fmt.Printf("%s: ok\n", file)
+			continue
+		}
+		for _, a := range anomalies {
+			fmt.Printf("%s: %v\n", file, a)
+		}
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// validate parses file decoding every value, then verifies the position of the EOF opcode and the checksum.
+// Keys whose values can't be decoded are reported at their offset and skipped.
+func validate(file string) ([]anomaly, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	r, err := rdb.NewMemReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		p         *rdb.Parser
+		anomalies []anomaly
+		report    = new(rdb.RecoveryReport)
+	)
+	err = rdb.Parse(r, rdb.WithFilter(nopFilter{}), rdb.WithStrategy(rdb.SkipMeta), rdb.WithRecover(report),
+		func(parser *rdb.Parser) { p = parser })
+	for _, k := range report.Skipped {
+		anomalies = append(anomalies, anomaly{k.Offset, fmt.Errorf("db %d, key %q, %s: %s", k.DB, k.Key, k.Encoding, k.Err)})
+	}
+	if err != nil {
+		if p == nil {
+			return nil, err
+		}
+		return append(anomalies, anomaly{p.Offset(), err}), nil
+	}
+
+	version, err := readVersion(file)
+	if err != nil {
+		return nil, err
+	}
+	end := fi.Size()
+	if version >= 5 {
+		end -= 8
+	}
+	if offset := p.Offset(); offset != end {
+		anomalies = append(anomalies, anomaly{offset, fmt.Errorf("EOF opcode is followed by %d unexpected bytes", end-offset)})
+	}
+	if version < 5 || end < p.Offset() {
+		return anomalies, nil
+	}
+
+	want, err := storedChecksum(file, end)
+	if err != nil {
+		return nil, err
+	}
+	// a zero checksum means rdbchecksum is disabled
+	if crc := p.Checksum(); want != 0 && crc != want {
+		anomalies = append(anomalies, anomaly{end, fmt.Errorf("checksum mismatch: want %016x, got %016x", want, crc)})
+	}
+	return anomalies, nil
+}
+
+// readVersion reads the rdb version of file.
+func readVersion(file string) (int, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(fd, header); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(header[5:]))
+}
+
+// storedChecksum returns the checksum stored at offset of file.
+func storedChecksum(file string, offset int64) (uint64, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+	var b [8]byte
+	if _, err := fd.ReadAt(b[:], offset); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
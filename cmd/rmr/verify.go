@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// serverTypes maps rdb types to the ones reported by the TYPE command.
+var serverTypes = map[rdb.ValueType]string{
+	rdb.TypeString:    "string",
+	rdb.TypeList:      "list",
+	rdb.TypeSet:       "set",
+	rdb.TypeHash:      "hash",
+	rdb.TypeSortedSet: "zset",
+}
+
+// verifyKey is a sampled key of the dump.
+type verifyKey struct {
+	db     int
+	key    string
+	typ    rdb.ValueType
+	expiry int
+	digest rdb.Digest
+}
+
+// verifyReport samples keys of the dump and compares their existence, type, TTL and value with a live redis,
+// it reports a row per drifted check.
+type verifyReport struct {
+	addr, auth string
+	slack      time.Duration
+	pipeline   int
+
+	mu     sync.Mutex
+	sample []verifyKey
+	seen   int
+	rand   *rand.Rand
+}
+
+func newVerifyReport(addr, auth string, n int, slack time.Duration, pipeline int) *verifyReport {
+	if pipeline < 1 {
+		pipeline = 1
+	}
+	return &verifyReport{
+		addr:     addr,
+		auth:     auth,
+		slack:    slack,
+		pipeline: pipeline,
+		sample:   make([]verifyKey, 0, n),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// add keeps a uniform sample of keys with reservoir sampling.
+func (r *verifyReport) add(key rdb.Key, v value) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen++
+	i := len(r.sample)
+	if i == cap(r.sample) {
+		if i = r.rand.Intn(r.seen); i >= len(r.sample) {
+			return
+		}
+	} else {
+		r.sample = r.sample[:i+1]
+	}
+	r.sample[i] = verifyKey{
+		db:     key.DB,
+		key:    key.Key,
+		typ:    rdb.Encoding2Type(key.Encoding),
+		expiry: key.Expiry,
+		digest: v.Digest(),
+	}
+}
+
+func (r *verifyReport) header() string {
+	return "db,key,check,dump,server"
+}
+
+func (r *verifyReport) rows() []string {
+	c, err := dial(r.addr, r.auth)
+	if err != nil {
+		f.error(err)
+	}
+	defer c.conn.Close()
+
+	var rows []string
+	drifted := 0
+	for start := 0; start < len(r.sample); start += r.pipeline {
+		end := start + r.pipeline
+		if end > len(r.sample) {
+			end = len(r.sample)
+		}
+		batch, err := r.verify(c, r.sample[start:end])
+		if err != nil {
+			f.error(err)
+		}
+		for _, row := range batch {
+			if row != nil {
+				drifted++
+				rows = append(rows, row...)
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "verified %d of %d keys, %d drifted\n", len(r.sample), r.seen, drifted)
+	return rows
+}
+
+// verify checks batch in a single round trip, it returns the drift rows of each key.
+func (r *verifyReport) verify(c *client, batch []verifyKey) ([][]string, error) {
+	const perKey = 3
+	for i, k := range batch {
+		c.selectDB(k.db)
+		c.send(i, "TYPE", k.key)
+		c.send(i, "PTTL", k.key)
+		switch k.typ {
+		case rdb.TypeString:
+			c.send(i, "GET", k.key)
+		case rdb.TypeList:
+			c.send(i, "LRANGE", k.key, "0", "-1")
+		case rdb.TypeSet:
+			c.send(i, "SMEMBERS", k.key)
+		case rdb.TypeHash:
+			c.send(i, "HGETALL", k.key)
+		case rdb.TypeSortedSet:
+			c.send(i, "ZRANGE", k.key, "0", "-1", "WITHSCORES")
+		}
+	}
+	replies, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]reply, len(batch))
+	for _, rep := range replies {
+		if rep.owner >= 0 {
+			values[rep.owner] = append(values[rep.owner], rep)
+		}
+	}
+
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+	rows := make([][]string, len(batch))
+	for i, k := range batch {
+		if len(values[i]) != perKey {
+			return nil, errProtocol
+		}
+		drift := func(check, dump, server string) {
+			rows[i] = append(rows[i], fmt.Sprintf("%d,%s,%s,%s,%s", k.db, strconv.Quote(k.key), check, dump, server))
+		}
+		typ, _ := values[i][0].value.(string)
+		expired := k.expiry >= 0 && int64(k.expiry) <= nowMs
+		if typ == "none" {
+			if !expired {
+				drift("missing", serverTypes[k.typ], "none")
+			}
+			continue
+		}
+		if typ != serverTypes[k.typ] {
+			drift("type", serverTypes[k.typ], typ)
+			continue
+		}
+
+		pttl, _ := values[i][1].value.(int64)
+		switch {
+		case k.expiry < 0 && pttl >= 0:
+			drift("ttl", "none", strconv.FormatInt(pttl, 10))
+		case k.expiry >= 0 && pttl < 0:
+			drift("ttl", strconv.FormatInt(int64(k.expiry)-nowMs, 10), "none")
+		case k.expiry >= 0:
+			diff := time.Duration(int64(k.expiry)-nowMs-pttl) * time.Millisecond
+			if diff > r.slack || diff < -r.slack {
+				drift("ttl", strconv.FormatInt(int64(k.expiry)-nowMs, 10), strconv.FormatInt(pttl, 10))
+			}
+		}
+
+		rep := values[i][2]
+		if rep.err != nil {
+			return nil, rep.err
+		}
+		digest := serverDigest(k.typ, rep.value)
+		if digest != k.digest {
+			drift("value", k.digest.String(), digest.String())
+		}
+	}
+	return rows, nil
+}
+
+// serverDigest returns the digest of a value read from redis, as computed by rdb for the same value.
+func serverDigest(typ rdb.ValueType, v interface{}) rdb.Digest {
+	strs := func() []string {
+		values, _ := v.([]interface{})
+		s := make([]string, len(values))
+		for i, value := range values {
+			s[i], _ = value.(string)
+		}
+		return s
+	}
+	switch typ {
+	case rdb.TypeString:
+		s, _ := v.(string)
+		return rdb.String{Value: s}.Digest()
+	case rdb.TypeList:
+		return rdb.List{Values: strs()}.Digest()
+	case rdb.TypeSet:
+		set := rdb.Set{Values: make(map[interface{}]struct{})}
+		for _, m := range strs() {
+			set.Values[m] = struct{}{}
+		}
+		return set.Digest()
+	case rdb.TypeHash:
+		h := rdb.Hash{Values: make(map[string]string)}
+		pairs := strs()
+		for i := 0; i+1 < len(pairs); i += 2 {
+			h.Values[pairs[i]] = pairs[i+1]
+		}
+		return h.Digest()
+	case rdb.TypeSortedSet:
+		ss := rdb.SortedSet{Values: make(map[string]float64)}
+		pairs := strs()
+		for i := 0; i+1 < len(pairs); i += 2 {
+			score, _ := strconv.ParseFloat(pairs[i+1], 64)
+			ss.Values[pairs[i]] = score
+		}
+		return ss.Digest()
+	}
+	return rdb.Digest{}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/matthewjhe/rdb"
+)
+
+// watchEnv is set in the environment of the runs started by -watch, they run the analysis once.
+const watchEnv = "RMR_WATCHED"
+
+// watching reports whether -watch is set and this process isn't one of its runs.
+func watching() bool {
+	return *watch && os.Getenv(watchEnv) == ""
+}
+
+// watchFiles runs rmr with the same arguments every time one of files is replaced, until it's interrupted.
+// The runs are separate processes, so that every one starts from a clean state; a failed run is reported
+// and files are still watched, since the next dump may be fine.
+func watchFiles(files []string) error {
+	for _, file := range files {
+		if file == "-" || isRemote(file) {
+			return fmt.Errorf("-watch: %s isn't a local file", file)
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	w := rdb.NewWatcher(*watchEvery, files...)
+	return w.Watch(func() error {
+		cmd := exec.Command(self, os.Args[1:]...)
+		cmd.Env = append(os.Environ(), watchEnv+"=1")
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "-watch: %v\n", err)
+		}
+		return nil
+	})
+}
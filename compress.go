@@ -0,0 +1,67 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Compressions of rdb data.
+const (
+	CompressionNone  = ""
+	CompressionGzip  = "gzip"
+	CompressionBzip2 = "bzip2"
+	CompressionZstd  = "zstd"
+	CompressionLZ4   = "lz4"
+)
+
+var magics = []struct {
+	compression string
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionBzip2, []byte("BZh")},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionLZ4, []byte{0x04, 0x22, 0x4d, 0x18}},
+}
+
+// DetectCompression returns the compression of data starting with b, detected by its magic bytes.
+// It returns CompressionNone if b doesn't start with a known magic, 4 bytes are enough to detect all of them.
+func DetectCompression(b []byte) string {
+	for _, m := range magics {
+		if bytes.HasPrefix(b, m.magic) {
+			return m.compression
+		}
+	}
+	return CompressionNone
+}
+
+// NewCompressedReader returns a new BufferReader reading from r, which is decompressed if it's compressed.
+// It's buffer has at least the specified size. If size == 0, use default size.
+//
+// Gzip and bzip2 are supported, ErrUnsupportedCompression is returned for zstd and lz4.
+func NewCompressedReader(r io.Reader, size int) (Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch compression := DetectCompression(magic); compression {
+	case CompressionNone:
+		return NewStreamReader(br, size), nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return NewStreamReader(zr, size), nil
+	case CompressionBzip2:
+		return NewStreamReader(bzip2.NewReader(br), size), nil
+	default:
+		return nil, errors.Wrap(ErrUnsupportedCompression, compression)
+	}
+}
@@ -0,0 +1,86 @@
+package rdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCompressedReader(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/dumps/rdb_version_5_with_checksum.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	if c := DetectCompression(buf.Bytes()); c != CompressionGzip {
+		t.Fatalf("want: %v, got: %v", CompressionGzip, c)
+	}
+
+	for _, b := range [][]byte{buf.Bytes(), data} {
+		r, err := NewCompressedReader(bytes.NewReader(b), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter := new(stringMapFilter)
+		if err := Parse(r, WithFilter(filter)); err != nil {
+			t.Fatal(err)
+		}
+		if got := filter.got["abcd"]; got != "efgh" {
+			t.Fatalf("want: efgh, got: %q", got)
+		}
+	}
+
+	_, err = NewCompressedReader(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0}), 0)
+	if errors.Cause(err) != ErrUnsupportedCompression {
+		t.Fatalf("want: %v, got: %v", ErrUnsupportedCompression, err)
+	}
+}
+
+func TestReaderWrapper(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/dumps/rdb_version_5_with_checksum.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	file, err := ioutil.TempFile("", "rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Write(buf.Bytes())
+	file.Close()
+
+	r, err := NewMemReader(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := new(stringMapFilter)
+	wrapper := func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	}
+	if err := Parse(r, WithFilter(filter), WithReaderWrapper(wrapper)); err != nil {
+		t.Fatal(err)
+	}
+	if got := filter.got["abcd"]; got != "efgh" {
+		t.Fatalf("want: efgh, got: %q", got)
+	}
+
+	wantErr := errors.New("wrapper")
+	err = Parse(NewStreamReader(bytes.NewReader(data), 0), WithReaderWrapper(func(io.Reader) (io.Reader, error) {
+		return nil, wantErr
+	}))
+	if err != wantErr {
+		t.Fatalf("want: %v, got: %v", wantErr, err)
+	}
+}
@@ -0,0 +1,72 @@
+package rdb
+
+import (
+	"io"
+)
+
+// WithConsumed returns a ParseOption which stores in n the number of bytes Parse read,
+// the header and the checksum following the EOF opcode included, once it returns.
+//
+// Parse stops right after the checksum, so another payload concatenated to the rdb file
+// can be parsed from the same Reader, which is left open.
+func WithConsumed(n *int64) ParseOption {
+	return func(p *Parser) {
+		p.consumed = n
+		p.checksum = true
+	}
+}
+
+// ParseConcatenated parses rdb files concatenated in r, such as the payloads of a replication capture,
+// each of them with a new Filter returned by filterFactory. It returns the size of each payload parsed.
+//
+// The payloads are parsed until r is exhausted, the error is the one of the first payload which failed.
+// A Reader other than the ones returned by NewMemReader, NewBufferReader and NewStreamReader is read through a buffer,
+// a layer set by WithReaderWrapper wraps the whole stream.
+func ParseConcatenated(r Reader, filterFactory func() Filter, opts ...ParseOption) ([]int64, error) {
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	p := new(Parser)
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.wrapper != nil {
+		wr, err := p.wrapper(ioReader{r})
+		if err != nil {
+			return nil, err
+		}
+		r = NewStreamReader(wr, 0)
+		opts = append(opts, func(p *Parser) { p.wrapper = nil })
+	}
+
+	mr, _ := r.(*MemReader)
+	br, _ := r.(*BufferReader)
+	if mr == nil && br == nil {
+		br = NewStreamReader(ioReader{r}, 0).(*BufferReader)
+	}
+	var sizes []int64
+	for {
+		var pr Reader = br
+		if mr != nil {
+			if mr.i >= len(mr.b) {
+				return sizes, nil
+			}
+			// a payload is parsed on its own, so that its offset and checksum start at its header
+			pr = &MemReader{b: mr.b[mr.i:]}
+		} else if _, err := br.Peek(1); err == io.EOF {
+			return sizes, nil
+		} else if err != nil {
+			return sizes, err
+		}
+
+		var n int64
+		err := Parse(pr, append(opts, WithFilter(filterFactory()), WithConsumed(&n))...)
+		if mr != nil {
+			mr.Discard(int(n))
+		}
+		sizes = append(sizes, n)
+		if err != nil {
+			return sizes, err
+		}
+	}
+}
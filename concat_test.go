@@ -0,0 +1,70 @@
+package rdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestParseConcatenated(t *testing.T) {
+	var payloads [][]byte
+	for _, keys := range []int{3, 5} {
+		var buf bytes.Buffer
+		if err := generate(&buf, shape{Seed: 1, Keys: keys, Elements: 4, ValueSize: 8}); err != nil {
+			t.Fatal(err)
+		}
+		payloads = append(payloads, buf.Bytes())
+	}
+	v5, err := ioutil.ReadFile("testdata/dumps/rdb_version_5_with_checksum.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads = append(payloads, v5)
+	data := bytes.Join(payloads, nil)
+
+	for _, r := range []Reader{&MemReader{b: data}, NewStreamReader(bytes.NewReader(data), 0)} {
+		var filters []*endFilter
+		sizes, err := ParseConcatenated(r, func() Filter {
+			f := &endFilter{stats: NewStats()}
+			filters = append(filters, f)
+			return f
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sizes) != len(payloads) {
+			t.Fatalf("want: %v payloads, got: %v", len(payloads), len(sizes))
+		}
+		for i, size := range sizes {
+			if size != int64(len(payloads[i])) {
+				t.Fatalf("%v: want: %v bytes, got: %v", i, len(payloads[i]), size)
+			}
+			if s := filters[i].stats; !s.Ended || !s.ChecksumOK {
+				t.Fatalf("%v: ended: %v, checksum ok: %v", i, s.Ended, s.ChecksumOK)
+			}
+		}
+	}
+
+	// trailing garbage fails the parse of the payload it starts
+	sizes, err := ParseConcatenated(&MemReader{b: append(data, "junk"...)}, func() Filter { return new(testEmptyFilter) })
+	if err == nil || len(sizes) != len(payloads)+1 {
+		t.Fatalf("got: %v, %v", sizes, err)
+	}
+}
+
+func TestWithConsumed(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/dumps/rdb_version_5_with_checksum.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	r := NewStreamReader(bytes.NewReader(append(data, data...)), 0)
+	for i := 0; i < 2; i++ {
+		if err := Parse(r, WithFilter(new(testEmptyFilter)), WithConsumed(&n)); err != nil {
+			t.Fatal(i, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("%v: want: %v, got: %v", i, len(data), n)
+		}
+	}
+}
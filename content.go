@@ -0,0 +1,205 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"regexp"
+)
+
+// ContentDecoder detects serialized objects applications store in string values, e.g. JSON documents.
+type ContentDecoder struct {
+	Type   string                                  // content type detected strings are tagged with, e.g. "json"
+	Detect func(value string) bool                 // reports whether value holds the content type
+	Decode func(value string) (interface{}, error) // parses detected values, nil if they are only tagged
+}
+
+// Content decoders of common formats, only JSONContent decodes values.
+// To only tag JSON values, use ContentDecoder{Type: JSONContent.Type, Detect: JSONContent.Detect}.
+var (
+	JSONContent    = ContentDecoder{Type: "json", Detect: isJSON, Decode: decodeJSON}
+	MsgpackContent = ContentDecoder{Type: "msgpack", Detect: isMsgpack}
+	PHPContent     = ContentDecoder{Type: "php", Detect: isPHPSerialized}
+)
+
+// WithContentDecoder returns a ParseOption which tags string values with the type of the first of decoders
+// detecting them, see String.ContentType and String.Content.
+// Detection runs in filter workers, on every string value which isn't skipped.
+func WithContentDecoder(decoders ...ContentDecoder) ParseOption {
+	return func(p *Parser) {
+		p.decoders = append(p.decoders, decoders...)
+	}
+}
+
+// detect sets the content of s, as detected by decoders.
+func detect(s *String, decoders []ContentDecoder) {
+	s.ContentType = ""
+	s.Content = nil
+	if s.Value == "" {
+		return
+	}
+	for _, d := range decoders {
+		if !d.Detect(s.Value) {
+			continue
+		}
+		s.ContentType = d.Type
+		if d.Decode != nil {
+			// a value failing to decode is still tagged, its content is left nil
+			s.Content, _ = d.Decode(s.Value)
+		}
+		return
+	}
+}
+
+func isJSON(value string) bool {
+	// scalars are left out, any integer would be detected
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{', '[':
+			// json.Valid needs Go 1.9, a RawMessage is checked without being decoded
+			var raw json.RawMessage
+			return json.Unmarshal([]byte(value), &raw) == nil
+		}
+		return false
+	}
+	return false
+}
+
+func decodeJSON(value string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(value), &v)
+	return v, err
+}
+
+// phpSerialized matches the values serialized by PHP's serialize: arrays, objects and strings.
+var phpSerialized = regexp.MustCompile(`(?s)^(?:a:\d+:\{.*\}|[OC]:\d+:".*\}|s:\d+:".*";)$`)
+
+func isPHPSerialized(value string) bool {
+	return phpSerialized.MatchString(value)
+}
+
+// isMsgpack reports whether value is a single msgpack map or array.
+func isMsgpack(value string) bool {
+	if len(value) < 2 {
+		return false
+	}
+	b := value[0]
+	container := b>>4 == 0x8 || b>>4 == 0x9 || b == 0xdc || b == 0xdd || b == 0xde || b == 0xdf
+	if !container {
+		return false
+	}
+	n, ok := skipMsgpack(value, 0, 0)
+	return ok && n == len(value)
+}
+
+// skipMsgpack returns the offset following the msgpack object at offset i, depth bounds nesting.
+func skipMsgpack(value string, i, depth int) (int, bool) {
+	if i >= len(value) || depth > 64 {
+		return 0, false
+	}
+	b := value[i]
+	i++
+	// size returns the big endian integer of n bytes at i
+	size := func(n int) (int, bool) {
+		if i+n > len(value) {
+			return 0, false
+		}
+		var u uint64
+		switch n {
+		case 1:
+			u = uint64(value[i])
+		case 2:
+			u = uint64(binary.BigEndian.Uint16([]byte(value[i : i+2])))
+		case 4:
+			u = uint64(binary.BigEndian.Uint32([]byte(value[i : i+4])))
+		}
+		i += n
+		return int(u), u <= uint64(len(value))
+	}
+	elements := func(n int) (int, bool) {
+		for ; n > 0; n-- {
+			var ok bool
+			if i, ok = skipMsgpack(value, i, depth+1); !ok {
+				return 0, false
+			}
+		}
+		return i, true
+	}
+	bytes := func(n int) (int, bool) {
+		if i+n > len(value) {
+			return 0, false
+		}
+		return i + n, true
+	}
+	switch {
+	case b <= 0x7f, b >= 0xe0, b == 0xc0, b == 0xc2, b == 0xc3:
+		return i, true
+	case b>>4 == 0x8:
+		return elements(2 * int(b&0x0f))
+	case b>>4 == 0x9:
+		return elements(int(b & 0x0f))
+	case b>>5 == 0x5:
+		return bytes(int(b & 0x1f))
+	}
+	switch b {
+	case 0xcc, 0xd0:
+		return bytes(1)
+	case 0xcd, 0xd1:
+		return bytes(2)
+	case 0xca, 0xce, 0xd2:
+		return bytes(4)
+	case 0xcb, 0xcf, 0xd3:
+		return bytes(8)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		// fixext: type and 1, 2, 4, 8 or 16 bytes
+		return bytes(1 + 1<<(b-0xd4))
+	case 0xc4, 0xd9, 0xc7:
+		n, ok := size(1)
+		if !ok {
+			return 0, false
+		}
+		if b == 0xc7 {
+			n++
+		}
+		return bytes(n)
+	case 0xc5, 0xda, 0xc8:
+		n, ok := size(2)
+		if !ok {
+			return 0, false
+		}
+		if b == 0xc8 {
+			n++
+		}
+		return bytes(n)
+	case 0xc6, 0xdb, 0xc9:
+		n, ok := size(4)
+		if !ok {
+			return 0, false
+		}
+		if b == 0xc9 {
+			n++
+		}
+		return bytes(n)
+	case 0xdc, 0xde:
+		n, ok := size(2)
+		if !ok {
+			return 0, false
+		}
+		if b == 0xde {
+			n *= 2
+		}
+		return elements(n)
+	case 0xdd, 0xdf:
+		n, ok := size(4)
+		if !ok {
+			return 0, false
+		}
+		if b == 0xdf {
+			n *= 2
+		}
+		return elements(n)
+	}
+	// 0xc1 is never used
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package rdb
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestContentDecoder(t *testing.T) {
+	values := map[string]string{
+		"json":    `{"name": "x", "tags": [1, 2]}`,
+		"array":   ` [1, "a"]`,
+		"broken":  `{"name": `,
+		"number":  `12345`,
+		"msgpack": "\x82\xa4name\xa1x\xa4tags\x92\x01\x02",
+		"fixstr":  "\xa4name",
+		"short":   "\x82\xa4name",
+		"php":     `a:1:{s:4:"name";s:1:"x";}`,
+		"phpobj":  `O:8:"stdClass":1:{s:1:"a";i:1;}`,
+		"phpstr":  `s:5:"hello";`,
+		"plain":   "hello",
+		"empty":   "",
+		"notphp":  "a:1:{",
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for k, v := range values {
+		e.String(&String{Key: Key{Key: k, Expiry: -1}, Value: v})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	types := make(map[string]string)
+	contents := make(map[string]interface{})
+	f := FuncFilter{OnString: func(s *String) {
+		mu.Lock()
+		defer mu.Unlock()
+		types[s.Key.Key] = s.ContentType
+		contents[s.Key.Key] = s.Content
+	}}
+	err := Parse(NewStreamReader(&buf, 0), WithFilter(f), WithContentDecoder(JSONContent, MsgpackContent, PHPContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"json": "json", "array": "json", "broken": "", "number": "",
+		"msgpack": "msgpack", "fixstr": "", "short": "",
+		"php": "php", "phpobj": "php", "phpstr": "php",
+		"plain": "", "empty": "", "notphp": "",
+	}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("want: %v, got: %v", want, types)
+	}
+	json := map[string]interface{}{"name": "x", "tags": []interface{}{1.0, 2.0}}
+	if !reflect.DeepEqual(contents["json"], json) {
+		t.Fatalf("want: %v, got: %v", json, contents["json"])
+	}
+	if contents["msgpack"] != nil || contents["php"] != nil {
+		t.Fatalf("got: %v %v", contents["msgpack"], contents["php"])
+	}
+}
@@ -0,0 +1,13 @@
+package rdb
+
+import "hash/crc64"
+
+// crc64Table is the table of CRC-64-Jones, the reflected polynomial used by redis.
+var crc64Table = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// CRC64 returns the result of adding the bytes in p to crc, using the CRC-64 variant of redis.
+// The checksum at the end of a rdb file is the CRC64 of all preceding bytes, starting from 0.
+func CRC64(crc uint64, p []byte) uint64 {
+	// hash/crc64 inverts crc before and after the update, redis doesn't
+	return ^crc64.Update(^crc, crc64Table, p)
+}
@@ -0,0 +1,96 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCRC64(t *testing.T) {
+	// test vector of redis crc64.c
+	if got := CRC64(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("want: %x, got: %x", uint64(0xe9c6d914c4b8d9ca), got)
+	}
+	if got := CRC64(CRC64(0, []byte("1234")), []byte("56789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("want: %x, got: %x", uint64(0xe9c6d914c4b8d9ca), got)
+	}
+}
+
+func TestParserChecksum(t *testing.T) {
+	file := "testdata/dumps/rdb_version_5_with_checksum.rdb"
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := len(data) - 8
+	want := binary.LittleEndian.Uint64(data[end:])
+
+	mr, err := NewMemReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers := []Reader{mr, NewStreamReader(bytes.NewReader(data), 0)}
+	for _, r := range readers {
+		var p *Parser
+		err := Parse(r, WithFilter(new(testEmptyFilter)), WithChecksum(), func(parser *Parser) { p = parser })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Offset() != int64(end) {
+			t.Fatalf("want: %v, got: %v", end, p.Offset())
+		}
+		if p.Checksum() != want {
+			t.Fatalf("want: %x, got: %x", want, p.Checksum())
+		}
+	}
+}
+
+type endFilter struct {
+	testEmptyFilter
+	stats *Stats
+}
+
+func (f *endFilter) End(checksum uint64, ok bool) {
+	f.stats.End(checksum, ok)
+}
+
+func TestEnd(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "greeting", Expiry: -1}, Value: "hello"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	stored := binary.LittleEndian.Uint64(data[len(data)-8:])
+	corrupt := append([]byte(nil), data...)
+	corrupt[bytes.Index(corrupt, []byte("hello"))] = 'j'
+	disabled := append([]byte(nil), corrupt...)
+	binary.LittleEndian.PutUint64(disabled[len(disabled)-8:], 0)
+
+	tests := []struct {
+		data     []byte
+		ended    bool
+		checksum uint64
+		ok       bool
+	}{
+		{data, true, stored, true},
+		{corrupt, true, stored, false},
+		{disabled, true, 0, true},
+		{data[:len(data)-9], false, 0, false},
+	}
+	for i, test := range tests {
+		for _, r := range []Reader{&MemReader{b: test.data}, NewStreamReader(bytes.NewReader(test.data), 0)} {
+			f := &endFilter{stats: NewStats()}
+			err := Parse(r, WithFilter(f))
+			if test.ended && err != nil {
+				t.Fatal(i, err)
+			}
+			s := f.stats
+			if s.Ended != test.ended || s.Checksum != test.checksum || s.ChecksumOK != test.ok {
+				t.Fatalf("%v: got %v, %x, %v, want %v, %x, %v", i, s.Ended, s.Checksum, s.ChecksumOK, test.ended, test.checksum, test.ok)
+			}
+		}
+	}
+}
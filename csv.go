@@ -0,0 +1,126 @@
+package rdb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CSVColumn is a column of a CSVExporter, Value returns the field of an Entry.
+type CSVColumn struct {
+	Name  string
+	Value func(e Entry) string
+}
+
+// csvColumns are the columns of Entry fields, by name.
+var csvColumns = []CSVColumn{
+	{"db", func(e Entry) string { return strconv.Itoa(e.DB) }},
+	{"type", func(e Entry) string { return string(e.Type) }},
+	{"encoding", func(e Entry) string { return Encoding2String(e.Encoding) }},
+	{"key", func(e Entry) string { return e.Key }},
+	{"mem", func(e Entry) string { return strconv.FormatUint(e.Memory, 10) }},
+	{"size", func(e Entry) string { return strconv.FormatUint(e.SerializedLen, 10) }},
+	{"len", func(e Entry) string { return strconv.Itoa(e.Cardinality) }},
+	{"expiry", func(e Entry) string { return strconv.Itoa(e.ExpireAt) }},
+	{"idle", func(e Entry) string { return strconv.Itoa(e.Idle) }},
+	{"freq", func(e Entry) string { return strconv.Itoa(e.Freq) }},
+	{"offset", func(e Entry) string { return strconv.FormatInt(e.Offset, 10) }},
+}
+
+// DefaultCSVColumns are the names of the columns written by a CSVExporter without columns.
+const DefaultCSVColumns = "db,type,encoding,key,mem,size,len,expiry"
+
+// CSVColumns returns the columns of a comma separated list of Entry fields:
+// db, type, encoding, key, mem, size, len, expiry, idle, freq and offset.
+func CSVColumns(names string) ([]CSVColumn, error) {
+	var selected []CSVColumn
+NEXT:
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		for _, c := range csvColumns {
+			if c.Name == name {
+				selected = append(selected, c)
+				continue NEXT
+			}
+		}
+		return nil, fmt.Errorf("invalid CSV column: %q", name)
+	}
+	return selected, nil
+}
+
+// CSVExporter writes the Entry of keys as CSV rows with encoding/csv, fields holding commas, quotes
+// or line breaks are quoted as by RFC 4180. The first row is the header, made of column names.
+//
+// Rows are buffered, Flush must be called once all keys are written.
+// CSVExporter is safe for concurrent use, Write can be called directly from the callback of EntryFilter, e.g.
+//
+//	x := rdb.NewCSVExporter(os.Stdout)
+//	err := rdb.Parse(reader, rdb.WithFilter(rdb.EntryFilter(func(e rdb.Entry) { x.Write(e) })))
+//	if err == nil {
+//	    err = x.Flush()
+//	}
+type CSVExporter struct {
+	mu      sync.Mutex
+	w       *csv.Writer
+	columns []CSVColumn
+	row     []string
+	started bool // whether the header is written
+	err     error
+}
+
+// NewCSVExporter returns a CSVExporter writing columns to w, the columns of DefaultCSVColumns if there's none.
+func NewCSVExporter(w io.Writer, columns ...CSVColumn) *CSVExporter {
+	if len(columns) == 0 {
+		columns, _ = CSVColumns(DefaultCSVColumns)
+	}
+	return &CSVExporter{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+}
+
+// start writes the header, once.
+func (x *CSVExporter) start() {
+	if x.started || x.err != nil {
+		return
+	}
+	x.started = true
+	for i, c := range x.columns {
+		x.row[i] = c.Name
+	}
+	x.err = x.w.Write(x.row)
+}
+
+// SetComma sets the field delimiter, it must be called before the first Write.
+func (x *CSVExporter) SetComma(r rune) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.w.Comma = r
+}
+
+// Write writes the row of e, it returns the first error met by x.
+func (x *CSVExporter) Write(e Entry) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.start()
+	if x.err != nil {
+		return x.err
+	}
+	for i, c := range x.columns {
+		x.row[i] = c.Value(e)
+	}
+	x.err = x.w.Write(x.row)
+	return x.err
+}
+
+// Flush writes buffered rows to the underlying writer.
+func (x *CSVExporter) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.start()
+	x.w.Flush()
+	if x.err == nil {
+		x.err = x.w.Error()
+	}
+	return x.err
+}
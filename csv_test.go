@@ -0,0 +1,56 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestCSVExporter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "a,b", Expiry: -1}, Value: "v"})
+	e.String(&String{Key: Key{Key: "say \"hi\"\nthere", Expiry: 1500000000000}, Value: "v"})
+	e.Hash(&Hash{Key: Key{Key: "h", Expiry: -1}, Values: map[string]string{"f": "v"}})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	columns, err := CSVColumns("db,key,type,expiry,len")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	x := NewCSVExporter(&out, columns...)
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(EntryFilter(func(e Entry) { x.Write(e) })), EnableSync()); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"db", "key", "type", "expiry", "len"},
+		{"0", "a,b", "string", "-1", "1"},
+		{"0", "say \"hi\"\nthere", "string", "1500000000000", "1"},
+		{"0", "h", "hash", "-1", "1"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("want: %q, got: %q", want, rows)
+	}
+
+	if _, err := CSVColumns("db,nope"); err == nil {
+		t.Fatal("want an error for an unknown column")
+	}
+
+	out.Reset()
+	x = NewCSVExporter(&out)
+	x.SetComma('\t')
+	if err := x.Flush(); err != nil || out.String() != "db\ttype\tencoding\tkey\tmem\tsize\tlen\texpiry\n" {
+		t.Fatalf("got: %q, %v", out.String(), err)
+	}
+}
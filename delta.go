@@ -0,0 +1,88 @@
+package rdb
+
+import (
+	"sort"
+)
+
+// Delta represents the change of the key count and memory of a group of keys, such as a type or a prefix,
+// between two dumps, e.g. last week's and today's.
+type Delta struct {
+	Name   string
+	Before Usage
+	After  Usage
+}
+
+// Keys reports the change of the key count, negative if keys were removed.
+func (d Delta) Keys() int {
+	return d.After.Keys - d.Before.Keys
+}
+
+// Memory reports the change of memory, negative if the group shrank.
+func (d Delta) Memory() int64 {
+	return int64(d.After.Memory) - int64(d.Before.Memory)
+}
+
+// Growth reports the change of memory relative to the memory before, 0 if the group is new.
+func (d Delta) Growth() float64 {
+	if d.Before.Memory == 0 {
+		return 0
+	}
+	return float64(d.Memory()) / float64(d.Before.Memory)
+}
+
+// TypeDeltas returns the change of every type between the summaries of two dumps,
+// ordered by the absolute change of memory descending.
+func TypeDeltas(before, after Summary) []Delta {
+	usages := make(map[string]*Delta)
+	for t, u := range before.Types {
+		usages[string(t)] = &Delta{Name: string(t), Before: u}
+	}
+	for t, u := range after.Types {
+		d, ok := usages[string(t)]
+		if !ok {
+			d = &Delta{Name: string(t)}
+			usages[string(t)] = d
+		}
+		d.After = u
+	}
+	return sortDeltas(usages)
+}
+
+// PrefixDeltas returns the change of every prefix between the prefixes of two dumps, as returned by
+// PrefixReport.Prefixes, ordered by the absolute change of memory descending.
+// Both reports must split keys the same way.
+func PrefixDeltas(before, after []Prefix) []Delta {
+	usages := make(map[string]*Delta)
+	for _, p := range before {
+		usages[p.Prefix] = &Delta{Name: p.Prefix, Before: p.Usage}
+	}
+	for _, p := range after {
+		d, ok := usages[p.Prefix]
+		if !ok {
+			d = &Delta{Name: p.Prefix}
+			usages[p.Prefix] = d
+		}
+		d.After = p.Usage
+	}
+	return sortDeltas(usages)
+}
+
+func sortDeltas(usages map[string]*Delta) []Delta {
+	deltas := make([]Delta, 0, len(usages))
+	for _, d := range usages {
+		deltas = append(deltas, *d)
+	}
+	abs := func(n int64) int64 {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		if m, n := abs(deltas[i].Memory()), abs(deltas[j].Memory()); m != n {
+			return m > n
+		}
+		return deltas[i].Name < deltas[j].Name
+	})
+	return deltas
+}
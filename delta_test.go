@@ -0,0 +1,51 @@
+package rdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrefixDeltas(t *testing.T) {
+	before, after := NewPrefixReport(":", 1), NewPrefixReport(":", 1)
+	before.Add(Key{Key: "session:1", Expiry: -1}, 100)
+	before.Add(Key{Key: "user:1", Expiry: -1}, 50)
+	before.Add(Key{Key: "cache:1", Expiry: -1}, 10)
+	after.Add(Key{Key: "session:1", Expiry: -1}, 100)
+	after.Add(Key{Key: "session:2", Expiry: -1}, 300)
+	after.Add(Key{Key: "user:1", Expiry: -1}, 30)
+	after.Add(Key{Key: "queue:1", Expiry: -1}, 20)
+
+	deltas := PrefixDeltas(before.Prefixes(), after.Prefixes())
+	want := []Delta{
+		{Name: "session", Before: Usage{Keys: 1, Memory: 100}, After: Usage{Keys: 2, Memory: 400}},
+		{Name: "queue", After: Usage{Keys: 1, Memory: 20}},
+		{Name: "user", Before: Usage{Keys: 1, Memory: 50}, After: Usage{Keys: 1, Memory: 30}},
+		{Name: "cache", Before: Usage{Keys: 1, Memory: 10}},
+	}
+	if !reflect.DeepEqual(deltas, want) {
+		t.Fatalf("want: %+v, got: %+v", want, deltas)
+	}
+	if d := deltas[0]; d.Keys() != 1 || d.Memory() != 300 || d.Growth() != 3 {
+		t.Fatalf("got: %v keys, %v memory, %v growth", d.Keys(), d.Memory(), d.Growth())
+	}
+	if d := deltas[3]; d.Keys() != -1 || d.Memory() != -10 || d.Growth() != -1 {
+		t.Fatalf("got: %v keys, %v memory, %v growth", d.Keys(), d.Memory(), d.Growth())
+	}
+}
+
+func TestTypeDeltas(t *testing.T) {
+	before, after := NewSummarizer(), NewSummarizer()
+	before.Add(Key{Key: "a", Encoding: EncodingString, Expiry: -1}, 10)
+	before.Add(Key{Key: "b", Encoding: EncodingHash, Expiry: -1}, 100)
+	after.Add(Key{Key: "a", Encoding: EncodingString, Expiry: -1}, 10)
+	after.Add(Key{Key: "b", Encoding: EncodingHashZip, Expiry: -1}, 40)
+
+	deltas := TypeDeltas(before.Summary(), after.Summary())
+	want := []Delta{
+		{Name: "hash", Before: Usage{Keys: 1, Memory: 100}, After: Usage{Keys: 1, Memory: 40}},
+		{Name: "string", Before: Usage{Keys: 1, Memory: 10}, After: Usage{Keys: 1, Memory: 10}},
+	}
+	if !reflect.DeepEqual(deltas, want) {
+		t.Fatalf("want: %+v, got: %+v", want, deltas)
+	}
+}
@@ -0,0 +1,167 @@
+package rdb
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Digest is the SHA-1 digest of a decoded value.
+type Digest [sha1.Size]byte
+
+// String returns the hex format of d.
+func (d Digest) String() string {
+	return fmt.Sprintf("%x", d[:])
+}
+
+// digest writes length prefixed strings into a SHA-1 hash, so that adjacent strings can't be confused.
+type digest struct {
+	hash.Hash
+	buf [8]byte
+}
+
+func newDigest(typ ValueType) *digest {
+	d := &digest{Hash: sha1.New()}
+	d.write(string(typ))
+	return d
+}
+
+func (d *digest) write(s string) {
+	binary.LittleEndian.PutUint64(d.buf[:], uint64(len(s)))
+	d.Write(d.buf[:])
+	d.Write([]byte(s))
+}
+
+func (d *digest) sum() Digest {
+	var sum Digest
+	copy(sum[:], d.Sum(nil))
+	return sum
+}
+
+// Digest returns the digest of s's value.
+func (s String) Digest() Digest {
+	d := newDigest(TypeString)
+	d.write(s.Value)
+	return d.sum()
+}
+
+// Digest returns the digest of l's values.
+func (l List) Digest() Digest {
+	d := newDigest(TypeList)
+	for _, v := range l.Values {
+		d.write(v)
+	}
+	return d.sum()
+}
+
+// Digest returns the digest of s's members, it doesn't depend on the encoding of s.
+func (s Set) Digest() Digest {
+	members := make([]string, 0, len(s.Values))
+	for v := range s.Values {
+		members = append(members, fmt.Sprint(v))
+	}
+	sort.Strings(members)
+	d := newDigest(TypeSet)
+	for _, m := range members {
+		d.write(m)
+	}
+	return d.sum()
+}
+
+// Digest returns the digest of h's fields and values.
+func (h Hash) Digest() Digest {
+	fields := make([]string, 0, len(h.Values))
+	for field := range h.Values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	d := newDigest(TypeHash)
+	for _, field := range fields {
+		d.write(field)
+		d.write(h.Values[field])
+	}
+	return d.sum()
+}
+
+// Digest returns the digest of ss's members and scores.
+func (ss SortedSet) Digest() Digest {
+	members := make([]string, 0, len(ss.Values))
+	for member := range ss.Values {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	d := newDigest(TypeSortedSet)
+	for _, member := range members {
+		d.write(member)
+		binary.LittleEndian.PutUint64(d.buf[:], math.Float64bits(ss.Values[member]))
+		d.Write(d.buf[:])
+	}
+	return d.sum()
+}
+
+// DuplicateGroup represents keys holding identical values.
+type DuplicateGroup struct {
+	Digest Digest
+	Keys   []Key
+	Memory uint64 // combined memory used by Keys
+}
+
+// Duplicates groups keys by the digests of their values.
+//
+// Duplicates keeps every added key in memory.
+// Duplicates is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type Duplicates struct {
+	mu     sync.Mutex
+	groups map[Digest]*DuplicateGroup
+}
+
+// NewDuplicates returns an empty Duplicates.
+func NewDuplicates() *Duplicates {
+	return &Duplicates{groups: make(map[Digest]*DuplicateGroup)}
+}
+
+// Add adds key which uses memory bytes and whose value has digest d.
+func (dup *Duplicates) Add(key Key, memory uint64, d Digest) {
+	dup.mu.Lock()
+	defer dup.mu.Unlock()
+	g, ok := dup.groups[d]
+	if !ok {
+		g = &DuplicateGroup{Digest: d}
+		dup.groups[d] = g
+	}
+	g.Keys = append(g.Keys, key)
+	g.Memory += memory
+}
+
+// Groups returns groups of at least two keys, ordered by combined memory descending.
+func (dup *Duplicates) Groups() []DuplicateGroup {
+	dup.mu.Lock()
+	defer dup.mu.Unlock()
+	var groups []DuplicateGroup
+	for _, g := range dup.groups {
+		if len(g.Keys) < 2 {
+			continue
+		}
+		group := *g
+		group.Keys = make([]Key, len(g.Keys))
+		copy(group.Keys, g.Keys)
+		sort.Slice(group.Keys, func(i, j int) bool {
+			if group.Keys[i].DB != group.Keys[j].DB {
+				return group.Keys[i].DB < group.Keys[j].DB
+			}
+			return group.Keys[i].Key < group.Keys[j].Key
+		})
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Memory != groups[j].Memory {
+			return groups[i].Memory > groups[j].Memory
+		}
+		return groups[i].Keys[0].Key < groups[j].Keys[0].Key
+	})
+	return groups
+}
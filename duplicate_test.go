@@ -0,0 +1,45 @@
+package rdb
+
+import "testing"
+
+func TestDigest(t *testing.T) {
+	a := Set{Values: map[interface{}]struct{}{"1": {}, "b": {}}}
+	b := Set{Values: map[interface{}]struct{}{1: {}, "b": {}}}
+	if a.Digest() != b.Digest() {
+		t.Fatalf("want: %v, got: %v", a.Digest(), b.Digest())
+	}
+
+	l1 := List{Values: []string{"ab", "c"}}
+	l2 := List{Values: []string{"a", "bc"}}
+	if l1.Digest() == l2.Digest() {
+		t.Fatalf("%v and %v have the same digest", l1.Values, l2.Values)
+	}
+
+	s := String{Value: "a"}
+	l := List{Values: []string{"a"}}
+	if s.Digest() == l.Digest() {
+		t.Fatal("string and list have the same digest")
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	dup := NewDuplicates()
+	foo := String{Value: "foo"}.Digest()
+	bar := String{Value: "bar"}.Digest()
+	dup.Add(Key{Key: "a"}, 10, foo)
+	dup.Add(Key{Key: "b"}, 10, bar)
+	dup.Add(Key{Key: "c"}, 20, foo)
+	dup.Add(Key{Key: "d"}, 5, bar)
+	dup.Add(Key{Key: "e"}, 5, String{Value: "baz"}.Digest())
+
+	groups := dup.Groups()
+	if len(groups) != 2 {
+		t.Fatalf("want: 2 groups, got: %+v", groups)
+	}
+	if g := groups[0]; g.Digest != foo || g.Memory != 30 || len(g.Keys) != 2 || g.Keys[0].Key != "a" {
+		t.Fatalf("got: %+v", g)
+	}
+	if g := groups[1]; g.Digest != bar || g.Memory != 15 {
+		t.Fatalf("got: %+v", g)
+	}
+}
@@ -0,0 +1,270 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// encoderVersion is the rdb version written by Encoder.
+const encoderVersion = "0008"
+
+// Encoder writes keys as a rdb file.
+//
+// Values are written with the plain encodings: linkedlist, hashtable and skiplist,
+// redis converts them to compact encodings when loading if they fit.
+// Keys dropped by WithKeyRewrite are silently skipped by the methods writing values.
+// Encoder is safe for concurrent use, its methods can be called directly from Filter's callbacks.
+type Encoder struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	crc uint64
+	db  int
+	buf [9]byte
+	err error
+
+	rewrite func(key string) (string, bool) // set by WithKeyRewrite
+	dbs     map[int]int                     // set by WithDBMap
+	expiry  []ExpiryPolicy                  // set by WithExpiryPolicy
+}
+
+// EncoderOption configures an Encoder.
+type EncoderOption func(*Encoder)
+
+// WithKeyRewrite returns an EncoderOption which passes the name of every key through fn before it's written,
+// e.g. to move keys to another namespace. Keys for which fn returns false are dropped.
+//
+//	e := rdb.NewEncoder(w, rdb.WithKeyRewrite(func(key string) (string, bool) {
+//	    if strings.HasPrefix(key, "prod:") {
+//	        return "staging:" + key[len("prod:"):], true
+//	    }
+//	    return key, false
+//	}))
+func WithKeyRewrite(fn func(key string) (string, bool)) EncoderOption {
+	return func(e *Encoder) {
+		e.rewrite = fn
+	}
+}
+
+// WithDBMap returns an EncoderOption which writes keys of the databases in dbs to the databases they map to,
+// keys of other databases keep theirs. E.g. map[int]int{1: 0, 2: 0} flattens a dump of databases 0-2 into
+// database 0, as required by redis cluster; keys with the same name in several databases are then all written.
+func WithDBMap(dbs map[int]int) EncoderOption {
+	return func(e *Encoder) {
+		e.dbs = dbs
+	}
+}
+
+// ExpiryPolicy adjusts the expiry of a key when it's written, expiries are unix times in milliseconds,
+// -1 if the key has no expiry.
+type ExpiryPolicy func(expiry int) int
+
+// StripExpiry is an ExpiryPolicy which removes expiries, keys are written persistent.
+func StripExpiry(expiry int) int {
+	return -1
+}
+
+// RelativeExpiry returns an ExpiryPolicy which keeps the TTLs keys had at ref, e.g. the time a backup was taken,
+// from now on: expiries are shifted by now - ref.
+func RelativeExpiry(ref, now time.Time) ExpiryPolicy {
+	shift := int(now.Sub(ref) / time.Millisecond)
+	return func(expiry int) int {
+		if expiry < 0 {
+			return expiry
+		}
+		return expiry + shift
+	}
+}
+
+// ClampExpiry returns an ExpiryPolicy which extends TTLs shorter than min and shortens ones longer than max, relative to now.
+// Zero bounds are ignored, keys without expiry are kept persistent.
+func ClampExpiry(now time.Time, min, max time.Duration) ExpiryPolicy {
+	ms := int(now.UnixNano() / int64(time.Millisecond))
+	return func(expiry int) int {
+		if expiry < 0 {
+			return expiry
+		}
+		if min > 0 && expiry < ms+int(min/time.Millisecond) {
+			expiry = ms + int(min/time.Millisecond)
+		}
+		if max > 0 && expiry > ms+int(max/time.Millisecond) {
+			expiry = ms + int(max/time.Millisecond)
+		}
+		return expiry
+	}
+}
+
+// WithExpiryPolicy returns an EncoderOption which adjusts the expiries of keys with policies, applied in order.
+// Without it, absolute expiries are kept.
+func WithExpiryPolicy(policies ...ExpiryPolicy) EncoderOption {
+	return func(e *Encoder) {
+		e.expiry = append(e.expiry, policies...)
+	}
+}
+
+// NewEncoder returns an Encoder writing to w, the header is written immediately.
+func NewEncoder(w io.Writer, opts ...EncoderOption) *Encoder {
+	e := &Encoder{w: bufio.NewWriter(w), db: -1}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.write([]byte("REDIS" + encoderVersion))
+	return e
+}
+
+func (e *Encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = CRC64(e.crc, b)
+	_, e.err = e.w.Write(b)
+}
+
+func (e *Encoder) writeByte(b byte) {
+	e.buf[0] = b
+	e.write(e.buf[:1])
+}
+
+func (e *Encoder) writeLength(n int) {
+	switch {
+	case n < 1<<6:
+		e.writeByte(byte(n))
+	case n < 1<<14:
+		e.buf[0] = byte(n>>8) | 0x40
+		e.buf[1] = byte(n)
+		e.write(e.buf[:2])
+	case uint64(n) <= math.MaxUint32:
+		e.buf[0] = 0x80
+		binary.BigEndian.PutUint32(e.buf[1:], uint32(n))
+		e.write(e.buf[:5])
+	default:
+		e.buf[0] = 0x81
+		binary.BigEndian.PutUint64(e.buf[1:], uint64(n))
+		e.write(e.buf[:9])
+	}
+}
+
+func (e *Encoder) writeString(s string) {
+	e.writeLength(len(s))
+	e.write([]byte(s))
+}
+
+// writeKey writes the database selector if needed, the expiry, the type and the name of key,
+// it reports false if key is dropped by the rewrite function, nothing is written then.
+func (e *Encoder) writeKey(key Key, encoding Encoding) bool {
+	if e.rewrite != nil {
+		var ok bool
+		if key.Key, ok = e.rewrite(key.Key); !ok {
+			return false
+		}
+	}
+	if db, ok := e.dbs[key.DB]; ok {
+		key.DB = db
+	}
+	for _, policy := range e.expiry {
+		key.Expiry = policy(key.Expiry)
+	}
+	if key.DB != e.db {
+		e.writeByte(TokenDB)
+		e.writeLength(key.DB)
+		e.db = key.DB
+	}
+	if key.Expiry >= 0 {
+		e.buf[0] = TokenExpMSec
+		binary.LittleEndian.PutUint64(e.buf[1:], uint64(key.Expiry))
+		e.write(e.buf[:9])
+	}
+	e.writeByte(byte(encoding))
+	e.writeString(key.Key)
+	return true
+}
+
+// String writes s.
+func (e *Encoder) String(s *String) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.writeKey(s.Key, EncodingString) {
+		return e.err
+	}
+	e.writeString(s.Value)
+	return e.err
+}
+
+// List writes l.
+func (e *Encoder) List(l *List) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.writeKey(l.Key, EncodingList) {
+		return e.err
+	}
+	e.writeLength(len(l.Values))
+	for _, v := range l.Values {
+		e.writeString(v)
+	}
+	return e.err
+}
+
+// Set writes s.
+func (e *Encoder) Set(s *Set) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.writeKey(s.Key, EncodingSet) {
+		return e.err
+	}
+	e.writeLength(len(s.Values))
+	for v := range s.Values {
+		e.writeString(fmt.Sprint(v))
+	}
+	return e.err
+}
+
+// Hash writes h.
+func (e *Encoder) Hash(h *Hash) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.writeKey(h.Key, EncodingHash) {
+		return e.err
+	}
+	e.writeLength(len(h.Values))
+	for field, value := range h.Values {
+		e.writeString(field)
+		e.writeString(value)
+	}
+	return e.err
+}
+
+// SortedSet writes ss, scores are written as binary doubles.
+func (e *Encoder) SortedSet(ss *SortedSet) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.writeKey(ss.Key, EncodingSortedSet2) {
+		return e.err
+	}
+	e.writeLength(len(ss.Values))
+	for member, score := range ss.Values {
+		e.writeString(member)
+		binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(score))
+		e.write(e.buf[:8])
+	}
+	return e.err
+}
+
+// Close writes the EOF opcode and the checksum, then flushes the underlying writer.
+// It doesn't close the underlying writer.
+func (e *Encoder) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.writeByte(TokenEOF)
+	binary.LittleEndian.PutUint64(e.buf[:8], e.crc)
+	if e.err == nil {
+		_, e.err = e.w.Write(e.buf[:8])
+	}
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
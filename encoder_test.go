@@ -0,0 +1,213 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type encodedFilter struct {
+	testEmptyFilter
+
+	mu      sync.Mutex
+	strings map[string]string
+	lists   map[string][]string
+	sets    map[string]int
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]float64
+	expiry  map[string]int
+	dbs     map[string]int
+}
+
+func newEncodedFilter() *encodedFilter {
+	return &encodedFilter{
+		strings: make(map[string]string),
+		lists:   make(map[string][]string),
+		sets:    make(map[string]int),
+		hashes:  make(map[string]map[string]string),
+		zsets:   make(map[string]map[string]float64),
+		expiry:  make(map[string]int),
+		dbs:     make(map[string]int),
+	}
+}
+
+func (f *encodedFilter) key(k Key) {
+	f.expiry[k.Key] = k.Expiry
+	f.dbs[k.Key] = k.DB
+}
+
+func (f *encodedFilter) String(s *String) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key(s.Key)
+	f.strings[s.Key.Key] = s.Value
+}
+
+func (f *encodedFilter) List(l *List) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key(l.Key)
+	f.lists[l.Key.Key] = append([]string(nil), l.Values...)
+}
+
+func (f *encodedFilter) Set(s *Set) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key(s.Key)
+	f.sets[s.Key.Key] = len(s.Values)
+}
+
+func (f *encodedFilter) Hash(h *Hash) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key(h.Key)
+	f.hashes[h.Key.Key] = make(map[string]string)
+	for k, v := range h.Values {
+		f.hashes[h.Key.Key][k] = v
+	}
+}
+
+func (f *encodedFilter) SortedSet(ss *SortedSet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.key(ss.Key)
+	f.zsets[ss.Key.Key] = make(map[string]float64)
+	for k, v := range ss.Values {
+		f.zsets[ss.Key.Key][k] = v
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	long := strings.Repeat("x", 20000)
+	list := make([]string, 100)
+	for i := range list {
+		list[i] = strings.Repeat("a", i)
+	}
+	hash := map[string]string{"f1": "v1", "f2": long}
+	zset := map[string]float64{"a": 1.5, "b": math.Inf(-1), "c": 0}
+	e.String(&String{Key: Key{Key: "s", Expiry: 1500000000123}, Value: long})
+	e.List(&List{Key: Key{Key: "l", Expiry: -1}, Values: list})
+	e.Set(&Set{Key: Key{Key: "set", DB: 3, Expiry: -1}, Values: map[interface{}]struct{}{1: {}, "x": {}}})
+	e.Hash(&Hash{Key: Key{Key: "h", DB: 3, Expiry: -1}, Values: hash})
+	e.SortedSet(&SortedSet{Key: Key{Key: "z", Expiry: -1}, Values: zset})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	if crc := CRC64(0, b[:len(b)-8]); crc != binary.LittleEndian.Uint64(b[len(b)-8:]) {
+		t.Fatalf("checksum mismatch: %x", crc)
+	}
+	f := newEncodedFilter()
+	if err := Parse(NewStreamReader(&buf, 0), WithFilter(f)); err != nil {
+		t.Fatal(err)
+	}
+	if f.strings["s"] != long || f.expiry["s"] != 1500000000123 {
+		t.Fatalf("got: %v %v", len(f.strings["s"]), f.expiry["s"])
+	}
+	if !reflect.DeepEqual(f.lists["l"], list) || f.expiry["l"] != -1 {
+		t.Fatalf("got: %v", f.lists["l"])
+	}
+	if f.sets["set"] != 2 || f.dbs["set"] != 3 {
+		t.Fatalf("got: %v %v", f.sets["set"], f.dbs["set"])
+	}
+	if !reflect.DeepEqual(f.hashes["h"], hash) || f.dbs["h"] != 3 {
+		t.Fatalf("got: %v", f.hashes["h"])
+	}
+	if !reflect.DeepEqual(f.zsets["z"], zset) || f.dbs["z"] != 0 {
+		t.Fatalf("got: %v", f.zsets["z"])
+	}
+}
+
+func TestEncoderKeyRewrite(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf, WithKeyRewrite(func(key string) (string, bool) {
+		if strings.HasPrefix(key, "prod:") {
+			return "staging:" + key[len("prod:"):], true
+		}
+		return key, !strings.HasPrefix(key, "tmp:")
+	}))
+	e.String(&String{Key: Key{Key: "prod:s", Expiry: -1}, Value: "v"})
+	e.String(&String{Key: Key{Key: "tmp:s", Expiry: -1}, Value: "v"})
+	e.List(&List{Key: Key{Key: "prod:l", Expiry: -1}, Values: []string{"a", "b"}})
+	e.Hash(&Hash{Key: Key{Key: "h", Expiry: -1}, Values: map[string]string{"f": "v"}})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newEncodedFilter()
+	if err := Parse(NewStreamReader(&buf, 0), WithFilter(f)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.strings) != 1 || f.strings["staging:s"] != "v" {
+		t.Fatalf("got: %v", f.strings)
+	}
+	if !reflect.DeepEqual(f.lists["staging:l"], []string{"a", "b"}) || len(f.lists) != 1 {
+		t.Fatalf("got: %v", f.lists)
+	}
+	if f.hashes["h"]["f"] != "v" {
+		t.Fatalf("got: %v", f.hashes)
+	}
+}
+
+func TestEncoderDBMap(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf, WithDBMap(map[int]int{1: 0, 2: 5}))
+	for db, key := range []string{"a", "b", "c", "d"} {
+		e.String(&String{Key: Key{Key: key, DB: db, Expiry: -1}, Value: "v"})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newEncodedFilter()
+	if err := Parse(NewStreamReader(&buf, 0), WithFilter(f)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"a": 0, "b": 0, "c": 5, "d": 3}
+	if !reflect.DeepEqual(f.dbs, want) {
+		t.Fatalf("want: %v, got: %v", want, f.dbs)
+	}
+}
+
+func TestExpiryPolicies(t *testing.T) {
+	now := time.Unix(2000000000, 0)
+	ms := 2000000000000
+	tests := []struct {
+		policies []ExpiryPolicy
+		expiry   int
+		want     int
+	}{
+		{nil, 1500000000000, 1500000000000},
+		{[]ExpiryPolicy{StripExpiry}, 1500000000000, -1},
+		{[]ExpiryPolicy{RelativeExpiry(time.Unix(1500000000, 0), now)}, 1500000060000, ms + 60000},
+		{[]ExpiryPolicy{RelativeExpiry(time.Unix(1500000000, 0), now)}, -1, -1},
+		{[]ExpiryPolicy{ClampExpiry(now, time.Hour, 0)}, ms + 1000, ms + 3600000},
+		{[]ExpiryPolicy{ClampExpiry(now, time.Hour, 0)}, ms + 7200000, ms + 7200000},
+		{[]ExpiryPolicy{ClampExpiry(now, 0, time.Hour)}, ms + 7200000, ms + 3600000},
+		{[]ExpiryPolicy{ClampExpiry(now, 0, time.Hour)}, -1, -1},
+		{[]ExpiryPolicy{RelativeExpiry(time.Unix(1500000000, 0), now), ClampExpiry(now, time.Minute, 0)}, 1500000001000, ms + 60000},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf, WithExpiryPolicy(test.policies...))
+		e.String(&String{Key: Key{Key: "s", Expiry: test.expiry}, Value: "v"})
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f := newEncodedFilter()
+		if err := Parse(NewStreamReader(&buf, 0), WithFilter(f)); err != nil {
+			t.Fatal(err)
+		}
+		if f.expiry["s"] != test.want {
+			t.Fatalf("%d: want: %v, got: %v", i, test.want, f.expiry["s"])
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package rdb
+
+// Entry is the metadata of a key, gathered in one record.
+type Entry struct {
+	DB            int
+	Key           string // as by Key.String
+	Type          ValueType
+	Encoding      Encoding
+	ExpireAt      int    // unix time in milliseconds, -1 if key has no expiry
+	Idle          int    // LRU idle time in seconds, -1 if it isn't stored
+	Freq          int    // LFU access frequency, -1 if it isn't stored
+	Memory        uint64 // as reported by the value's Memory
+	SerializedLen uint64 // uncompressed size of the value's payload in the rdb file
+	Offset        int64  // offset of the key's value type in the rdb file, 0 unless it's tracked as by Parser.Offset
+	Cardinality   int    // number of elements, 1 for strings
+}
+
+// EntryFilter returns a Filter which calls fn with the Entry of each key, e.g.
+//
+//	err := rdb.Parse(reader, rdb.WithFilter(rdb.EntryFilter(func(e rdb.Entry) {
+//	    fmt.Println(e.Key, e.Type, e.Memory, e.Cardinality)
+//	})))
+//
+// Values are decoded to compute Memory, combine it with filters skipping keys to save the work.
+func EntryFilter(fn func(e Entry)) Filter {
+	return FuncFilter{
+		OnSet:       func(s *Set) { fn(newEntry(s.Key, s.Memory(), s.Size(), s.Len())) },
+		OnList:      func(l *List) { fn(newEntry(l.Key, l.Memory(), l.Size(), l.Len())) },
+		OnHash:      func(h *Hash) { fn(newEntry(h.Key, h.Memory(), h.Size(), h.Len())) },
+		OnString:    func(s *String) { fn(newEntry(s.Key, s.Memory(), s.Size(), s.Len())) },
+		OnSortedSet: func(s *SortedSet) { fn(newEntry(s.Key, s.Memory(), s.Size(), s.Len())) },
+	}
+}
+
+func newEntry(key Key, memory, size uint64, n int) Entry {
+	return Entry{
+		DB:            key.DB,
+		Key:           key.String(),
+		Type:          Encoding2Type(key.Encoding),
+		Encoding:      key.Encoding,
+		ExpireAt:      key.Expiry,
+		Idle:          key.Idle,
+		Freq:          key.Freq,
+		Memory:        memory,
+		SerializedLen: size,
+		Offset:        key.offset,
+		Cardinality:   n,
+	}
+}
@@ -0,0 +1,58 @@
+package rdb
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEntryFilter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "s", Expiry: 1500000000000}, Value: "value"})
+	e.writeByte(TokenIdle)
+	e.writeLength(300)
+	e.writeByte(TokenFreq)
+	e.writeByte(5)
+	e.List(&List{Key: Key{DB: 1, Key: "l", Expiry: -1}, Values: []string{"a", "b", "c"}})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu      sync.Mutex
+		entries = make(map[string]Entry)
+	)
+	f := EntryFilter(func(e Entry) {
+		mu.Lock()
+		defer mu.Unlock()
+		entries[e.Key] = e
+	})
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("want: 2 entries, got: %v", entries)
+	}
+
+	s, l := entries["s"], entries["l"]
+	if s.Memory == 0 || l.Memory == 0 {
+		t.Fatalf("want: memory, got: %v, %v", s.Memory, l.Memory)
+	}
+	s.Memory, l.Memory = 0, 0
+	want := Entry{
+		Key: "s", Type: TypeString, Encoding: EncodingString, ExpireAt: 1500000000000,
+		Idle: -1, Freq: -1, SerializedLen: 5, Offset: 20, Cardinality: 1,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("want: %+v, got: %+v", want, s)
+	}
+	want = Entry{
+		DB: 1, Key: "l", Type: TypeList, Encoding: EncodingList, ExpireAt: -1,
+		Idle: 300, Freq: 5, SerializedLen: 3, Offset: 36, Cardinality: 3,
+	}
+	if !reflect.DeepEqual(l, want) {
+		t.Fatalf("want: %+v, got: %+v", want, l)
+	}
+}
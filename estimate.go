@@ -0,0 +1,134 @@
+package rdb
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Estimate is the cost of parsing a whole rdb file, extrapolated by EstimateCost from its header,
+// its RESIZEDB hints and a sample of its first keys.
+type Estimate struct {
+	Version    int
+	UsedMemory uint64 // used-mem AUX field, memory used by redis when it saved the file, 0 if it isn't stored
+
+	Size        int64         // bytes of the file, 0 if it's unknown
+	Sampled     int64         // bytes of the file parsed
+	SampledKeys int           // keys of the file parsed
+	Complete    bool          // whether the sample is the whole file, estimates are then exact
+	HintedKeys  int           // keys announced by the RESIZEDB hints of the databases sampled
+	SampleTime  time.Duration // time spent parsing the sample
+
+	Keys       int64         // estimated number of keys, at least HintedKeys
+	Memory     uint64        // estimated memory used by keys once restored
+	KeyBytes   uint64        // estimated bytes of key names
+	ValueBytes uint64        // estimated bytes of serialized values
+	MaxMemory  uint64        // memory of the biggest key sampled
+	ParseTime  time.Duration // estimated time to parse the file with values decoded, on this host
+}
+
+// estimateFilter gathers the sample of an Estimate.
+type estimateFilter struct {
+	FuncFilter
+
+	e *Estimate
+}
+
+func (f estimateFilter) Header(version int, aux map[string]string) {
+	f.e.UsedMemory, _ = strconv.ParseUint(aux["used-mem"], 10, 64)
+}
+
+// EstimateCost parses the first sample bytes of a rdb file of size bytes, 0 if it's unknown, and extrapolates
+// the cost of parsing it whole, e.g. to tell whether an export fits a laptop before running it.
+//
+// Estimates grow with the ratio of the file size to the sample; if the size is unknown, as for compressed
+// streams, they grow with the ratio of the RESIZEDB hints to the keys sampled. The sample is cut at
+// the first key following sample bytes, the whole file is parsed if sample is 0.
+func EstimateCost(r Reader, size, sample int64) (*Estimate, error) {
+	e := &Estimate{Size: size}
+	var (
+		mu        sync.Mutex
+		keyBytes  uint64
+		valBytes  uint64
+		memory    uint64
+		hints     = make(map[int]int)
+		entryFunc = EntryFilter(func(entry Entry) {
+			mu.Lock()
+			defer mu.Unlock()
+			e.SampledKeys++
+			keyBytes += uint64(len(entry.Key))
+			valBytes += entry.SerializedLen
+			memory += entry.Memory
+			if entry.Memory > e.MaxMemory {
+				e.MaxMemory = entry.Memory
+			}
+		}).(FuncFilter)
+	)
+	entryFunc.OnDatabase = func(db DB) bool {
+		if db.Size > 0 {
+			hints[db.Num] = db.Size
+		}
+		return false
+	}
+	p, err := newParser(r, WithFilter(estimateFilter{entryFunc, e}), WithStrategy(SkipMeta), func(p *Parser) {
+		// offsets are tracked to stop after sample bytes
+		p.checksum = true
+		p.limit = sample
+	})
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := p.readHeader(); err != nil {
+		return nil, err
+	}
+	e.Version, _ = strconv.Atoi(p.version)
+	p.startWorkers()
+	if err := p.Parse(); err != nil {
+		return nil, err
+	}
+	e.SampleTime = time.Since(start)
+	e.Sampled = p.read()
+	e.Complete = p.eof != nil
+	for _, n := range hints {
+		e.HintedKeys += n
+	}
+
+	ratio := 1.0
+	switch {
+	case e.Complete:
+	case size > e.Sampled && e.Sampled > 9:
+		// the header isn't made of keys
+		ratio = float64(size-9) / float64(e.Sampled-9)
+	case e.HintedKeys > e.SampledKeys && e.SampledKeys > 0:
+		ratio = float64(e.HintedKeys) / float64(e.SampledKeys)
+	}
+	e.Keys = int64(float64(e.SampledKeys) * ratio)
+	if e.Keys < int64(e.HintedKeys) {
+		e.Keys = int64(e.HintedKeys)
+	}
+	e.Memory = uint64(float64(memory) * ratio)
+	e.KeyBytes = uint64(float64(keyBytes) * ratio)
+	e.ValueBytes = uint64(float64(valBytes) * ratio)
+	e.ParseTime = time.Duration(float64(e.SampleTime) * ratio)
+	return e, nil
+}
+
+// PeakMemory estimates the memory held while the file is parsed by workers decoding values concurrently,
+// for an operation which retains perKey bytes and the name of every key, e.g. 0 for a streaming export
+// which retains nothing, or the size of a row for one which sorts keys.
+func (e *Estimate) PeakMemory(workers int, perKey uint64) uint64 {
+	// values waiting for a worker are held serialized, the ones being decoded are held whole
+	peak := uint64(workers) * e.MaxMemory
+	if e.Keys > 0 {
+		queued := uint64(filterBufferSize)
+		if uint64(e.Keys) < queued {
+			queued = uint64(e.Keys)
+		}
+		peak += queued * (e.ValueBytes / uint64(e.Keys))
+	}
+	if perKey > 0 {
+		peak += uint64(e.Keys)*perKey + e.KeyBytes
+	}
+	return peak
+}
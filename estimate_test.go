@@ -0,0 +1,53 @@
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i := 0; i < 3000; i++ {
+		e.String(&String{Key: Key{Key: fmt.Sprintf("key:%04d", i), Expiry: -1}, Value: fmt.Sprintf("value:%04d", i)})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	var memory uint64
+	if err := Parse(&MemReader{b: b}, WithFilter(EntryFilter(func(e Entry) { memory += e.Memory }))); err != nil {
+		t.Fatal(err)
+	}
+	est, err := EstimateCost(&MemReader{b: b}, int64(len(b)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !est.Complete || est.Keys != 3000 || est.SampledKeys != 3000 || est.Memory != memory || est.KeyBytes != 3000*8 {
+		t.Fatalf("want: exact estimate, got: %+v", est)
+	}
+	if peak := est.PeakMemory(4, 100); peak < 3000*108 {
+		t.Fatalf("want: peak memory of retained keys, got: %v", peak)
+	}
+
+	est, err = EstimateCost(NewStreamReader(bytes.NewReader(b), 0), int64(len(b)), int64(len(b)/3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Complete || est.SampledKeys >= 3000 || est.Keys < 2900 || est.Keys > 3100 || est.Version != 8 {
+		t.Fatalf("want: about 3000 keys extrapolated, got: %+v", est)
+	}
+	if est.Memory < memory*9/10 || est.Memory > memory*11/10 || est.ParseTime < est.SampleTime {
+		t.Fatalf("want: about %d bytes extrapolated, got: %+v", memory, est)
+	}
+
+	est, err = EstimateCost(NewStreamReader(bytes.NewReader(b), 0), 0, int64(len(b)/3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Keys != int64(est.SampledKeys) {
+		t.Fatalf("want: sampled keys without size nor hints, got: %+v", est)
+	}
+}
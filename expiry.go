@@ -0,0 +1,195 @@
+package rdb
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ExpiryBucket counts the keys which expire in [Start, Start+Interval) of an ExpiryTimeline.
+type ExpiryBucket struct {
+	Usage
+
+	Start time.Time
+}
+
+// ExpiryTimeline buckets keys by expiration time, e.g. per hour, to predict when memory is released
+// and spot expiration storms once a snapshot is restored.
+//
+// Keys without expiry and keys which already expired at Now are counted apart.
+// ExpiryTimeline is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type ExpiryTimeline struct {
+	// Now is the time expiries are compared against.
+	Now time.Time
+	// Interval is the width of buckets, they are aligned on multiples of it since the unix epoch.
+	// Expiries have a millisecond precision, shorter intervals are counted as 1ms.
+	Interval time.Duration
+
+	mu         sync.Mutex
+	buckets    map[int64]*Usage // usage per bucket, by index since the epoch
+	expired    Usage
+	persistent Usage
+}
+
+// NewExpiryTimeline returns an ExpiryTimeline with buckets of interval, comparing expiries against current time.
+// Intervals shorter than 1ms are raised to 1ms.
+func NewExpiryTimeline(interval time.Duration) *ExpiryTimeline {
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return &ExpiryTimeline{
+		Now:      time.Now(),
+		Interval: interval,
+		buckets:  make(map[int64]*Usage),
+	}
+}
+
+// Add adds key which uses memory bytes to the timeline.
+func (t *ExpiryTimeline) Add(key Key, memory uint64) {
+	now := t.Now.UnixNano() / int64(time.Millisecond)
+	interval := t.interval()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case key.Expiry < 0:
+		t.persistent.add(memory)
+	case int64(key.Expiry) <= now:
+		t.expired.add(memory)
+	default:
+		i := int64(key.Expiry) / interval
+		u, ok := t.buckets[i]
+		if !ok {
+			u = new(Usage)
+			t.buckets[i] = u
+		}
+		u.add(memory)
+	}
+}
+
+// Buckets returns the buckets holding keys, ordered by time.
+func (t *ExpiryTimeline) Buckets() []ExpiryBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	buckets := make([]ExpiryBucket, 0, len(t.buckets))
+	for i, u := range t.buckets {
+		start := time.Unix(0, i*t.interval()*int64(time.Millisecond)).UTC()
+		buckets = append(buckets, ExpiryBucket{Usage: *u, Start: start})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+	return buckets
+}
+
+// interval returns the width of buckets in milliseconds, at least 1.
+func (t *ExpiryTimeline) interval() int64 {
+	if ms := int64(t.Interval / time.Millisecond); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// Expired reports the keys which already expired at Now.
+func (t *ExpiryTimeline) Expired() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expired
+}
+
+// Persistent reports the keys without expiry.
+func (t *ExpiryTimeline) Persistent() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.persistent
+}
+
+// ExpiringKey represents a key of an ExpiryIndex.
+type ExpiringKey struct {
+	Key    Key
+	Memory uint64
+}
+
+// ExpiryIndex keeps the keys with an expiry ordered by expiration time, to answer which keys expire next
+// once a snapshot is restored, e.g. to simulate evictions.
+//
+// Keys without expiry are left out, as are the ones whose expiry is skipped by SkipExpiry.
+// ExpiryIndex is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type ExpiryIndex struct {
+	// Now is the time NextExpiring compares expiries against.
+	Now time.Time
+
+	mu     sync.Mutex
+	keys   []ExpiringKey
+	sorted bool
+}
+
+// NewExpiryIndex returns an ExpiryIndex comparing expiries against current time.
+func NewExpiryIndex() *ExpiryIndex {
+	return &ExpiryIndex{Now: time.Now()}
+}
+
+// Add adds key which uses memory bytes to the index.
+func (x *ExpiryIndex) Add(key Key, memory uint64) {
+	if key.Expiry < 0 {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.keys = append(x.keys, ExpiringKey{Key: key, Memory: memory})
+	x.sorted = false
+}
+
+// Len reports the number of keys in the index.
+func (x *ExpiryIndex) Len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.keys)
+}
+
+// sort orders keys by expiry once keys have been added, x.mu must be held.
+func (x *ExpiryIndex) sort() {
+	if x.sorted {
+		return
+	}
+	sort.Slice(x.keys, func(i, j int) bool {
+		if x.keys[i].Key.Expiry != x.keys[j].Key.Expiry {
+			return x.keys[i].Key.Expiry < x.keys[j].Key.Expiry
+		}
+		return x.keys[i].Key.Key < x.keys[j].Key.Key
+	})
+	x.sorted = true
+}
+
+// search returns the index of the first key expiring at or after t, x.mu must be held.
+func (x *ExpiryIndex) search(t time.Time) int {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	return sort.Search(len(x.keys), func(i int) bool {
+		return int64(x.keys[i].Key.Expiry) >= ms
+	})
+}
+
+// NextExpiring returns the n keys which expire first after Now, ordered by expiry.
+// Keys which already expired at Now are left out, they expire as soon as they're restored.
+func (x *ExpiryIndex) NextExpiring(n int) []ExpiringKey {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.sort()
+	i := x.search(x.Now.Add(time.Millisecond))
+	if n > len(x.keys)-i {
+		n = len(x.keys) - i
+	}
+	return append([]ExpiringKey(nil), x.keys[i:i+n]...)
+}
+
+// ExpiringBetween returns the keys which expire in [a, b), ordered by expiry.
+func (x *ExpiryIndex) ExpiringBetween(a, b time.Time) []ExpiringKey {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.sort()
+	i, j := x.search(a), x.search(b)
+	if j <= i {
+		return nil
+	}
+	return append([]ExpiringKey(nil), x.keys[i:j]...)
+}
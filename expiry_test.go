@@ -0,0 +1,93 @@
+package rdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiryTimeline(t *testing.T) {
+	tl := NewExpiryTimeline(time.Hour)
+	tl.Now = time.Unix(1000, 0)
+	tl.Add(Key{Key: "a", Expiry: -1}, 10)
+	tl.Add(Key{Key: "b", Expiry: 999000}, 20)
+	tl.Add(Key{Key: "c", Expiry: 1060000}, 30)
+	tl.Add(Key{Key: "d", Expiry: 3599999}, 40)
+	tl.Add(Key{Key: "e", Expiry: 7200000}, 50)
+
+	if u := tl.Persistent(); u.Keys != 1 || u.Memory != 10 {
+		t.Fatalf("got: %+v", u)
+	}
+	if u := tl.Expired(); u.Keys != 1 || u.Memory != 20 {
+		t.Fatalf("got: %+v", u)
+	}
+	buckets := tl.Buckets()
+	if len(buckets) != 2 {
+		t.Fatalf("want: 2 buckets, got: %+v", buckets)
+	}
+	if b := buckets[0]; !b.Start.Equal(time.Unix(0, 0)) || b.Keys != 2 || b.Memory != 70 {
+		t.Fatalf("got: %+v", b)
+	}
+	if b := buckets[1]; !b.Start.Equal(time.Unix(7200, 0)) || b.Keys != 1 || b.Memory != 50 {
+		t.Fatalf("got: %+v", b)
+	}
+}
+
+func TestExpiryTimelineShortInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, time.Microsecond, -time.Hour} {
+		tl := NewExpiryTimeline(interval)
+		tl.Now = time.Unix(1000, 0)
+		tl.Add(Key{Key: "a", Expiry: 1000001}, 10)
+		tl.Add(Key{Key: "b", Expiry: 1000002}, 20)
+		buckets := tl.Buckets()
+		if len(buckets) != 2 || !buckets[0].Start.Equal(time.Unix(1000, int64(time.Millisecond))) {
+			t.Fatalf("interval %v: want: 2 buckets of 1ms, got: %+v", interval, buckets)
+		}
+	}
+
+	// Interval may be set after NewExpiryTimeline
+	tl := NewExpiryTimeline(time.Hour)
+	tl.Now = time.Unix(1000, 0)
+	tl.Interval = 0
+	tl.Add(Key{Key: "a", Expiry: 1000001}, 10)
+	if buckets := tl.Buckets(); len(buckets) != 1 {
+		t.Fatalf("want: 1 bucket, got: %+v", buckets)
+	}
+}
+
+func TestExpiryIndex(t *testing.T) {
+	x := NewExpiryIndex()
+	x.Now = time.Unix(1000, 0)
+	x.Add(Key{Key: "a", Expiry: -1}, 10)
+	x.Add(Key{Key: "b", Expiry: 999000}, 20)
+	x.Add(Key{Key: "c", Expiry: 1000000}, 30)
+	x.Add(Key{Key: "e", Expiry: 7200000}, 50)
+	x.Add(Key{Key: "d", Expiry: 1060000}, 40)
+	x.Add(Key{Key: "f", Expiry: -1, HasExpiry: true}, 60)
+
+	if n := x.Len(); n != 4 {
+		t.Fatalf("want: 4 keys, got: %v", n)
+	}
+	names := func(keys []ExpiringKey) string {
+		var s string
+		for _, k := range keys {
+			s += k.Key.Key
+		}
+		return s
+	}
+	if got := names(x.NextExpiring(2)); got != "de" {
+		t.Fatalf("want: de, got: %v", got)
+	}
+	if got := names(x.NextExpiring(10)); got != "de" {
+		t.Fatalf("want: de, got: %v", got)
+	}
+	if got := names(x.ExpiringBetween(time.Unix(999, 0), time.Unix(1060, 0))); got != "bc" {
+		t.Fatalf("want: bc, got: %v", got)
+	}
+	if got := x.ExpiringBetween(time.Unix(2000, 0), time.Unix(1000, 0)); got != nil {
+		t.Fatalf("want: no keys, got: %+v", got)
+	}
+	x.Add(Key{Key: "g", Expiry: 1001000}, 70)
+	if keys := x.NextExpiring(1); len(keys) != 1 || keys[0].Key.Key != "g" || keys[0].Memory != 70 {
+		t.Fatalf("got: %+v", keys)
+	}
+}
@@ -0,0 +1,361 @@
+package rdb
+
+import (
+	"regexp"
+	"sync/atomic"
+)
+
+// FuncFilter is a Filter whose callbacks are its fields, nil fields are no-ops which don't abort the parse.
+//
+//	err := rdb.Parse(reader, rdb.WithFilter(rdb.FuncFilter{
+//	    OnString: func(s *rdb.String) { fmt.Println(s.Key.Key, s.Value) },
+//	}))
+type FuncFilter struct {
+	OnKey      func(key Key) bool
+	OnType     func(typ Type) bool
+	OnDatabase func(db DB) bool
+
+	OnSet       func(s *Set)
+	OnList      func(l *List)
+	OnHash      func(h *Hash)
+	OnString    func(s *String)
+	OnSortedSet func(s *SortedSet)
+}
+
+// Key calls OnKey.
+func (f FuncFilter) Key(key Key) bool {
+	return f.OnKey != nil && f.OnKey(key)
+}
+
+// Type calls OnType.
+func (f FuncFilter) Type(typ Type) bool {
+	return f.OnType != nil && f.OnType(typ)
+}
+
+// Database calls OnDatabase.
+func (f FuncFilter) Database(db DB) bool {
+	return f.OnDatabase != nil && f.OnDatabase(db)
+}
+
+// Set calls OnSet.
+func (f FuncFilter) Set(s *Set) {
+	if f.OnSet != nil {
+		f.OnSet(s)
+	}
+}
+
+// List calls OnList.
+func (f FuncFilter) List(l *List) {
+	if f.OnList != nil {
+		f.OnList(l)
+	}
+}
+
+// Hash calls OnHash.
+func (f FuncFilter) Hash(h *Hash) {
+	if f.OnHash != nil {
+		f.OnHash(h)
+	}
+}
+
+// String calls OnString.
+func (f FuncFilter) String(s *String) {
+	if f.OnString != nil {
+		f.OnString(s)
+	}
+}
+
+// SortedSet calls OnSortedSet.
+func (f FuncFilter) SortedSet(s *SortedSet) {
+	if f.OnSortedSet != nil {
+		f.OnSortedSet(s)
+	}
+}
+
+// skipEverything is the strategy of SkipAll with all its effects, so that strategies can be intersected.
+const skipEverything = SkipMeta | SkipExpiry | SkipValue | SkipAll
+
+// chain is a Filter calling several filters.
+type chain struct {
+	filters []Filter
+	done    []int32 // whether a filter aborted, it's read by filter workers
+}
+
+// ChainFilters returns a Filter which calls filters in order, e.g. to compute several reports in one parse.
+//
+// A record is skipped as far as all the filters skip it, so a filter may be given values it skipped,
+// the value callbacks of combinators such as TypeOnly and PatternOnly check them again.
+// The parse aborts once all the filters aborted, filters which aborted aren't called anymore.
+// End is called on filters which are Enders.
+func ChainFilters(filters ...Filter) Filter {
+	c := &chain{filters: filters, done: make([]int32, len(filters))}
+	return withEnder(c, filters...)
+}
+
+// call calls fn on each filter which hasn't aborted and intersects the strategies they set with p, if any.
+// It reports whether all the filters aborted.
+func (c *chain) call(p *Parser, fn func(f Filter) bool) bool {
+	if p == nil {
+		p = new(Parser)
+	}
+	global, running := p.strategy.global, p.strategy.running
+	skipGlobal, skipRunning := skipEverything, skipEverything
+	active, aborted := 0, 0
+	for i, f := range c.filters {
+		if _, ok := f.(passive); !ok {
+			active++
+		}
+		if atomic.LoadInt32(&c.done[i]) != 0 {
+			aborted++
+			continue
+		}
+		p.strategy.global, p.strategy.running = global, running
+		if fn(f) {
+			atomic.StoreInt32(&c.done[i], 1)
+			aborted++
+			continue
+		}
+		skipGlobal &= everything(p.strategy.global)
+		skipRunning &= everything(p.strategy.running)
+	}
+	p.strategy.global, p.strategy.running = skipGlobal, skipRunning
+	return active > 0 && aborted == active
+}
+
+// passive is implemented by filters which never abort, chains abort once their other filters did.
+type passive interface {
+	passive()
+}
+
+// everything returns strategy with all the effects of SkipAll if it's set.
+func everything(strategy int) int {
+	if strategy&SkipAll != 0 {
+		return skipEverything
+	}
+	return strategy
+}
+
+func (c *chain) Key(key Key) bool {
+	return c.call(key.p, func(f Filter) bool { return f.Key(key) })
+}
+
+func (c *chain) Type(typ Type) bool {
+	return c.call(typ.p, func(f Filter) bool { return f.Type(typ) })
+}
+
+func (c *chain) Database(db DB) bool {
+	return c.call(db.p, func(f Filter) bool { return f.Database(db) })
+}
+
+// each calls fn on each filter which hasn't aborted.
+func (c *chain) each(fn func(f Filter)) {
+	for i, f := range c.filters {
+		if atomic.LoadInt32(&c.done[i]) == 0 {
+			fn(f)
+		}
+	}
+}
+
+func (c *chain) Set(s *Set)             { c.each(func(f Filter) { f.Set(s) }) }
+func (c *chain) List(l *List)           { c.each(func(f Filter) { f.List(l) }) }
+func (c *chain) Hash(h *Hash)           { c.each(func(f Filter) { f.Hash(h) }) }
+func (c *chain) String(s *String)       { c.each(func(f Filter) { f.String(s) }) }
+func (c *chain) SortedSet(s *SortedSet) { c.each(func(f Filter) { f.SortedSet(s) }) }
+
+// only is a Filter which passes the keys matched by match to filter only.
+type only struct {
+	filter Filter
+	match  func(key Key) bool
+}
+
+// TypeOnly returns a Filter which passes the keys of type typ, e.g. TypeHash, to filter, other keys are skipped.
+func TypeOnly(typ ValueType, filter Filter) Filter {
+	return withEnder(only{filter, func(key Key) bool { return Encoding2Type(key.Encoding) == typ }}, filter)
+}
+
+// WithTypes returns a ParseOption which only passes the keys of types, e.g. TypeHash, to the filter,
+// other keys are skipped without decoding their values.
+func WithTypes(types ...ValueType) ParseOption {
+	return func(p *Parser) {
+		p.types = make(map[ValueType]bool, len(types))
+		for _, typ := range types {
+			p.types[typ] = true
+		}
+	}
+}
+
+// PatternOnly returns a Filter which passes the keys matching pattern to filter, other keys are skipped.
+func PatternOnly(pattern *regexp.Regexp, filter Filter) Filter {
+	return withEnder(only{filter, func(key Key) bool { return pattern.MatchString(key.Key) }}, filter)
+}
+
+func (o only) Type(typ Type) bool {
+	// the key name isn't known yet
+	return o.filter.Type(typ)
+}
+
+func (o only) Key(key Key) bool {
+	if !o.match(key) {
+		key.Skip(SkipAll)
+		return false
+	}
+	return o.filter.Key(key)
+}
+
+func (o only) Database(db DB) bool {
+	return o.filter.Database(db)
+}
+
+func (o only) Set(s *Set) {
+	if o.match(s.Key) {
+		o.filter.Set(s)
+	}
+}
+
+func (o only) List(l *List) {
+	if o.match(l.Key) {
+		o.filter.List(l)
+	}
+}
+
+func (o only) Hash(h *Hash) {
+	if o.match(h.Key) {
+		o.filter.Hash(h)
+	}
+}
+
+func (o only) String(s *String) {
+	if o.match(s.Key) {
+		o.filter.String(s)
+	}
+}
+
+func (o only) SortedSet(s *SortedSet) {
+	if o.match(s.Key) {
+		o.filter.SortedSet(s)
+	}
+}
+
+// ender is a Filter combining filters, some of which are Enders.
+type ender struct {
+	Filter
+
+	filters []Filter
+}
+
+// withEnder returns filter, which combines filters, as an Ender if some of them are.
+func withEnder(filter Filter, filters ...Filter) Filter {
+	for _, f := range filters {
+		if _, ok := f.(Ender); ok {
+			return ender{filter, filters}
+		}
+	}
+	return filter
+}
+
+// End calls End on filters which are Enders.
+func (e ender) End(checksum uint64, ok bool) {
+	for _, f := range e.filters {
+		if f, isEnder := f.(Ender); isEnder {
+			f.End(checksum, ok)
+		}
+	}
+}
+
+// subscriptions is a Filter calling the functions subscribed by OnType.
+type subscriptions struct {
+	p *Parser
+
+	sets       []func(*Set) error
+	lists      []func(*List) error
+	hashes     []func(*Hash) error
+	strings    []func(*String) error
+	sortedsets []func(*SortedSet) error
+}
+
+func (s *subscriptions) add(fn interface{}) {
+	switch fn := fn.(type) {
+	case func(*Set) error:
+		s.sets = append(s.sets, fn)
+	case func(*List) error:
+		s.lists = append(s.lists, fn)
+	case func(*Hash) error:
+		s.hashes = append(s.hashes, fn)
+	case func(*String) error:
+		s.strings = append(s.strings, fn)
+	case func(*SortedSet) error:
+		s.sortedsets = append(s.sortedsets, fn)
+	}
+}
+
+func (s *subscriptions) passive()            {}
+func (s *subscriptions) Key(key Key) bool    { return false }
+func (s *subscriptions) Database(db DB) bool { return false }
+
+// Type skips the keys of types without subscribers.
+func (s *subscriptions) Type(typ Type) bool {
+	var n int
+	switch Encoding2Type(typ.Encoding) {
+	case TypeSet:
+		n = len(s.sets)
+	case TypeList:
+		n = len(s.lists)
+	case TypeHash:
+		n = len(s.hashes)
+	case TypeString:
+		n = len(s.strings)
+	case TypeSortedSet:
+		n = len(s.sortedsets)
+	}
+	if n == 0 {
+		typ.Skip(SkipAll)
+	}
+	return false
+}
+
+// The subscribers of a value are called until one of them fails the parse.
+
+func (s *subscriptions) Set(v *Set) {
+	for _, fn := range s.sets {
+		if err := fn(v); err != nil {
+			s.p.close(err)
+			return
+		}
+	}
+}
+
+func (s *subscriptions) List(v *List) {
+	for _, fn := range s.lists {
+		if err := fn(v); err != nil {
+			s.p.close(err)
+			return
+		}
+	}
+}
+
+func (s *subscriptions) Hash(v *Hash) {
+	for _, fn := range s.hashes {
+		if err := fn(v); err != nil {
+			s.p.close(err)
+			return
+		}
+	}
+}
+
+func (s *subscriptions) String(v *String) {
+	for _, fn := range s.strings {
+		if err := fn(v); err != nil {
+			s.p.close(err)
+			return
+		}
+	}
+}
+
+func (s *subscriptions) SortedSet(v *SortedSet) {
+	for _, fn := range s.sortedsets {
+		if err := fn(v); err != nil {
+			s.p.close(err)
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package rdb
+
+import (
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestFuncFilter(t *testing.T) {
+	r, err := NewMemReader("testdata/dumps/parser_filters.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		strings int
+		hashes  int
+	)
+	f := FuncFilter{
+		OnString: func(s *String) {
+			mu.Lock()
+			strings++
+			mu.Unlock()
+		},
+		OnHash: func(h *Hash) {
+			mu.Lock()
+			hashes++
+			mu.Unlock()
+		},
+	}
+	if err := Parse(r, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	if strings != 18 || hashes != 3 {
+		t.Fatalf("want: 18 strings and 3 hashes, got: %v and %v", strings, hashes)
+	}
+
+	// aborts once the first key is read
+	r, err = NewMemReader("testdata/dumps/parser_filters.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := 0
+	f = FuncFilter{OnKey: func(key Key) bool { keys++; return true }}
+	if err := Parse(r, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	if keys != 1 {
+		t.Fatalf("want: 1 key, got: %v", keys)
+	}
+}
+
+// countFilter counts the values passed to it per type.
+type countFilter struct {
+	testEmptyFilter
+
+	got map[ValueType]int
+}
+
+func (f *countFilter) add(key Key) {
+	f.Lock()
+	defer f.Unlock()
+	f.got[Encoding2Type(key.Encoding)]++
+}
+
+func (f *countFilter) Set(s *Set)             { f.add(s.Key) }
+func (f *countFilter) List(l *List)           { f.add(l.Key) }
+func (f *countFilter) Hash(h *Hash)           { f.add(h.Key) }
+func (f *countFilter) String(s *String)       { f.add(s.Key) }
+func (f *countFilter) SortedSet(s *SortedSet) { f.add(s.Key) }
+
+func TestChainFilters(t *testing.T) {
+	parse := func(f Filter) {
+		r, err := NewMemReader("testdata/dumps/parser_filters.rdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Parse(r, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		hashes  = &countFilter{got: make(map[ValueType]int)}
+		sets    = &countFilter{got: make(map[ValueType]int)}
+		all     = &countFilter{got: make(map[ValueType]int)}
+		aborted = 0
+		abort   = FuncFilter{OnKey: func(Key) bool { aborted++; return true }}
+	)
+	parse(ChainFilters(abort, TypeOnly(TypeHash, hashes), PatternOnly(regexp.MustCompile("^set"), sets), all))
+
+	if aborted != 1 {
+		t.Fatalf("want: 1 key before aborting, got: %v", aborted)
+	}
+	want := map[ValueType]int{TypeHash: 3}
+	if !reflect.DeepEqual(hashes.got, want) {
+		t.Fatalf("want: %v, got: %v", want, hashes.got)
+	}
+	want = map[ValueType]int{TypeSet: 6}
+	if !reflect.DeepEqual(sets.got, want) {
+		t.Fatalf("want: %v, got: %v", want, sets.got)
+	}
+	want = map[ValueType]int{TypeString: 18, TypeHash: 3, TypeSet: 6, TypeList: 12, TypeSortedSet: 4}
+	if !reflect.DeepEqual(all.got, want) {
+		t.Fatalf("want: %v, got: %v", want, all.got)
+	}
+
+	// keys skipped by all the filters aren't decoded
+	r, err := NewMemReader("testdata/dumps/parser_filters.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewTopKeys(100, ByDuration)
+	f := ChainFilters(TypeOnly(TypeHash, FuncFilter{}), TypeOnly(TypeSet, FuncFilter{}))
+	if err := Parse(r, WithFilter(f), WithStrategy(SkipMeta), WithDecodeTiming(decoded)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(decoded.Keys()); n != 9 {
+		t.Fatalf("want: 9 keys decoded, got: %v", n)
+	}
+}
+
+func TestWithTypes(t *testing.T) {
+	r, err := NewMemReader("testdata/dumps/parser_filters.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &countFilter{got: make(map[ValueType]int)}
+	decoded := NewTopKeys(100, ByDuration)
+	if err := Parse(r, WithFilter(f), WithTypes(TypeHash, TypeSet), WithStrategy(SkipMeta), WithDecodeTiming(decoded)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[ValueType]int{TypeHash: 3, TypeSet: 6}
+	if !reflect.DeepEqual(f.got, want) || len(decoded.Keys()) != 9 {
+		t.Fatalf("want: %v, got: %v, %v keys decoded", want, f.got, len(decoded.Keys()))
+	}
+
+	for _, s := range []string{"hash", "ZSet", "sortedset"} {
+		if _, err := ParseValueType(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if typ, err := ParseValueType("zset"); typ != TypeSortedSet || err != nil {
+		t.Fatalf("want: sortedset, got: %v, %v", typ, err)
+	}
+	if _, err := ParseValueType("bitmap"); err == nil {
+		t.Fatal("want: an error for an invalid type")
+	}
+}
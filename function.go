@@ -0,0 +1,78 @@
+package rdb
+
+import (
+	"strings"
+)
+
+// Library is a library of redis functions, saved by redis 7 and later in rdb files of version 10 or later.
+type Library struct {
+	Name   string // name of the library, from the shebang line of Code
+	Engine string // engine running the library, e.g. LUA, from the shebang line of Code
+	Code   string // source code of the library, as given to FUNCTION LOAD
+}
+
+// A LibraryFilter is a Filter which is given the function libraries of the rdb file.
+// Functions is called by the parser's goroutine, before the keys following the library are parsed.
+type LibraryFilter interface {
+	Functions(lib Library)
+}
+
+// newLibrary returns the library of code, whose first line is a shebang such as "#!lua name=mylib".
+func newLibrary(code string) Library {
+	lib := Library{Code: code}
+	line := code
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return lib
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return lib
+	}
+	lib.Engine = strings.ToUpper(fields[0])
+	for _, f := range fields[1:] {
+		if strings.HasPrefix(f, "name=") {
+			lib.Name = f[len("name="):]
+		}
+	}
+	return lib
+}
+
+// functions reads the library following a FUNCTION2 opcode and passes it to the filter, if it's a LibraryFilter.
+func (p *Parser) functions() error {
+	f, ok := p.filter.(LibraryFilter)
+	if !ok {
+		return p.skipString()
+	}
+	code, err := p.readRawString(false)
+	if err != nil {
+		return err
+	}
+	f.Functions(newLibrary(code))
+	return nil
+}
+
+// Functions calls Functions on filters which are LibraryFilters.
+func (c *chain) Functions(lib Library) {
+	c.each(func(f Filter) {
+		if f, ok := f.(LibraryFilter); ok {
+			f.Functions(lib)
+		}
+	})
+}
+
+// Functions calls Functions on filter if it's a LibraryFilter.
+func (o only) Functions(lib Library) {
+	if f, ok := o.filter.(LibraryFilter); ok {
+		f.Functions(lib)
+	}
+}
+
+// Functions calls Functions on the combined filter if it's a LibraryFilter.
+func (e ender) Functions(lib Library) {
+	if f, ok := e.Filter.(LibraryFilter); ok {
+		f.Functions(lib)
+	}
+}
@@ -0,0 +1,71 @@
+package rdb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type libraryFilter struct {
+	FuncFilter
+	libs []Library
+}
+
+func (f *libraryFilter) Functions(lib Library) {
+	f.libs = append(f.libs, lib)
+}
+
+func TestFunctions(t *testing.T) {
+	const code = "#!lua name=mylib\nredis.register_function('f', function() return 1 end)"
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeByte(TokenFunction2)
+	e.writeString(code)
+	e.String(&String{Key: Key{Key: "k", Expiry: -1}, Value: "v"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	copy(b[5:], "0010")
+
+	want := []Library{{Name: "mylib", Engine: "LUA", Code: code}}
+	for _, chained := range []bool{false, true} {
+		keys := 0
+		f := &libraryFilter{FuncFilter: FuncFilter{OnKey: func(Key) bool { keys++; return false }}}
+		var filter Filter = f
+		if chained {
+			filter = ChainFilters(FuncFilter{}, TypeOnly(TypeString, f))
+		}
+		if err := Parse(&MemReader{b: b}, WithFilter(filter), WithStrategy(SkipMeta)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f.libs, want) || keys != 1 {
+			t.Fatalf("want: %+v and 1 key, got: %+v and %v keys", want, f.libs, keys)
+		}
+	}
+
+	// libraries are skipped by filters which aren't LibraryFilters
+	n := 0
+	f := FuncFilter{OnString: func(*String) { n++ }}
+	if err := Parse(&MemReader{b: b}, WithFilter(f), WithStrategy(SkipMeta)); err != nil || n != 1 {
+		t.Fatalf("want: 1 string, got: %v, %v", n, err)
+	}
+}
+
+func TestNewLibrary(t *testing.T) {
+	tests := []struct {
+		code string
+		want Library
+	}{
+		{"#!lua name=lib\nreturn", Library{Name: "lib", Engine: "LUA"}},
+		{"#!lua   name=lib other=1", Library{Name: "lib", Engine: "LUA"}},
+		{"return 1", Library{}},
+		{"#!", Library{}},
+	}
+	for i, test := range tests {
+		test.want.Code = test.code
+		if got := newLibrary(test.code); got != test.want {
+			t.Fatalf("index: %v, want: %+v, got: %+v", i, test.want, got)
+		}
+	}
+}
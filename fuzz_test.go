@@ -0,0 +1,64 @@
+//go:build go1.18
+// +build go1.18
+
+package rdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func FuzzParse(f *testing.F) {
+	files, err := filepath.Glob("testdata/dumps/*.rdb")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	var buf bytes.Buffer
+	if err := generate(&buf, shape{Seed: 1, Keys: 16, Elements: 4, ValueSize: 8, Expiry: 0.5, Compact: true}); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		Parse(&MemReader{b: data}, WithFilter(&testEmptyFilter{}), WithStrategy(SkipMeta))
+		Parse(NewStreamReader(bytes.NewReader(data), 0), WithFilter(&testEmptyFilter{}), WithStrategy(SkipMeta))
+	})
+}
+
+func FuzzZiplist(f *testing.F) {
+	f.Add(ziplist([]string{"a", "1000", "-100000", "1099511627776", string(make([]byte, 300))}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		(&value{b: data}).readZiplist(nil)
+	})
+}
+
+func FuzzZipmap(f *testing.F) {
+	f.Add([]byte("\x02\x03foo\x03\x00bar\x05hello\x05\x02world!!\xff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		(&value{b: data}).readZipmap(nil)
+	})
+}
+
+func FuzzLZF(f *testing.F) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 8; i++ {
+		buf, ulen := lzfStream(r, 1+r.Intn(1000))
+		f.Add(buf, ulen)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, ulen int) {
+		out, err := readLZF(data, len(data), ulen, nil)
+		if err == nil && len(out) > ulen {
+			t.Fatalf("got %v bytes, want at most %v", len(out), ulen)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+var (
+	generateFile = flag.String("generate", "", "write a generated rdb file of -generate.keys keys")
+	generateKeys = flag.Int("generate.keys", 100000, "number of keys of the generated rdb file")
+)
+
+// shape describes a generated rdb file.
+type shape struct {
+	Seed      int64
+	Keys      int     // number of keys, their types are rotated
+	DBs       int     // number of databases the keys are spread over
+	Elements  int     // elements of each collection
+	ValueSize int     // bytes of each string and element
+	Expiry    float64 // fraction of keys with an expiry
+	Compact   bool    // whether compact encodings are also written: ziplists, quicklists and intsets
+}
+
+// generate writes a rdb file of shape sh to w.
+func generate(w *bytes.Buffer, sh shape) error {
+	r := rand.New(rand.NewSource(sh.Seed))
+	e := NewEncoder(w)
+	types := 5
+	if sh.Compact {
+		types = 8
+	}
+	if sh.DBs < 1 {
+		sh.DBs = 1
+	}
+	value := func() string {
+		b := make([]byte, sh.ValueSize)
+		for i := range b {
+			b[i] = 'a' + byte(r.Intn(26))
+		}
+		return string(b)
+	}
+	elements := func() []string {
+		values := make([]string, sh.Elements)
+		for i := range values {
+			values[i] = strconv.Itoa(i) + ":" + value()
+		}
+		return values
+	}
+
+	for i := 0; i < sh.Keys; i++ {
+		key := Key{DB: i * sh.DBs / sh.Keys, Expiry: -1, Key: "key:" + strconv.Itoa(i)}
+		if r.Float64() < sh.Expiry {
+			key.Expiry = 1500000000000 + r.Intn(1e9)
+		}
+		var err error
+		switch i % types {
+		case 0:
+			err = e.String(&String{Key: key, Value: value()})
+		case 1:
+			err = e.List(&List{Key: key, Values: elements()})
+		case 2:
+			set := &Set{Key: key, Values: make(map[interface{}]struct{})}
+			for _, v := range elements() {
+				set.Values[v] = struct{}{}
+			}
+			err = e.Set(set)
+		case 3:
+			hash := &Hash{Key: key, Values: make(map[string]string)}
+			for _, v := range elements() {
+				hash.Values[v] = value()
+			}
+			err = e.Hash(hash)
+		case 4:
+			ss := &SortedSet{Key: key, Values: make(map[string]float64)}
+			for _, v := range elements() {
+				ss.Values[v] = r.NormFloat64()
+			}
+			err = e.SortedSet(ss)
+		case 5:
+			fields := elements()
+			values := make([]string, 0, 2*len(fields))
+			for _, f := range fields {
+				values = append(values, f, value())
+			}
+			err = e.raw(key, EncodingHashZip, ziplist(values))
+		case 6:
+			values := elements()
+			var nodes [][]byte
+			for j := 0; j < len(values); j += 128 {
+				end := j + 128
+				if end > len(values) {
+					end = len(values)
+				}
+				nodes = append(nodes, ziplist(values[j:end]))
+			}
+			err = e.raw(key, EncodingQuicklist, nodes...)
+		case 7:
+			values := make([]int64, sh.Elements)
+			for j := range values {
+				values[j] = r.Int63n(1 << 20)
+			}
+			err = e.raw(key, EncodingIntset, intset(values))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// raw writes key with a value already in encoding, a quicklist is written as its ziplists.
+func (e *Encoder) raw(key Key, encoding Encoding, values ...[]byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.writeKey(key, encoding)
+	if encoding == EncodingQuicklist {
+		e.writeLength(len(values))
+	}
+	for _, v := range values {
+		e.writeString(string(v))
+	}
+	return e.err
+}
+
+// ziplist returns the ziplist of values, integers are encoded as such.
+func ziplist(values []string) []byte {
+	b := make([]byte, 10, 11+len(values)*8)
+	prev, tail := 0, 10
+	for _, v := range values {
+		tail = len(b)
+		if prev < 254 {
+			b = append(b, byte(prev))
+		} else {
+			b = append(b, 0xfe, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(prev))
+		}
+		i, err := strconv.ParseInt(v, 10, 64)
+		switch {
+		case err == nil && int64(int16(i)) == i:
+			b = append(b, 0xc0, 0, 0)
+			binary.LittleEndian.PutUint16(b[len(b)-2:], uint16(i))
+		case err == nil && int64(int32(i)) == i:
+			b = append(b, 0xd0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(i))
+		case err == nil:
+			b = append(b, 0xe0, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint64(b[len(b)-8:], uint64(i))
+		case len(v) < 1<<6:
+			b = append(b, byte(len(v)))
+			b = append(b, v...)
+		case len(v) < 1<<14:
+			b = append(b, byte(len(v)>>8)|0x40, byte(len(v)))
+			b = append(b, v...)
+		default:
+			b = append(b, 0x80, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(b[len(b)-4:], uint32(len(v)))
+			b = append(b, v...)
+		}
+		prev = len(b) - tail
+	}
+	b = append(b, 0xff)
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(b)))
+	binary.LittleEndian.PutUint32(b[4:], uint32(tail))
+	if len(values) < 65535 {
+		binary.LittleEndian.PutUint16(b[8:], uint16(len(values)))
+	} else {
+		binary.LittleEndian.PutUint16(b[8:], 65535)
+	}
+	return b
+}
+
+// zipmap returns the zipmap of fields and values, which are shorter than 254 bytes.
+func zipmap(values []string) []byte {
+	n := len(values) / 2
+	if n > 254 {
+		n = 254
+	}
+	b := []byte{byte(n)}
+	for i, v := range values {
+		b = append(b, byte(len(v)))
+		if i%2 == 1 {
+			// free bytes
+			b = append(b, 0)
+		}
+		b = append(b, v...)
+	}
+	return append(b, 0xff)
+}
+
+// intset returns the intset of values with the smallest encoding that fits them.
+func intset(values []int64) []byte {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	size := 2
+	for _, v := range sorted {
+		if int64(int32(v)) != v {
+			size = 8
+		} else if int64(int16(v)) != v && size < 4 {
+			size = 4
+		}
+	}
+	b := make([]byte, 8+size*len(sorted))
+	binary.LittleEndian.PutUint32(b[0:], uint32(size))
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(sorted)))
+	for i, v := range sorted {
+		switch size {
+		case 2:
+			binary.LittleEndian.PutUint16(b[8+i*2:], uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(b[8+i*4:], uint32(v))
+		case 8:
+			binary.LittleEndian.PutUint64(b[8+i*8:], uint64(v))
+		}
+	}
+	return b
+}
+
+type encodingCountFilter struct {
+	testEmptyFilter
+
+	mu        sync.Mutex
+	encodings map[Encoding]int
+	elements  int
+}
+
+func (f *encodingCountFilter) count(key Key, elements int) {
+	f.mu.Lock()
+	f.encodings[key.Encoding]++
+	f.elements += elements
+	f.mu.Unlock()
+}
+
+func (f *encodingCountFilter) String(s *String)       { f.count(s.Key, 1) }
+func (f *encodingCountFilter) List(l *List)           { f.count(l.Key, len(l.Values)) }
+func (f *encodingCountFilter) Set(s *Set)             { f.count(s.Key, len(s.Values)) }
+func (f *encodingCountFilter) Hash(h *Hash)           { f.count(h.Key, len(h.Values)) }
+func (f *encodingCountFilter) SortedSet(s *SortedSet) { f.count(s.Key, len(s.Values)) }
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	sh := shape{Seed: 1, Keys: 800, DBs: 3, Elements: 300, ValueSize: 16, Expiry: 0.5, Compact: true}
+	if err := generate(&buf, sh); err != nil {
+		t.Fatal(err)
+	}
+	f := &encodingCountFilter{encodings: make(map[Encoding]int)}
+	if err := Parse(NewStreamReader(&buf, 0), WithFilter(f)); err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range []Encoding{EncodingString, EncodingList, EncodingSet, EncodingHash,
+		EncodingSortedSet2, EncodingHashZip, EncodingQuicklist, EncodingIntset} {
+		if got := f.encodings[encoding]; got != sh.Keys/8 {
+			t.Fatalf("%v: got %v keys, want %v", encoding, got, sh.Keys/8)
+		}
+	}
+	// intsets may have fewer elements, their values are random
+	if min, max := sh.Keys/8*(1+6*sh.Elements), sh.Keys/8*(1+7*sh.Elements); f.elements < min || f.elements > max {
+		t.Fatalf("got %v elements, want between %v and %v", f.elements, min, max)
+	}
+
+	if *generateFile != "" {
+		buf.Reset()
+		sh = shape{Seed: 1, Keys: *generateKeys, DBs: 4, Elements: 64, ValueSize: 32, Expiry: 0.2, Compact: true}
+		if err := generate(&buf, sh); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(*generateFile, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func benchmarkValue(b *testing.B, v *value, read func(*value, *scratch) error) {
+	s := &scratch{buffers: true, containers: true}
+	b.SetBytes(int64(len(v.b)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.reset()
+		if err := read(v, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadZiplist(b *testing.B) {
+	values := make([]string, 512)
+	for i := range values {
+		if i%2 == 0 {
+			values[i] = strconv.Itoa(i * 1000)
+		} else {
+			values[i] = "value:" + strconv.Itoa(i)
+		}
+	}
+	benchmarkValue(b, &value{b: ziplist(values)}, func(v *value, s *scratch) error {
+		_, err := v.readZiplist(s)
+		return err
+	})
+}
+
+func BenchmarkReadIntset(b *testing.B) {
+	values := make([]int64, 512)
+	for i := range values {
+		values[i] = int64(i) * 100
+	}
+	benchmarkValue(b, &value{b: intset(values)}, func(v *value, s *scratch) error {
+		_, err := v.readIntset(s)
+		return err
+	})
+}
@@ -0,0 +1,95 @@
+package rdb
+
+import (
+	"fmt"
+)
+
+// EncodingError is returned when the value of a key has an encoding which isn't parsed, e.g. one written
+// by a newer redis.
+type EncodingError struct {
+	Key      string
+	Encoding Encoding
+	Offset   int64 // offset of the value type in the rdb file, if it's tracked, see Parser.Offset
+}
+
+func (e *EncodingError) Error() string {
+	if !e.Encoding.IsValid() {
+		return fmt.Sprintf("Unknown encoding %d of key %q at offset %d, the rdb file may be written by a newer redis",
+			byte(e.Encoding), e.Key, e.Offset)
+	}
+	return fmt.Sprintf("Unsupported encoding %d (%s %s) of key %q at offset %d",
+		byte(e.Encoding), e.Encoding.Type(), e.Encoding, e.Key, e.Offset)
+}
+
+// readHashMetadata reads a hash whose fields may expire, saved by redis 7.4 and later. Every field and value
+// follows the expiry of the field, 0 if it has none, which is relative to the minimum one of the hash
+// for EncodingHashMetadata. The values are returned as triplets of field, value and expiry.
+func (p *Parser) readHashMetadata(encoding Encoding) ([]*value, error) {
+	var min int
+	if encoding == EncodingHashMetadata {
+		var err error
+		if min, err = p.little64(); err != nil {
+			return nil, err
+		}
+	}
+	size, _, err := p.readLength(false)
+	if err != nil {
+		return nil, err
+	}
+	values := newValues(size * 3)
+	for i := 0; i < size; i++ {
+		ttl, _, err := p.readLength(false)
+		if err != nil {
+			return nil, err
+		}
+		expiry := -1
+		if ttl != 0 {
+			expiry = ttl
+			if encoding == EncodingHashMetadata {
+				expiry += min - 1
+			}
+		}
+		field, err := p.readValue(true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.readValue(true)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, field, value, newExpiryValue(expiry))
+	}
+	return values, nil
+}
+
+// skipHashMetadata skips a hash whose encoding is EncodingHashMetadata or EncodingHashMetadataPreGA.
+func (p *Parser) skipHashMetadata(encoding Encoding) error {
+	if encoding == EncodingHashMetadata {
+		p.Discard(8)
+	}
+	size, _, err := p.readLength(false)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < size; i++ {
+		if _, _, err := p.readLength(false); err != nil {
+			return err
+		}
+		if err := p.skipString(); err != nil {
+			return err
+		}
+		if err := p.skipString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipHashListpackEx skips a hash whose encoding is EncodingHashListpackEx or EncodingHashListpackPreGA:
+// a listpack of fields, values and expiries, preceded by the minimum expiry for EncodingHashListpackEx.
+func (p *Parser) skipHashListpackEx(encoding Encoding) error {
+	if encoding == EncodingHashListpackEx {
+		p.Discard(8)
+	}
+	return p.skipString()
+}
@@ -0,0 +1,103 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestHashMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeKey(Key{Key: "h", Expiry: -1}, EncodingHashMetadata)
+	min := make([]byte, 8)
+	binary.LittleEndian.PutUint64(min, 1700000000000)
+	e.write(min)
+	e.writeLength(2)
+	e.writeLength(0)
+	e.writeString("a")
+	e.writeString("1")
+	e.writeLength(501)
+	e.writeString("b")
+	e.writeString("2")
+	e.writeKey(Key{Key: "pre", Expiry: -1}, EncodingHashMetadataPreGA)
+	e.writeLength(1)
+	e.writeLength(1700000000000)
+	e.writeString("c")
+	e.writeString("3")
+	e.writeKey(Key{Key: "lp", Expiry: -1}, EncodingHashListpackEx)
+	e.write(min)
+	e.writeString("listpack")
+	e.String(&String{Key: Key{Key: "s", Expiry: -1}, Value: "v"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	copy(b[5:], "0012")
+
+	type hash struct {
+		values   map[string]string
+		expiries map[string]int
+	}
+	var keys []string
+	hashes := make(map[string]hash)
+	f := FuncFilter{
+		OnKey: func(key Key) bool { keys = append(keys, key.Key); return false },
+		OnHash: func(h *Hash) {
+			hv := hash{values: make(map[string]string), expiries: make(map[string]int)}
+			for k, v := range h.Values {
+				hv.values[k] = v
+			}
+			for k, v := range h.Expiries {
+				hv.expiries[k] = v
+			}
+			hashes[h.Key.Key] = hv
+		},
+	}
+	if err := Parse(&MemReader{b: b}, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]hash{
+		"h":   {values: map[string]string{"a": "1", "b": "2"}, expiries: map[string]int{"b": 1700000000500}},
+		"pre": {values: map[string]string{"c": "3"}, expiries: map[string]int{"c": 1700000000000}},
+	}
+	if !reflect.DeepEqual(hashes, want) || len(keys) != 4 {
+		t.Fatalf("want: %+v and 4 keys, got: %+v and keys %v", want, hashes, keys)
+	}
+
+	s, err := ScanSkeleton(&MemReader{b: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 4 || s.Entries[3].Key != "s" {
+		t.Fatalf("want: 4 entries, got: %+v", s.Entries)
+	}
+}
+
+func TestEncodingError(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "s", Expiry: -1}, Value: "v"})
+	e.writeKey(Key{Key: "new", Expiry: -1}, Encoding(30))
+	e.writeString("value")
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	copy(b[5:], "0012")
+
+	for _, strategy := range []int{SkipMeta, SkipValue} {
+		err := Parse(&MemReader{b: b}, WithFilter(FuncFilter{}), WithStrategy(strategy))
+		ee, ok := errors.Cause(err).(*EncodingError)
+		if !ok || ee.Key != "new" || ee.Encoding != 30 {
+			t.Fatalf("strategy %v: want: an EncodingError of key new, got: %v", strategy, err)
+		}
+	}
+	_, err := ScanSkeleton(&MemReader{b: b})
+	if ee, ok := errors.Cause(err).(*EncodingError); !ok || ee.Key != "new" {
+		t.Fatalf("skeleton: want: an EncodingError of key new, got: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package rdb
+
+import (
+	"strconv"
+)
+
+// A HeaderFilter is a Filter which is given the header of the rdb file before the first key: its version and
+// AUX fields, such as redis-ver, redis-bits or used-mem.
+// Header is called by the parser's goroutine, aux is empty for rdb files before version 7.
+// ParseSegments calls it on the filter of every segment, before the keys of the segment,
+// and ParseDatabases once on the filter shared by all databases, before any key.
+type HeaderFilter interface {
+	Header(version int, aux map[string]string)
+}
+
+// header calls Header on the filter once, if it's a HeaderFilter.
+func (p *Parser) header() {
+	if !p.pendingHeader {
+		return
+	}
+	p.pendingHeader = false
+	f, ok := p.filter.(HeaderFilter)
+	if !ok {
+		return
+	}
+	version, _ := strconv.Atoi(p.version)
+	aux := p.aux
+	if aux == nil {
+		aux = make(map[string]string)
+	}
+	p.aux = nil
+	f.Header(version, aux)
+}
+
+// Header calls Header on filters which are HeaderFilters.
+func (c *chain) Header(version int, aux map[string]string) {
+	c.each(func(f Filter) {
+		if f, ok := f.(HeaderFilter); ok {
+			f.Header(version, aux)
+		}
+	})
+}
+
+// Header calls Header on filter if it's a HeaderFilter.
+func (o only) Header(version int, aux map[string]string) {
+	if f, ok := o.filter.(HeaderFilter); ok {
+		f.Header(version, aux)
+	}
+}
+
+// Header calls Header on the combined filter if it's a HeaderFilter.
+func (e ender) Header(version int, aux map[string]string) {
+	if f, ok := e.Filter.(HeaderFilter); ok {
+		f.Header(version, aux)
+	}
+}
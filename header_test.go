@@ -0,0 +1,86 @@
+package rdb
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+type headerFilter struct {
+	FuncFilter
+	mu      sync.Mutex // ParseDatabases shares the filter across databases
+	version int
+	aux     map[string]string
+	headers int
+	keys    int
+	before  int // keys parsed before the header
+}
+
+func (f *headerFilter) Header(version int, aux map[string]string) {
+	f.mu.Lock()
+	f.version, f.aux = version, aux
+	f.headers++
+	f.mu.Unlock()
+}
+
+func TestHeader(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for _, kv := range [][2]string{{"redis-ver", "7.2.4"}, {"redis-bits", "64"}} {
+		e.writeByte(TokenAUX)
+		e.writeString(kv[0])
+		e.writeString(kv[1])
+	}
+	for i := 0; i < 100; i++ {
+		e.String(&String{Key: Key{Key: string(rune('a' + i%26)), DB: i / 50, Expiry: -1}, Value: "v"})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every segment of ParseSegments has its own filter, the keys are summed across them,
+	// while the databases of ParseDatabases share one
+	parse := func(parse func(newFilter func() Filter) error) {
+		var filters []*headerFilter
+		newFilter := func() Filter {
+			f := &headerFilter{}
+			f.OnKey = func(Key) bool {
+				f.mu.Lock()
+				if f.aux == nil {
+					f.before++
+				}
+				f.keys++
+				f.mu.Unlock()
+				return false
+			}
+			filters = append(filters, f)
+			return f
+		}
+		if err := parse(newFilter); err != nil {
+			t.Fatal(err)
+		}
+		keys := 0
+		for _, f := range filters {
+			if f.version != 8 || f.aux["redis-ver"] != "7.2.4" || len(f.aux) != 2 || f.headers != 1 || f.before != 0 {
+				t.Fatalf("got: version %v, aux %v, %v headers, %v keys before the header",
+					f.version, f.aux, f.headers, f.before)
+			}
+			keys += f.keys
+		}
+		if keys != 100 {
+			t.Fatalf("want: 100 keys, got: %v in %v filters", keys, len(filters))
+		}
+	}
+	parse(func(newFilter func() Filter) error {
+		return Parse(&MemReader{b: buf.Bytes()}, WithFilter(newFilter()), WithStrategy(SkipMeta), EnableSync())
+	})
+	parse(func(newFilter func() Filter) error {
+		return ParseSegments(&MemReader{b: buf.Bytes()}, 4, newFilter, WithStrategy(SkipMeta), EnableSync())
+	})
+	parse(func(newFilter func() Filter) error {
+		return ParseDatabases(&MemReader{b: buf.Bytes()}, WithFilter(newFilter()), WithStrategy(SkipMeta))
+	})
+	parse(func(newFilter func() Filter) error {
+		return Parse(&MemReader{b: buf.Bytes()}, WithFilter(ChainFilters(FuncFilter{}, newFilter())), WithStrategy(SkipMeta))
+	})
+}
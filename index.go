@@ -0,0 +1,125 @@
+package rdb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PrefixIndex is a trie of key names, split by delimiters, whose nodes aggregate the keys under them.
+//
+// A PrefixIndex is filled by WithKeyPrefixIndex during a parse, and queried once the parse returns.
+// Its nodes are shared with the index, they must not be modified.
+type PrefixIndex struct {
+	mu     sync.Mutex
+	delims string
+	root   PrefixNode
+}
+
+// PrefixNode is a node of a PrefixIndex.
+//
+// Usage counts the keys whose names start with Prefix, Own the ones named Prefix exactly.
+type PrefixNode struct {
+	Usage
+
+	Prefix string // prefix of the node, it ends with a delimiter unless it's a full key name
+	Own    Usage
+
+	children map[string]*PrefixNode
+}
+
+// NewPrefixIndex returns an empty PrefixIndex splitting keys after any character of delims.
+// If delims is empty, ":" is used.
+func NewPrefixIndex(delims string) *PrefixIndex {
+	if delims == "" {
+		delims = ":"
+	}
+	return &PrefixIndex{delims: delims}
+}
+
+// WithKeyPrefixIndex returns a ParseOption which adds every key to idx.
+// Keys are added with the memory of their values once they are decoded, keys whose values are skipped
+// are added with the memory of their names and expiries only.
+func WithKeyPrefixIndex(idx *PrefixIndex) ParseOption {
+	return func(p *Parser) {
+		p.index = idx
+	}
+}
+
+// Add adds key which uses memory bytes to the index.
+func (idx *PrefixIndex) Add(key string, memory uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	n := &idx.root
+	n.add(memory)
+	for end := 0; end < len(key); {
+		i := strings.IndexAny(key[end:], idx.delims)
+		if i < 0 {
+			end = len(key)
+		} else {
+			end += i + 1
+		}
+		child, ok := n.children[key[:end]]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*PrefixNode)
+			}
+			child = &PrefixNode{Prefix: key[:end]}
+			n.children[key[:end]] = child
+		}
+		n = child
+		n.add(memory)
+	}
+	n.Own.add(memory)
+}
+
+// Root returns the root node of idx, its prefix is empty and it counts all the keys.
+func (idx *PrefixIndex) Root() *PrefixNode {
+	return &idx.root
+}
+
+// Lookup returns the node of prefix, which must end with a delimiter unless it's a full key name.
+// It reports false if no key starts with prefix.
+func (idx *PrefixIndex) Lookup(prefix string) (*PrefixNode, bool) {
+	n := &idx.root
+	for end := 0; end < len(prefix); {
+		i := strings.IndexAny(prefix[end:], idx.delims)
+		if i < 0 {
+			end = len(prefix)
+		} else {
+			end += i + 1
+		}
+		child, ok := n.children[prefix[:end]]
+		if !ok {
+			return nil, false
+		}
+		n = child
+	}
+	return n, true
+}
+
+// Children returns the children of n, ordered by memory usage descending.
+func (n *PrefixNode) Children() []*PrefixNode {
+	children := make([]*PrefixNode, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].Memory != children[j].Memory {
+			return children[i].Memory > children[j].Memory
+		}
+		return children[i].Prefix < children[j].Prefix
+	})
+	return children
+}
+
+// Walk calls fn with n and its descendants in depth-first order, children ordered as by Children.
+// The descendants of a node are skipped if fn returns false.
+func (n *PrefixNode) Walk(fn func(n *PrefixNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.Children() {
+		child.Walk(fn)
+	}
+}
@@ -0,0 +1,68 @@
+package rdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrefixIndex(t *testing.T) {
+	idx := NewPrefixIndex("")
+	idx.Add("user:1:name", 10)
+	idx.Add("user:1:email", 20)
+	idx.Add("user:2", 5)
+	idx.Add("user:", 1)
+	idx.Add("counter", 7)
+
+	if root := idx.Root(); root.Keys != 5 || root.Memory != 43 {
+		t.Fatalf("got: %+v", root.Usage)
+	}
+	user, ok := idx.Lookup("user:")
+	if !ok || user.Keys != 4 || user.Memory != 36 || user.Own != (Usage{Keys: 1, Memory: 1}) {
+		t.Fatalf("got: %+v", user)
+	}
+	var prefixes []string
+	for _, child := range user.Children() {
+		prefixes = append(prefixes, child.Prefix)
+	}
+	if want := []string{"user:1:", "user:2"}; !reflect.DeepEqual(prefixes, want) {
+		t.Fatalf("want: %v, got: %v", want, prefixes)
+	}
+	if n, ok := idx.Lookup("user:1:email"); !ok || n.Own.Memory != 20 || len(n.Children()) != 0 {
+		t.Fatalf("got: %+v", n)
+	}
+	if _, ok := idx.Lookup("user:3"); ok {
+		t.Fatal("want: no node")
+	}
+
+	prefixes = prefixes[:0]
+	idx.Root().Walk(func(n *PrefixNode) bool {
+		prefixes = append(prefixes, n.Prefix)
+		return n.Prefix != "user:1:"
+	})
+	if want := []string{"", "user:", "user:1:", "user:2", "counter"}; !reflect.DeepEqual(prefixes, want) {
+		t.Fatalf("want: %v, got: %v", want, prefixes)
+	}
+}
+
+func TestWithKeyPrefixIndex(t *testing.T) {
+	parse := func(opts ...ParseOption) *PrefixIndex {
+		r, err := NewMemReader("testdata/dumps/parser_filters.rdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx := NewPrefixIndex(":")
+		if err := Parse(r, append(opts, WithStrategy(SkipMeta), WithKeyPrefixIndex(idx))...); err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	skipped := parse()
+	decoded := parse(WithFilter(FuncFilter{}))
+	if skipped.Root().Keys != 43 || decoded.Root().Keys != 43 {
+		t.Fatalf("want: 43 keys, got: %v and %v", skipped.Root().Keys, decoded.Root().Keys)
+	}
+	if skipped.Root().Memory >= decoded.Root().Memory {
+		t.Fatalf("want: values memory counted, got: %v and %v", skipped.Root().Memory, decoded.Root().Memory)
+	}
+}
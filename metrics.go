@@ -0,0 +1,72 @@
+package rdb
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics counts the progress of parses, to monitor long-running ones, e.g. of services embedding the parser.
+//
+// Metrics is safe for concurrent use, it can be shared by several parses, such as segments of ParseSegments.
+type Metrics struct {
+	bytes  int64
+	keys   int64
+	queued int64
+	start  time.Time
+}
+
+// MetricsSnapshot is the state of Metrics at some point.
+type MetricsSnapshot struct {
+	Bytes       int64         `json:"bytes"`         // bytes parsed
+	Keys        int64         `json:"keys"`          // keys parsed
+	Queued      int64         `json:"queued"`        // values waiting for filter workers
+	Elapsed     time.Duration `json:"elapsed"`       // time since the Metrics was created
+	BytesPerSec float64       `json:"bytes_per_sec"` // average throughput since the Metrics was created
+	KeysPerSec  float64       `json:"keys_per_sec"`
+}
+
+// NewMetrics returns a Metrics, throughputs are computed from now.
+func NewMetrics() *Metrics {
+	return &Metrics{start: time.Now()}
+}
+
+// WithMetrics returns a ParseOption which counts the progress of the parse in m.
+func WithMetrics(m *Metrics) ParseOption {
+	return func(p *Parser) {
+		p.metrics = m
+		// offsets are tracked to count bytes
+		p.checksum = true
+	}
+}
+
+// Snapshot returns the current state of m.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{
+		Bytes:   atomic.LoadInt64(&m.bytes),
+		Keys:    atomic.LoadInt64(&m.keys),
+		Queued:  atomic.LoadInt64(&m.queued),
+		Elapsed: time.Since(m.start),
+	}
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		s.BytesPerSec = float64(s.Bytes) / secs
+		s.KeysPerSec = float64(s.Keys) / secs
+	}
+	return s
+}
+
+// Publish publishes the snapshots of m as the expvar variable name.
+// Like expvar.Publish, it panics if name is already registered.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return m.Snapshot() }))
+}
+
+// progress adds the bytes read since the last call to the metrics, if any.
+func (p *Parser) progress() {
+	if p.metrics == nil {
+		return
+	}
+	off := p.read()
+	atomic.AddInt64(&p.metrics.bytes, off-p.reported)
+	p.reported = off
+}
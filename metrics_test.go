@@ -0,0 +1,38 @@
+package rdb
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	const file = "testdata/dumps/parser_filters.rdb"
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMetrics()
+	m.Publish("rdb_test_metrics")
+	for _, opts := range [][]ParseOption{nil, {WithFilter(FuncFilter{})}} {
+		r, err := NewMemReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Parse(r, append(opts, WithStrategy(SkipMeta), WithMetrics(m))...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var s MetricsSnapshot
+	if err := json.Unmarshal([]byte(expvar.Get("rdb_test_metrics").String()), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Keys != 86 || s.Bytes != 2*info.Size() || s.Queued != 0 {
+		t.Fatalf("want: 86 keys, %v bytes, got: %+v", 2*info.Size(), s)
+	}
+	if s.BytesPerSec <= 0 || s.KeysPerSec <= 0 {
+		t.Fatalf("want: throughputs, got: %+v", s)
+	}
+}
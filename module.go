@@ -0,0 +1,143 @@
+package rdb
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Opcodes of the values saved by modules, in MODULE_AUX fields and in the values of module keys.
+const (
+	moduleOpcodeEOF    = 0
+	moduleOpcodeSInt   = 1
+	moduleOpcodeUInt   = 2
+	moduleOpcodeFloat  = 3
+	moduleOpcodeDouble = 4
+	moduleOpcodeString = 5
+)
+
+// Values of ModuleAux.When.
+const (
+	ModuleAuxBeforeKeys = 1
+	ModuleAuxAfterKeys  = 2
+)
+
+// moduleCharset encodes the names of module types in their 64 bits ids.
+const moduleCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// ModuleAux is auxiliary data saved by a module apart from keys, e.g. the index definitions of RediSearch.
+// Its values are skipped, they can only be decoded by the module.
+type ModuleAux struct {
+	Module string // name of the module type, 9 characters such as ReJSON-RL
+	EncVer int    // encoding version of the module type
+	When   int    // ModuleAuxBeforeKeys or ModuleAuxAfterKeys
+}
+
+// A ModuleAuxFilter is a Filter which is given the MODULE_AUX fields of the rdb file.
+// ModuleAux is called by the parser's goroutine, before the keys following the field are parsed.
+type ModuleAuxFilter interface {
+	ModuleAux(aux ModuleAux)
+}
+
+// moduleType returns the name and the encoding version of the module type whose id is id.
+func moduleType(id uint64) (string, int) {
+	name := make([]byte, 9)
+	encver := int(id & 1023)
+	id >>= 10
+	for i := len(name) - 1; i >= 0; i-- {
+		name[i] = moduleCharset[id&63]
+		id >>= 6
+	}
+	return string(name), encver
+}
+
+// readModuleAux reads the field following a MODULE_AUX opcode, its values are skipped.
+func (p *Parser) readModuleAux() (ModuleAux, error) {
+	var aux ModuleAux
+	id, _, err := p.readLength(false)
+	if err != nil {
+		return aux, err
+	}
+	aux.Module, aux.EncVer = moduleType(uint64(id))
+	op, _, err := p.readLength(false)
+	if err != nil {
+		return aux, err
+	}
+	if op != moduleOpcodeUInt {
+		return aux, errors.Wrapf(ErrInvalidRDB, "module %s: invalid MODULE_AUX opcode %d", aux.Module, op)
+	}
+	if aux.When, _, err = p.readLength(false); err != nil {
+		return aux, err
+	}
+	return aux, p.skipModuleValues(aux.Module)
+}
+
+// moduleAux reads the field following a MODULE_AUX opcode and passes it to the filter, if it's a ModuleAuxFilter.
+func (p *Parser) moduleAux() error {
+	aux, err := p.readModuleAux()
+	if err != nil {
+		return err
+	}
+	if f, ok := p.filter.(ModuleAuxFilter); ok {
+		f.ModuleAux(aux)
+	}
+	return nil
+}
+
+// skipModuleValue skips the value of a module key, its module type id followed by the values saved by the module.
+func (p *Parser) skipModuleValue() error {
+	id, _, err := p.readLength(false)
+	if err != nil {
+		return err
+	}
+	module, _ := moduleType(uint64(id))
+	return p.skipModuleValues(module)
+}
+
+// skipModuleValues skips the values saved by module, up to their EOF opcode.
+func (p *Parser) skipModuleValues(module string) error {
+	for {
+		op, _, err := p.readLength(false)
+		if err != nil {
+			return err
+		}
+		switch op {
+		case moduleOpcodeEOF:
+			return nil
+		case moduleOpcodeSInt, moduleOpcodeUInt:
+			_, _, err = p.readLength(false)
+		case moduleOpcodeFloat:
+			p.Discard(4)
+		case moduleOpcodeDouble:
+			p.Discard(8)
+		case moduleOpcodeString:
+			err = p.skipString()
+		default:
+			return errors.Wrapf(ErrInvalidRDB, "module %s: invalid opcode %d", module, op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ModuleAux calls ModuleAux on filters which are ModuleAuxFilters.
+func (c *chain) ModuleAux(aux ModuleAux) {
+	c.each(func(f Filter) {
+		if f, ok := f.(ModuleAuxFilter); ok {
+			f.ModuleAux(aux)
+		}
+	})
+}
+
+// ModuleAux calls ModuleAux on filter if it's a ModuleAuxFilter.
+func (o only) ModuleAux(aux ModuleAux) {
+	if f, ok := o.filter.(ModuleAuxFilter); ok {
+		f.ModuleAux(aux)
+	}
+}
+
+// ModuleAux calls ModuleAux on the combined filter if it's a ModuleAuxFilter.
+func (e ender) ModuleAux(aux ModuleAux) {
+	if f, ok := e.Filter.(ModuleAuxFilter); ok {
+		f.ModuleAux(aux)
+	}
+}
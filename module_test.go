@@ -0,0 +1,76 @@
+package rdb
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type moduleAuxFilter struct {
+	FuncFilter
+	aux []ModuleAux
+}
+
+func (f *moduleAuxFilter) ModuleAux(aux ModuleAux) {
+	f.aux = append(f.aux, aux)
+}
+
+// moduleID returns the id of the module type name whose encoding version is encver.
+func moduleID(name string, encver int) int {
+	var id int
+	for _, c := range name {
+		id = id<<6 | strings.IndexRune(moduleCharset, c)
+	}
+	return id<<10 | encver
+}
+
+func TestModuleAux(t *testing.T) {
+	id := moduleID("ReJSON-RL", 3)
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeByte(TokenModuleAUX)
+	e.writeLength(id)
+	e.writeLength(moduleOpcodeUInt)
+	e.writeLength(ModuleAuxBeforeKeys)
+	e.writeLength(moduleOpcodeString)
+	e.writeString("index")
+	e.writeLength(moduleOpcodeDouble)
+	e.write(make([]byte, 8))
+	e.writeLength(moduleOpcodeEOF)
+	e.String(&String{Key: Key{Key: "a", Expiry: -1}, Value: "1"})
+	e.writeKey(Key{Key: "json", Expiry: -1}, EncodingModule2)
+	e.writeLength(id)
+	e.writeLength(moduleOpcodeSInt)
+	e.writeLength(42)
+	e.writeLength(moduleOpcodeFloat)
+	e.write(make([]byte, 4))
+	e.writeLength(moduleOpcodeEOF)
+	e.String(&String{Key: Key{Key: "b", Expiry: -1}, Value: "2"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	copy(b[5:], "0009")
+
+	keys, strs := 0, 0
+	f := &moduleAuxFilter{FuncFilter: FuncFilter{
+		OnKey:    func(Key) bool { keys++; return false },
+		OnString: func(*String) { strs++ },
+	}}
+	if err := Parse(&MemReader{b: b}, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	want := []ModuleAux{{Module: "ReJSON-RL", EncVer: 3, When: ModuleAuxBeforeKeys}}
+	if !reflect.DeepEqual(f.aux, want) || keys != 3 || strs != 2 {
+		t.Fatalf("want: %+v, 3 keys and 2 strings, got: %+v, %v keys and %v strings", want, f.aux, keys, strs)
+	}
+
+	s, err := ScanSkeleton(&MemReader{b: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 3 || s.Entries[1].Key != "json" || s.Entries[1].Type() != TypeModule {
+		t.Fatalf("want: 3 entries, got: %+v", s.Entries)
+	}
+}
@@ -0,0 +1,103 @@
+package rdb
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithParallelism returns a ParseOption which sets the number of files ParseAll parses concurrently.
+func WithParallelism(n int) ParseOption {
+	return func(p *Parser) {
+		p.parallelism = n
+	}
+}
+
+// FileResult is the result of a file parsed by ParseAll.
+type FileResult struct {
+	File     string
+	Filter   Filter // filter the file was parsed with
+	Size     int64
+	Duration time.Duration
+	Err      error
+}
+
+// ParseErrors is returned by ParseAll if any file failed, it holds the failed results.
+type ParseErrors []FileResult
+
+func (e ParseErrors) Error() string {
+	s := make([]string, len(e))
+	for i, r := range e {
+		s[i] = fmt.Sprintf("%s: %v", r.File, r.Err)
+	}
+	return strings.Join(s, "; ")
+}
+
+// ParseAll parses files concurrently, each of them with a new Filter returned by filterFactory.
+// Files are memory-mapped, compressed files are decompressed while read.
+//
+// At most runtime.NumCPU() files are parsed at a time unless WithParallelism is set.
+// Results are in the same order as files, the error is a ParseErrors if any file failed.
+func ParseAll(files []string, filterFactory func() Filter, opts ...ParseOption) ([]FileResult, error) {
+	p := new(Parser)
+	for _, opt := range opts {
+		opt(p)
+	}
+	n := p.parallelism
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+
+	var wg sync.WaitGroup
+	results := make([]FileResult, len(files))
+	sem := make(chan struct{}, n)
+	for i, file := range files {
+		results[i].File = file
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(r *FileResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			r.Filter = filterFactory()
+			r.Size, r.Err = parseFile(r.File, append(opts, WithFilter(r.Filter))...)
+			r.Duration = time.Since(start)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	var errs ParseErrors
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, r)
+		}
+	}
+	if errs != nil {
+		return results, errs
+	}
+	return results, nil
+}
+
+// parseFile parses the named file and returns its size.
+func parseFile(file string, opts ...ParseOption) (int64, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	mr, err := NewMemReader(file)
+	if err != nil {
+		return 0, err
+	}
+	r := mr
+	if DetectCompression(mr.(*MemReader).b) != CompressionNone {
+		if r, err = NewCompressedReader(ioReader{mr}, 0); err != nil {
+			return 0, err
+		}
+	}
+	return fi.Size(), Parse(r, opts...)
+}
@@ -0,0 +1,35 @@
+package rdb
+
+import (
+	"testing"
+)
+
+func TestParseAll(t *testing.T) {
+	files := []string{
+		"testdata/dumps/keys_with_expiry.rdb",
+		"testdata/dumps/multiple_databases.rdb",
+		"testdata/dumps/missing.rdb",
+		"testdata/dumps/rdb_version_5_with_checksum.rdb",
+	}
+	results, err := ParseAll(files, func() Filter {
+		return new(stringMapFilter)
+	}, WithParallelism(2))
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 1 || errs[0].File != files[2] {
+		t.Fatalf("got: %v", err)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("want: %v results, got: %v", len(files), len(results))
+	}
+	for i, r := range results {
+		if r.File != files[i] {
+			t.Fatalf("want: %v, got: %v", files[i], r.File)
+		}
+		if i != 2 && (r.Err != nil || r.Size == 0) {
+			t.Fatalf("%v: %v, size: %v", r.File, r.Err, r.Size)
+		}
+	}
+	if got := results[3].Filter.(*stringMapFilter).got["abcd"]; got != "efgh" {
+		t.Fatalf("want: efgh, got: %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package rdb
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Prefix represents the aggregated statistics of keys sharing the same prefix.
+type Prefix struct {
+	Usage
+
+	Prefix    string
+	Expires   int            // number of keys with an expiry
+	Encodings map[string]int // number of keys per encoding
+}
+
+// TTLCoverage reports the ratio of keys with an expiry.
+func (p Prefix) TTLCoverage() float64 {
+	if p.Keys == 0 {
+		return 0
+	}
+	return float64(p.Expires) / float64(p.Keys)
+}
+
+// PrefixReport aggregates keys by their prefixes.
+//
+// Keys which have no prefix are grouped under the empty prefix.
+// PrefixReport is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type PrefixReport struct {
+	mu       sync.Mutex
+	prefixes map[string]*Prefix
+
+	delims  string
+	depth   int
+	pattern *regexp.Regexp
+}
+
+// NewPrefixReport returns a PrefixReport which splits keys by any character of delims,
+// the prefix of a key is made of its first depth segments.
+// If delims is empty, ":" is used. If depth < 1, 1 is used.
+func NewPrefixReport(delims string, depth int) *PrefixReport {
+	if delims == "" {
+		delims = ":"
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	return &PrefixReport{
+		delims:   delims,
+		depth:    depth,
+		prefixes: make(map[string]*Prefix),
+	}
+}
+
+// NewPatternPrefixReport returns a PrefixReport which uses pattern to find the prefix of a key.
+// The prefix is the concatenation of pattern's capture groups, or the whole match if pattern has no groups.
+func NewPatternPrefixReport(pattern *regexp.Regexp) *PrefixReport {
+	return &PrefixReport{
+		pattern:  pattern,
+		prefixes: make(map[string]*Prefix),
+	}
+}
+
+// Prefix returns the prefix of key.
+func (r *PrefixReport) Prefix(key string) string {
+	if r.pattern != nil {
+		m := r.pattern.FindStringSubmatch(key)
+		switch len(m) {
+		case 0:
+			return ""
+		case 1:
+			return m[0]
+		default:
+			return strings.Join(m[1:], "")
+		}
+	}
+
+	end := 0
+	for n := 0; n < r.depth; n++ {
+		i := strings.IndexAny(key[end:], r.delims)
+		if i < 0 {
+			break
+		}
+		end += i + 1
+	}
+	if end == 0 {
+		return ""
+	}
+	return key[:end-1]
+}
+
+// Add adds key which uses memory bytes to the report.
+func (r *PrefixReport) Add(key Key, memory uint64) {
+	prefix := r.Prefix(key.Key)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.prefixes[prefix]
+	if !ok {
+		p = &Prefix{
+			Prefix:    prefix,
+			Encodings: make(map[string]int),
+		}
+		r.prefixes[prefix] = p
+	}
+	p.add(memory)
+	if key.Expiry >= 0 || key.HasExpiry {
+		p.Expires++
+	}
+	p.Encodings[Encoding2String(key.Encoding)]++
+}
+
+// Prefixes returns the statistics of every prefix, ordered by memory usage descending.
+func (r *PrefixReport) Prefixes() []Prefix {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prefixes := make([]Prefix, 0, len(r.prefixes))
+	for _, p := range r.prefixes {
+		encodings := make(map[string]int, len(p.Encodings))
+		for k, v := range p.Encodings {
+			encodings[k] = v
+		}
+		prefix := *p
+		prefix.Encodings = encodings
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].Memory != prefixes[j].Memory {
+			return prefixes[i].Memory > prefixes[j].Memory
+		}
+		return prefixes[i].Prefix < prefixes[j].Prefix
+	})
+	return prefixes
+}
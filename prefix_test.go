@@ -0,0 +1,50 @@
+package rdb
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		report *PrefixReport
+		key    string
+		want   string
+	}{
+		{NewPrefixReport("", 0), "user:1000:name", "user"},
+		{NewPrefixReport(":", 2), "user:1000:name", "user:1000"},
+		{NewPrefixReport(":", 5), "user:1000:name", "user:1000"},
+		{NewPrefixReport(":/", 1), "cache/page:1", "cache"},
+		{NewPrefixReport(":", 1), "counter", ""},
+		{NewPatternPrefixReport(regexp.MustCompile(`^(\w+):\d+:(\w+)$`)), "user:1000:name", "username"},
+		{NewPatternPrefixReport(regexp.MustCompile(`^session`)), "session:abc", "session"},
+		{NewPatternPrefixReport(regexp.MustCompile(`^session`)), "user:1", ""},
+	}
+	for i, test := range tests {
+		if got := test.report.Prefix(test.key); got != test.want {
+			t.Fatalf("index: %v, want: %q, got: %q", i, test.want, got)
+		}
+	}
+}
+
+func TestPrefixReport(t *testing.T) {
+	r := NewPrefixReport(":", 1)
+	r.Add(Key{Key: "user:1", Expiry: -1, Encoding: EncodingHashZip}, 10)
+	r.Add(Key{Key: "user:2", Expiry: 1000, Encoding: EncodingHash}, 30)
+	r.Add(Key{Key: "session:1", Expiry: 1000, Encoding: EncodingString}, 5)
+
+	prefixes := r.Prefixes()
+	if len(prefixes) != 2 {
+		t.Fatalf("want: 2 prefixes, got: %+v", prefixes)
+	}
+	user := prefixes[0]
+	if user.Prefix != "user" || user.Keys != 2 || user.Memory != 40 || user.TTLCoverage() != 0.5 {
+		t.Fatalf("got: %+v", user)
+	}
+	if user.Encodings["ziplist"] != 1 || user.Encodings["hashtable"] != 1 {
+		t.Fatalf("got: %+v", user.Encodings)
+	}
+	if session := prefixes[1]; session.Prefix != "session" || session.TTLCoverage() != 1 {
+		t.Fatalf("got: %+v", session)
+	}
+}
@@ -0,0 +1,80 @@
+package rdb
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Range is a run of records of a rdb file which can be parsed on its own by ParseRange,
+// e.g. to process a huge dump in chunks across several machines.
+type Range struct {
+	Start   int64 // offset of the first record in the file, a key or a database selector
+	Bytes   int64 // parsing stops at the first record following Start+Bytes, 0 parses up to the EOF opcode
+	Keys    int   // parsing stops after this many keys, 0 for no limit
+	DB      int   // database the records start in
+	Resumed bool  // whether Start is in the middle of database DB, its Database callback is called first then
+	Version int   // rdb version of the file
+}
+
+// ScanRanges walks the records of a memory-mapped rdb file without decoding them and splits them
+// into at most n ranges of about the same size, which partition the keys of the file.
+// A single range follows the header if r isn't returned by NewMemReader.
+func ScanRanges(r Reader, n int) ([]Range, error) {
+	p, err := newParser(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.readHeader(); err != nil {
+		return nil, err
+	}
+	version, _ := strconv.Atoi(p.version)
+	mr, ok := r.(*MemReader)
+	if !ok || n < 2 {
+		return []Range{{Start: 9, Version: version}}, nil
+	}
+	segments, err := p.scan(mr, n, false)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]Range, len(segments))
+	for i, seg := range segments {
+		ranges[i] = Range{
+			Start:   int64(seg.start),
+			Bytes:   int64(seg.end - seg.start),
+			DB:      seg.db,
+			Resumed: seg.resumed,
+			Version: version,
+		}
+	}
+	// the last range parses the EOF opcode
+	ranges[len(ranges)-1].Bytes = 0
+	return ranges, nil
+}
+
+// ParseRange parses the records of rg, r reads the file from rg.Start on, e.g. a file seeked to rg.Start
+// or the body of an HTTP range request. A key is parsed by the range it starts in.
+//
+// The Header callback isn't called, neither is End unless the range ends with the EOF opcode.
+func ParseRange(r Reader, rg Range, opts ...ParseOption) (err error) {
+	if rg.Version < 1 || rg.Version > maxVersion {
+		return errors.WithStack(ErrUnsupportedRDB)
+	}
+	// offsets are tracked to stop after rg.Bytes
+	p, err := newParser(r, append(opts[:len(opts):len(opts)], func(p *Parser) { p.checksum = true })...)
+	if err != nil {
+		return err
+	}
+	span := p.startSpan("rdb.parse", map[string]interface{}{"start": rg.Start})
+	defer func() { span.End(err) }()
+	p.version = fmt.Sprintf("%04d", rg.Version)
+	p.db = rg.DB
+	p.resumed = rg.Resumed
+	if rg.Bytes > 0 {
+		p.limit = p.read() + rg.Bytes
+	}
+	p.maxKeys = rg.Keys
+	p.startWorkers()
+	return p.Parse()
+}
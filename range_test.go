@@ -0,0 +1,69 @@
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type rangeFilter struct {
+	*encodedFilter
+	ended bool
+}
+
+func (f *rangeFilter) End(checksum uint64, ok bool) {
+	f.ended = true
+}
+
+func TestParseRange(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i := 0; i < 3000; i++ {
+		key := Key{Key: fmt.Sprint("key:", i), DB: i / 1000, Expiry: -1}
+		if i%3 == 0 {
+			key.Expiry = 1500000000000 + i
+		}
+		e.String(&String{Key: key, Value: fmt.Sprint(i)})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	want := newEncodedFilter()
+	if err := Parse(&MemReader{b: b}, WithFilter(want), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges, err := ScanRanges(&MemReader{b: b}, 4)
+	if err != nil || len(ranges) != 4 {
+		t.Fatalf("want: 4 ranges, got: %v, %v", ranges, err)
+	}
+	got := newEncodedFilter()
+	for i, rg := range ranges {
+		f := &rangeFilter{encodedFilter: got}
+		r := NewStreamReader(bytes.NewReader(b[rg.Start:]), 0)
+		if err := ParseRange(r, rg, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+			t.Fatalf("range %d: %v", i, err)
+		}
+		if f.ended != (i == len(ranges)-1) {
+			t.Fatalf("range %d: got ended %v", i, f.ended)
+		}
+	}
+	if len(got.dbs) != 3000 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("want: 3000 keys, got: %v", len(got.dbs))
+	}
+
+	rg := ranges[1]
+	rg.Keys = 10
+	got = newEncodedFilter()
+	r := NewStreamReader(bytes.NewReader(b[rg.Start:]), 0)
+	if err := ParseRange(r, rg, WithFilter(got), WithStrategy(SkipMeta)); err != nil || len(got.dbs) != 10 {
+		t.Fatalf("want: 10 keys, got: %v, %v", len(got.dbs), err)
+	}
+
+	if err := ParseRange(r, Range{}, WithFilter(got)); err == nil {
+		t.Fatal("want an error without version")
+	}
+}
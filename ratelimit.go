@@ -0,0 +1,137 @@
+package rdb
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimitChunk is the number of bytes a rateLimitedReader reads between waits.
+const rateLimitChunk = 64 << 10
+
+// WithRateLimit returns a ParseOption which limits reading to bytesPerSec bytes per second,
+// so that scans of dumps on shared storage don't saturate it.
+// The limit is shared by all the parsers given the returned option, such as segments of ParseSegments
+// and files of ParseAll.
+func WithRateLimit(bytesPerSec int) ParseOption {
+	l := &rateLimiter{rate: float64(bytesPerSec)}
+	return func(p *Parser) {
+		if bytesPerSec > 0 {
+			p.limiter = l
+		}
+	}
+}
+
+// rateLimiter paces readers to a rate, starting from its first wait.
+type rateLimiter struct {
+	mu    sync.Mutex
+	rate  float64 // bytes per second
+	start time.Time
+	n     int64
+}
+
+// wait accounts n bytes, and sleeps until they are allowed by the rate.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	l.n += int64(n)
+	d := time.Duration(float64(l.n)/l.rate*float64(time.Second)) - time.Since(l.start)
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// rateLimitedReader is a Reader which waits for a rateLimiter every rateLimitChunk bytes.
+type rateLimitedReader struct {
+	Reader
+
+	l *rateLimiter
+	n int
+}
+
+func (r *rateLimitedReader) take(n int) {
+	r.n += n
+	if r.n >= rateLimitChunk {
+		r.l.wait(r.n)
+		r.n = 0
+	}
+}
+
+// Close closes the underlying Reader if it's an io.Closer.
+func (r *rateLimitedReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Offset returns the offset of the underlying Reader, if it tracks it.
+func (r *rateLimitedReader) Offset() int {
+	if t, ok := r.Reader.(tracker); ok {
+		return t.Offset()
+	}
+	return 0
+}
+
+// Checksum returns the checksum of the underlying Reader, if it tracks it.
+func (r *rateLimitedReader) Checksum() uint64 {
+	if t, ok := r.Reader.(tracker); ok {
+		return t.Checksum()
+	}
+	return 0
+}
+
+func (r *rateLimitedReader) Discard(n int) {
+	r.take(n)
+	r.Reader.Discard(n)
+}
+
+func (r *rateLimitedReader) ReadByte() (byte, error) {
+	r.take(1)
+	return r.Reader.ReadByte()
+}
+
+func (r *rateLimitedReader) ReadBytes(n int) ([]byte, error) {
+	r.take(n)
+	return r.Reader.ReadBytes(n)
+}
+
+func (r *rateLimitedReader) transientBytes(n int) ([]byte, error) {
+	r.take(n)
+	return transientBytes(r.Reader, n)
+}
+
+// readLength reads a length encoding with the underlying Reader, its first byte is accounted
+// since the length of the encoding is only known once it's read.
+func (r *rateLimitedReader) readLength(withEncoding bool) (int, bool, error) {
+	r.take(1)
+	return readLength(r.Reader, withEncoding)
+}
+
+func (r *rateLimitedReader) little16() (int, error) {
+	r.take(2)
+	return r.Reader.little16()
+}
+
+func (r *rateLimitedReader) little32() (int, error) {
+	r.take(4)
+	return r.Reader.little32()
+}
+
+func (r *rateLimitedReader) little64() (int, error) {
+	r.take(8)
+	return r.Reader.little64()
+}
+
+func (r *rateLimitedReader) big32() (int, error) {
+	r.take(4)
+	return r.Reader.big32()
+}
+
+func (r *rateLimitedReader) big64() (int, error) {
+	r.take(8)
+	return r.Reader.big64()
+}
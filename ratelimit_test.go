@@ -0,0 +1,70 @@
+package rdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "s", Expiry: -1}, Value: strings.Repeat("x", 400<<10)})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	filter := new(testEmptyFilter)
+	if err := Parse(NewStreamReader(&buf, 0), WithFilter(filter), WithRateLimit(2<<20)); err != nil {
+		t.Fatal(err)
+	}
+	// the last wait is after 384KB
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Fatalf("want: at least 150ms, got: %v", d)
+	}
+}
+
+func TestRateLimitParse(t *testing.T) {
+	for _, r := range []Reader{new(rateLimitedReader), new(checksumReader)} {
+		if _, ok := r.(lengthReader); !ok {
+			t.Fatalf("%T doesn't decode lengths itself", r)
+		}
+	}
+
+	files, err := filepath.Glob("testdata/dumps/*.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			got     [2]map[string]string
+			parsers [2]*Parser
+		)
+		readers := []Reader{&MemReader{b: data}, NewStreamReader(bytes.NewReader(data), 0)}
+		for i, r := range readers {
+			f := &snapshotFilter{got: make(map[string]string)}
+			err := Parse(r, WithFilter(f), WithStrategy(SkipMeta), WithChecksum(), WithRateLimit(1<<30),
+				func(p *Parser) { parsers[i] = p })
+			if err != nil {
+				t.Fatal(file, err)
+			}
+			got[i] = f.got
+		}
+		if !reflect.DeepEqual(got[0], got[1]) {
+			t.Fatalf("%v: values differ with a rate limit", file)
+		}
+		if m, s := parsers[0], parsers[1]; m.Offset() != s.Offset() || m.Checksum() != s.Checksum() {
+			t.Fatalf("%v: want: offset %v and checksum %x, got: %v and %x",
+				file, m.Offset(), m.Checksum(), s.Offset(), s.Checksum())
+		}
+	}
+}
@@ -1,28 +1,36 @@
 package rdb
 
 import (
-	"bytes"
 	"encoding/binary"
 	stderr "errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"regexp"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// Opcodes of rdb files, which precede records other than keys. A key's record starts with the type of its value,
+// one of the Encoding constants, unless it's preceded by its expiry, LRU or LFU.
 const (
-	tokenAUX     = 0xFA // information about the RDB generated
-	tokenResize  = 0xFB // hint about the size of the keys in the currently selected database
-	tokenExpMSec = 0xFC // expiry time in ms
-	tokenExpSec  = 0xFD // expiry time in seconds
-	tokenDB      = 0xFE // database selector
-	tokenEOF     = 0xFF // end of RDB file
+	TokenSlotInfo      = 0xF4 // hash slot of the following keys and its size hints, written by cluster nodes since rdb version 12
+	TokenFunction2     = 0xF5 // library of functions, since rdb version 10
+	TokenFunctionPreGA = 0xF6 // library of functions of redis 7 release candidates, unsupported
+	TokenModuleAUX     = 0xF7 // module data which isn't attached to a key
+	TokenIdle          = 0xF8 // LRU idle time of the next key in seconds
+	TokenFreq          = 0xF9 // LFU frequency of the next key
+	TokenAUX           = 0xFA // information about the RDB generated
+	TokenResize        = 0xFB // hint about the size of the keys in the currently selected database
+	TokenExpMSec       = 0xFC // expiry time in ms
+	TokenExpSec        = 0xFD // expiry time in seconds
+	TokenDB            = 0xFE // database selector
+	TokenEOF           = 0xFF // end of RDB file
 )
 
 // Parse strategies
@@ -33,6 +41,9 @@ const (
 	SkipAll
 )
 
+// maxVersion is the latest rdb version supported, the one of redis 7.4.
+const maxVersion = 12
+
 // Parse errors
 var (
 	ErrInvalidRDB            = stderr.New("Invalid RDB file")
@@ -40,6 +51,15 @@ var (
 	ErrInvalidZipmapEntry    = stderr.New("Invalid zipmap entry")
 	ErrInvalidLengthEncoding = stderr.New("Invalid length encoding")
 	ErrInvalidCompressedData = stderr.New("Invalid compressed data")
+	ErrInvalidIntset         = stderr.New("Invalid intset")
+	ErrInvalidZiplist        = stderr.New("Invalid ziplist")
+	ErrInvalidZipmap         = stderr.New("Invalid zipmap")
+
+	ErrUnsupportedCompression = stderr.New("Unsupported compression")
+
+	ErrTimeout = stderr.New("Parse timed out")
+
+	ErrInvalidSkeleton = stderr.New("Invalid skeleton index")
 )
 
 // ParseOption configures the behaviors when parsing a rdb file.
@@ -61,8 +81,91 @@ func WithStrategy(strategy int) ParseOption {
 
 const (
 	filterBufferSize = 512
+
+	// maxPrealloc bounds the elements allocated ahead from a length read from the rdb file,
+	// which may be corrupt.
+	maxPrealloc = 1024
 )
 
+// WithBufferReuse returns a ParseOption which makes filter workers reuse the buffers values are decoded in,
+// such as decompressed strings, ziplist entries and formatted integers, and the maps and slices of values
+// passed to Filter's callbacks, to cut allocations.
+//
+// Strings, maps and slices passed to Filter's callbacks are then only valid until the callback returns,
+// they must be copied to be retained, e.g. with strings.Repeat(s, 1).
+// Strings read from memory-mapped files which aren't compressed are unaffected.
+func WithBufferReuse() ParseOption {
+	return func(p *Parser) {
+		p.reuse = true
+	}
+}
+
+// WithFreshValues returns a ParseOption which makes filter workers allocate new maps and slices of values
+// for every key even with WithBufferReuse, so that Filter's callbacks can retain them.
+// Their strings may still be reused, see WithBufferReuse.
+func WithFreshValues() ParseOption {
+	return func(p *Parser) {
+		p.fresh = true
+	}
+}
+
+// WithStrict returns a ParseOption which verifies ziplists, zipmaps and intsets are consistent:
+// their headers must match their entries, and the entries must be followed by the terminator only.
+// Malformed values fail the parse instead of being decoded as far as possible.
+func WithStrict() ParseOption {
+	return func(p *Parser) {
+		p.strict = true
+	}
+}
+
+// WithKeyFormat returns a ParseOption which selects how Key.String represents binary keys: KeyRaw, KeyHex or KeyBase64.
+// The reports of the parse use Key.String, such as RecoveryReport, Entry and the attributes of spans.
+func WithKeyFormat(format int) ParseOption {
+	return func(p *Parser) {
+		p.keyFormat = format
+	}
+}
+
+// WithMaxStringSize returns a ParseOption which discards string values larger than n bytes uncompressed
+// instead of reading them into memory, they are delivered with their sizes and memory usage only,
+// see String.Oversized. Elements of other types aren't limited.
+func WithMaxStringSize(n int) ParseOption {
+	return func(p *Parser) {
+		p.maxString = n
+	}
+}
+
+// WithTimeout returns a ParseOption which aborts the parse with ErrTimeout once it runs longer than d,
+// e.g. for scheduled jobs which must not overrun their window. The budget is checked between keys,
+// it doesn't interrupt a read blocked on the underlying reader.
+// Segments of ParseSegments and files of ParseAll each have their own budget.
+func WithTimeout(d time.Duration) ParseOption {
+	return func(p *Parser) {
+		p.timeout = d
+	}
+}
+
+// WithScoreStrings returns a ParseOption which sets the Scores of sorted sets, the strings of their scores
+// for exact round-tripping, e.g. into ZADD: scores are kept as written in the rdb file, and binary scores
+// are formatted as the shortest strings which parse back to them.
+func WithScoreStrings() ParseOption {
+	return func(p *Parser) {
+		p.scores = true
+	}
+}
+
+// WithValueTransformer returns a ParseOption which replaces values by the result of transform before they are decoded,
+// once they are decompressed, e.g. to decompress or decrypt values an application stored compressed or encrypted.
+//
+// transform is given the strings and every element of linkedlists, hashtables and skiplists, hash fields included.
+// Ziplists, quicklists, zipmaps and intsets are decoded as is, redis only uses them for small elements.
+// It's called concurrently by filter workers unless EnableSync is set, the error fails the parse.
+func WithValueTransformer(transform func(key Key, b []byte) ([]byte, error)) ParseOption {
+	return func(p *Parser) {
+		p.transform = transform
+	}
+}
+
 // EnableSync returns a ParseOption which disable async filtering.
 func EnableSync() ParseOption {
 	return func(p *Parser) {
@@ -75,6 +178,8 @@ type state struct {
 	skip       bool   // skipping current key or value?
 	compressed bool   // current key or value is compressed?
 	memory     uint64 // current key or value memory usage
+	limit      int    // size above which the current value is discarded, 0 if it isn't limited
+	oversized  bool   // current value is discarded since it's larger than limit?
 }
 
 // state represents parser's skipping strategy.
@@ -98,15 +203,115 @@ type Parser struct {
 
 	err     chan error
 	sizeint uint64
+	pattern *regexp.Regexp
+	wrapper func(io.Reader) (io.Reader, error)
+
+	parallelism int          // number of files parsed concurrently by ParseAll
+	limiter     *rateLimiter // limiter of reading, if any
+	checksum    bool         // whether the checksum of a Reader other than MemReader is maintained
+	reuse       bool         // whether filter workers reuse decode buffers
+	fresh       bool         // whether filter workers allocate new maps and slices for every value
+	strict      bool         // whether compact encodings are verified
+	scores      bool         // whether the strings of scores are kept, see WithScoreStrings
+	keyFormat   int          // representation of binary keys by Key.String
+	maxString   int          // size above which string values are discarded, see WithMaxStringSize
+
+	decoders []ContentDecoder // detectors of string contents, see WithContentDecoder
+
+	transform func(Key, []byte) ([]byte, error) // transformer of values before they are decoded, if any
+	timeout   time.Duration                     // maximum duration of the parse, see WithTimeout
+	timing    *TopKeys                          // keys added with their decode duration, if any
+	index     *PrefixIndex                      // index of key names, if any
+	metrics   *Metrics                          // progress counters, if any
+	reported  int64                             // offset up to which bytes are counted by metrics
+	tracer    Tracer                            // tracer of the parse, if any
+	recovery  *RecoveryReport                   // keys skipped since their values are malformed, see WithRecover
+
+	pendingHeader bool              // whether the Header callback waits for the end of the AUX fields
+	aux           map[string]string // AUX fields read so far, if the filter is a HeaderFilter
+
+	limit   int64      // offset at which the records stop, see ParseRange
+	maxKeys int        // number of keys after which the records stop, see ParseRange
+	keys    int        // number of keys parsed
+	db      int        // database the records start in
+	resumed bool       // whether the records start in the middle of database db
+	segment *MemReader // reader of the segment being parsed by ParseSegments, if any
+	eof     *eof       // the end of the rdb file, once the EOF opcode is parsed
+
+	consumed *int64             // where the number of bytes parsed is stored, see WithConsumed
+	subs     *subscriptions     // functions subscribed by OnType, if any
+	types    map[ValueType]bool // types of the keys passed to the filter, see WithTypes
+}
+
+// eof records the end of a rdb file.
+type eof struct {
+	offset   int64  // offset following the EOF opcode
+	checksum uint64 // checksum of the data up to the EOF opcode
+	stored   uint64 // checksum stored in the rdb file
 }
 
 // Parse parses a Redis RDB file.
-func Parse(r Reader, opts ...ParseOption) error {
+func Parse(r Reader, opts ...ParseOption) (err error) {
+	p, err := newParser(r, opts...)
+	if err != nil {
+		return err
+	}
+	span := p.startSpan("rdb.parse", nil)
+	defer func() { span.End(err) }()
+	if p.consumed != nil {
+		start := p.read()
+		defer func() { *p.consumed = p.read() - start }()
+	}
+	if err := p.readHeader(); err != nil {
+		return err
+	}
+	p.startWorkers()
+	return p.Parse()
+}
+
+// newParser returns a Parser reading from r, configured by opts.
+func newParser(r Reader, opts ...ParseOption) (*Parser, error) {
 	p := new(Parser)
 	p.Reader = r
 	p.err = make(chan error, 1)
 	p.sizeint = 8
 
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.subs != nil {
+		if p.filter == nil {
+			p.filter = p.subs
+		} else {
+			p.filter = ChainFilters(p.filter, p.subs)
+		}
+	}
+	if p.types != nil && p.filter != nil {
+		filter := p.filter
+		p.filter = withEnder(only{filter, func(key Key) bool { return p.types[key.Encoding.Type()] }}, filter)
+	}
+	if _, ok := p.filter.(Ender); ok {
+		p.checksum = true
+	}
+	if p.wrapper != nil {
+		wr, err := p.wrapper(ioReader{r})
+		if err != nil {
+			return nil, err
+		}
+		p.Reader = NewStreamReader(wr, 0)
+	}
+	if _, ok := p.Reader.(*MemReader); p.checksum && !ok {
+		p.Reader = &checksumReader{Reader: p.Reader}
+	}
+	if p.limiter != nil {
+		p.Reader = &rateLimitedReader{Reader: p.Reader, l: p.limiter}
+	}
+	p.reported = p.read()
+	return p, nil
+}
+
+// readHeader reads the magic string and the version.
+func (p *Parser) readHeader() error {
 	// "REDIS" string
 	magic, err := p.readString(5)
 	if err != nil {
@@ -124,44 +329,47 @@ func Parse(r Reader, opts ...ParseOption) error {
 	if err != nil {
 		return err
 	}
-	if v < 1 || v > 8 {
+	if v < 1 || v > maxVersion {
 		return errors.WithStack(ErrUnsupportedRDB)
 	}
-	p.version = version
+	// version is transient, it's copied
+	p.version = string([]byte(version))
+	p.pendingHeader = true
+	return nil
+}
 
-	for _, opt := range opts {
-		opt(p)
+// startWorkers starts the goroutines which decode values and call the filter.
+func (p *Parser) startWorkers() {
+	if p.filter == nil {
+		return
+	}
+	ch := p.sync
+	workers := 1
+	if p.sync == nil {
+		p.async = make(chan *redisType, filterBufferSize)
+		ch = p.async
+		workers = runtime.NumCPU()
+	}
+	if workers == 1 {
+		// at least on worker
+		workers++
 	}
 
-	if p.filter != nil {
-		ch := p.sync
-		workers := 1
-		if p.sync == nil {
-			p.async = make(chan *redisType, filterBufferSize)
-			ch = p.async
-			workers = runtime.NumCPU()
-		}
-		if workers == 1 {
-			// at least on worker
-			workers++
-		}
-
-		for i := 1; i < workers; i++ {
-			p.Add(1)
-			go p.filterWorker(ch)
-		}
+	for i := 1; i < workers; i++ {
+		p.Add(1)
+		go p.filterWorker(ch)
 	}
-	return p.Parse()
 }
 
 func (p *Parser) filterWorker(ch <-chan *redisType) {
-	var (
-		set       = new(Set)
-		list      = new(List)
-		hash      = new(Hash)
-		sds       = new(String)
-		sortedset = new(SortedSet)
-	)
+	d := &decoded{
+		set:       new(Set),
+		list:      new(List),
+		hash:      new(Hash),
+		sds:       new(String),
+		sortedset: new(SortedSet),
+		s:         &scratch{buffers: p.reuse, containers: p.reuse && !p.fresh, strict: p.strict, scores: p.scores, decoders: p.decoders},
+	}
 
 	defer p.Done()
 
@@ -170,41 +378,134 @@ func (p *Parser) filterWorker(ch <-chan *redisType) {
 		if !ok {
 			return
 		}
-		if err := rt.decompress(); err != nil {
-			p.close(err)
-			return
+		if p.metrics != nil {
+			atomic.AddInt64(&p.metrics.queued, -1)
 		}
-		switch Encoding2Type(rt.key.Encoding) {
-		case TypeSet:
-			if err := rt.set(set); err != nil {
-				p.close(err)
-				return
-			}
-			p.filter.Set(set)
-		case TypeList:
-			if err := rt.list(list); err != nil {
-				p.close(err)
-				return
-			}
-			p.filter.List(list)
-		case TypeHash:
-			if err := rt.hash(hash); err != nil {
-				p.close(err)
-				return
-			}
-			p.filter.Hash(hash)
-		case TypeString:
-			p.filter.String(rt.string(sds))
-		case TypeSortedSet:
-			if err := rt.sortedset(sortedset); err != nil {
-				p.close(err)
-				return
+		var start time.Time
+		if p.timing != nil {
+			start = time.Now()
+		}
+		span := p.startDecodeSpan(rt.key)
+		v, err := p.decode(rt, d)
+		span.End(err)
+		switch {
+		case err == nil:
+			p.timed(start, rt.key, v)
+			if p.index != nil {
+				p.index.Add(rt.key.Key, v.Memory())
 			}
-			p.filter.SortedSet(sortedset)
+			p.deliver(v)
+		case p.recovery != nil:
+			p.recovery.add(rt.key, err)
+		default:
+			p.close(err)
+			return
 		}
 
+		d.clear()
 		rt.reset()
+		d.s.reset()
+	}
+}
+
+// decoded holds the values a filter worker decodes in, they are reused across keys.
+type decoded struct {
+	set       *Set
+	list      *List
+	hash      *Hash
+	sds       *String
+	sortedset *SortedSet
+	s         *scratch
+}
+
+// clear empties the maps reused by the next keys. Their keys may alias the arena, see WithBufferReuse,
+// so they must be deleted before the arena is reset: once overwritten they hash differently.
+func (d *decoded) clear() {
+	if !d.s.reusing() {
+		return
+	}
+	for k := range d.set.Values {
+		delete(d.set.Values, k)
+	}
+	for k := range d.hash.Values {
+		delete(d.hash.Values, k)
+	}
+	for k := range d.hash.Expiries {
+		delete(d.hash.Expiries, k)
+	}
+	for k := range d.sortedset.Values {
+		delete(d.sortedset.Values, k)
+	}
+	for k := range d.sortedset.Scores {
+		delete(d.sortedset.Scores, k)
+	}
+}
+
+// decode decompresses, transforms and decodes the value of rt in d, and returns it.
+func (p *Parser) decode(rt *redisType, d *decoded) (measured, error) {
+	if err := rt.decompress(d.s); err != nil {
+		return nil, err
+	}
+	if err := rt.transform(p.transform); err != nil {
+		return nil, err
+	}
+	switch Encoding2Type(rt.key.Encoding) {
+	case TypeSet:
+		return d.set, rt.set(d.set, d.s)
+	case TypeList:
+		return d.list, rt.list(d.list, d.s)
+	case TypeHash:
+		return d.hash, rt.hash(d.hash, d.s)
+	case TypeSortedSet:
+		return d.sortedset, rt.sortedset(d.sortedset, d.s)
+	default:
+		return rt.string(d.sds, d.s), nil
+	}
+}
+
+// deliver calls the filter callback of a decoded value v, if it matches the value pattern.
+func (p *Parser) deliver(v measured) {
+	if !p.matched(v) {
+		return
 	}
+	switch v := v.(type) {
+	case *Set:
+		p.filter.Set(v)
+	case *List:
+		p.filter.List(v)
+	case *Hash:
+		p.filter.Hash(v)
+	case *String:
+		p.filter.String(v)
+	case *SortedSet:
+		p.filter.SortedSet(v)
+	}
+}
+
+// matched reports whether v matches the value pattern, if any.
+func (p *Parser) matched(v interface{}) bool {
+	return p.pattern == nil || findMatches(p.pattern, v) != nil
+}
+
+// measured is implemented by all value types.
+type measured interface {
+	Memory() uint64
+	Size() uint64
+	Len() int
+}
+
+// timed adds key, whose value v was decoded since start, to the decode timing report, if any.
+func (p *Parser) timed(start time.Time, key Key, v measured) {
+	if p.timing == nil {
+		return
+	}
+	p.timing.Add(TopKey{
+		Key:      key,
+		Memory:   v.Memory(),
+		Size:     v.Size(),
+		Length:   v.Len(),
+		Duration: time.Since(start),
+	})
 }
 
 func (p *Parser) close(err error) {
@@ -231,8 +532,9 @@ func (p *Parser) getMemory() uint64 {
 	return m
 }
 
+// readString reads a string of n bytes, which is only valid until the next read.
 func (p *Parser) readString(n int) (string, error) {
-	b, err := p.ReadBytes(n)
+	b, err := transientBytes(p.Reader, n)
 	if err != nil {
 		return "", err
 	}
@@ -249,7 +551,7 @@ func (p *Parser) readRawString(memory bool) (string, error) {
 	}
 	if p.state.compressed {
 		p.state.compressed = false
-		b, err = readLZF(b, len(b), length)
+		b, err = readLZF(b, len(b), length, nil)
 		if err != nil {
 			return "", err
 		}
@@ -264,56 +566,172 @@ func (p *Parser) readValue(memory bool) (*value, error) {
 	}
 	c := p.state.compressed
 	p.state.compressed = false
-	return newValue(c, length, p.getMemory(), b), nil
+	v := newValue(c, length, p.getMemory(), b)
+	v.o, p.state.oversized = p.state.oversized, false
+	return v, nil
 }
 
-func (p *Parser) readDoubleValue(encoding byte) (*value, error) {
-	f, err := p.readDouble(encoding)
+// compactHeader is the length of the longest header of ziplists, zipmaps and intsets.
+const compactHeader = 10
+
+// readCompactValue reads a ziplist, zipmap or intset value. If it's skipped, only its header is decoded,
+// to count its elements.
+func (p *Parser) readCompactValue(encoding Encoding) (*value, error) {
+	if !p.state.skip {
+		return p.readValue(false)
+	}
+	head, length, err := p.readHead(compactHeader, func(head []byte) bool { return saturated(encoding, head) })
 	if err != nil {
 		return nil, err
 	}
-	return newDoubleValue(f), nil
+	v := newValue(false, length, 0, nil)
+	v.n = countElements(encoding, head)
+	return v, nil
 }
 
-func (p *Parser) readDouble(encoding byte) (float64, error) {
+// readHead reads a redis string, and returns its first n bytes at most along with its length.
+// A compressed string is only decompressed as far as its first n bytes, unless whole reports true for them:
+// the whole string is returned then.
+func (p *Parser) readHead(n int, whole func(head []byte) bool) ([]byte, int, error) {
+	length, encoded, err := p.readLength(true)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !encoded {
+		if n > length {
+			n = length
+		}
+		b, err := transientBytes(p.Reader, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		head := append([]byte(nil), b...)
+		if !whole(head) {
+			p.Discard(length - n)
+			return head, length, nil
+		}
+		b, err = transientBytes(p.Reader, length-n)
+		if err != nil {
+			return nil, 0, err
+		}
+		return append(head, b...), length, nil
+	}
+
+	switch length {
+	case 0:
+		p.Discard(1)
+	case 1:
+		p.Discard(2)
+	case 2:
+		p.Discard(4)
+	case 3:
+		clen, _, err := p.readLength(false)
+		if err != nil {
+			return nil, 0, err
+		}
+		ulen, _, err := p.readLength(false)
+		if err != nil {
+			return nil, 0, err
+		}
+		b, err := transientBytes(p.Reader, clen)
+		if err != nil {
+			return nil, 0, err
+		}
+		if head := readLZFHead(b, n); !whole(head) {
+			return head, ulen, nil
+		}
+		b, err = readLZF(b, clen, ulen, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		return b, ulen, nil
+	default:
+		return nil, 0, errors.WithStack(ErrInvalidLengthEncoding)
+	}
+	// integers aren't compact values
+	return nil, 0, nil
+}
+
+// newValues returns an empty slice for n values.
+func newValues(n int) []*value {
+	if n > maxPrealloc {
+		n = maxPrealloc
+	}
+	if n < 0 {
+		n = 0
+	}
+	return make([]*value, 0, n)
+}
+
+func (p *Parser) readDoubleValue(encoding Encoding) (*value, error) {
+	f, str, err := p.readDouble(encoding)
+	if err != nil {
+		return nil, err
+	}
+	v := newDoubleValue(f)
+	if p.scores && !p.state.skip {
+		if str == "" {
+			str = formatScore(f)
+		}
+		v.b = []byte(str)
+	}
+	return v, nil
+}
+
+// readDouble reads a score, along with its string as written in the rdb file if it's one.
+// The string is only valid until the next read.
+func (p *Parser) readDouble(encoding Encoding) (float64, string, error) {
 	if encoding == EncodingSortedSet2 {
 		if p.state.skip {
 			p.Discard(8)
-			return 0, nil
+			return 0, "", nil
 		}
-		bs, err := p.ReadBytes(8)
+		bs, err := transientBytes(p.Reader, 8)
 		if err != nil {
-			return 0, err
+			return 0, "", err
 		}
-		var f64 float64
-		err = binary.Read(bytes.NewReader(bs), binary.LittleEndian, &f64)
-		return f64, err
+		return math.Float64frombits(binary.LittleEndian.Uint64(bs)), "", nil
 	}
 
 	b, err := p.ReadByte()
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
 	switch b {
 	case 253:
-		return math.NaN(), nil
+		return math.NaN(), "", nil
 	case 254:
-		return math.Inf(0), nil
+		return math.Inf(0), "", nil
 	case 255:
-		return math.Inf(-1), nil
+		return math.Inf(-1), "", nil
 	default:
 		if p.state.skip {
 			p.Discard(int(b))
-			return 0, nil
+			return 0, "", nil
 		}
 		str, err := p.readString(int(b))
 		if err != nil {
-			return 0, err
+			return 0, "", err
 		}
-		var f float64
-		fmt.Sscanf(str, "%lg", &f)
-		return f, nil
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return 0, "", errors.WithStack(err)
+		}
+		return f, str, nil
+	}
+}
+
+// formatScore formats f as redis parses scores, the shortest string which parses back to f exactly.
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
 	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
 }
 
 var (
@@ -330,7 +748,29 @@ func (p *Parser) readRawBytes(memory bool) ([]byte, int, error) {
 	}
 
 	if !encoded {
-		bs, err := p.ReadBytes(length)
+		if p.state.limit > 0 && length > p.state.limit && !p.state.skip {
+			p.state.oversized = true
+			p.Discard(length)
+			if memory {
+				p.state.memory = _overhead.alloc(length)
+			}
+			return nil, length, nil
+		}
+		if p.state.skip && (!memory || length > 32) {
+			// only short strings are checked for integers
+			p.Discard(length)
+			if memory {
+				p.state.memory = _overhead.alloc(length)
+			}
+			return nil, length, nil
+		}
+		var bs []byte
+		if p.state.skip {
+			// only checked for integers
+			bs, err = transientBytes(p.Reader, length)
+		} else {
+			bs, err = p.ReadBytes(length)
+		}
 		if err != nil {
 			return nil, 0, err
 		}
@@ -356,15 +796,11 @@ func (p *Parser) readRawBytes(memory bool) ([]byte, int, error) {
 		if err != nil {
 			return nil, 0, err
 		}
-		var buf = make([]byte, 0, 11)
-		bs, err := strconv.AppendInt(buf[:], int64(i32), 10), nil
-		if err != nil {
-			return nil, 0, err
-		}
 		p.state.memory += 8
 		if p.state.skip {
-			return nil, len(bs), nil
+			return nil, intLen(i32), nil
 		}
+		bs := strconv.AppendInt(make([]byte, 0, 11), int64(i32), 10)
 		return bs, len(bs), nil
 	case 1:
 		// 1101: an 16 bit integer
@@ -372,17 +808,13 @@ func (p *Parser) readRawBytes(memory bool) ([]byte, int, error) {
 		if err != nil {
 			return nil, 0, err
 		}
-		var buf = make([]byte, 0, 6)
-		bs, err := strconv.AppendInt(buf[:], int64(i16), 10), nil
-		if err != nil {
-			return nil, 0, err
-		}
 		if i16 < 0 || i16 >= 10000 {
 			p.state.memory += 8
 		}
 		if p.state.skip {
-			return nil, len(bs), nil
+			return nil, intLen(i16), nil
 		}
+		bs := strconv.AppendInt(make([]byte, 0, 6), int64(i16), 10)
 		return bs, len(bs), nil
 	case 0:
 		// 1100: an 8 bit integer
@@ -390,17 +822,13 @@ func (p *Parser) readRawBytes(memory bool) ([]byte, int, error) {
 		if err != nil {
 			return nil, 0, err
 		}
-		var buf = make([]byte, 0, 4)
-		bs, err := strconv.AppendInt(buf[:], int64(int8(b)), 10), nil
-		if err != nil {
-			return nil, 0, err
-		}
 		if int8(b) < 0 {
 			p.state.memory += 8
 		}
 		if p.state.skip {
-			return nil, len(bs), nil
+			return nil, intLen(int(int8(b))), nil
 		}
+		bs := strconv.AppendInt(make([]byte, 0, 4), int64(int8(b)), 10)
 		return bs, len(bs), nil
 	}
 	return nil, 0, errors.WithStack(ErrInvalidLengthEncoding)
@@ -420,6 +848,11 @@ func (p *Parser) readCompressed(memory bool) ([]byte, int, error) {
 	if memory {
 		p.state.memory += _overhead.alloc(ulen)
 	}
+	if p.state.limit > 0 && ulen > p.state.limit && !p.state.skip {
+		p.state.oversized = true
+		p.Discard(clen)
+		return nil, ulen, nil
+	}
 	if p.state.skip {
 		p.Discard(clen)
 		return nil, ulen, nil
@@ -434,57 +867,24 @@ func (p *Parser) readCompressed(memory bool) ([]byte, int, error) {
 }
 
 func (p *Parser) readLength(withEncoding bool) (int, bool, error) {
-	first, err := p.ReadByte()
-	if err != nil {
-		return 0, false, err
-	}
-	switch first {
-	case 0x80:
-		i32, err := p.big32()
-		if err != nil {
-			return 0, false, err
-		}
-		return i32, false, nil
-	case 0x81:
-		i64, err := p.big64()
-		if err != nil {
-			return 0, false, err
-		}
-		return i64, false, nil
-	default:
-		switch first >> 6 {
-		case 0:
-			// 00: 6 bits
-			return int(first & 0x3f), false, nil
-		case 1:
-			// 01: 14 bits
-			next, err := p.ReadByte()
-			if err != nil {
-				return 0, false, err
-			}
-			return int(next) | int(first&0x3f)<<8, false, nil
-		case 3:
-			// 11: encoded in a special format
-			if !withEncoding {
-				return 0, false, errors.WithStack(ErrInvalidLengthEncoding)
-			}
-			return int(first & 0x3f), true, nil
-		}
-	}
-	return 0, false, errors.WithStack(ErrInvalidLengthEncoding)
+	return readLength(p.Reader, withEncoding)
 }
 
 // Parse parses a Redis RDB file.
-func (p *Parser) Parse() error {
+func (p *Parser) Parse() (err error) {
 	var (
 		exp             = -1
-		currentDB       = DB{p: p}
-		currentKey      = Key{p: p}
+		hasExp          bool
+		idle, freq      = -1, -1
+		currentDB       = DB{p: p, Num: p.db, Size: -1, Expires: -1}
+		currentKey      = Key{p: p, DB: p.db}
 		currentType     = Type{p: p}
 		defaultStrategy = p.strategy.global
+		dbSpan          = Span(noopSpan{})
+		pendingDB       bool // whether the Database callback waits for the RESIZEDB hint
 	)
 
-	if c, ok := p.Reader.(io.Closer); ok {
+	if c, ok := p.Reader.(io.Closer); ok && p.consumed == nil {
 		defer c.Close()
 	}
 
@@ -496,22 +896,66 @@ func (p *Parser) Parse() error {
 			close(p.async)
 		}
 		p.Wait()
+		select {
+		case werr := <-p.err:
+			if err == nil {
+				err = werr
+			}
+		default:
+		}
+		dbSpan.End(err)
+		p.progress()
+		if err != nil && p.recovery != nil {
+			p.recovery.fail(p.read(), err)
+		}
+		if err == nil && p.segment == nil {
+			p.end()
+		}
 	}()
 
+	if p.timeout > 0 {
+		timer := time.AfterFunc(p.timeout, func() {
+			p.close(errors.Wrapf(ErrTimeout, "after %v", p.timeout))
+		})
+		defer timer.Stop()
+	}
+	if p.resumed {
+		dbSpan = p.startSpan("rdb.db", map[string]interface{}{"db": p.db})
+		if p.database(currentDB) {
+			return nil
+		}
+	}
 	for {
 		select {
 		case err := <-p.err:
 			return err
 		default:
 		}
+		if p.segment != nil && p.segment.i >= len(p.segment.b) ||
+			p.limit > 0 && p.read() >= p.limit || p.maxKeys > 0 && p.keys >= p.maxKeys {
+			p.header()
+			if pendingDB {
+				p.database(currentDB)
+			}
+			return nil
+		}
 
 		b, err := p.ReadByte()
 		if err != nil {
 			return err
 		}
+		if b != TokenAUX {
+			p.header()
+		}
+		if pendingDB && b != TokenResize {
+			pendingDB = false
+			if p.database(currentDB) {
+				return nil
+			}
+		}
 
 		switch b {
-		case tokenDB:
+		case TokenDB:
 			// restore default strategy
 			p.setStrategy(defaultStrategy)
 			num, _, err := p.readLength(false)
@@ -520,12 +964,19 @@ func (p *Parser) Parse() error {
 			}
 			currentKey.DB = num
 			currentDB.Num = num
-			if p.database(currentDB) {
-				return nil
+			currentDB.Size, currentDB.Expires = -1, -1
+			dbSpan.End(nil)
+			dbSpan = p.startSpan("rdb.db", map[string]interface{}{"db": num})
+			// the RESIZEDB hint follows the selector since version 7
+			pendingDB = true
+
+		case TokenAUX:
+			_, header := p.filter.(HeaderFilter)
+			header = header && p.pendingHeader
+			// AUX fields are read for the Header callback even if they're skipped
+			if p.skipStage(SkipMeta, SkipAll) && header {
+				p.state.skip = false
 			}
-
-		case tokenAUX:
-			p.skipStage(SkipMeta, SkipAll)
 			key, err := p.readRawString(false)
 			if err != nil {
 				return err
@@ -534,11 +985,17 @@ func (p *Parser) Parse() error {
 			if err != nil {
 				return err
 			}
+			if header {
+				if p.aux == nil {
+					p.aux = make(map[string]string)
+				}
+				p.aux[key] = value
+			}
 			if !p.skipStage(SkipMeta, SkipAll) {
 				fmt.Printf("AUX: %s: %s\n", key, value)
 			}
 
-		case tokenResize:
+		case TokenResize:
 			dbSize, _, err := p.readLength(false)
 			if err != nil {
 				return err
@@ -547,11 +1004,19 @@ func (p *Parser) Parse() error {
 			if err != nil {
 				return err
 			}
+			if pendingDB {
+				pendingDB = false
+				currentDB.Size, currentDB.Expires = dbSize, expiresSize
+				if p.database(currentDB) {
+					return nil
+				}
+			}
 			if !p.skipStage(SkipMeta, SkipAll) {
 				fmt.Printf("db_size: %d, expires_size: %d\n", dbSize, expiresSize)
 			}
 
-		case tokenExpMSec:
+		case TokenExpMSec:
+			hasExp = true
 			if p.skipStage(SkipExpiry, SkipAll) {
 				p.Discard(8)
 				break
@@ -561,7 +1026,8 @@ func (p *Parser) Parse() error {
 				return err
 			}
 
-		case tokenExpSec:
+		case TokenExpSec:
+			hasExp = true
 			if p.skipStage(SkipExpiry, SkipAll) {
 				p.Discard(4)
 				break
@@ -570,13 +1036,43 @@ func (p *Parser) Parse() error {
 			if err != nil {
 				return err
 			}
+			// EXPIRETIME holds seconds, Key.Expiry is in milliseconds
+			exp *= 1000
 
-		case tokenEOF:
-			return nil
+		case TokenIdle:
+			idle, _, err = p.readLength(false)
+			if err != nil {
+				return err
+			}
+
+		case TokenFreq:
+			c, err := p.ReadByte()
+			if err != nil {
+				return err
+			}
+			freq = int(c)
+
+		case TokenFunction2:
+			if err := p.functions(); err != nil {
+				return err
+			}
+
+		case TokenFunctionPreGA:
+			return errors.Wrap(ErrUnsupportedRDB, "functions of a redis 7 release candidate")
+
+		case TokenModuleAUX:
+			if err := p.moduleAux(); err != nil {
+				return err
+			}
+
+		case TokenEOF:
+			return p.readEOF()
 
 		default:
 			p.skipStage(SkipAll)
-			currentType.Encoding = b
+			encoding := Encoding(b)
+			currentKey.offset = p.read() - 1
+			currentType.Encoding = encoding
 			if p.typ(currentType) {
 				return nil
 			}
@@ -588,16 +1084,40 @@ func (p *Parser) Parse() error {
 			}
 			currentKey.Key = key
 			currentKey.Expiry = exp
-			currentKey.Encoding = b
+			currentKey.HasExpiry = hasExp
+			currentKey.Idle, currentKey.Freq = idle, freq
+			currentKey.Encoding = encoding
 			currentKey.memory = p.getMemory() + _overhead.top(exp)
+			p.keys++
+			if p.metrics != nil {
+				atomic.AddInt64(&p.metrics.keys, 1)
+				p.progress()
+			}
 			if p.key(currentKey) {
 				return nil
 			}
-			exp = -1
+			exp, idle, freq = -1, -1, -1
+			hasExp = false
 
 			p.skipStage(SkipValue, SkipAll)
-			switch b {
+			if p.filter == nil || p.strategy.running&SkipAll != 0 {
+				// the value isn't delivered, it's only skipped
+				ok, err := p.skipValue(encoding)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return &EncodingError{Key: currentKey.Key, Encoding: encoding, Offset: currentKey.offset}
+				}
+				if p.index != nil {
+					p.index.Add(currentKey.Key, currentKey.memory)
+				}
+				p.clearstate()
+				continue
+			}
+			switch encoding {
 			case EncodingString:
+				p.state.limit = p.maxString
 				value, err := p.readValue(true)
 				if err != nil {
 					return err
@@ -610,15 +1130,16 @@ func (p *Parser) Parse() error {
 					return err
 				}
 
-				if b == EncodingList {
+				if encoding == EncodingList {
 					p.sizeint = 4
 				}
-				values := make([]*value, size)
+				values := newValues(size)
 				for i := 0; i < size; i++ {
-					values[i], err = p.readValue(true)
+					value, err := p.readValue(true)
 					if err != nil {
 						return err
 					}
+					values = append(values, value)
 				}
 				p.filterRedisType(currentKey, values...)
 
@@ -628,12 +1149,13 @@ func (p *Parser) Parse() error {
 					return err
 				}
 
-				values := make([]*value, size*2)
+				values := newValues(size * 2)
 				for i := 0; i < size*2; i++ {
-					values[i], err = p.readValue(true)
+					value, err := p.readValue(true)
 					if err != nil {
 						return err
 					}
+					values = append(values, value)
 				}
 				p.filterRedisType(currentKey, values...)
 
@@ -642,22 +1164,23 @@ func (p *Parser) Parse() error {
 				if err != nil {
 					return err
 				}
-				values := make([]*value, size*2)
+				values := newValues(size * 2)
 				for i := 0; i < size; i++ {
-					values[2*i], err = p.readValue(true)
+					member, err := p.readValue(true)
 					if err != nil {
 						return err
 					}
-					values[2*i+1], err = p.readDoubleValue(b)
+					score, err := p.readDoubleValue(encoding)
 					if err != nil {
 						return err
 					}
+					values = append(values, member, score)
 				}
 				p.filterRedisType(currentKey, values...)
 
 			case EncodingZipmap, EncodingZiplist, EncodingHashZip,
 				EncodingSortedSetZip, EncodingIntset:
-				value, err := p.readValue(false)
+				value, err := p.readCompactValue(encoding)
 				if err != nil {
 					return err
 				}
@@ -669,18 +1192,37 @@ func (p *Parser) Parse() error {
 				if err != nil {
 					return err
 				}
-				values := make([]*value, size)
+				values := newValues(size)
 				for i := 0; i < size; i++ {
-					values[i], err = p.readValue(false)
+					value, err := p.readCompactValue(EncodingZiplist)
 					if err != nil {
 						return err
 					}
+					values = append(values, value)
 				}
 				p.filterRedisType(currentKey, values...)
 
+			case EncodingHashMetadataPreGA, EncodingHashMetadata:
+				values, err := p.readHashMetadata(encoding)
+				if err != nil {
+					return err
+				}
+				p.filterRedisType(currentKey, values...)
+
+			case EncodingModule2:
+				// module values can only be decoded by their module, the key is given to the filter only
+				if err := p.skipModuleValue(); err != nil {
+					return err
+				}
+
+			case EncodingHashListpackPreGA, EncodingHashListpackEx:
+				// listpacks aren't decoded, the key is given to the filter only
+				if err := p.skipHashListpackEx(encoding); err != nil {
+					return err
+				}
+
 			default:
-				log.Printf("unsupported encoding: %d, %x\n", b, b)
-				return nil
+				return &EncodingError{Key: currentKey.Key, Encoding: encoding, Offset: currentKey.offset}
 			}
 		}
 		// restore default state
@@ -688,10 +1230,70 @@ func (p *Parser) Parse() error {
 	}
 }
 
+// Offset returns the number of bytes read or skipped, the header included.
+// Once the EOF opcode is parsed, it's the offset following the opcode.
+// It's 0 unless the Reader is returned by NewMemReader or WithChecksum is set.
+//
+// A Parser is available to custom ParseOptions, e.g.
+//
+//	var p *rdb.Parser
+//	err := rdb.Parse(reader, rdb.WithFilter(filter{}), func(parser *rdb.Parser) { p = parser })
+func (p *Parser) Offset() int64 {
+	if p.eof != nil {
+		return p.eof.offset
+	}
+	return p.read()
+}
+
+// read returns the number of bytes read or skipped, the checksum following the EOF opcode included.
+func (p *Parser) read() int64 {
+	if t, ok := p.Reader.(tracker); ok {
+		return int64(t.Offset())
+	}
+	return 0
+}
+
+// Checksum returns the CRC64 of the bytes read or skipped, the header included, as redis computes it.
+// Once the EOF opcode is parsed, it's the checksum of the data up to the opcode,
+// which matches the one stored in the rdb file of version 5 or later.
+// It's 0 unless the Reader is returned by NewMemReader or WithChecksum is set.
+func (p *Parser) Checksum() uint64 {
+	if p.eof != nil {
+		return p.eof.checksum
+	}
+	if t, ok := p.Reader.(tracker); ok {
+		return t.Checksum()
+	}
+	return 0
+}
+
+// readEOF reads the checksum following the EOF opcode, in rdb files of version 5 or later.
+func (p *Parser) readEOF() error {
+	e := &eof{offset: p.Offset(), checksum: p.Checksum()}
+	if v, _ := strconv.Atoi(p.version); v >= 5 {
+		b, err := transientBytes(p.Reader, 8)
+		if err != nil {
+			return err
+		}
+		e.stored = binary.LittleEndian.Uint64(b)
+	}
+	p.eof = e
+	return nil
+}
+
+// end calls the End callback of the filter, once the EOF opcode is parsed.
+func (p *Parser) end() {
+	if e, ok := p.filter.(Ender); ok && p.eof != nil {
+		e.End(p.eof.stored, p.eof.stored == 0 || p.eof.stored == p.eof.checksum)
+	}
+}
+
 func (p *Parser) clearstate() {
 	p.state.memory = 0
 	p.state.skip = false
 	p.state.compressed = false
+	p.state.limit = 0
+	p.state.oversized = false
 	p.strategy.running = p.strategy.global
 	p.sizeint = 8
 }
@@ -735,10 +1337,16 @@ func (p *Parser) filterRedisType(key Key, values ...*value) {
 	rt.values = values
 	rt.i = i
 
+	if p.metrics != nil {
+		atomic.AddInt64(&p.metrics.queued, 1)
+	}
 	select {
 	case p.async <- rt:
 	case p.sync <- rt:
 	case err := <-p.err:
 		p.close(err)
+		if p.metrics != nil {
+			atomic.AddInt64(&p.metrics.queued, -1)
+		}
 	}
 }
@@ -1,13 +1,18 @@
 package rdb
 
 import (
+	"bytes"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -47,6 +52,17 @@ func TestParse(t *testing.T) {
 			t.Fatalf("index: %v, got: %+v, want: %v", i, got, test.want)
 		}
 		test.validate(t)
+
+		test.reset()
+		file, err := os.Open(test.file)
+		if err != nil {
+			t.Fatal(err, i)
+		}
+		if got := Parse(NewStreamReader(file, 0), test.options...); errors.Cause(got) != test.want {
+			t.Fatalf("index: %v, got: %+v, want: %v", i, got, test.want)
+		}
+		file.Close()
+		test.validate(t)
 	}
 }
 
@@ -706,3 +722,411 @@ var (
 	_300bytes = `IJXP54329MQ96A2M28QF6SFX3XGNWGAII3M32MSIMR0O478AMZKNXDUYD5JGMHJRB9A85RZ3DC3AIS62YSDW2BDJ97IBSH7FKOVFWKJYS7XBMIBX0Z1WNLQRY7D27PFPBBGBDFDCKL0FIOBYEADX6G5UK3B0XYMGS0379GRY6F0FY5Q9JUCJLGOGDNNP8XW3SJX2L872UJZZL8G871G9THKYQ2WKPFEBIHOOTIGDNWC15NL5324W8FYDP97JHKCSMLWXNMSTYIUE7F22ZGR4NZK3T0UTBZ2AFRCT5LMT3P6B`
 	_20kbytes string
 )
+
+type keyCountFilter struct {
+	testEmptyFilter
+	skip   bool
+	keys   int
+	values int
+}
+
+func (f *keyCountFilter) Key(k Key) bool {
+	f.Lock()
+	f.keys++
+	f.Unlock()
+	if f.skip {
+		k.Skip(SkipAll)
+	}
+	return false
+}
+
+func (f *keyCountFilter) value() {
+	f.Lock()
+	f.values++
+	f.Unlock()
+}
+
+func (f *keyCountFilter) String(*String)       { f.value() }
+func (f *keyCountFilter) List(*List)           { f.value() }
+func (f *keyCountFilter) Set(*Set)             { f.value() }
+func (f *keyCountFilter) Hash(*Hash)           { f.value() }
+func (f *keyCountFilter) SortedSet(*SortedSet) { f.value() }
+
+func TestParseSkipAll(t *testing.T) {
+	files, err := filepath.Glob("testdata/dumps/*.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		parse := func(skip bool) *keyCountFilter {
+			r, err := NewMemReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := &keyCountFilter{skip: skip}
+			if err := Parse(r, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+				t.Fatalf("%v: %v", file, err)
+			}
+			return f
+		}
+		want, got := parse(false), parse(true)
+		if got.keys != want.keys || got.values != 0 {
+			t.Fatalf("%v: want %v keys, got %v keys and %v values", file, want.keys, got.keys, got.values)
+		}
+	}
+}
+
+func benchmarkDump(b *testing.B) []byte {
+	var buf bytes.Buffer
+	sh := shape{Seed: 1, Keys: 2000, Elements: 100, ValueSize: 64, Expiry: 0.2, Compact: true}
+	if err := generate(&buf, sh); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func benchmarkParse(b *testing.B, strategy int) {
+	data := benchmarkDump(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewStreamReader(bytes.NewReader(data), 0)
+		if err := Parse(r, WithFilter(&testEmptyFilter{}), WithStrategy(strategy)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B)          { benchmarkParse(b, 0) }
+func BenchmarkParseSkipValue(b *testing.B) { benchmarkParse(b, SkipValue) }
+func BenchmarkParseSkipAll(b *testing.B)   { benchmarkParse(b, SkipAll) }
+
+type dbSizeFilter struct {
+	testEmptyFilter
+
+	got []DB
+}
+
+func (f *dbSizeFilter) Database(db DB) bool {
+	f.got = append(f.got, db)
+	return false
+}
+
+func TestDatabaseSize(t *testing.T) {
+	tests := []struct {
+		file          string
+		size, expires int
+	}{
+		{"testdata/dumps/big_string.rdb", 3, 0},
+		{"testdata/dumps/keys_with_expiry.rdb", -1, -1},
+	}
+	for _, test := range tests {
+		r, err := NewMemReader(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := new(dbSizeFilter)
+		if err := Parse(r, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+			t.Fatal(test.file, err)
+		}
+		if len(f.got) != 1 || f.got[0].Size != test.size || f.got[0].Expires != test.expires {
+			t.Fatalf("%v: want: %v, %v, got: %+v", test.file, test.size, test.expires, f.got)
+		}
+	}
+}
+
+type lenFilter struct {
+	testEmptyFilter
+
+	got map[string]int
+}
+
+func (f *lenFilter) add(key Key, n int) {
+	f.Lock()
+	defer f.Unlock()
+	f.got[key.Key] = n
+}
+
+func (f *lenFilter) Set(s *Set)             { f.add(s.Key, s.Len()) }
+func (f *lenFilter) List(l *List)           { f.add(l.Key, l.Len()) }
+func (f *lenFilter) Hash(h *Hash)           { f.add(h.Key, h.Len()) }
+func (f *lenFilter) String(s *String)       { f.add(s.Key, s.Len()) }
+func (f *lenFilter) SortedSet(s *SortedSet) { f.add(s.Key, s.Len()) }
+
+func TestSkipValueLen(t *testing.T) {
+	files, err := filepath.Glob("testdata/dumps/*.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := generate(&buf, shape{Seed: 1, Keys: 80, Elements: 30, ValueSize: 8, Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	readers := map[string]func() Reader{
+		"generated": func() Reader { return &MemReader{b: buf.Bytes()} },
+	}
+	for _, file := range files {
+		file := file
+		readers[file] = func() Reader {
+			r, err := NewMemReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return r
+		}
+	}
+	for name, reader := range readers {
+		var got [2]map[string]int
+		for i, strategy := range []int{SkipMeta, SkipMeta | SkipValue} {
+			f := &lenFilter{got: make(map[string]int)}
+			if err := Parse(reader(), WithFilter(f), WithStrategy(strategy)); err != nil {
+				t.Fatal(name, err)
+			}
+			got[i] = f.got
+		}
+		if !reflect.DeepEqual(got[0], got[1]) {
+			t.Fatalf("%v: want: %v, got: %v", name, got[0], got[1])
+		}
+	}
+}
+
+func TestSkipValueLenSaturated(t *testing.T) {
+	// the headers of these values can't count their entries, which are walked instead
+	var list, hash, zipmapped []string
+	for i := 0; i < 70000; i++ {
+		list = append(list, strconv.Itoa(i))
+	}
+	for i := 0; i < 33000; i++ {
+		hash = append(hash, "f"+strconv.Itoa(i), "v")
+	}
+	for i := 0; i < 300; i++ {
+		zipmapped = append(zipmapped, "f"+strconv.Itoa(i), "v")
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeKey(Key{Key: "list", Expiry: -1}, EncodingZiplist)
+	e.writeString(string(ziplist(list)))
+	e.writeKey(Key{Key: "hash", Expiry: -1}, EncodingHashZip)
+	e.writeString(string(ziplist(hash)))
+	e.writeKey(Key{Key: "zipmap", Expiry: -1}, EncodingZipmap)
+	e.writeString(string(zipmap(zipmapped)))
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"list": 70000, "hash": 33000, "zipmap": 300}
+	for _, strategy := range []int{SkipMeta, SkipMeta | SkipValue} {
+		f := &lenFilter{got: make(map[string]int)}
+		if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(strategy)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f.got, want) {
+			t.Fatalf("strategy %v: want: %v, got: %v", strategy, want, f.got)
+		}
+	}
+}
+
+func TestScoreStrings(t *testing.T) {
+	parse := func(file string, opts ...ParseOption) map[string]string {
+		r, err := NewMemReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mu sync.Mutex
+		scores := make(map[string]string)
+		f := FuncFilter{OnSortedSet: func(s *SortedSet) {
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range s.Values {
+				score, ok := s.Scores[k]
+				if !ok {
+					continue
+				}
+				if f, err := strconv.ParseFloat(score, 64); err != nil || f != v {
+					t.Errorf("member: %v, want: %v, got: %q", k, v, score)
+				}
+				scores[k] = score
+			}
+		}}
+		if err := Parse(r, append(opts, WithFilter(f), WithStrategy(SkipMeta))...); err != nil {
+			t.Fatal(err)
+		}
+		return scores
+	}
+
+	tests := []struct {
+		file string
+		want map[string]string
+	}{
+		{"testdata/dumps/rdb_version_8_with_64b_length_and_scores.rdb", map[string]string{"finalfield": "2.718"}},
+		{"testdata/dumps/sorted_set_as_ziplist.rdb", map[string]string{
+			"8b6ba6718a786daefa69438148361901": "1",
+			"cb7a24bb7528f934b841b34c3a73e0c7": "2.3700000000000001", // as written by redis with %.17g
+			"523af537946b79c4f8369ed39ba78605": "3.423",
+		}},
+	}
+	for _, test := range tests {
+		got := parse(test.file, WithScoreStrings())
+		for k, want := range test.want {
+			if got[k] != want {
+				t.Fatalf("file: %v, member: %v, want: %q, got: %q", test.file, k, want, got[k])
+			}
+		}
+		if got := parse(test.file); len(got) != 0 {
+			t.Fatalf("file: %v, want: no scores, got: %v", test.file, len(got))
+		}
+	}
+	if got := parse("testdata/dumps/regular_sorted_set.rdb", WithScoreStrings()); len(got) == 0 {
+		t.Fatal("want: scores")
+	}
+
+	for f, want := range map[float64]string{0.1: "0.1", 1e21: "1e+21", math.Inf(1): "inf", math.Inf(-1): "-inf"} {
+		if got := formatScore(f); got != want {
+			t.Fatalf("want: %v, got: %v", want, got)
+		}
+	}
+}
+
+func TestHasExpiry(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i := 0; i < 10; i++ {
+		key := Key{Key: strconv.Itoa(i), Expiry: -1}
+		if i%3 == 0 {
+			key.Expiry = 1500000000000 + i
+		}
+		e.String(&String{Key: key, Value: "v"})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strategy := range []int{SkipMeta, SkipMeta | SkipExpiry | SkipValue} {
+		var withExpiry, decoded int
+		f := FuncFilter{OnKey: func(key Key) bool {
+			if key.HasExpiry {
+				withExpiry++
+			}
+			if key.Expiry >= 0 {
+				decoded++
+			}
+			return false
+		}}
+		if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(strategy)); err != nil {
+			t.Fatal(err)
+		}
+		want := 4
+		if strategy&SkipExpiry != 0 {
+			want = 0
+		}
+		if withExpiry != 4 || decoded != want {
+			t.Fatalf("strategy: %v, want: 4 keys with expiry, %v decoded, got: %v, %v", strategy, want, withExpiry, decoded)
+		}
+	}
+}
+
+func TestMaxStringSize(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "small", Expiry: -1}, Value: "value"})
+	e.String(&String{Key: Key{Key: "big", Expiry: -1}, Value: strings.Repeat("x", 100000)})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		value     string
+		oversized bool
+		size      uint64
+		memory    uint64
+	}
+	parse := func(opts ...ParseOption) map[string]result {
+		var mu sync.Mutex
+		got := make(map[string]result)
+		f := FuncFilter{OnString: func(s *String) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[s.Key.Key] = result{s.Value, s.Oversized, s.Size(), s.Memory()}
+		}}
+		r := NewStreamReader(bytes.NewReader(buf.Bytes()), 0)
+		if err := Parse(r, append(opts, WithFilter(f), WithStrategy(SkipMeta))...); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	want := parse()
+	got := parse(WithMaxStringSize(1000))
+	if got["small"] != want["small"] {
+		t.Fatalf("want: %+v, got: %+v", want["small"], got["small"])
+	}
+	big := want["big"]
+	big.value, big.oversized = "", true
+	if got["big"] != big {
+		t.Fatalf("want: %+v, got: %+v", big, got["big"])
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i := 0; i < 1000; i++ {
+		e.String(&String{Key: Key{Key: strconv.Itoa(i), Expiry: -1}, Value: "v"})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := FuncFilter{OnKey: func(key Key) bool {
+		time.Sleep(time.Millisecond)
+		return false
+	}}
+	err := Parse(NewStreamReader(bytes.NewReader(buf.Bytes()), 0), WithFilter(slow), WithTimeout(20*time.Millisecond))
+	if errors.Cause(err) != ErrTimeout {
+		t.Fatalf("want: %v, got: %v", ErrTimeout, err)
+	}
+	if err := Parse(NewStreamReader(bytes.NewReader(buf.Bytes()), 0), WithFilter(FuncFilter{}), WithTimeout(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpirySeconds(t *testing.T) {
+	// EXPIRETIME records of redis before 2.6 hold seconds, Key.Expiry is in milliseconds regardless
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeByte(TokenExpSec)
+	e.write([]byte{0x00, 0xf1, 0x53, 0x65}) // 1700000000
+	e.String(&String{Key: Key{Key: "sec", Expiry: -1}, Value: "v"})
+	e.String(&String{Key: Key{Key: "ms", Expiry: 1700000000123}, Value: "v"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strategy := range []int{SkipMeta, SkipMeta | SkipExpiry} {
+		expiries := make(map[string]Key)
+		f := FuncFilter{OnKey: func(key Key) bool {
+			expiries[key.Key] = key
+			return false
+		}}
+		if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(strategy|SkipValue)); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{"sec": 1700000000000, "ms": 1700000000123}
+		if strategy&SkipExpiry != 0 {
+			want = map[string]int{"sec": -1, "ms": -1}
+		}
+		for key, expiry := range want {
+			if k := expiries[key]; k.Expiry != expiry || !k.HasExpiry {
+				t.Fatalf("strategy %v: want: key %v expiring at %v, got: %+v", strategy, key, expiry, k)
+			}
+		}
+	}
+
+	s, err := ScanSkeleton(&MemReader{b: buf.Bytes()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 2 || s.Entries[0].Expiry != 1700000000000 || s.Entries[1].Expiry != 1700000000123 {
+		t.Fatalf("want: expiries in milliseconds, got: %+v", s.Entries)
+	}
+}
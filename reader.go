@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"io"
 	"os"
+
+	"github.com/pkg/errors"
 )
 
 // Reader is the interface that wraps the operations against rdb data.
@@ -20,6 +22,101 @@ type Reader interface {
 	ReadBytes(n int) ([]byte, error)
 }
 
+// transientReader is implemented by Readers which can read bytes without allocating them.
+// The slice returned by transientBytes is only valid until the next read.
+type transientReader interface {
+	transientBytes(n int) ([]byte, error)
+}
+
+// transientBytes reads exactly n bytes from r, which are only valid until the next read.
+func transientBytes(r Reader, n int) ([]byte, error) {
+	if t, ok := r.(transientReader); ok {
+		return t.transientBytes(n)
+	}
+	return r.ReadBytes(n)
+}
+
+// lengthReader is implemented by Readers which decode length encodings faster than byte by byte.
+type lengthReader interface {
+	readLength(withEncoding bool) (int, bool, error)
+}
+
+// readLength reads a length encoding from r, it's decoded byte by byte unless r is a lengthReader.
+func readLength(r Reader, withEncoding bool) (int, bool, error) {
+	if l, ok := r.(lengthReader); ok {
+		return l.readLength(withEncoding)
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first {
+	case 0x80:
+		i32, err := r.big32()
+		if err != nil {
+			return 0, false, err
+		}
+		return i32, false, nil
+	case 0x81:
+		i64, err := r.big64()
+		if err != nil {
+			return 0, false, err
+		}
+		return i64, false, nil
+	default:
+		switch first >> 6 {
+		case 0:
+			// 00: 6 bits
+			return int(first & 0x3f), false, nil
+		case 1:
+			// 01: 14 bits
+			next, err := r.ReadByte()
+			if err != nil {
+				return 0, false, err
+			}
+			return int(next) | int(first&0x3f)<<8, false, nil
+		case 3:
+			// 11: encoded in a special format
+			if !withEncoding {
+				return 0, false, errors.WithStack(ErrInvalidLengthEncoding)
+			}
+			return int(first & 0x3f), true, nil
+		}
+	}
+	return 0, false, errors.WithStack(ErrInvalidLengthEncoding)
+}
+
+// decodeLength decodes the length encoding at the start of b, it returns the length, whether it's encoded
+// in a special format and the number of bytes it's made of.
+func decodeLength(b []byte, withEncoding bool) (int, bool, int, error) {
+	first := b[0]
+	switch {
+	case first == 0x80:
+		if len(b) < 5 {
+			return 0, false, 0, io.ErrUnexpectedEOF
+		}
+		return int(int32(binary.BigEndian.Uint32(b[1:]))), false, 5, nil
+	case first == 0x81:
+		if len(b) < 9 {
+			return 0, false, 0, io.ErrUnexpectedEOF
+		}
+		return int(int64(binary.BigEndian.Uint64(b[1:]))), false, 9, nil
+	case first>>6 == 0:
+		// 00: 6 bits
+		return int(first & 0x3f), false, 1, nil
+	case first>>6 == 1:
+		// 01: 14 bits
+		if len(b) < 2 {
+			return 0, false, 0, io.ErrUnexpectedEOF
+		}
+		return int(b[1]) | int(first&0x3f)<<8, false, 2, nil
+	case first>>6 == 3 && withEncoding:
+		// 11: encoded in a special format
+		return int(first & 0x3f), true, 1, nil
+	}
+	return 0, false, 0, errors.WithStack(ErrInvalidLengthEncoding)
+}
+
 // numberReader is the interface that converts byte sequences into number.
 type numberReader interface {
 	big32() (int, error)
@@ -33,6 +130,9 @@ type numberReader interface {
 type MemReader struct {
 	i int
 	b []byte
+
+	crc    uint64 // checksum of b[:crcOff]
+	crcOff int
 }
 
 // NewMemReader memory-maps the named file and returns a MemReader that reads from it.
@@ -44,15 +144,46 @@ func NewMemReader(file string) (Reader, error) {
 	return &MemReader{b: b}, nil
 }
 
-// Discard skips the next n bytes.
+// Offset returns the number of bytes read or skipped.
+func (r *MemReader) Offset() int {
+	return r.i
+}
+
+// Checksum returns the CRC64 of the bytes read or skipped, it's computed incrementally on demand.
+func (r *MemReader) Checksum() uint64 {
+	end := r.i
+	if end > len(r.b) {
+		end = len(r.b)
+	}
+	if end > r.crcOff {
+		r.crc = CRC64(r.crc, r.b[r.crcOff:end])
+		r.crcOff = end
+	}
+	return r.crc
+}
+
+// Read implements io.Reader, it copies the unread bytes into b.
+func (r *MemReader) Read(b []byte) (int, error) {
+	if r.i >= len(r.b) {
+		return 0, io.EOF
+	}
+	n := copy(b, r.b[r.i:])
+	r.i += n
+	return n, nil
+}
+
+// Discard skips the next n bytes, or the remaining bytes if fewer are available.
 func (r *MemReader) Discard(n int) {
+	if n < 0 || n > len(r.b)-r.i {
+		n = len(r.b) - r.i
+	}
 	r.i += n
 }
 
 // ReadByte reads and returns a single byte.
 // If no byte is available, returns an error.
 func (r *MemReader) ReadByte() (byte, error) {
-	if 1 > len(r.b[r.i:]) {
+	if r.i >= len(r.b) {
 		return 0, io.ErrUnexpectedEOF
 	}
 	r.i++
@@ -64,13 +195,29 @@ func (r *MemReader) ReadByte() (byte, error) {
 //
 // NOTE: It's not safe to modify the returned slice.
 func (r *MemReader) ReadBytes(n int) ([]byte, error) {
-	if n > len(r.b[r.i:]) {
+	if n < 0 || n > len(r.b)-r.i {
 		return nil, io.ErrUnexpectedEOF
 	}
 	r.i += n
 	return r.b[r.i-n : r.i], nil
 }
 
+func (r *MemReader) readLength(withEncoding bool) (int, bool, error) {
+	if r.i >= len(r.b) {
+		return 0, false, io.ErrUnexpectedEOF
+	}
+	length, encoded, n, err := decodeLength(r.b[r.i:], withEncoding)
+	if err != nil {
+		return 0, false, err
+	}
+	r.i += n
+	return length, encoded, nil
+}
+
+func (r *MemReader) transientBytes(n int) ([]byte, error) {
+	return r.ReadBytes(n)
+}
+
 func (r *MemReader) readString(n int) (string, error) {
 	b, err := r.ReadBytes(n)
 	if err != nil {
@@ -79,6 +226,23 @@ func (r *MemReader) readString(n int) (string, error) {
 	return bytes2string(b), nil
 }
 
+// littleInt reads a signed integer of n bytes, 2, 4 or 8, in little endian format.
+// Unlike little64, it's exact on 32-bit platforms.
+func (r *MemReader) littleInt(n int) (int64, error) {
+	b, err := r.ReadBytes(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
 // helper funcs that converts byte sequences into number.
 
 func (r *MemReader) little16() (int, error) {
@@ -121,12 +285,17 @@ func (r *MemReader) big64() (int, error) {
 	return int(int64(binary.BigEndian.Uint64(b))), nil
 }
 
+// maxReadAhead is the size BufferReader.ReadBytes allocates before the bytes are read.
+const maxReadAhead = 1 << 20
+
 // BufferReader is a Reader that reads from a *bufio.Reader.
 type BufferReader struct {
 	*bufio.Reader
 
-	buf  [8]byte
-	file *os.File
+	buf     [8]byte
+	size    int    // size of the buffer as requested, bufio.Reader.Size needs Go 1.10
+	scratch []byte // holds transient reads larger than the buffer
+	file    io.Closer
 }
 
 // NewBufferReader returns a new BufferReader reading from file.
@@ -141,11 +310,21 @@ func NewBufferReader(file string, size int) (Reader, error) {
 	}
 	return &BufferReader{
 		file:   f,
+		size:   size,
 		Reader: bufio.NewReaderSize(f, size),
 	}, nil
 }
 
-// Close closes the file.
+// NewStreamReader returns a new BufferReader reading from r, such as a pipe, which can't be memory-mapped.
+// It's buffer has at least the specified size. If size == 0, use default size.
+func NewStreamReader(r io.Reader, size int) Reader {
+	if size == 0 {
+		size = 4096
+	}
+	return &BufferReader{Reader: bufio.NewReaderSize(r, size), size: size}
+}
+
+// Close closes the file, readers returned by NewStreamReader are left open.
 func (r *BufferReader) Close() error {
 	if r.file != nil {
 		f := r.file
@@ -162,13 +341,77 @@ func (r *BufferReader) Discard(n int) {
 
 // ReadBytes reads and returns exactly n bytes.
 // If ReadBytes reads fewer than n bytes, it also returns an error.
+//
+// The returned slice is owned by the caller, bytes which don't outlive the next read
+// are read with transientBytes instead.
 func (r *BufferReader) ReadBytes(n int) ([]byte, error) {
-	buf := make([]byte, n)
-	_, err := io.ReadFull(r, buf)
+	if n < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// n may be corrupt, so large buffers grow as they are filled
+	size := n
+	if size > maxReadAhead {
+		size = maxReadAhead
+	}
+	buf := make([]byte, size)
+	for off := 0; ; {
+		k, err := io.ReadFull(r, buf[off:])
+		off += k
+		if err != nil {
+			if err == io.EOF && off > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if off == n {
+			return buf, nil
+		}
+		grow := len(buf)
+		if grow > n-off {
+			grow = n - off
+		}
+		buf = append(buf, make([]byte, grow)...)
+	}
+}
+
+// transientBytes reads exactly n bytes, they are peeked from the buffer if it's large enough.
+func (r *BufferReader) transientBytes(n int) ([]byte, error) {
+	if n > maxReadAhead {
+		return r.ReadBytes(n)
+	}
+	if n > r.size {
+		if cap(r.scratch) < n {
+			r.scratch = make([]byte, n)
+		}
+		_, err := io.ReadFull(r, r.scratch[:n])
+		if err != nil {
+			return nil, err
+		}
+		return r.scratch[:n], nil
+	}
+	b, err := r.Peek(n)
 	if err != nil {
+		if len(b) > 0 && err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
-	return buf, nil
+	r.Reader.Discard(n)
+	return b, nil
+}
+
+// readLength reads a length encoding, its bytes are peeked at once instead of read one by one.
+func (r *BufferReader) readLength(withEncoding bool) (int, bool, error) {
+	b, err := r.Peek(9)
+	if len(b) == 0 {
+		return 0, false, err
+	}
+	length, encoded, n, err := decodeLength(b, withEncoding)
+	if err != nil {
+		return 0, false, err
+	}
+	r.Reader.Discard(n)
+	return length, encoded, nil
 }
 
 // helper funcs that converts byte sequences into number.
@@ -220,3 +463,191 @@ func (r *BufferReader) big64() (int, error) {
 	}
 	return int(int64(binary.BigEndian.Uint64(b))), nil
 }
+
+// WithReaderWrapper returns a ParseOption which inserts a layer, such as decryption,
+// between the Reader given to Parse and the parser. The wrapped data is read through a buffer.
+func WithReaderWrapper(wrapper func(io.Reader) (io.Reader, error)) ParseOption {
+	return func(p *Parser) {
+		p.wrapper = wrapper
+	}
+}
+
+// ioReader adapts a Reader to io.Reader.
+type ioReader struct {
+	Reader
+}
+
+func (r ioReader) Read(b []byte) (int, error) {
+	if rd, ok := r.Reader.(io.Reader); ok {
+		return rd.Read(b)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c, err := r.ReadByte()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	b[0] = c
+	return 1, nil
+}
+
+// WithChecksum returns a ParseOption which maintains the CRC64 of the data read, returned by Parser.Checksum.
+// Readers returned by NewMemReader always maintain it.
+func WithChecksum() ParseOption {
+	return func(p *Parser) {
+		p.checksum = true
+	}
+}
+
+// tracker is implemented by Readers which track their offset and checksum.
+type tracker interface {
+	Offset() int
+	Checksum() uint64
+}
+
+// checksumReader is a Reader which maintains the offset and the CRC64 of the data read from a Reader.
+type checksumReader struct {
+	Reader
+
+	off int
+	crc uint64
+}
+
+// Offset returns the number of bytes read or skipped.
+func (r *checksumReader) Offset() int {
+	return r.off
+}
+
+// Checksum returns the CRC64 of the bytes read or skipped.
+func (r *checksumReader) Checksum() uint64 {
+	return r.crc
+}
+
+// Close closes the underlying Reader if it's an io.Closer.
+func (r *checksumReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (r *checksumReader) update(b []byte) {
+	r.off += len(b)
+	r.crc = CRC64(r.crc, b)
+}
+
+// Discard skips the next n bytes, they are read to be checksummed.
+func (r *checksumReader) Discard(n int) {
+	for n > 0 {
+		k := n
+		if k > 4096 {
+			k = 4096
+		}
+		b, err := transientBytes(r.Reader, k)
+		if err != nil {
+			return
+		}
+		r.update(b)
+		n -= k
+	}
+}
+
+func (r *checksumReader) ReadByte() (byte, error) {
+	c, err := r.Reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	r.update([]byte{c})
+	return c, nil
+}
+
+func (r *checksumReader) transientBytes(n int) ([]byte, error) {
+	b, err := transientBytes(r.Reader, n)
+	if err != nil {
+		return nil, err
+	}
+	r.update(b)
+	return b, nil
+}
+
+// readLength reads a length encoding with two reads at most, which are checksummed; the wrapped Reader
+// doesn't decode it itself since its bytes would then be skipped.
+func (r *checksumReader) readLength(withEncoding bool) (int, bool, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+	var b [9]byte
+	b[0] = first
+	n := 1
+	switch {
+	case first == 0x80:
+		n = 5
+	case first == 0x81:
+		n = 9
+	case first>>6 == 1:
+		n = 2
+	}
+	if n > 1 {
+		next, err := r.transientBytes(n - 1)
+		if err != nil {
+			return 0, false, err
+		}
+		copy(b[1:], next)
+	}
+	length, encoded, _, err := decodeLength(b[:n], withEncoding)
+	return length, encoded, err
+}
+
+func (r *checksumReader) ReadBytes(n int) ([]byte, error) {
+	b, err := r.Reader.ReadBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	r.update(b)
+	return b, nil
+}
+
+func (r *checksumReader) little16() (int, error) {
+	b, err := r.ReadBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(int16(binary.LittleEndian.Uint16(b))), nil
+}
+
+func (r *checksumReader) little32() (int, error) {
+	b, err := r.ReadBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(int32(binary.LittleEndian.Uint32(b))), nil
+}
+
+func (r *checksumReader) little64() (int, error) {
+	b, err := r.ReadBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return int(int64(binary.LittleEndian.Uint64(b))), nil
+}
+
+func (r *checksumReader) big32() (int, error) {
+	b, err := r.ReadBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(int32(binary.BigEndian.Uint32(b))), nil
+}
+
+func (r *checksumReader) big64() (int, error) {
+	b, err := r.ReadBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return int(int64(binary.BigEndian.Uint64(b))), nil
+}
@@ -0,0 +1,77 @@
+package rdb
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestTransientBytes(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	r := NewStreamReader(bytes.NewReader(data), 16)
+	off := 0
+	for _, n := range []int{10, 40, 16, 30} {
+		b, err := transientBytes(r, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := data[off : off+n]; !bytes.Equal(b, want) {
+			t.Fatalf("got: %s, want: %s", b, want)
+		}
+		off += n
+	}
+	if _, err := transientBytes(r, 10); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got: %v, want: %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+type repeatReader byte
+
+func (r repeatReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = byte(r)
+	}
+	return len(b), nil
+}
+
+func TestTransientBytesAllocs(t *testing.T) {
+	r := NewStreamReader(repeatReader('x'), 0)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := transientBytes(r, 100); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("got %v allocs, want 0", allocs)
+	}
+}
+
+func TestReadLength(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	lengths := []int{0, 63, 64, 16383, 16384, 1<<31 - 1, 1<<32 + 1}
+	for _, n := range lengths {
+		e.writeLength(n)
+	}
+	e.w.Flush()
+	data := append(buf.Bytes()[9:], 0xc2, 0xbf)
+
+	mp := &Parser{Reader: &MemReader{b: data}}
+	bp := &Parser{Reader: NewStreamReader(bytes.NewReader(data), 16)}
+	for i := 0; i <= len(lengths)+1; i++ {
+		for _, p := range []*Parser{mp, bp} {
+			n, encoded, err := p.readLength(i == len(lengths))
+			switch {
+			case i < len(lengths) && (err != nil || encoded || n != lengths[i]):
+				t.Fatalf("%v: want: %v, got: %v, %v, %v", i, lengths[i], n, encoded, err)
+			case i == len(lengths) && (err != nil || !encoded || n != 2):
+				t.Fatalf("%v: want: encoded 2, got: %v, %v, %v", i, n, encoded, err)
+			case i > len(lengths) && errors.Cause(err) != ErrInvalidLengthEncoding:
+				t.Fatalf("%v: want: %v, got: %v", i, ErrInvalidLengthEncoding, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package rdb
+
+import (
+	"sync"
+)
+
+// SkippedKey is a key skipped by a parse with WithRecover since its value couldn't be decoded.
+type SkippedKey struct {
+	DB       int    `json:"db"`
+	Key      string `json:"key"`
+	Offset   int64  `json:"offset"` // offset of the value type of the key in the rdb file
+	Encoding string `json:"encoding"`
+	Err      string `json:"error"`
+}
+
+// RecoveryReport lists the keys skipped by a parse with WithRecover, it's serializable with encoding/json.
+//
+// Err and Offset are set if the parse failed anyway, e.g. the records can't be followed past Offset.
+type RecoveryReport struct {
+	mu sync.Mutex
+
+	Skipped []SkippedKey `json:"skipped"`
+	Err     string       `json:"error,omitempty"`
+	Offset  int64        `json:"offset,omitempty"`
+}
+
+// WithRecover returns a ParseOption which skips keys whose values can't be decoded, such as malformed ziplists
+// or compressed data, instead of failing the parse. They are added to r.
+//
+// Only values are recovered from, a parse still fails if the record stream is broken, since the next record
+// can't be found then.
+func WithRecover(r *RecoveryReport) ParseOption {
+	return func(p *Parser) {
+		p.recovery = r
+		// offsets of keys are tracked
+		p.checksum = true
+	}
+}
+
+func (r *RecoveryReport) add(key Key, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Skipped = append(r.Skipped, SkippedKey{
+		DB:       key.DB,
+		Key:      key.String(),
+		Offset:   key.offset,
+		Encoding: Encoding2String(key.Encoding),
+		Err:      err.Error(),
+	})
+}
+
+func (r *RecoveryReport) fail(offset int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Err = err.Error()
+	r.Offset = offset
+}
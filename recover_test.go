@@ -0,0 +1,61 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "a", Expiry: -1}, Value: "1"})
+	bad := intset([]int64{1, 2, 3})
+	bad[0] = 3
+	e.raw(Key{Key: "bad", Expiry: -1}, EncodingIntset, bad)
+	e.String(&String{Key: Key{Key: "b", Expiry: -1}, Value: "2"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if err := Parse(&MemReader{b: data}, WithFilter(new(testEmptyFilter))); err == nil {
+		t.Fatal("want: an error, got: nil")
+	}
+
+	for _, r := range []Reader{&MemReader{b: data}, NewStreamReader(bytes.NewReader(data), 0)} {
+		report := new(RecoveryReport)
+		f := new(stringMapFilter)
+		if err := Parse(r, WithFilter(f), WithRecover(report), EnableSync()); err != nil {
+			t.Fatal(err)
+		}
+		if len(f.got) != 2 {
+			t.Fatalf("want: 2 strings, got: %v", f.got)
+		}
+		if len(report.Skipped) != 1 {
+			t.Fatalf("want: 1 skipped key, got: %+v", report.Skipped)
+		}
+		got := report.Skipped[0]
+		want := int64(bytes.Index(data, []byte("\x0b\x03bad")))
+		if got.Key != "bad" || got.Offset != want || got.Encoding != "intset" || got.Err == "" {
+			t.Fatalf("want: bad at %v, got: %+v", want, got)
+		}
+		b, err := json.Marshal(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), `"key":"bad"`) {
+			t.Fatalf("got: %s", b)
+		}
+	}
+
+	// a broken record stream still fails the parse
+	report := new(RecoveryReport)
+	if err := Parse(&MemReader{b: data[:len(data)-12]}, WithFilter(new(testEmptyFilter)), WithRecover(report)); err == nil {
+		t.Fatal("want: an error, got: nil")
+	}
+	if report.Err == "" || report.Offset == 0 {
+		t.Fatalf("got: %+v", report)
+	}
+}
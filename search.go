@@ -0,0 +1,124 @@
+package rdb
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// WithValuePattern returns a ParseOption which only delivers values matching pattern to the filter.
+//
+// A value matches if pattern matches a string's value, a list element, a set or sorted set member,
+// or a hash field or value. Values must be decoded, so the SkipValue strategy must not be used.
+func WithValuePattern(pattern *regexp.Regexp) ParseOption {
+	return func(p *Parser) {
+		p.pattern = pattern
+	}
+}
+
+// Match represents a string of a value which matches a pattern.
+type Match struct {
+	Key   Key
+	Field string // hash field or list index, empty for other types
+	Value string // matched string
+}
+
+// Search finds a pattern in decoded values.
+//
+// Search is safe for concurrent use, its methods can be called directly from Filter's callbacks.
+type Search struct {
+	Pattern *regexp.Regexp
+
+	mu      sync.Mutex
+	matches []Match
+}
+
+// NewSearch returns a Search which finds pattern.
+func NewSearch(pattern *regexp.Regexp) *Search {
+	return &Search{Pattern: pattern}
+}
+
+// String searches s, it reports whether s matches.
+func (s *Search) String(v *String) bool {
+	return s.add(findMatches(s.Pattern, v))
+}
+
+// List searches l, it reports whether l matches.
+func (s *Search) List(v *List) bool {
+	return s.add(findMatches(s.Pattern, v))
+}
+
+// Set searches set v, it reports whether v matches.
+func (s *Search) Set(v *Set) bool {
+	return s.add(findMatches(s.Pattern, v))
+}
+
+// Hash searches h, it reports whether h matches.
+func (s *Search) Hash(v *Hash) bool {
+	return s.add(findMatches(s.Pattern, v))
+}
+
+// SortedSet searches ss, it reports whether ss matches.
+func (s *Search) SortedSet(v *SortedSet) bool {
+	return s.add(findMatches(s.Pattern, v))
+}
+
+func (s *Search) add(matches []Match) bool {
+	if len(matches) == 0 {
+		return false
+	}
+	s.mu.Lock()
+	s.matches = append(s.matches, matches...)
+	s.mu.Unlock()
+	return true
+}
+
+// Matches returns the found matches.
+func (s *Search) Matches() []Match {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := make([]Match, len(s.matches))
+	copy(matches, s.matches)
+	return matches
+}
+
+// findMatches returns matches of pattern in v.
+func findMatches(pattern *regexp.Regexp, v interface{}) []Match {
+	var matches []Match
+	switch v := v.(type) {
+	case *String:
+		if pattern.MatchString(v.Value) {
+			matches = append(matches, Match{Key: v.Key, Value: v.Value})
+		}
+	case *List:
+		for i, e := range v.Values {
+			if pattern.MatchString(e) {
+				matches = append(matches, Match{Key: v.Key, Field: strconv.Itoa(i), Value: e})
+			}
+		}
+	case *Set:
+		for m := range v.Values {
+			if s, ok := m.(string); ok && pattern.MatchString(s) {
+				matches = append(matches, Match{Key: v.Key, Value: s})
+			} else if i, ok := m.(int); ok && pattern.MatchString(strconv.Itoa(i)) {
+				matches = append(matches, Match{Key: v.Key, Value: strconv.Itoa(i)})
+			}
+		}
+	case *Hash:
+		for field, value := range v.Values {
+			if pattern.MatchString(field) {
+				matches = append(matches, Match{Key: v.Key, Field: field, Value: field})
+			}
+			if pattern.MatchString(value) {
+				matches = append(matches, Match{Key: v.Key, Field: field, Value: value})
+			}
+		}
+	case *SortedSet:
+		for m := range v.Values {
+			if pattern.MatchString(m) {
+				matches = append(matches, Match{Key: v.Key, Value: m})
+			}
+		}
+	}
+	return matches
+}
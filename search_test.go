@@ -0,0 +1,53 @@
+package rdb
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestWithValuePattern(t *testing.T) {
+	filter := &stringMapFilter{
+		want: map[string]string{
+			"foo": "bar",
+			"bar": "baz",
+		},
+	}
+	r, err := NewMemReader("testdata/dumps/rdb_version_5_with_checksum.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Parse(r, WithFilter(filter), WithValuePattern(regexp.MustCompile("^ba"))); err != nil {
+		t.Fatal(err)
+	}
+	filter.validate(t)
+	if len(filter.got) != len(filter.want) {
+		t.Fatalf("want: %v, got: %v", filter.want, filter.got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := NewSearch(regexp.MustCompile("token"))
+	if s.String(&String{Key: Key{Key: "a"}, Value: "no"}) {
+		t.Fatal("want no match")
+	}
+	s.String(&String{Key: Key{Key: "b"}, Value: "token=1"})
+	s.List(&List{Key: Key{Key: "c"}, Values: []string{"x", "my token"}})
+	s.Hash(&Hash{Key: Key{Key: "d"}, Values: map[string]string{"token": "v"}})
+	s.Set(&Set{Key: Key{Key: "e"}, Values: map[interface{}]struct{}{"tokens": {}, 1: {}}})
+
+	want := []Match{
+		{Key: Key{Key: "b"}, Value: "token=1"},
+		{Key: Key{Key: "c"}, Field: "1", Value: "my token"},
+		{Key: Key{Key: "d"}, Field: "token", Value: "token"},
+		{Key: Key{Key: "e"}, Value: "tokens"},
+	}
+	got := s.Matches()
+	if len(got) != len(want) {
+		t.Fatalf("want: %v, got: %v", want, got)
+	}
+	for i := range want {
+		if got[i].Key.Key != want[i].Key.Key || got[i].Field != want[i].Field || got[i].Value != want[i].Value {
+			t.Fatalf("want: %v, got: %v", want, got)
+		}
+	}
+}
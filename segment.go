@@ -0,0 +1,296 @@
+package rdb
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// segment is a range of records of a memory-mapped file.
+type segment struct {
+	start, end int
+	db         int  // database the records start in
+	resumed    bool // whether the records start in the middle of database db
+}
+
+// ParseSegments parses a memory-mapped rdb file in n segments concurrently, each of them with a new Filter
+// returned by filterFactory.
+//
+// A pre-scan walks the records without decoding them and splits them into segments of about the same size.
+// The filter of a segment which doesn't start a database gets a Database callback of the database
+// its records belong to first.
+// r is parsed with Parse if it isn't returned by NewMemReader, n is less than 2 or WithReaderWrapper is set.
+func ParseSegments(r Reader, n int, filterFactory func() Filter, opts ...ParseOption) (err error) {
+	p, err := newParser(r, opts...)
+	if err != nil {
+		return err
+	}
+	mr, ok := r.(*MemReader)
+	if !ok || n < 2 || p.wrapper != nil {
+		return Parse(r, append(opts, WithFilter(filterFactory()))...)
+	}
+	span := p.startSpan("rdb.parse", nil)
+	defer func() { span.End(err) }()
+	if err := p.readHeader(); err != nil {
+		return err
+	}
+	segments, err := p.scan(mr, n, false)
+	if err != nil {
+		return err
+	}
+	return p.parseSegments(mr, segments, filterFactory, opts)
+}
+
+// ParseDatabases parses a memory-mapped rdb file with one parser per database concurrently, all of them
+// calling the filter set by WithFilter, which must be safe for concurrent use then.
+// Its Header is called once, before any key, if it's a HeaderFilter.
+//
+// A pre-scan walks the records without decoding them and locates the database selectors, it's lighter than
+// a full parse but still reads every record's header. Strategies set by the callbacks only apply to the database
+// whose parser calls them.
+// r is parsed with Parse if it isn't returned by NewMemReader or WithReaderWrapper is set.
+func ParseDatabases(r Reader, opts ...ParseOption) (err error) {
+	p, err := newParser(r, opts...)
+	if err != nil {
+		return err
+	}
+	mr, ok := r.(*MemReader)
+	if !ok || p.wrapper != nil {
+		return Parse(r, opts...)
+	}
+	span := p.startSpan("rdb.parse", nil)
+	defer func() { span.End(err) }()
+	if err := p.readHeader(); err != nil {
+		return err
+	}
+	segments, err := p.scan(mr, 0, true)
+	if err != nil {
+		return err
+	}
+	return p.parseSegments(mr, segments, nil, opts)
+}
+
+// parseSegments parses segments of mr concurrently, each of them with a new Filter returned by filterFactory,
+// or the Filter set by opts if filterFactory is nil.
+func (p *Parser) parseSegments(mr *MemReader, segments []segment, filterFactory func() Filter, opts []ParseOption) (err error) {
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		last  *Parser
+	)
+	if filterFactory == nil {
+		// the filter shared by all segments is given the header once, before the keys of any of them
+		p.header()
+	}
+	for _, seg := range segments {
+		sr := &MemReader{b: mr.b[:seg.end], i: seg.start}
+		sopts := opts
+		if filterFactory != nil {
+			sopts = append(opts[:len(opts):len(opts)], WithFilter(filterFactory()))
+		}
+		sp, _ := newParser(sr, sopts...)
+		sp.version = p.version
+		sp.db = seg.db
+		sp.resumed = seg.resumed
+		if filterFactory != nil {
+			// the filter of every segment is given the header before its keys
+			sp.pendingHeader = true
+			sp.aux = make(map[string]string, len(p.aux))
+			for k, v := range p.aux {
+				sp.aux[k] = v
+			}
+		}
+		sp.segment = sr
+		sp.startWorkers()
+		last = sp
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if perr := sp.Parse(); perr != nil {
+				errMu.Lock()
+				if err == nil {
+					err = perr
+				}
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// the last segment ends with the EOF opcode, its filter is told once all segments are parsed
+	if err == nil {
+		last.end()
+	}
+	return err
+}
+
+// scan walks the records of mr following the header without decoding them and splits them into at most n segments,
+// or at every database selector but the first one if byDB is set.
+// mr is the Reader of p, unless it's wrapped.
+func (p *Parser) scan(mr *MemReader, n int, byDB bool) ([]segment, error) {
+	step := len(mr.b) - mr.i
+	if n > 0 {
+		step /= n
+	}
+	segments := []segment{{start: mr.i}}
+	db, start := 0, -1
+	selected := false // whether a database selector was walked
+	for {
+		last := &segments[len(segments)-1]
+		off := mr.i
+		b, err := p.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case TokenDB:
+			if byDB && selected {
+				last.end = off
+				segments = append(segments, segment{start: off})
+			}
+			selected = true
+			db, _, err = p.readLength(false)
+		case TokenAUX:
+			// AUX fields are collected for the Header callback of every segment
+			var key, value string
+			if key, err = p.readRawString(false); err == nil {
+				if value, err = p.readRawString(false); err == nil {
+					if p.aux == nil {
+						p.aux = make(map[string]string)
+					}
+					p.aux[key] = value
+				}
+			}
+		case TokenFunction2:
+			err = p.skipString()
+		case TokenModuleAUX:
+			_, err = p.readModuleAux()
+		case TokenFunctionPreGA:
+			return nil, errors.Wrap(ErrUnsupportedRDB, "functions of a redis 7 release candidate")
+		case TokenResize:
+			if _, _, err = p.readLength(false); err == nil {
+				_, _, err = p.readLength(false)
+			}
+		case TokenExpMSec:
+			if start < 0 {
+				start = off
+			}
+			p.Discard(8)
+		case TokenExpSec:
+			if start < 0 {
+				start = off
+			}
+			p.Discard(4)
+		case TokenIdle:
+			if start < 0 {
+				start = off
+			}
+			_, _, err = p.readLength(false)
+		case TokenFreq:
+			if start < 0 {
+				start = off
+			}
+			p.Discard(1)
+		case TokenEOF:
+			// the last segment parses the EOF opcode and the checksum
+			last.end = len(mr.b)
+			return segments, nil
+		default:
+			if start < 0 {
+				start = off
+			}
+			if !byDB && start-last.start >= step && len(segments) < n {
+				last.end = start
+				segments = append(segments, segment{start: start, db: db, resumed: true})
+			}
+			start = -1
+			var ok bool
+			if err = p.skipString(); err != nil {
+				return nil, err
+			}
+			if ok, err = p.skipValue(Encoding(b)); err == nil && !ok {
+				// unsupported encoding, the last segment reports it
+				segments[len(segments)-1].end = len(mr.b)
+				return segments, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipValue skips a value whose encoding is b without decoding it.
+// It reports false if the encoding isn't supported.
+func (p *Parser) skipValue(b Encoding) (bool, error) {
+	n := 1
+	switch b {
+	case EncodingString, EncodingZipmap, EncodingZiplist, EncodingHashZip, EncodingSortedSetZip, EncodingIntset:
+	case EncodingList, EncodingSet, EncodingQuicklist, EncodingHash, EncodingSortedSet, EncodingSortedSet2:
+		size, _, err := p.readLength(false)
+		if err != nil {
+			return true, err
+		}
+		n = size
+		if b == EncodingHash {
+			n *= 2
+		}
+	case EncodingHashMetadataPreGA, EncodingHashMetadata:
+		return true, p.skipHashMetadata(b)
+	case EncodingHashListpackPreGA, EncodingHashListpackEx:
+		return true, p.skipHashListpackEx(b)
+	case EncodingModule2:
+		return true, p.skipModuleValue()
+	default:
+		return false, nil
+	}
+	for i := 0; i < n; i++ {
+		if err := p.skipString(); err != nil {
+			return true, err
+		}
+		switch b {
+		case EncodingSortedSet:
+			l, err := p.ReadByte()
+			if err != nil {
+				return true, err
+			}
+			if l < 253 {
+				p.Discard(int(l))
+			}
+		case EncodingSortedSet2:
+			p.Discard(8)
+		}
+	}
+	return true, nil
+}
+
+// skipString skips a redis string.
+func (p *Parser) skipString() error {
+	length, encoded, err := p.readLength(true)
+	if err != nil {
+		return err
+	}
+	if !encoded {
+		p.Discard(length)
+		return nil
+	}
+	switch length {
+	case 0:
+		p.Discard(1)
+	case 1:
+		p.Discard(2)
+	case 2:
+		p.Discard(4)
+	case 3:
+		clen, _, err := p.readLength(false)
+		if err != nil {
+			return err
+		}
+		if _, _, err := p.readLength(false); err != nil {
+			return err
+		}
+		p.Discard(clen)
+	default:
+		return errors.WithStack(ErrInvalidLengthEncoding)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type skipDBFilter struct {
+	*encodedFilter
+	db int
+}
+
+func (f skipDBFilter) Database(db DB) bool {
+	if db.Num == f.db {
+		db.Skip(SkipAll)
+	}
+	return false
+}
+
+func TestParseSegments(t *testing.T) {
+	file, err := ioutil.TempFile("", "rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	e := NewEncoder(file)
+	for i := 0; i < 3000; i++ {
+		key := Key{Key: fmt.Sprint("key:", i), DB: i / 1000, Expiry: -1}
+		if i%3 == 0 {
+			key.Expiry = 1500000000000 + i
+		}
+		switch i % 4 {
+		case 0:
+			e.String(&String{Key: key, Value: fmt.Sprint(i)})
+		case 1:
+			e.List(&List{Key: key, Values: []string{"a", fmt.Sprint(i)}})
+		case 2:
+			e.Hash(&Hash{Key: key, Values: map[string]string{"f": fmt.Sprint(i)}})
+		case 3:
+			e.SortedSet(&SortedSet{Key: key, Values: map[string]float64{"m": float64(i)}})
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	parse := func(n int, db int) *encodedFilter {
+		r, err := NewMemReader(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := newEncodedFilter()
+		if err := ParseSegments(r, n, func() Filter { return skipDBFilter{f, db} }); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	want := parse(1, -1)
+	if len(want.expiry) != 3000 {
+		t.Fatalf("want: 3000 keys, got: %v", len(want.expiry))
+	}
+	for _, n := range []int{2, 7} {
+		if got := parse(n, -1); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v segments: got %v keys", n, len(got.expiry))
+		}
+	}
+	if got := parse(7, 1); len(got.expiry) != 2000 {
+		t.Fatalf("want: 2000 keys, got: %v", len(got.expiry))
+	}
+}
+
+func TestParseSegmentsEnd(t *testing.T) {
+	var buf bytes.Buffer
+	if err := generate(&buf, shape{Seed: 1, Keys: 1000, Elements: 8, ValueSize: 16, Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	stats := NewStats()
+	if err := ParseSegments(&MemReader{b: buf.Bytes()}, 4, func() Filter { return &endFilter{stats: stats} }); err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Ended || !stats.ChecksumOK {
+		t.Fatalf("got ended %v, checksum ok %v", stats.Ended, stats.ChecksumOK)
+	}
+}
+
+func TestParseDatabases(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i := 0; i < 3000; i++ {
+		key := Key{Key: fmt.Sprint("key:", i), DB: i / 1000, Expiry: -1}
+		switch i % 2 {
+		case 0:
+			e.String(&String{Key: key, Value: fmt.Sprint(i)})
+		case 1:
+			e.List(&List{Key: key, Values: []string{"a", fmt.Sprint(i)}})
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := &MemReader{b: buf.Bytes()}
+	p, _ := newParser(mr)
+	if err := p.readHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if segments, err := p.scan(mr, 0, true); err != nil || len(segments) != 3 {
+		t.Fatalf("want: 3 databases, got: %v, %v", segments, err)
+	}
+
+	want := newEncodedFilter()
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(want), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	got := newEncodedFilter()
+	if err := ParseDatabases(&MemReader{b: buf.Bytes()}, WithFilter(got), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.dbs) != 3000 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("want: 3000 keys, got: %v", len(got.dbs))
+	}
+
+	got = newEncodedFilter()
+	if err := ParseDatabases(&MemReader{b: buf.Bytes()}, WithFilter(skipDBFilter{got, 1}), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.dbs) != 2000 {
+		t.Fatalf("want: 2000 keys, got: %v", len(got.dbs))
+	}
+
+	stats := NewStats()
+	if err := ParseDatabases(&MemReader{b: buf.Bytes()}, WithFilter(&endFilter{stats: stats})); err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Ended || !stats.ChecksumOK {
+		t.Fatalf("got ended %v, checksum ok %v", stats.Ended, stats.ChecksumOK)
+	}
+}
@@ -0,0 +1,256 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink is a destination of exported rows, such as CSV or JSON lines.
+//
+// Every call of Write holds whole rows: rows written by concurrent calls aren't interleaved, and sinks which
+// split their output, such as RotatingFileSink, never split a call. Sinks are safe for concurrent use.
+type Sink interface {
+	io.Writer
+
+	// Flush writes buffered rows to the underlying writers.
+	Flush() error
+	// Close flushes the sink and releases its resources, it must be called once the rows are written.
+	Close() error
+}
+
+// BufferedSink is a Sink which buffers rows written to a Writer, and flushes them periodically so that
+// a slow export still streams its output.
+type BufferedSink struct {
+	mu   sync.Mutex
+	w    *bufio.Writer
+	err  error
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBufferedSink returns a BufferedSink writing to w through a buffer of size bytes, which is flushed
+// every interval, or only once it's full if interval is 0.
+// Closing the sink leaves w open.
+func NewBufferedSink(w io.Writer, size int, interval time.Duration) *BufferedSink {
+	s := &BufferedSink{w: bufio.NewWriterSize(w, size)}
+	if interval > 0 {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.flushEvery(interval)
+	}
+	return s
+}
+
+func (s *BufferedSink) flushEvery(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Write writes rows p, it returns the first error met by s.
+func (s *BufferedSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	var n int
+	n, s.err = s.w.Write(p)
+	return n, s.err
+}
+
+// Flush writes buffered rows to the underlying writer.
+func (s *BufferedSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.w.Flush()
+	}
+	return s.err
+}
+
+// Close stops periodic flushes and flushes s.
+func (s *BufferedSink) Close() error {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	return s.Flush()
+}
+
+// RotatingFileSink is a Sink which writes rows to numbered files, a file is closed and the next one
+// created once it reaches a size or a number of rows.
+//
+// Header and Footer, if any, are written at the start and the end of every file, e.g. a CSV header.
+// Wrap, if set, wraps every file, e.g. to compress it with gzip.NewWriter, the size of files is counted
+// before they are wrapped. They must be set before the first Write.
+type RotatingFileSink struct {
+	Header []byte
+	Footer []byte
+	Wrap   func(w io.Writer) io.WriteCloser
+
+	pattern  string
+	maxBytes int64
+	maxRows  int
+
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	wrap  io.WriteCloser
+	bytes int64 // bytes of rows written to the current file
+	rows  int   // rows written to the current file
+	files []string
+	err   error
+}
+
+// NewRotatingFileSink returns a RotatingFileSink writing to files named by pattern, which holds a verb
+// formatting the number of the file, starting at 1, e.g. out-%04d.csv.
+// A file holds at most about maxBytes bytes and maxRows rows, a row being a line; 0 means no limit.
+// A call of Write is never split, a file holds at least one.
+func NewRotatingFileSink(pattern string, maxBytes int64, maxRows int) *RotatingFileSink {
+	return &RotatingFileSink{pattern: pattern, maxBytes: maxBytes, maxRows: maxRows}
+}
+
+// Write writes rows p to the current file, after rotating it if p would make it cross a limit.
+func (s *RotatingFileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	rows := bytes.Count(p, []byte{'\n'})
+	if s.file != nil && (s.maxBytes > 0 && s.bytes+int64(len(p)) > s.maxBytes || s.maxRows > 0 && s.rows+rows > s.maxRows) {
+		s.err = s.closeFile()
+	}
+	if s.file == nil && s.err == nil {
+		s.err = s.create()
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	var n int
+	n, s.err = s.w.Write(p)
+	s.bytes += int64(n)
+	s.rows += rows
+	return n, s.err
+}
+
+// create creates the next file and writes the header.
+func (s *RotatingFileSink) create() error {
+	name := fmt.Sprintf(s.pattern, len(s.files)+1)
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.files = append(s.files, name)
+	s.bytes, s.rows = 0, 0
+	var w io.Writer = file
+	if s.Wrap != nil {
+		s.wrap = s.Wrap(file)
+		w = s.wrap
+	}
+	s.w = bufio.NewWriter(w)
+	_, err = s.w.Write(s.Header)
+	return err
+}
+
+// closeFile writes the footer and closes the current file.
+func (s *RotatingFileSink) closeFile() error {
+	_, err := s.w.Write(s.Footer)
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if s.wrap != nil {
+		if werr := s.wrap.Close(); err == nil {
+			err = werr
+		}
+		s.wrap = nil
+	}
+	if ferr := s.file.Close(); err == nil {
+		err = ferr
+	}
+	s.file = nil
+	return err
+}
+
+// Flush writes buffered rows to the current file, files which are wrapped may buffer them further.
+func (s *RotatingFileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil && s.err == nil {
+		s.err = s.w.Flush()
+	}
+	return s.err
+}
+
+// Close closes the current file.
+func (s *RotatingFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		if err := s.closeFile(); s.err == nil {
+			s.err = err
+		}
+	}
+	return s.err
+}
+
+// Files returns the names of the files written so far.
+func (s *RotatingFileSink) Files() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.files...)
+}
+
+// multiSink writes rows to several sinks.
+type multiSink []Sink
+
+// NewMultiSink returns a Sink which writes rows to every one of sinks, e.g. to a local file and a remote one.
+// Writes stop at the first error.
+func NewMultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Write(p []byte) (int, error) {
+	for _, s := range m {
+		if _, err := s.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (m multiSink) Flush() error {
+	var err error
+	for _, s := range m {
+		if serr := s.Flush(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+func (m multiSink) Close() error {
+	var err error
+	for _, s := range m {
+		if serr := s.Close(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
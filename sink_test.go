@@ -0,0 +1,125 @@
+package rdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestBufferedSink(t *testing.T) {
+	var out lockedBuffer
+	s := NewBufferedSink(&out, 1<<10, 10*time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fmt.Fprintf(s, "%d,%s\n", i, strings.Repeat("x", 50))
+			}
+		}(i)
+	}
+	wg.Wait()
+	// rows are flushed periodically
+	time.Sleep(50 * time.Millisecond)
+	if out.String() == "" {
+		t.Fatal("want flushed rows")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 800 {
+		t.Fatalf("want: 800 rows, got: %v", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) != 52 {
+			t.Fatalf("got interleaved row: %q", line)
+		}
+	}
+}
+
+func TestRotatingFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := NewRotatingFileSink(filepath.Join(dir, "out-%04d.csv.gz"), 0, 2)
+	s.Header = []byte("key\n")
+	s.Wrap = func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	var all lockedBuffer
+	m := NewMultiSink(s, NewBufferedSink(&all, 4096, 0))
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(m, "k%d\n", i)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if all.String() != "k0\nk1\nk2\nk3\nk4\n" {
+		t.Fatalf("got: %q", all.String())
+	}
+
+	files := s.Files()
+	want := []string{"key\nk0\nk1\n", "key\nk2\nk3\n", "key\nk4\n"}
+	if len(files) != len(want) || filepath.Base(files[2]) != "out-0003.csv.gz" {
+		t.Fatalf("got: %v", files)
+	}
+	for i, file := range files {
+		fd, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(gz)
+		fd.Close()
+		if err != nil || string(b) != want[i] {
+			t.Fatalf("file %d: want: %q, got: %q, %v", i, want[i], b, err)
+		}
+	}
+
+	// a write crossing the size limit starts a file, unless the file is empty
+	s = NewRotatingFileSink(filepath.Join(dir, "size-%d.csv"), 10, 0)
+	io.WriteString(s, "0123456789abcdef\n")
+	io.WriteString(s, "x\n")
+	io.WriteString(s, "y\n")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := s.Files(); len(files) != 2 {
+		t.Fatalf("want: 2 files, got: %v", files)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "size-2.csv")); string(b) != "x\ny\n" {
+		t.Fatalf("got: %q", b)
+	}
+}
@@ -0,0 +1,331 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// skeletonMagic starts skeleton files, it's followed by the version of the format.
+const (
+	skeletonMagic   = "RDBSKEL"
+	skeletonVersion = 1
+)
+
+// SkeletonEntry locates a key in a rdb file.
+type SkeletonEntry struct {
+	DB       int
+	Key      string
+	Encoding Encoding
+	Expiry   int   // unix time in milliseconds, -1 if key has no expiry
+	Offset   int64 // offset of the first opcode of the key's record, its expiry, LRU, LFU or value type
+	Value    int64 // offset of the key's value type
+	Length   int64 // bytes of the record from Offset, up to the end of the value
+}
+
+// Type returns the type of the entry's value, e.g. TypeHash.
+func (e SkeletonEntry) Type() ValueType {
+	return Encoding2Type(e.Encoding)
+}
+
+// Skeleton is an index of the keys of a rdb file, built in one pass which doesn't decode values.
+// It's saved to a sidecar file by WriteTo and loaded by ReadSkeleton, so that lookups, extractions
+// and partial scans of the same file don't walk it again.
+type Skeleton struct {
+	Version  int    // rdb version of the file
+	Size     int64  // offset following the EOF opcode
+	Checksum uint64 // checksum stored in the file, 0 before rdb version 5, to tell whether a skeleton is stale
+	Entries  []SkeletonEntry
+
+	lookup map[skeletonKey]int // indices of entries, built on first lookup
+}
+
+type skeletonKey struct {
+	db  int
+	key string
+}
+
+// ScanSkeleton walks the records of a rdb file without decoding values and returns the skeleton of its keys,
+// ordered by offset. r may be any Reader, offsets are tracked.
+func ScanSkeleton(r Reader) (*Skeleton, error) {
+	p, err := newParser(r, func(p *Parser) { p.checksum = true })
+	if err != nil {
+		return nil, err
+	}
+	if err := p.readHeader(); err != nil {
+		return nil, err
+	}
+	s := new(Skeleton)
+	s.Version, _ = strconv.Atoi(p.version)
+	db, exp, start := 0, -1, int64(-1)
+	for {
+		off := p.read()
+		b, err := p.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case TokenDB:
+			db, _, err = p.readLength(false)
+		case TokenAUX:
+			if err = p.skipString(); err == nil {
+				err = p.skipString()
+			}
+		case TokenFunction2:
+			err = p.skipString()
+		case TokenModuleAUX:
+			_, err = p.readModuleAux()
+		case TokenFunctionPreGA:
+			return nil, errors.Wrap(ErrUnsupportedRDB, "functions of a redis 7 release candidate")
+		case TokenResize:
+			if _, _, err = p.readLength(false); err == nil {
+				_, _, err = p.readLength(false)
+			}
+		case TokenExpMSec:
+			if start < 0 {
+				start = off
+			}
+			exp, err = p.little64()
+		case TokenExpSec:
+			if start < 0 {
+				start = off
+			}
+			if exp, err = p.little32(); err == nil {
+				exp *= 1000
+			}
+		case TokenIdle:
+			if start < 0 {
+				start = off
+			}
+			_, _, err = p.readLength(false)
+		case TokenFreq:
+			if start < 0 {
+				start = off
+			}
+			p.Discard(1)
+		case TokenEOF:
+			if err := p.readEOF(); err != nil {
+				return nil, err
+			}
+			s.Size, s.Checksum = p.Offset(), p.eof.stored
+			return s, nil
+		default:
+			if start < 0 {
+				start = off
+			}
+			key, err := p.readRawString(false)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := p.skipValue(Encoding(b))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, &EncodingError{Key: key, Encoding: Encoding(b), Offset: off}
+			}
+			s.Entries = append(s.Entries, SkeletonEntry{
+				DB:       db,
+				Key:      key,
+				Encoding: Encoding(b),
+				Expiry:   exp,
+				Offset:   start,
+				Value:    off,
+				Length:   p.read() - start,
+			})
+			exp, start = -1, -1
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Lookup returns the entry of key in database db.
+func (s *Skeleton) Lookup(db int, key string) (SkeletonEntry, bool) {
+	if s.lookup == nil {
+		s.lookup = make(map[skeletonKey]int, len(s.Entries))
+		for i, e := range s.Entries {
+			s.lookup[skeletonKey{e.DB, e.Key}] = i
+		}
+	}
+	i, ok := s.lookup[skeletonKey{db, key}]
+	if !ok {
+		return SkeletonEntry{}, false
+	}
+	return s.Entries[i], true
+}
+
+// Payload returns the DUMP payload of the key of e, read from r, the rdb file of s: the value as it's serialized
+// in the file, followed by the rdb version and the checksum RESTORE verifies.
+func (s *Skeleton) Payload(r io.ReaderAt, e SkeletonEntry) ([]byte, error) {
+	record := make([]byte, e.Offset+e.Length-e.Value)
+	if _, err := r.ReadAt(record, e.Value); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// the key name following the value type is left out
+	mr := &MemReader{b: record, i: 1}
+	p, _ := newParser(mr)
+	if err := p.skipString(); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0, 1+len(record)-mr.i+10)
+	payload = append(payload, record[0])
+	payload = append(payload, record[mr.i:]...)
+	payload = append(payload, byte(s.Version), byte(s.Version>>8))
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], CRC64(0, payload))
+	return append(payload, b[:]...), nil
+}
+
+// Ranges splits the keys of the file into at most n ranges of about the same size, to be parsed by ParseRange.
+func (s *Skeleton) Ranges(n int) []Range {
+	ranges := []Range{{Start: 9, Version: s.Version}}
+	if n < 2 || len(s.Entries) == 0 {
+		return ranges
+	}
+	step := (s.Size - s.Entries[0].Offset) / int64(n)
+	for _, e := range s.Entries {
+		last := &ranges[len(ranges)-1]
+		if e.Offset-last.Start >= step && len(ranges) < n {
+			last.Bytes = e.Offset - last.Start
+			ranges = append(ranges, Range{Start: e.Offset, DB: e.DB, Resumed: true, Version: s.Version})
+		}
+	}
+	return ranges
+}
+
+// WriteTo writes s to w in the skeleton file format: the magic string and the format version,
+// followed by the header fields and the entries, integers are varint-encoded.
+func (s *Skeleton) WriteTo(w io.Writer) (int64, error) {
+	bw := &countingWriter{w: bufio.NewWriter(w)}
+	bw.write([]byte(skeletonMagic))
+	bw.uvarint(skeletonVersion)
+	bw.uvarint(uint64(s.Version))
+	bw.uvarint(uint64(s.Size))
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], s.Checksum)
+	bw.write(b[:])
+	bw.uvarint(uint64(len(s.Entries)))
+	var prev int64
+	for _, e := range s.Entries {
+		bw.uvarint(uint64(e.DB))
+		bw.uvarint(uint64(len(e.Key)))
+		bw.write([]byte(e.Key))
+		bw.write([]byte{byte(e.Encoding)})
+		bw.varint(int64(e.Expiry))
+		// offsets grow, they are stored as deltas
+		bw.uvarint(uint64(e.Offset - prev))
+		bw.uvarint(uint64(e.Value - e.Offset))
+		bw.uvarint(uint64(e.Length))
+		prev = e.Offset
+	}
+	if bw.err == nil {
+		bw.err = bw.w.(*bufio.Writer).Flush()
+	}
+	return bw.n, bw.err
+}
+
+// ReadSkeleton reads a skeleton written by WriteTo.
+func ReadSkeleton(r io.Reader) (*Skeleton, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(skeletonMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != skeletonMagic {
+		return nil, errors.WithStack(ErrInvalidSkeleton)
+	}
+	var fields [4]uint64
+	for i := range fields[:3] {
+		v, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidSkeleton, err.Error())
+		}
+		fields[i] = v
+	}
+	if fields[0] != skeletonVersion {
+		return nil, errors.Wrapf(ErrInvalidSkeleton, "unsupported format version %d", fields[0])
+	}
+	s := &Skeleton{Version: int(fields[1]), Size: int64(fields[2])}
+	var b [8]byte
+	if _, err := io.ReadFull(br, b[:]); err != nil {
+		return nil, errors.Wrap(ErrInvalidSkeleton, err.Error())
+	}
+	s.Checksum = binary.LittleEndian.Uint64(b[:])
+	n, err := binary.ReadUvarint(br)
+	if err != nil || n > uint64(s.Size) {
+		return nil, errors.WithStack(ErrInvalidSkeleton)
+	}
+	s.Entries = make([]SkeletonEntry, 0, n)
+	var prev int64
+	for i := uint64(0); i < n; i++ {
+		e, err := readSkeletonEntry(br, prev)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidSkeleton, "entry %d: %v", i, err)
+		}
+		s.Entries = append(s.Entries, e)
+		prev = e.Offset
+	}
+	return s, nil
+}
+
+func readSkeletonEntry(br *bufio.Reader, prev int64) (e SkeletonEntry, err error) {
+	var v [6]uint64
+	read := func(i int) {
+		if err == nil {
+			v[i], err = binary.ReadUvarint(br)
+		}
+	}
+	read(0)
+	read(1)
+	if err != nil {
+		return e, err
+	}
+	key := make([]byte, v[1])
+	if _, err = io.ReadFull(br, key); err != nil {
+		return e, err
+	}
+	b, err := br.ReadByte()
+	if err != nil {
+		return e, err
+	}
+	e.Encoding = Encoding(b)
+	exp, err := binary.ReadVarint(br)
+	read(2)
+	read(3)
+	read(4)
+	if err != nil {
+		return e, err
+	}
+	e.DB, e.Key, e.Expiry = int(v[0]), string(key), int(exp)
+	e.Offset = prev + int64(v[2])
+	e.Value = e.Offset + int64(v[3])
+	e.Length = int64(v[4])
+	return e, nil
+}
+
+// countingWriter writes to w until an error occurs, and counts the bytes written.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (w *countingWriter) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countingWriter) uvarint(v uint64) {
+	w.write(w.buf[:binary.PutUvarint(w.buf[:], v)])
+}
+
+func (w *countingWriter) varint(v int64) {
+	w.write(w.buf[:binary.PutVarint(w.buf[:], v)])
+}
@@ -0,0 +1,123 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSkeleton(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for i := 0; i < 3000; i++ {
+		key := Key{Key: fmt.Sprint("key:", i), DB: i / 1000, Expiry: -1}
+		if i%3 == 0 {
+			key.Expiry = 1500000000000 + i
+		}
+		switch i % 2 {
+		case 0:
+			e.String(&String{Key: key, Value: fmt.Sprint(i)})
+		case 1:
+			e.List(&List{Key: key, Values: []string{"a", fmt.Sprint(i)}})
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	s, err := ScanSkeleton(NewStreamReader(bytes.NewReader(b), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Entries) != 3000 || s.Size+8 != int64(len(b)) || s.Version != 8 {
+		t.Fatalf("got %v entries, size %v, version %v", len(s.Entries), s.Size, s.Version)
+	}
+	entry, ok := s.Lookup(1, "key:1500")
+	if !ok || entry.Type() != "string" || entry.Expiry != 1500000001500 {
+		t.Fatalf("got %+v, %v", entry, ok)
+	}
+	if _, ok := s.Lookup(0, "key:1500"); ok {
+		t.Fatal("want key:1500 missing from db 0")
+	}
+
+	// a record holds the key alone
+	f := newEncodedFilter()
+	rg := Range{Start: entry.Offset, Bytes: entry.Length, DB: entry.DB, Resumed: true, Version: s.Version}
+	if err := ParseRange(NewStreamReader(bytes.NewReader(b[entry.Offset:]), 0), rg, WithFilter(f)); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.strings) != 1 || f.strings["key:1500"] != "1500" || f.expiry["key:1500"] != 1500000001500 {
+		t.Fatalf("got %v, %v", f.strings, f.expiry)
+	}
+
+	var w bytes.Buffer
+	if n, err := s.WriteTo(&w); err != nil || n != int64(w.Len()) {
+		t.Fatalf("got %v, %v", n, err)
+	}
+	got, err := ReadSkeleton(&w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Entries, s.Entries) || got.Size != s.Size || got.Checksum != s.Checksum || got.Checksum == 0 {
+		t.Fatalf("want: %+v, got: %+v", s.Entries[:2], got.Entries[:2])
+	}
+	if _, err := ReadSkeleton(bytes.NewReader(b)); err == nil {
+		t.Fatal("want an error reading a rdb file")
+	}
+
+	want := newEncodedFilter()
+	if err := Parse(&MemReader{b: b}, WithFilter(want), WithStrategy(SkipMeta)); err != nil {
+		t.Fatal(err)
+	}
+	f = newEncodedFilter()
+	ranges := s.Ranges(3)
+	if len(ranges) != 3 {
+		t.Fatalf("want: 3 ranges, got: %v", ranges)
+	}
+	for _, rg := range ranges {
+		if err := ParseRange(NewStreamReader(bytes.NewReader(b[rg.Start:]), 0), rg, WithFilter(f), WithStrategy(SkipMeta)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Fatalf("want: 3000 keys, got: %v", len(f.dbs))
+	}
+}
+
+func TestSkeletonPayload(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "a", Expiry: -1}, Value: "b"})
+	e.Hash(&Hash{Key: Key{Key: "h", Expiry: 1500000000000}, Values: map[string]string{"f": "v"}})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ScanSkeleton(&MemReader{b: buf.Bytes()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(buf.Bytes())
+
+	entry, _ := s.Lookup(0, "a")
+	payload, err := s.Payload(r, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{byte(EncodingString), 1, 'b', 8, 0}
+	if !bytes.Equal(payload[:len(payload)-8], want) || binary.LittleEndian.Uint64(payload[len(want):]) != CRC64(0, want) {
+		t.Fatalf("want: %x, got: %x", want, payload)
+	}
+
+	entry, _ = s.Lookup(0, "h")
+	payload, err = s.Payload(r, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{byte(EncodingHash), 1, 1, 'f', 1, 'v', 8, 0}
+	if !bytes.Equal(payload[:len(payload)-8], want) {
+		t.Fatalf("want: %x, got: %x", want, payload)
+	}
+}
@@ -0,0 +1,135 @@
+package rdb
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Histogram counts samples into buckets.
+//
+// Bucket i counts samples in (Bounds[i-1], Bounds[i]], the last bucket counts samples greater than every bound.
+type Histogram struct {
+	Bounds []int64
+	Counts []int
+
+	Count int
+	Sum   int64
+	Min   int64
+	Max   int64
+}
+
+// NewHistogram returns a Histogram with the given bucket upper bounds.
+func NewHistogram(bounds ...int64) *Histogram {
+	b := make([]int64, len(bounds))
+	copy(b, bounds)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return &Histogram{
+		Bounds: b,
+		Counts: make([]int, len(b)+1),
+	}
+}
+
+// Add adds sample v to h.
+func (h *Histogram) Add(v int64) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return h.Bounds[i] >= v })
+	h.Counts[i]++
+	if h.Count == 0 || v < h.Min {
+		h.Min = v
+	}
+	if h.Count == 0 || v > h.Max {
+		h.Max = v
+	}
+	h.Count++
+	h.Sum += v
+}
+
+// Mean reports the mean of the samples.
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.Count)
+}
+
+// Percentile reports the p-th (0 < p <= 100) percentile of the samples.
+//
+// The result is estimated by the upper bound of the bucket which contains the percentile,
+// it is clamped to the actual Min and Max.
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(h.Count)))
+	n := 0
+	for i, c := range h.Counts {
+		n += c
+		if n < rank {
+			continue
+		}
+		if i == len(h.Bounds) || h.Bounds[i] > h.Max {
+			return h.Max
+		}
+		if h.Bounds[i] < h.Min {
+			return h.Min
+		}
+		return h.Bounds[i]
+	}
+	return h.Max
+}
+
+// Stats collects histograms of key lengths, memory usage, element counts and TTLs.
+//
+// Histograms can be replaced before the first call of Add to use other buckets.
+// Stats is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type Stats struct {
+	mu sync.Mutex
+
+	KeyLength *Histogram // key name length in bytes
+	Memory    *Histogram // memory usage in bytes
+	Length    *Histogram // number of elements
+	TTL       *Histogram // time to live in seconds of keys which have an expiry
+
+	// Now is the time TTLs are computed against.
+	Now time.Time
+
+	// Ended reports whether End was called, with Checksum stored in the rdb file
+	// and ChecksumOK whether it matched.
+	Ended      bool
+	Checksum   uint64
+	ChecksumOK bool
+}
+
+// NewStats returns a Stats with default buckets and TTLs computed against current time.
+func NewStats() *Stats {
+	return &Stats{
+		KeyLength: NewHistogram(8, 16, 32, 64, 128, 256, 512, 1024),
+		Memory:    NewHistogram(64, 128, 256, 512, 1<<10, 4<<10, 16<<10, 64<<10, 256<<10, 1<<20, 16<<20, 256<<20),
+		Length:    NewHistogram(1, 8, 64, 128, 512, 1<<10, 8<<10, 64<<10, 1<<20),
+		TTL:       NewHistogram(0, 60, 600, 3600, 6*3600, 86400, 7*86400, 30*86400, 365*86400),
+		Now:       time.Now(),
+	}
+}
+
+// Add adds key which uses memory bytes and has length elements to s.
+func (s *Stats) Add(key Key, memory uint64, length int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.KeyLength.Add(int64(len(key.Key)))
+	s.Memory.Add(int64(memory))
+	s.Length.Add(int64(length))
+	if key.Expiry >= 0 {
+		ttl := (int64(key.Expiry) - s.Now.UnixNano()/int64(time.Millisecond)) / 1000
+		s.TTL.Add(ttl)
+	}
+}
+
+// End records the end of the rdb file, it can be called from Ender's End.
+func (s *Stats) End(checksum uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Ended = true
+	s.Checksum = checksum
+	s.ChecksumOK = ok
+}
@@ -0,0 +1,44 @@
+package rdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(100, 10, 1000)
+	for i := int64(1); i <= 100; i++ {
+		h.Add(i * 5)
+	}
+	if h.Count != 100 || h.Min != 5 || h.Max != 500 || h.Mean() != 252.5 {
+		t.Fatalf("got: %+v", h)
+	}
+	want := []int{2, 18, 80, 0}
+	for i, c := range want {
+		if h.Counts[i] != c {
+			t.Fatalf("want: %v, got: %v", want, h.Counts)
+		}
+	}
+	percentiles := map[float64]int64{1: 10, 10: 100, 50: 500, 100: 500}
+	for p, v := range percentiles {
+		if got := h.Percentile(p); got != v {
+			t.Fatalf("p%v, want: %v, got: %v", p, v, got)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := NewStats()
+	s.Now = time.Unix(1000, 0)
+	s.Add(Key{Key: "foo", Expiry: -1}, 100, 1)
+	s.Add(Key{Key: "foobar", Expiry: 1060000}, 200, 3)
+	if s.KeyLength.Count != 2 || s.KeyLength.Sum != 9 {
+		t.Fatalf("got: %+v", s.KeyLength)
+	}
+	if s.Memory.Sum != 300 || s.Length.Max != 3 {
+		t.Fatalf("got: %+v %+v", s.Memory, s.Length)
+	}
+	if s.TTL.Count != 1 || s.TTL.Max != 60 {
+		t.Fatalf("got: %+v", s.TTL)
+	}
+}
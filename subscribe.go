@@ -0,0 +1,27 @@
+//go:build go1.18
+// +build go1.18
+
+package rdb
+
+// Value is the constraint satisfied by the types of values delivered to filters.
+type Value interface {
+	Set | List | Hash | String | SortedSet
+}
+
+// OnType returns a ParseOption which subscribes fn to the values of type T, e.g.
+//
+//	err := rdb.Parse(reader, rdb.OnType(func(h *rdb.Hash) error {
+//	    fmt.Println(h.Key.Key, len(h.Values))
+//	    return nil
+//	}))
+//
+// Keys of types without subscribers are skipped, unless the filter set by WithFilter, if any, reads them.
+// Subscribers are called after the filter by the same goroutines, the error they return fails the parse.
+func OnType[T Value](fn func(v *T) error) ParseOption {
+	return func(p *Parser) {
+		if p.subs == nil {
+			p.subs = &subscriptions{p: p}
+		}
+		p.subs.add(fn)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package rdb
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestOnType(t *testing.T) {
+	parse := func(opts ...ParseOption) error {
+		r, err := NewMemReader("testdata/dumps/parser_filters.rdb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Parse(r, append(opts, WithStrategy(SkipMeta))...)
+	}
+
+	hashes, sets := 0, 0
+	err := parse(
+		OnType(func(h *Hash) error { hashes++; return nil }),
+		OnType(func(s *Set) error { sets++; return nil }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashes != 3 || sets != 6 {
+		t.Fatalf("want: 3 hashes and 6 sets, got: %v and %v", hashes, sets)
+	}
+
+	// the filter aborts the parse, subscribers don't keep it going
+	keys, lists := 0, 0
+	err = parse(
+		WithFilter(FuncFilter{OnKey: func(Key) bool { keys++; return keys > 1 }}),
+		OnType(func(l *List) error { lists++; return nil }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != 2 {
+		t.Fatalf("want: 2 keys before aborting, got: %v", keys)
+	}
+
+	errStop := errors.New("stop")
+	err = parse(OnType(func(s *String) error { return errStop }))
+	if errors.Cause(err) != errStop {
+		t.Fatalf("want: %v, got: %v", errStop, err)
+	}
+}
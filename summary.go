@@ -0,0 +1,94 @@
+package rdb
+
+import (
+	"sync"
+	"time"
+)
+
+// Summary represents an overview of keys.
+type Summary struct {
+	Usage // all keys
+
+	DBs       map[int]Usage
+	Types     map[ValueType]Usage
+	Encodings map[string]Usage
+
+	Persistent int // keys without expiry
+	Volatile   int // keys which will expire, or have an expiry skipped by SkipExpiry
+	Expired    int // keys which have already expired
+
+	Biggest TopKey // key using the most memory
+}
+
+// Summarizer builds a Summary.
+//
+// Summarizer is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type Summarizer struct {
+	// Now is the time expiries are compared against.
+	Now time.Time
+
+	mu sync.Mutex
+	s  Summary
+}
+
+// NewSummarizer returns a Summarizer comparing expiries against current time.
+func NewSummarizer() *Summarizer {
+	return &Summarizer{
+		Now: time.Now(),
+		s: Summary{
+			DBs:       make(map[int]Usage),
+			Types:     make(map[ValueType]Usage),
+			Encodings: make(map[string]Usage),
+		},
+	}
+}
+
+// Add adds key which uses memory bytes to the summary.
+func (z *Summarizer) Add(key Key, memory uint64) {
+	now := z.Now.UnixNano() / int64(time.Millisecond)
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	s := &z.s
+	s.add(memory)
+	u := s.DBs[key.DB]
+	u.add(memory)
+	s.DBs[key.DB] = u
+	u = s.Types[Encoding2Type(key.Encoding)]
+	u.add(memory)
+	s.Types[Encoding2Type(key.Encoding)] = u
+	u = s.Encodings[Encoding2String(key.Encoding)]
+	u.add(memory)
+	s.Encodings[Encoding2String(key.Encoding)] = u
+	switch {
+	case key.Expiry < 0 && !key.HasExpiry:
+		s.Persistent++
+	case key.Expiry >= 0 && int64(key.Expiry) <= now:
+		s.Expired++
+	default:
+		s.Volatile++
+	}
+	if memory > s.Biggest.Memory || s.Keys == 1 {
+		s.Biggest = TopKey{Key: key, Memory: memory}
+	}
+}
+
+// Summary returns the summary of added keys.
+func (z *Summarizer) Summary() Summary {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	s := z.s
+	s.DBs = make(map[int]Usage, len(z.s.DBs))
+	for k, v := range z.s.DBs {
+		s.DBs[k] = v
+	}
+	s.Types = make(map[ValueType]Usage, len(z.s.Types))
+	for k, v := range z.s.Types {
+		s.Types[k] = v
+	}
+	s.Encodings = make(map[string]Usage, len(z.s.Encodings))
+	for k, v := range z.s.Encodings {
+		s.Encodings[k] = v
+	}
+	return s
+}
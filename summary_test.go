@@ -0,0 +1,34 @@
+package rdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizer(t *testing.T) {
+	z := NewSummarizer()
+	z.Now = time.Unix(1000, 0)
+	z.Add(Key{DB: 0, Key: "a", Encoding: EncodingString, Expiry: -1}, 10)
+	z.Add(Key{DB: 0, Key: "b", Encoding: EncodingHash, Expiry: 999000}, 100)
+	z.Add(Key{DB: 1, Key: "c", Encoding: EncodingHashZip, Expiry: 1060000}, 30)
+
+	s := z.Summary()
+	if s.Keys != 3 || s.Memory != 140 {
+		t.Fatalf("got: %+v", s.Usage)
+	}
+	if s.Persistent != 1 || s.Expired != 1 || s.Volatile != 1 {
+		t.Fatalf("got: %+v", s)
+	}
+	if u := s.DBs[0]; u.Keys != 2 || u.Memory != 110 {
+		t.Fatalf("got: %+v", s.DBs)
+	}
+	if u := s.Types[TypeHash]; u.Keys != 2 || u.Memory != 130 {
+		t.Fatalf("got: %+v", s.Types)
+	}
+	if len(s.Encodings) != 3 {
+		t.Fatalf("got: %+v", s.Encodings)
+	}
+	if s.Biggest.Key.Key != "b" || s.Biggest.Memory != 100 {
+		t.Fatalf("got: %+v", s.Biggest)
+	}
+}
@@ -0,0 +1,121 @@
+package rdb
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Orders of TopKeys.
+const (
+	ByMemory   = iota // estimated memory usage
+	BySize            // serialized size
+	ByLength          // number of elements
+	ByDuration        // decode duration, see WithDecodeTiming
+)
+
+// TopKey represents a key collected by TopKeys.
+type TopKey struct {
+	Key    Key
+	Memory uint64
+	Size   uint64
+	Length int
+
+	Duration time.Duration // time spent decoding the value, set by WithDecodeTiming
+}
+
+// TopKeys collects the biggest keys.
+//
+// Only the n biggest keys are kept, so memory usage is bounded regardless of the number of added keys.
+// TopKeys is safe for concurrent use, it can be fed directly from Filter's callbacks.
+type TopKeys struct {
+	mu sync.Mutex
+	n  int
+	h  topKeyHeap
+}
+
+// NewTopKeys returns a TopKeys which keeps the n biggest keys ordered by by,
+// which is one of ByMemory, BySize, ByLength or ByDuration.
+func NewTopKeys(n int, by int) *TopKeys {
+	return &TopKeys{
+		n: n,
+		h: topKeyHeap{by: by},
+	}
+}
+
+// Add adds k to t, it is dropped if it is smaller than the n biggest keys.
+func (t *TopKeys) Add(k TopKey) {
+	if t.n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.h.keys) < t.n {
+		heap.Push(&t.h, k)
+		return
+	}
+	if t.h.less(t.h.keys[0], k) {
+		t.h.keys[0] = k
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// Keys returns the collected keys, biggest first.
+func (t *TopKeys) Keys() []TopKey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]TopKey, len(t.h.keys))
+	copy(keys, t.h.keys)
+	sort.Slice(keys, func(i, j int) bool { return t.h.less(keys[j], keys[i]) })
+	return keys
+}
+
+// WithDecodeTiming returns a ParseOption which adds every decoded key to t along with how long decoding it took:
+// decompressing, transforming and decoding its value, the filter callback excluded.
+// A TopKeys ordered ByDuration keeps the slowest keys, e.g. giant quicklists or pathological LZF blocks.
+func WithDecodeTiming(t *TopKeys) ParseOption {
+	return func(p *Parser) {
+		p.timing = t
+	}
+}
+
+// topKeyHeap is a min-heap, the smallest collected key is at the top.
+type topKeyHeap struct {
+	by   int
+	keys []TopKey
+}
+
+func (h *topKeyHeap) less(a, b TopKey) bool {
+	switch h.by {
+	case BySize:
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+	case ByLength:
+		if a.Length != b.Length {
+			return a.Length < b.Length
+		}
+	case ByDuration:
+		if a.Duration != b.Duration {
+			return a.Duration < b.Duration
+		}
+	default:
+		if a.Memory != b.Memory {
+			return a.Memory < b.Memory
+		}
+	}
+	// make results stable
+	return a.Key.Key > b.Key.Key
+}
+
+func (h topKeyHeap) Len() int            { return len(h.keys) }
+func (h topKeyHeap) Less(i, j int) bool  { return h.less(h.keys[i], h.keys[j]) }
+func (h topKeyHeap) Swap(i, j int)       { h.keys[i], h.keys[j] = h.keys[j], h.keys[i] }
+func (h *topKeyHeap) Push(x interface{}) { h.keys = append(h.keys, x.(TopKey)) }
+func (h *topKeyHeap) Pop() interface{} {
+	n := len(h.keys)
+	k := h.keys[n-1]
+	h.keys = h.keys[:n-1]
+	return k
+}
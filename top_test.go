@@ -0,0 +1,62 @@
+package rdb
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTopKeys(t *testing.T) {
+	tests := []struct {
+		by   int
+		want []string
+	}{
+		{ByMemory, []string{"9", "8", "7"}},
+		{BySize, []string{"0", "1", "2"}},
+		{ByLength, []string{"5", "4", "6"}},
+		{ByDuration, []string{"3", "7", "2"}},
+	}
+	for i, test := range tests {
+		top := NewTopKeys(3, test.by)
+		for j := 0; j < 10; j++ {
+			top.Add(TopKey{
+				Key:    Key{Key: strconv.Itoa(j)},
+				Memory: uint64(j),
+				Size:   uint64(10 - j),
+				Length: 10 - (j-5)*(j-5),
+
+				Duration: time.Duration(j % 4),
+			})
+		}
+		keys := top.Keys()
+		if len(keys) != len(test.want) {
+			t.Fatalf("index: %v, want: %v, got: %v", i, test.want, keys)
+		}
+		for j, k := range keys {
+			if k.Key.Key != test.want[j] {
+				t.Fatalf("index: %v, want: %v, got: %v", i, test.want, keys)
+			}
+		}
+	}
+}
+
+func TestDecodeTiming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := generate(&buf, shape{Seed: 1, Keys: 40, Elements: 50, ValueSize: 8, Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	top := NewTopKeys(10, ByDuration)
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(new(testEmptyFilter)), WithDecodeTiming(top)); err != nil {
+		t.Fatal(err)
+	}
+	keys := top.Keys()
+	if len(keys) != 10 {
+		t.Fatalf("want: 10 keys, got: %v", len(keys))
+	}
+	for i, k := range keys {
+		if k.Length == 0 || k.Size == 0 || i > 0 && k.Duration > keys[i-1].Duration {
+			t.Fatalf("%v: got: %+v", i, k)
+		}
+	}
+}
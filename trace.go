@@ -0,0 +1,52 @@
+package rdb
+
+// Span is an operation traced by a Tracer, End is called once it's over with the error it failed with, if any.
+type Span interface {
+	End(err error)
+}
+
+// A Tracer starts the spans of a parse, it can be adapted to OpenTelemetry or any other tracing library.
+//
+// Spans are named:
+//
+//	rdb.parse   the whole parse of a rdb file
+//	rdb.db      the records of a database, attribute db
+//	rdb.decode  the decoding of a value by a filter worker, attributes db, key, type and encoding
+//
+// Start is called concurrently by filter workers unless EnableSync is set.
+type Tracer interface {
+	Start(name string, attrs map[string]interface{}) Span
+}
+
+// WithTracer returns a ParseOption which traces the parse with t.
+func WithTracer(t Tracer) ParseOption {
+	return func(p *Parser) {
+		p.tracer = t
+	}
+}
+
+// noopSpan is the Span started without a Tracer.
+type noopSpan struct{}
+
+func (noopSpan) End(err error) {}
+
+// startSpan starts a span of the tracer, if any.
+func (p *Parser) startSpan(name string, attrs map[string]interface{}) Span {
+	if p.tracer == nil {
+		return noopSpan{}
+	}
+	return p.tracer.Start(name, attrs)
+}
+
+// startDecodeSpan starts the span of decoding the value of key.
+func (p *Parser) startDecodeSpan(key Key) Span {
+	if p.tracer == nil {
+		return noopSpan{}
+	}
+	return p.tracer.Start("rdb.decode", map[string]interface{}{
+		"db":       key.DB,
+		"key":      key.String(),
+		"type":     Encoding2Type(key.Encoding),
+		"encoding": Encoding2String(key.Encoding),
+	})
+}
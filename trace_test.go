@@ -0,0 +1,49 @@
+package rdb
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+type testTracer struct {
+	sync.Mutex
+
+	started map[string]int
+	ended   map[string]int
+}
+
+type testSpan struct {
+	t    *testTracer
+	name string
+}
+
+func (t *testTracer) Start(name string, attrs map[string]interface{}) Span {
+	t.Lock()
+	defer t.Unlock()
+	t.started[name]++
+	return testSpan{t, name}
+}
+
+func (s testSpan) End(err error) {
+	s.t.Lock()
+	defer s.t.Unlock()
+	s.t.ended[s.name]++
+}
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	if err := generate(&buf, shape{Seed: 1, Keys: 30, DBs: 3, Elements: 4, ValueSize: 8}); err != nil {
+		t.Fatal(err)
+	}
+	tr := &testTracer{started: make(map[string]int), ended: make(map[string]int)}
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(new(testEmptyFilter)), WithTracer(tr)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"rdb.parse": 1, "rdb.db": 3, "rdb.decode": 30}
+	for name, n := range want {
+		if tr.started[name] != n || tr.ended[name] != n {
+			t.Fatalf("%v: want: %v spans, got: %v started, %v ended", name, n, tr.started[name], tr.ended[name])
+		}
+	}
+}
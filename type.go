@@ -1,37 +1,138 @@
 package rdb
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"strconv"
+	"strings"
 	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
 )
 
+// Encoding is the type byte of a value in a rdb file, which tells the redis type of the value and how it's serialized.
+// Encodings following EncodingQuicklist, written by redis 5 and later, are known but not parsed.
+type Encoding byte
+
 // Redis value encodings.
 const (
-	EncodingString       = 0
-	EncodingList         = 1
-	EncodingSet          = 2
-	EncodingSortedSet    = 3
-	EncodingHash         = 4
-	EncodingSortedSet2   = 5
-	EncodingZipmap       = 9
-	EncodingZiplist      = 10
-	EncodingIntset       = 11
-	EncodingSortedSetZip = 12
-	EncodingHashZip      = 13
-	EncodingQuicklist    = 14
+	EncodingString            Encoding = 0
+	EncodingList              Encoding = 1
+	EncodingSet               Encoding = 2
+	EncodingSortedSet         Encoding = 3
+	EncodingHash              Encoding = 4
+	EncodingSortedSet2        Encoding = 5
+	EncodingModulePreGA       Encoding = 6
+	EncodingModule2           Encoding = 7
+	EncodingZipmap            Encoding = 9
+	EncodingZiplist           Encoding = 10
+	EncodingIntset            Encoding = 11
+	EncodingSortedSetZip      Encoding = 12
+	EncodingHashZip           Encoding = 13
+	EncodingQuicklist         Encoding = 14
+	EncodingStreamListpacks   Encoding = 15
+	EncodingHashListpack      Encoding = 16
+	EncodingSortedSetListpack Encoding = 17
+	EncodingQuicklist2        Encoding = 18
+	EncodingStreamListpacks2  Encoding = 19
+	EncodingSetListpack       Encoding = 20
+	EncodingStreamListpacks3  Encoding = 21
+	EncodingHashMetadataPreGA Encoding = 22
+	EncodingHashListpackPreGA Encoding = 23
+	EncodingHashMetadata      Encoding = 24
+	EncodingHashListpackEx    Encoding = 25
 )
 
+// IsValid reports whether e is an encoding redis writes.
+func (e Encoding) IsValid() bool {
+	return e <= EncodingHashListpackEx && e != 8
+}
+
+// Type returns the redis type of values of encoding e, e.g. TypeHash, or TypeUnknown if e isn't valid.
+func (e Encoding) Type() ValueType {
+	switch e {
+	case EncodingString:
+		return TypeString
+	case EncodingList, EncodingZiplist, EncodingQuicklist, EncodingQuicklist2:
+		return TypeList
+	case EncodingSet, EncodingIntset, EncodingSetListpack:
+		return TypeSet
+	case EncodingSortedSet, EncodingSortedSet2, EncodingSortedSetZip, EncodingSortedSetListpack:
+		return TypeSortedSet
+	case EncodingHash, EncodingZipmap, EncodingHashZip, EncodingHashListpack,
+		EncodingHashMetadataPreGA, EncodingHashListpackPreGA, EncodingHashMetadata, EncodingHashListpackEx:
+		return TypeHash
+	case EncodingStreamListpacks, EncodingStreamListpacks2, EncodingStreamListpacks3:
+		return TypeStream
+	case EncodingModulePreGA, EncodingModule2:
+		return TypeModule
+	}
+	return TypeUnknown
+}
+
+// String returns the name redis gives to encoding e in OBJECT ENCODING, e.g. "ziplist", or "unknown" if e isn't valid.
+func (e Encoding) String() string {
+	switch e {
+	case EncodingString:
+		return "string"
+	case EncodingList:
+		return "linkedlist"
+	case EncodingZiplist, EncodingSortedSetZip, EncodingHashZip:
+		return "ziplist"
+	case EncodingQuicklist, EncodingQuicklist2:
+		return "quicklist"
+	case EncodingSet, EncodingHash, EncodingHashMetadataPreGA, EncodingHashMetadata:
+		return "hashtable"
+	case EncodingIntset:
+		return "intset"
+	case EncodingSortedSet, EncodingSortedSet2:
+		return "skiplist"
+	case EncodingZipmap:
+		return "zipmap"
+	case EncodingHashListpack, EncodingSortedSetListpack, EncodingSetListpack:
+		return "listpack"
+	case EncodingHashListpackPreGA, EncodingHashListpackEx:
+		return "listpackex"
+	case EncodingStreamListpacks, EncodingStreamListpacks2, EncodingStreamListpacks3:
+		return "stream"
+	case EncodingModulePreGA, EncodingModule2:
+		return "module"
+	}
+	return "unknown"
+}
+
+// ValueType is the redis type of a value, as reported by TYPE but for sorted sets.
+type ValueType string
+
 // Redis types.
 const (
-	TypeSet       = "set"
-	TypeList      = "list"
-	TypeHash      = "hash"
-	TypeString    = "string"
-	TypeSortedSet = "sortedset"
+	TypeSet       ValueType = "set"
+	TypeList      ValueType = "list"
+	TypeHash      ValueType = "hash"
+	TypeString    ValueType = "string"
+	TypeSortedSet ValueType = "sortedset"
+	TypeStream    ValueType = "stream"
+	TypeModule    ValueType = "module"
+	TypeUnknown   ValueType = "unknown"
 )
 
+// ParseValueType returns the type named s, case-insensitively; zset is an alias of sortedset.
+func ParseValueType(s string) (ValueType, error) {
+	switch typ := ValueType(strings.ToLower(s)); typ {
+	case TypeSet, TypeList, TypeHash, TypeString, TypeSortedSet, TypeStream, TypeModule:
+		return typ, nil
+	case "zset":
+		return TypeSortedSet, nil
+	}
+	return "", errors.Errorf("invalid type: %q", s)
+}
+
 // A Filter controls the parser's behaviors.
 //
+// Maps and slices of values passed to Set, List, Hash and SortedSet are reused by the next call
+// with WithBufferReuse, they are then only valid until the callback returns unless WithFreshValues is set.
+//
 // NOTE: Filter is not safe for concurrent use.
 type Filter interface {
 	Key(key Key) bool
@@ -45,15 +146,29 @@ type Filter interface {
 	SortedSet(s *SortedSet)
 }
 
+// An Ender is a Filter which is told the parse reached the EOF opcode, after the callbacks of all keys returned.
+// checksum is the one stored in the rdb file and ok reports whether it matches the data read.
+// Rdb files before version 5 have no checksum, it's 0 then, as well as with rdbchecksum disabled,
+// and ok is true.
+//
+// End isn't called if the parse fails, e.g. the data ends before the EOF opcode.
+type Ender interface {
+	End(checksum uint64, ok bool)
+}
+
 // Key represents a redis key.
 type Key struct {
-	Encoding byte
-	DB       int
-	Expiry   int
-	Key      string
+	Encoding  Encoding
+	DB        int
+	Expiry    int  // unix time in milliseconds, -1 if key has no expiry or it's skipped by SkipExpiry
+	HasExpiry bool // whether key has an expiry, even if it's skipped by SkipExpiry
+	Idle      int  // LRU idle time in seconds, -1 if it isn't stored
+	Freq      int  // LFU access frequency, -1 if it isn't stored
+	Key       string
 
 	p      *Parser
 	memory uint64
+	offset int64 // offset of the value type in the rdb file, if it's tracked
 }
 
 // Skip sets next item's skipping strategy.
@@ -61,9 +176,43 @@ func (k Key) Skip(strategy int) {
 	k.p.strategy.running = strategy
 }
 
+// Bytes returns the name of k as bytes, binary names included.
+func (k Key) Bytes() []byte {
+	return []byte(k.Key)
+}
+
+// String returns the name of k, binary names are represented as selected by WithKeyFormat.
+func (k Key) String() string {
+	if k.p == nil {
+		return k.Key
+	}
+	return FormatKey(k.Key, k.p.keyFormat)
+}
+
+// Representations of binary keys, see WithKeyFormat.
+const (
+	KeyRaw    = iota // as is
+	KeyHex           // hex encoded
+	KeyBase64        // standard base64 encoded
+)
+
+// FormatKey returns key represented as format if it's binary, i.e. not valid UTF-8, or key as is otherwise.
+func FormatKey(key string, format int) string {
+	if format == KeyRaw || utf8.ValidString(key) {
+		return key
+	}
+	switch format {
+	case KeyHex:
+		return hex.EncodeToString([]byte(key))
+	case KeyBase64:
+		return base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return key
+}
+
 // Type represents a redis type.
 type Type struct {
-	Encoding byte
+	Encoding Encoding
 
 	p *Parser
 }
@@ -74,10 +223,16 @@ func (t Type) Skip(strategy int) {
 }
 
 // DB represents a redis database.
+//
+// Size and Expires are the numbers of keys and keys with an expiry of the RESIZEDB hint following the database
+// selector, which is written since rdb version 7. They are -1 without the hint, and in databases resumed by segments
+// of ParseSegments.
 type DB struct {
 	p *Parser
 
-	Num int
+	Num     int
+	Size    int
+	Expires int
 }
 
 // Skip sets next database's skip strategy.
@@ -86,10 +241,16 @@ func (db DB) Skip(strategy int) {
 }
 
 // Set represents redis set.
+//
+// Members of an intset encoded set are ints in Values, and int64s in IntSet,
+// which are exact on 32-bit platforms too.
 type Set struct {
 	Key    Key
 	Values map[interface{}]struct{}
+	IntSet []int64 // members of an intset in ascending order, nil for other encodings
 	memory uint64
+	size   uint64
+	counts int // number of members counted while their values are skipped
 }
 
 // Memory reports memory used by s.
@@ -97,11 +258,48 @@ func (s Set) Memory() uint64 {
 	return s.Key.memory + s.memory
 }
 
+// Size reports the uncompressed size of s's payload in the RDB file.
+func (s Set) Size() uint64 {
+	return s.size
+}
+
+// Len reports the number of members in s, they are counted even if values are skipped.
+func (s Set) Len() int {
+	return len(s.Values) + s.counts
+}
+
 // List represents redis list.
 type List struct {
-	Key    Key
-	Values []string
-	memory uint64
+	Key       Key
+	Values    []string
+	Quicklist QuicklistStats // node statistics, set if l is encoded as quicklist
+	memory    uint64
+	size      uint64
+	counts    int // number of elements counted while their values are skipped
+}
+
+// QuicklistStats describes the ziplist nodes of a quicklist.
+type QuicklistStats struct {
+	Nodes      int
+	Compressed int    // number of LZF compressed nodes, as by list-compress-depth, counted only if values are decoded
+	Entries    int    // number of elements of all nodes
+	Bytes      uint64 // uncompressed size of all nodes
+}
+
+// AvgEntries reports the average number of elements of a node, to compare with list-max-ziplist-size.
+func (q QuicklistStats) AvgEntries() float64 {
+	if q.Nodes == 0 {
+		return 0
+	}
+	return float64(q.Entries) / float64(q.Nodes)
+}
+
+// AvgBytes reports the average size of a node.
+func (q QuicklistStats) AvgBytes() float64 {
+	if q.Nodes == 0 {
+		return 0
+	}
+	return float64(q.Bytes) / float64(q.Nodes)
 }
 
 // Memory reports memory used by l.
@@ -109,11 +307,26 @@ func (l List) Memory() uint64 {
 	return l.Key.memory + l.memory
 }
 
+// Size reports the uncompressed size of l's payload in the RDB file.
+func (l List) Size() uint64 {
+	return l.size
+}
+
+// Len reports the number of elements in l, they are counted even if values are skipped.
+func (l List) Len() int {
+	return len(l.Values) + l.counts
+}
+
 // Hash represents redis hash.
 type Hash struct {
 	Key    Key
 	Values map[string]string
-	memory uint64
+	// Expiries holds the expiry of the fields which expire, unix time in milliseconds, for hashes whose fields
+	// may expire (HEXPIRE of redis 7.4 and later). It's nil for other hashes.
+	Expiries map[string]int
+	memory   uint64
+	size     uint64
+	counts   int // number of fields counted while their values are skipped
 }
 
 // Memory reports memory used by l.
@@ -121,11 +334,27 @@ func (h Hash) Memory() uint64 {
 	return h.Key.memory + h.memory
 }
 
+// Size reports the uncompressed size of h's payload in the RDB file.
+func (h Hash) Size() uint64 {
+	return h.size
+}
+
+// Len reports the number of fields in h, they are counted even if values are skipped.
+func (h Hash) Len() int {
+	return len(h.Values) + h.counts
+}
+
 // String represents redis sds.
 type String struct {
-	Key    Key
-	Value  string
+	Key       Key
+	Value     string
+	Oversized bool // whether Value is discarded since it's larger than WithMaxStringSize, it's empty then
+
+	ContentType string      // type of serialized object Value holds, as detected by WithContentDecoder
+	Content     interface{} // Value decoded by the ContentDecoder detecting it, if it decodes values
+
 	memory uint64
+	size   uint64
 }
 
 // Memory reports memory used by s.
@@ -133,11 +362,24 @@ func (s String) Memory() uint64 {
 	return s.Key.memory + s.memory
 }
 
+// Size reports the uncompressed size of s's payload in the RDB file.
+func (s String) Size() uint64 {
+	return s.size
+}
+
+// Len always reports 1, a string is a single element.
+func (s String) Len() int {
+	return 1
+}
+
 // SortedSet represents redis sortedset.
 type SortedSet struct {
 	Key    Key
 	Values map[string]float64
+	Scores map[string]string // scores as strings, only set by WithScoreStrings
 	memory uint64
+	size   uint64
+	counts int // number of members counted while their values are skipped
 }
 
 // Memory reports memory used by ss.
@@ -145,6 +387,16 @@ func (ss SortedSet) Memory() uint64 {
 	return ss.Key.memory + ss.memory
 }
 
+// Size reports the uncompressed size of ss's payload in the RDB file.
+func (ss SortedSet) Size() uint64 {
+	return ss.size
+}
+
+// Len reports the number of members in ss, they are counted even if values are skipped.
+func (ss SortedSet) Len() int {
+	return len(ss.Values) + ss.counts
+}
+
 var (
 	redisTypePool = &sync.Pool{
 		New: func() interface{} {
@@ -174,10 +426,10 @@ func (rt *redisType) reset() {
 	redisTypePool.Put(i)
 }
 
-func (rt *redisType) decompress() (err error) {
+func (rt *redisType) decompress(s *scratch) (err error) {
 	for _, v := range rt.values {
 		if v.c {
-			v.b, err = readLZF(v.b, len(v.b), v.l)
+			v.b, err = readLZF(v.b, len(v.b), v.l, s)
 			if err != nil {
 				return err
 			}
@@ -186,10 +438,52 @@ func (rt *redisType) decompress() (err error) {
 	return nil
 }
 
-func (rt *redisType) set(set *Set) error {
+// transform replaces the values which are redis strings by the result of fn, compact encodings are left as is.
+func (rt *redisType) transform(fn func(Key, []byte) ([]byte, error)) (err error) {
+	if fn == nil {
+		return nil
+	}
+	switch rt.key.Encoding {
+	case EncodingString, EncodingList, EncodingSet, EncodingHash, EncodingSortedSet, EncodingSortedSet2,
+		EncodingHashMetadataPreGA, EncodingHashMetadata:
+	default:
+		return nil
+	}
+	// expiries of hash fields have no bytes
+	scores := rt.key.Encoding == EncodingSortedSet || rt.key.Encoding == EncodingSortedSet2
+	for i, v := range rt.values {
+		// skipped values have no bytes, neither have scores unless WithScoreStrings is set
+		if v.b == nil || scores && i%2 == 1 {
+			continue
+		}
+		if v.b, err = fn(rt.key, v.b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rt *redisType) size() uint64 {
+	var size uint64
+	for _, v := range rt.values {
+		size += uint64(v.l)
+	}
+	return size
+}
+
+func (rt *redisType) set(set *Set, s *scratch) error {
 	set.memory = 0
+	set.size = rt.size()
 	set.Key = rt.key
-	set.Values = make(map[interface{}]struct{})
+	set.IntSet = nil
+	set.counts = 0
+	if s.reusing() && set.Values != nil {
+		for k := range set.Values {
+			delete(set.Values, k)
+		}
+	} else {
+		set.Values = make(map[interface{}]struct{})
+	}
 	switch set.Key.Encoding {
 	case EncodingSet:
 		set.memory += _overhead.hash(len(rt.values))
@@ -198,27 +492,35 @@ func (rt *redisType) set(set *Set) error {
 			set.memory += values[i].m + _overhead.hashEntry() + _overhead.root()
 			if b := values[i].b; b != nil {
 				set.Values[bytes2string(b)] = struct{}{}
+			} else {
+				set.counts++
 			}
 		}
 	case EncodingIntset:
 		set.memory += uint64(rt.values[0].l)
-		inset, err := rt.values[0].readIntset()
+		set.counts = rt.values[0].n
+		inset, err := rt.values[0].readIntset(s)
 		if err != nil {
 			return err
 		}
 		for _, v := range inset {
-			set.Values[v] = struct{}{}
+			set.Values[int(v)] = struct{}{}
 		}
+		set.IntSet = inset
 	}
 	return nil
 }
 
-func (rt *redisType) list(list *List) (err error) {
+func (rt *redisType) list(list *List, s *scratch) (err error) {
 	list.memory = 0
+	list.size = rt.size()
 	list.Key = rt.key
+	list.Values = nil
+	list.Quicklist = QuicklistStats{}
+	list.counts = 0
 	switch list.Key.Encoding {
 	case EncodingList:
-		list.Values = make([]string, len(rt.values))
+		list.Values = s.strs(len(rt.values))
 		values := rt.values
 		list.memory += _overhead.linkedlist()
 		for i := 0; i < len(values); i++ {
@@ -229,45 +531,84 @@ func (rt *redisType) list(list *List) (err error) {
 		}
 	case EncodingZiplist:
 		list.memory += uint64(rt.values[0].l)
-		list.Values, err = rt.values[0].readZiplist()
+		list.counts = rt.values[0].n
+		list.Values, err = rt.values[0].readZiplist(s)
 		if err != nil {
 			return err
 		}
 	case EncodingQuicklist:
 		list.memory += _overhead.quicklist(len(rt.values))
+		if s.reusing() {
+			list.Values = s.list[:0]
+		}
+		list.Quicklist.Nodes = len(rt.values)
 		for _, value := range rt.values {
 			list.memory += uint64(value.l)
-			values, err := value.readZiplist()
+			list.counts += value.n
+			list.Quicklist.Bytes += uint64(value.l)
+			if value.c {
+				list.Quicklist.Compressed++
+			}
+			values, err := value.readZiplist(s)
 			if err != nil {
 				return err
 			}
 			list.Values = append(list.Values, values...)
+			if value.b != nil {
+				list.Quicklist.Entries += len(values)
+			} else {
+				list.Quicklist.Entries += value.n
+			}
+		}
+		if s.reusing() {
+			s.list = list.Values
 		}
 	}
 	return nil
 }
 
-func (rt *redisType) hash(hash *Hash) error {
+func (rt *redisType) hash(hash *Hash, s *scratch) error {
 	hash.memory = 0
+	hash.size = rt.size()
 	hash.Key = rt.key
-	hash.Values = make(map[string]string)
+	hash.counts = 0
+	if s.reusing() && hash.Values != nil {
+		for k := range hash.Values {
+			delete(hash.Values, k)
+		}
+	} else {
+		hash.Values = make(map[string]string)
+	}
+	metadata := hash.Key.Encoding == EncodingHashMetadata || hash.Key.Encoding == EncodingHashMetadataPreGA
+	switch {
+	case !metadata:
+		hash.Expiries = nil
+	case s.reusing() && hash.Expiries != nil:
+		for k := range hash.Expiries {
+			delete(hash.Expiries, k)
+		}
+	default:
+		hash.Expiries = make(map[string]int)
+	}
 	switch hash.Key.Encoding {
 	case EncodingHashZip:
 		hash.memory += uint64(rt.values[0].l)
-		values, err := rt.values[0].readZiplist()
+		hash.counts = rt.values[0].n
+		values, err := rt.values[0].readZiplist(s)
 		if err != nil {
 			return err
 		}
-		for i := 0; i < len(values); i += 2 {
+		for i := 0; i+1 < len(values); i += 2 {
 			hash.Values[values[i]] = values[i+1]
 		}
 	case EncodingZipmap:
 		hash.memory += uint64(rt.values[0].l)
-		values, err := rt.values[0].readZipmap()
+		hash.counts = rt.values[0].n
+		values, err := rt.values[0].readZipmap(s)
 		if err != nil {
 			return err
 		}
-		for i := 0; i < len(values); i += 2 {
+		for i := 0; i+1 < len(values); i += 2 {
 			hash.Values[values[i]] = values[i+1]
 		}
 	case EncodingHash:
@@ -277,26 +618,66 @@ func (rt *redisType) hash(hash *Hash) error {
 			hash.memory += values[i].m + values[i+1].m + _overhead.hashEntry() + 2*_overhead.root()
 			if k, v := values[i].b, values[i+1].b; k != nil && v != nil {
 				hash.Values[bytes2string(k)] = bytes2string(v)
+			} else {
+				hash.counts++
+			}
+		}
+	case EncodingHashMetadataPreGA, EncodingHashMetadata:
+		hash.memory += _overhead.hash(len(rt.values) / 3)
+		values := rt.values
+		for i := 0; i+2 < len(values); i += 3 {
+			hash.memory += values[i].m + values[i+1].m + _overhead.hashEntry() + 2*_overhead.root()
+			if k, v := values[i].b, values[i+1].b; k != nil && v != nil {
+				hash.Values[bytes2string(k)] = bytes2string(v)
+				if e := values[i+2].e; e >= 0 {
+					hash.Expiries[bytes2string(k)] = e
+				}
+			} else {
+				hash.counts++
 			}
 		}
 	}
 	return nil
 }
 
-func (rt *redisType) string(s *String) *String {
+func (rt *redisType) string(s *String, sc *scratch) *String {
 	s.memory = 0
+	s.size = rt.size()
 	s.Key = rt.key
+	s.Value = ""
 	if b := rt.values[0].b; b != nil {
 		s.Value = bytes2string(b)
 	}
+	s.Oversized = rt.values[0].o
 	s.memory = rt.values[0].m
+	if sc != nil {
+		detect(s, sc.decoders)
+	}
 	return s
 }
 
-func (rt *redisType) sortedset(ss *SortedSet) error {
+func (rt *redisType) sortedset(ss *SortedSet, s *scratch) error {
 	ss.memory = 0
+	ss.size = rt.size()
 	ss.Key = rt.key
-	ss.Values = make(map[string]float64)
+	ss.counts = 0
+	if s.reusing() && ss.Values != nil {
+		for k := range ss.Values {
+			delete(ss.Values, k)
+		}
+	} else {
+		ss.Values = make(map[string]float64)
+	}
+	switch {
+	case !s.scores:
+		ss.Scores = nil
+	case s.reusing() && ss.Scores != nil:
+		for k := range ss.Scores {
+			delete(ss.Scores, k)
+		}
+	default:
+		ss.Scores = make(map[string]string)
+	}
 	switch ss.Key.Encoding {
 	case EncodingSortedSet, EncodingSortedSet2:
 		ss.memory += _overhead.skiplist(len(rt.values) / 2)
@@ -305,20 +686,29 @@ func (rt *redisType) sortedset(ss *SortedSet) error {
 			ss.memory += values[i].m + 8 + _overhead.root() + _overhead.skiplistEntry()
 			if k := values[i].b; k != nil {
 				ss.Values[bytes2string(k)] = values[i+1].f
+				if ss.Scores != nil {
+					ss.Scores[bytes2string(k)] = bytes2string(values[i+1].b)
+				}
+			} else {
+				ss.counts++
 			}
 		}
 	case EncodingSortedSetZip:
 		ss.memory += uint64(rt.values[0].l)
-		values, err := rt.values[0].readZiplist()
+		ss.counts = rt.values[0].n
+		values, err := rt.values[0].readZiplist(s)
 		if err != nil {
 			return err
 		}
-		for i := 0; i < len(values); i += 2 {
+		for i := 0; i+1 < len(values); i += 2 {
 			f, err := strconv.ParseFloat(values[i+1], 64)
 			if err != nil {
 				return err
 			}
 			ss.Values[values[i]] = f
+			if ss.Scores != nil {
+				ss.Scores[values[i]] = values[i+1]
+			}
 		}
 	}
 	return nil
@@ -330,6 +720,9 @@ type value struct {
 	m uint64
 	f float64
 	b []byte
+	n int  // number of elements of a skipped ziplist, zipmap or intset, counted from its header
+	o bool // whether the value is discarded since it's larger than WithMaxStringSize
+	e int  // expiry of a hash field, unix time in milliseconds or -1
 	i interface{}
 }
 
@@ -352,16 +745,28 @@ func newDoubleValue(f float64) *value {
 	return v
 }
 
+// newExpiryValue returns the expiry of a hash field, unix time in milliseconds or -1.
+func newExpiryValue(expiry int) *value {
+	i := valuePool.Get()
+	v := i.(*value)
+	v.e = expiry
+	v.i = i
+	return v
+}
+
 func (v *value) reset() {
 	i := v.i
 	v.l = 0
 	v.m = 0
 	v.b = nil
 	v.c = false
+	v.n = 0
+	v.o = false
+	v.e = 0
 	valuePool.Put(i)
 }
 
-func (v *value) readZiplist() ([]string, error) {
+func (v *value) readZiplist(s *scratch) ([]string, error) {
 	if v.b == nil {
 		return nil, nil
 	}
@@ -370,28 +775,59 @@ func (v *value) readZiplist() ([]string, error) {
 
 	r := &MemReader{b: v.b}
 	// zlbytes: 4 byte unsigned integer in little endian format
-	r.Discard(4)
+	zlbytes, err := r.little32()
+	if err != nil {
+		return nil, err
+	}
 
 	// zltail: 4 byte unsigned integer in little endian format
-	r.Discard(4)
+	zltail, err := r.little32()
+	if err != nil {
+		return nil, err
+	}
 
 	// zllen: 2 byte unsigned integer in little endian format
 	zllen, err := r.little16()
 	if err != nil {
 		return nil, err
 	}
+	zllen = int(uint16(zllen))
 
-	values := make([]string, zllen)
-	for j := 0; j < int(zllen); j++ {
+	strict := s.strictly()
+	if strict && uint32(zlbytes) != uint32(len(v.b)) {
+		return nil, errors.Wrapf(ErrInvalidZiplist, "zlbytes is %d, the ziplist has %d bytes", uint32(zlbytes), len(v.b))
+	}
+	// offset and length of the last entry
+	tail, prev := r.i, 0
+
+	// zllen is 65535 if the entries can't be counted in 16 bits, they are read until zlend then
+	counted := zllen < 65535
+	values := s.strs(zllen)
+	j := 0
+	for ; counted && j < zllen || !counted && r.i < len(r.b) && r.b[r.i] != 0xff; j++ {
+		if j == len(values) {
+			values = append(values, "")
+		}
+		start := r.i
 		// <length-prev-entry><special-flag><raw-bytes-of-entry>
 		b, err := r.ReadByte()
 		if err != nil {
 			return nil, err
 		}
+		if strict && b == 0xff {
+			return nil, errors.Wrapf(ErrInvalidZiplist, "zllen is %d, zlend follows %d entries", zllen, j)
+		}
 		if b == 0xfe {
-			// ignore length-prev-entry
 			// if b == 254, next 4 bytes are used to store the length
-			r.Discard(4)
+			if !strict {
+				r.Discard(4)
+			} else if l, err := r.little32(); err != nil {
+				return nil, err
+			} else if l != prev {
+				return nil, errors.Wrapf(ErrInvalidZiplist, "entry %d: previous entry length is %d, want %d", j, l, prev)
+			}
+		} else if strict && int(b) != prev {
+			return nil, errors.Wrapf(ErrInvalidZiplist, "entry %d: previous entry length is %d, want %d", j, b, prev)
 		}
 
 		first, err := r.ReadByte()
@@ -434,21 +870,21 @@ func (v *value) readZiplist() ([]string, error) {
 				if err != nil {
 					return nil, err
 				}
-				values[j] = strconv.Itoa(i16)
+				values[j] = s.itoa(int64(i16))
 			case 1:
 				// 1101: 4 bytes as a 32 bit signed integer
 				i32, err := r.little32()
 				if err != nil {
 					return nil, err
 				}
-				values[j] = strconv.Itoa(i32)
+				values[j] = s.itoa(int64(i32))
 			case 2:
 				// 1110: 8 bytes as a 64 bit signed integer
-				i64, err := r.little64()
+				i64, err := r.littleInt(8)
 				if err != nil {
 					return nil, err
 				}
-				values[j] = strconv.Itoa(i64)
+				values[j] = s.itoa(i64)
 			}
 			fallthrough
 		default:
@@ -460,26 +896,43 @@ func (v *value) readZiplist() ([]string, error) {
 					return nil, err
 				}
 				i32 := uint32(bs[2])<<24 | uint32(bs[1])<<16 | uint32(bs[0])<<8
-				values[j] = strconv.Itoa(int(int32(i32) >> 8))
+				values[j] = s.itoa(int64(int32(i32) >> 8))
 			case first == 254:
 				// 11111110: 1 bytes as an 8 bit signed integer
 				b, err = r.ReadByte()
 				if err != nil {
 					return nil, err
 				}
-				values[j] = strconv.Itoa(int(int8(b)))
+				values[j] = s.itoa(int64(int8(b)))
 			case first >= 241 && first <= 253:
 				// 1111xxxx: 4 bit unsigned integer(0 - 12)
-				values[j] = strconv.Itoa(int(first) - 241)
+				values[j] = s.itoa(int64(first) - 241)
+			case first == 255 && strict:
+				return nil, errors.Wrapf(ErrInvalidZiplist, "entry %d: invalid encoding 0xff", j)
 			}
 		}
+		tail, prev = start, r.i-start
 	}
 	// zlend: always 255
+	if strict {
+		if !counted && j < zllen {
+			return nil, errors.Wrapf(ErrInvalidZiplist, "zllen is %d, the ziplist has %d entries", zllen, j)
+		}
+		if uint32(zltail) != uint32(tail) {
+			return nil, errors.Wrapf(ErrInvalidZiplist, "zltail is %d, the last entry is at %d", uint32(zltail), tail)
+		}
+		if r.i >= len(r.b) || r.b[r.i] != 0xff {
+			return nil, errors.Wrapf(ErrInvalidZiplist, "zllen is %d, zlend doesn't follow the entries", zllen)
+		}
+		if r.i != len(r.b)-1 {
+			return nil, errors.Wrapf(ErrInvalidZiplist, "%d bytes follow zlend", len(r.b)-1-r.i)
+		}
+	}
 
-	return values, nil
+	return values[:j], nil
 }
 
-func (v *value) readZipmap() ([]string, error) {
+func (v *value) readZipmap(s *scratch) ([]string, error) {
 	if v.b == nil {
 		return nil, nil
 	}
@@ -492,34 +945,38 @@ func (v *value) readZipmap() ([]string, error) {
 		return nil, err
 	}
 
-	var str string
-	var values []string
-	if zmlen <= 254 {
-		values = make([]string, zmlen*2)
-	} else {
-		values = make([]string, 512*2)
-	}
-	for {
-		str, err = readZipmapEntry(r, false)
-		if err != nil {
-			return nil, err
+	// zmlen is 254 if the entries can't be counted in a byte, there are 254 of them at least then,
+	// the entries are appended beyond the capacity reserved
+	values := s.strs(2 * int(zmlen))[:0]
+	strict := s.strictly()
+	for n := 0; ; n++ {
+		if r.i >= len(r.b) {
+			return nil, errors.Wrap(ErrInvalidZipmap, "no zmend")
+		}
+		if r.b[r.i] == 255 {
+			// zmend: always 255
+			if strict && r.i != len(r.b)-1 {
+				return nil, errors.Wrapf(ErrInvalidZipmap, "%d bytes follow zmend", len(r.b)-1-r.i)
+			}
+			if strict && (zmlen < 254 && int(zmlen) != n || zmlen >= 254 && n < 254) {
+				return nil, errors.Wrapf(ErrInvalidZipmap, "zmlen is %d, the zipmap has %d entries", zmlen, n)
+			}
+			return values, nil
 		}
-		values = append(values, str)
 
-		str, err = readZipmapEntry(r, true)
+		key, err := readZipmapEntry(r, false, strict)
 		if err != nil {
 			return nil, err
 		}
-		values = append(values, str)
-
-		if r.i < len(r.b) && r.b[r.i] == 255 {
-			// zmend: always 255
-			return values, nil
+		value, err := readZipmapEntry(r, true, strict)
+		if err != nil {
+			return nil, err
 		}
+		values = append(values, key, value)
 	}
 }
 
-func (v *value) readIntset() ([]int, error) {
+func (v *value) readIntset(s *scratch) ([]int64, error) {
 	if v.b == nil {
 		return nil, nil
 	}
@@ -539,19 +996,114 @@ func (v *value) readIntset() ([]int, error) {
 		return nil, err
 	}
 
-	values := make([]int, lengthOfContents)
+	if encoding != 2 && encoding != 4 && encoding != 8 ||
+		lengthOfContents < 0 || lengthOfContents > (len(r.b)-r.i)/encoding {
+		return nil, errors.WithStack(ErrInvalidIntset)
+	}
+	if s.strictly() && 8+lengthOfContents*encoding != len(r.b) {
+		return nil, errors.Wrapf(ErrInvalidIntset, "%d entries of %d bytes, the intset has %d bytes", lengthOfContents, encoding, len(r.b))
+	}
+	values := s.ints(lengthOfContents)
 	for j := 0; j < int(lengthOfContents); j++ {
-		switch encoding {
-		case 2:
-			values[j], err = r.little16()
-		case 4:
-			values[j], err = r.little32()
-		case 8:
-			values[j], err = r.little64()
-		}
+		values[j], err = r.littleInt(encoding)
 		if err != nil {
 			return nil, err
 		}
 	}
 	return values, nil
 }
+
+// scratch holds the buffers a filter worker reuses across keys.
+// Slices are carved from them with a capped capacity, so that appending to one doesn't overwrite the next.
+// A nil *scratch allocates fresh slices.
+type scratch struct {
+	buffers    bool // whether the arena is reused, see WithBufferReuse
+	containers bool // whether maps and slices are reused, see WithBufferReuse and WithFreshValues
+	strict     bool // whether encodings are verified, see WithStrict
+	scores     bool // whether the strings of scores are kept, see WithScoreStrings
+
+	decoders []ContentDecoder // detectors of string contents, see WithContentDecoder
+
+	arena   []byte   // decompressed values and formatted integers
+	strings []string // list, ziplist and zipmap entries
+	list    []string // quicklist entries
+	integer []int64  // intset entries
+}
+
+// reusing reports whether maps and slices are reused.
+func (s *scratch) reusing() bool {
+	return s != nil && s.containers
+}
+
+// strictly reports whether encodings are verified.
+func (s *scratch) strictly() bool {
+	return s != nil && s.strict
+}
+
+// reset makes the buffers available to the next key.
+func (s *scratch) reset() {
+	if s == nil {
+		return
+	}
+	s.arena = s.arena[:0]
+	s.strings = s.strings[:0]
+	s.list = s.list[:0]
+	s.integer = s.integer[:0]
+}
+
+// alloc returns n bytes.
+func (s *scratch) alloc(n int) []byte {
+	if s == nil || !s.buffers {
+		return make([]byte, n)
+	}
+	l := len(s.arena)
+	if l+n > cap(s.arena) {
+		// slices of the current arena are still in use, it's replaced instead of grown
+		s.arena = make([]byte, 0, 2*cap(s.arena)+n)
+		l = 0
+	}
+	s.arena = s.arena[:l+n]
+	return s.arena[l : l+n : l+n]
+}
+
+// strs returns n empty strings.
+func (s *scratch) strs(n int) []string {
+	if !s.reusing() {
+		return make([]string, n)
+	}
+	l := len(s.strings)
+	if l+n > cap(s.strings) {
+		s.strings = make([]string, 0, 2*cap(s.strings)+n)
+		l = 0
+	}
+	s.strings = s.strings[:l+n]
+	strs := s.strings[l : l+n : l+n]
+	for i := range strs {
+		strs[i] = ""
+	}
+	return strs
+}
+
+// ints returns n integers.
+func (s *scratch) ints(n int) []int64 {
+	if !s.reusing() {
+		return make([]int64, n)
+	}
+	l := len(s.integer)
+	if l+n > cap(s.integer) {
+		s.integer = make([]int64, 0, 2*cap(s.integer)+n)
+		l = 0
+	}
+	s.integer = s.integer[:l+n]
+	return s.integer[l : l+n : l+n]
+}
+
+// itoa formats i in the arena.
+func (s *scratch) itoa(i int64) string {
+	if s == nil || !s.buffers {
+		return strconv.FormatInt(i, 10)
+	}
+	b := strconv.AppendInt(s.alloc(20)[:0], i, 10)
+	s.arena = s.arena[:len(s.arena)-20+len(b)]
+	return bytes2string(b)
+}
@@ -0,0 +1,445 @@
+package rdb
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotFilter formats values within callbacks, so that it works with reused buffers.
+type snapshotFilter struct {
+	testEmptyFilter
+
+	got map[string]string
+}
+
+func (f *snapshotFilter) add(key Key, elems []string) {
+	sort.Strings(elems)
+	f.Lock()
+	defer f.Unlock()
+	// Sprint copies, unlike Join of a single element
+	f.got[fmt.Sprint(key.DB, key.Key)] = fmt.Sprint(elems)
+}
+
+func (f *snapshotFilter) String(s *String) {
+	f.add(s.Key, []string{s.Value})
+}
+
+func (f *snapshotFilter) List(l *List) {
+	f.add(l.Key, append([]string{fmt.Sprint(len(l.Values))}, l.Values...))
+}
+
+func (f *snapshotFilter) Set(s *Set) {
+	var elems []string
+	for m := range s.Values {
+		elems = append(elems, fmt.Sprint(m))
+	}
+	f.add(s.Key, elems)
+}
+
+func (f *snapshotFilter) Hash(h *Hash) {
+	var elems []string
+	for k, v := range h.Values {
+		elems = append(elems, k+"="+v)
+	}
+	f.add(h.Key, elems)
+}
+
+func (f *snapshotFilter) SortedSet(ss *SortedSet) {
+	var elems []string
+	for m, s := range ss.Values {
+		elems = append(elems, fmt.Sprint(m, "=", s))
+	}
+	f.add(ss.Key, elems)
+}
+
+func TestBufferReuse(t *testing.T) {
+	files, err := filepath.Glob("testdata/dumps/*.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		var got [3]map[string]string
+		for i, opts := range [][]ParseOption{nil, {WithBufferReuse(), WithFreshValues()}, {WithBufferReuse()}} {
+			r, err := NewMemReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := &snapshotFilter{got: make(map[string]string)}
+			if err := Parse(r, append(opts, WithFilter(f), WithStrategy(SkipMeta))...); err != nil {
+				t.Fatal(file, err)
+			}
+			got[i] = f.got
+		}
+		if !reflect.DeepEqual(got[0], got[1]) || !reflect.DeepEqual(got[0], got[2]) {
+			t.Fatalf("%v: values differ with reuse", file)
+		}
+	}
+}
+
+func TestFreshValuesByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeKey(Key{Key: "l1", Expiry: -1}, EncodingZiplist)
+	e.writeString(string(ziplist([]string{"a", "b"})))
+	e.writeKey(Key{Key: "l2", Expiry: -1}, EncodingZiplist)
+	e.writeString(string(ziplist([]string{"c", "d"})))
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lists := make(map[string][]string)
+	f := FuncFilter{OnList: func(l *List) { lists[l.Key.Key] = l.Values }}
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(SkipMeta), EnableSync()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"l1": {"a", "b"}, "l2": {"c", "d"}}
+	if !reflect.DeepEqual(lists, want) {
+		t.Fatalf("want: %q, got: %q", want, lists)
+	}
+}
+
+func TestBufferReuseSortedSet(t *testing.T) {
+	// integer members are formatted in the arena, which the list in between overwrites, so the members
+	// left in the reused map would hash differently; small maps are searched without hashing, hence 32 members.
+	// A range-delete loop is compiled to a map clear, which doesn't hash, unless optimizations are off as with -race.
+	var zset, list []string
+	for i := 0; i < 32; i++ {
+		zset = append(zset, strconv.Itoa(i), "1")
+		list = append(list, strconv.Itoa(1000+i), strconv.Itoa(2000+i))
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeKey(Key{Key: "z1", Expiry: -1}, EncodingSortedSetZip)
+	e.writeString(string(ziplist(zset)))
+	e.writeKey(Key{Key: "l", Expiry: -1}, EncodingZiplist)
+	e.writeString(string(ziplist(list)))
+	e.writeKey(Key{Key: "z2", Expiry: -1}, EncodingSortedSetZip)
+	e.writeString(string(ziplist([]string{"4", "4"})))
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var members []string
+	f := FuncFilter{OnSortedSet: func(ss *SortedSet) {
+		if ss.Key.Key == "z2" {
+			for m := range ss.Values {
+				members = append(members, m)
+			}
+		}
+	}}
+	err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(SkipMeta), WithBufferReuse(), EnableSync())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(members, []string{"4"}) {
+		t.Fatalf("want: [4], got: %q", members)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	files, err := filepath.Glob("testdata/dumps/*.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		r, err := NewMemReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Parse(r, WithFilter(&testEmptyFilter{}), WithStrategy(SkipMeta), WithStrict()); err != nil {
+			t.Fatal(file, err)
+		}
+	}
+
+	zl := ziplist([]string{"a", "100", "b"})
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), zl...))
+	}
+	tests := []struct {
+		b    []byte
+		want error
+		read func(*value, *scratch) error
+	}{
+		{zl, nil, nil},
+		{corrupt(func(b []byte) []byte { b[0]++; return b }), ErrInvalidZiplist, nil},                        // zlbytes
+		{corrupt(func(b []byte) []byte { b[4]++; return b }), ErrInvalidZiplist, nil},                        // zltail
+		{corrupt(func(b []byte) []byte { b[8]--; return b }), ErrInvalidZiplist, nil},                        // zllen
+		{corrupt(func(b []byte) []byte { b[13]++; return b }), ErrInvalidZiplist, nil},                       // prevlen
+		{corrupt(func(b []byte) []byte { return append(b[:len(b)-1], 0xff, 0xff) }), ErrInvalidZiplist, nil}, // trailing bytes
+		{[]byte("\x01\x03foo\x03\x00bar\xff"), nil, readZipmap},
+		{[]byte("\x02\x03foo\x03\x00bar\xff"), ErrInvalidZipmap, readZipmap},
+		{[]byte("\x01\x03foo\x03\x05bar\x00\x00\x00\x00\x00\xff"), ErrInvalidZipmapEntry, readZipmap},
+		{[]byte("\x01\x03foo\x03\x02bar\x00\xff"), ErrInvalidZipmapEntry, readZipmap},
+		{intset([]int64{1, 2, 3}), nil, readIntset},
+		{append(intset([]int64{1, 2, 3}), 0), ErrInvalidIntset, readIntset},
+	}
+	for i, test := range tests {
+		if test.read == nil {
+			// corrupt ziplist headers are ignored unless strict
+			test.read = readZiplist
+			if err := test.read(&value{b: test.b}, nil); err != nil {
+				t.Fatalf("%v: got %v, want no error unless strict", i, err)
+			}
+		}
+		err := test.read(&value{b: test.b}, &scratch{strict: true})
+		if errors.Cause(err) != test.want {
+			t.Fatalf("%v: got %v, want %v", i, err, test.want)
+		}
+	}
+}
+
+func readZiplist(v *value, s *scratch) error {
+	_, err := v.readZiplist(s)
+	return err
+}
+
+func readZipmap(v *value, s *scratch) error {
+	_, err := v.readZipmap(s)
+	return err
+}
+
+func readIntset(v *value, s *scratch) error {
+	_, err := v.readIntset(s)
+	return err
+}
+
+func TestLargeZiplist(t *testing.T) {
+	for _, n := range []int{65534, 65535, 70000} {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = strconv.Itoa(i % 100)
+		}
+		v := &value{b: ziplist(values)}
+		for _, s := range []*scratch{nil, {buffers: true, containers: true, strict: true}} {
+			got, err := v.readZiplist(s)
+			if err != nil {
+				t.Fatal(n, err)
+			}
+			if !reflect.DeepEqual(got, values) {
+				t.Fatalf("%v: got %v entries", n, len(got))
+			}
+		}
+	}
+}
+
+func TestIntSet(t *testing.T) {
+	for _, want := range [][]int64{
+		{-1 << 15, 0, 1<<15 - 1},
+		{-1 << 31, -1, 1<<31 - 1},
+		{-1 << 63, -1 << 32, 1 << 32, 1<<63 - 1},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		if err := e.raw(Key{Key: "intset", Expiry: -1}, EncodingIntset, intset(want)); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f := &intSetFilter{}
+		if err := Parse(NewStreamReader(&buf, 0), WithFilter(f), WithFreshValues()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f.got, want) {
+			t.Fatalf("got: %v, want: %v", f.got, want)
+		}
+	}
+}
+
+type intSetFilter struct {
+	testEmptyFilter
+	got []int64
+}
+
+func (f *intSetFilter) Set(s *Set) {
+	f.got = s.IntSet
+}
+
+func TestValueTransformer(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "s", Expiry: -1}, Value: "olleh"})
+	e.List(&List{Key: Key{Key: "l", Expiry: -1}, Values: []string{"ba", "dc"}})
+	e.Hash(&Hash{Key: Key{Key: "h", Expiry: -1}, Values: map[string]string{"dleif": "eulav"}})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reverse := func(key Key, b []byte) ([]byte, error) {
+		r := make([]byte, len(b))
+		for i, c := range b {
+			r[len(b)-1-i] = c
+		}
+		return r, nil
+	}
+	f := &snapshotFilter{got: make(map[string]string)}
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithValueTransformer(reverse)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"0s": "[hello]", "0l": "[2 ab cd]", "0h": "[field=value]"}
+	if !reflect.DeepEqual(f.got, want) {
+		t.Fatalf("want: %v, got: %v", want, f.got)
+	}
+
+	errTransform := errors.New("transform")
+	fail := func(key Key, b []byte) ([]byte, error) { return nil, errTransform }
+	err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(new(testEmptyFilter)), WithValueTransformer(fail))
+	if err != errTransform {
+		t.Fatalf("want: %v, got: %v", errTransform, err)
+	}
+}
+
+func TestKeyFormat(t *testing.T) {
+	tests := []struct {
+		key    string
+		format int
+		want   string
+	}{
+		{"user:1", KeyHex, "user:1"},
+		{"\xff\x00a", KeyRaw, "\xff\x00a"},
+		{"\xff\x00a", KeyHex, "ff0061"},
+		{"\xff\x00a", KeyBase64, "/wBh"},
+	}
+	for i, test := range tests {
+		if got := FormatKey(test.key, test.format); got != test.want {
+			t.Fatalf("index: %v, want: %q, got: %q", i, test.want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.String(&String{Key: Key{Key: "\xff\x00a", Expiry: -1}, Value: "v"})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got Entry
+	f := EntryFilter(func(e Entry) { got = e })
+	if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(SkipMeta), WithKeyFormat(KeyHex)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Key != "ff0061" {
+		t.Fatalf("want: %q, got: %q", "ff0061", got.Key)
+	}
+	if b := (Key{Key: "\xff\x00a"}).Bytes(); !bytes.Equal(b, []byte{0xff, 0, 'a'}) {
+		t.Fatalf("got: %v", b)
+	}
+}
+
+func TestZipmapSizes(t *testing.T) {
+	for _, n := range []int{0, 1, 253, 254, 300} {
+		values := make([]string, 0, 2*n)
+		for i := 0; i < n; i++ {
+			values = append(values, "f"+strconv.Itoa(i), strconv.Itoa(i))
+		}
+		zm := zipmap(values)
+		for _, s := range []*scratch{nil, {containers: true, strict: true}} {
+			got, err := (&value{b: zm}).readZipmap(s)
+			if err != nil {
+				t.Fatalf("%v entries: %v", n, err)
+			}
+			if len(got) != len(values) || len(values) > 0 && !reflect.DeepEqual(got, values) {
+				t.Fatalf("%v entries: got %v strings", n, len(got))
+			}
+		}
+
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.raw(Key{Key: "h", Expiry: -1}, EncodingZipmap, zm)
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		fields := -1
+		f := FuncFilter{OnHash: func(h *Hash) { fields = len(h.Values) }}
+		if err := Parse(&MemReader{b: buf.Bytes()}, WithFilter(f), WithStrategy(SkipMeta), WithStrict()); err != nil {
+			t.Fatal(err)
+		}
+		if fields != n {
+			t.Fatalf("want: %v fields, got: %v", n, fields)
+		}
+	}
+	// zmlen 254 stands for 254 entries at least
+	zm := zipmap([]string{"a", "b"})
+	zm[0] = 254
+	if _, err := (&value{b: zm}).readZipmap(&scratch{strict: true}); errors.Cause(err) != ErrInvalidZipmap {
+		t.Fatalf("want: %v, got: %v", ErrInvalidZipmap, err)
+	}
+}
+
+func TestQuicklistStats(t *testing.T) {
+	nodes := [][]string{{"a", "b", "c"}, {"1", "2"}, {"x", "y", "z", "w"}}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.writeKey(Key{Key: "q", Expiry: -1}, EncodingQuicklist)
+	e.writeLength(len(nodes))
+	var size uint64
+	for i, node := range nodes {
+		zl := ziplist(node)
+		size += uint64(len(zl))
+		if i != 1 {
+			e.writeString(string(zl))
+			continue
+		}
+		// LZF literal runs, as a compressed node
+		var lzf []byte
+		for b := zl; len(b) > 0; {
+			n := len(b)
+			if n > 32 {
+				n = 32
+			}
+			lzf = append(append(lzf, byte(n-1)), b[:n]...)
+			b = b[n:]
+		}
+		e.writeByte(0xC3)
+		e.writeLength(len(lzf))
+		e.writeLength(len(zl))
+		e.write(lzf)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got List
+	f := FuncFilter{OnList: func(l *List) { got = *l }}
+	if err := Parse(NewStreamReader(&buf, 0), WithFilter(f), WithFreshValues()); err != nil {
+		t.Fatal(err)
+	}
+	want := QuicklistStats{Nodes: 3, Compressed: 1, Entries: 9, Bytes: size}
+	if got.Quicklist != want {
+		t.Fatalf("want: %+v, got: %+v", want, got.Quicklist)
+	}
+	if got.Quicklist.AvgEntries() != 3 || len(got.Values) != 9 {
+		t.Fatalf("got: %v %v", got.Quicklist.AvgEntries(), got.Values)
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		encoding Encoding
+		valid    bool
+		typ      ValueType
+		name     string
+	}{
+		{EncodingZiplist, true, TypeList, "ziplist"},
+		{EncodingSortedSetZip, true, TypeSortedSet, "ziplist"},
+		{EncodingQuicklist2, true, TypeList, "quicklist"},
+		{EncodingSetListpack, true, TypeSet, "listpack"},
+		{EncodingHashListpackEx, true, TypeHash, "listpackex"},
+		{EncodingStreamListpacks3, true, TypeStream, "stream"},
+		{8, false, "unknown", "unknown"},
+		{EncodingHashListpackEx + 1, false, "unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if tt.encoding.IsValid() != tt.valid || tt.encoding.Type() != tt.typ || fmt.Sprint(tt.encoding) != tt.name {
+			t.Fatalf("%d: got %v, %v, %v", byte(tt.encoding), tt.encoding.IsValid(), tt.encoding.Type(), tt.encoding)
+		}
+		if Encoding2Type(tt.encoding) != tt.typ || Encoding2String(tt.encoding) != tt.name {
+			t.Fatalf("%d: Encoding2Type and Encoding2String differ", byte(tt.encoding))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package rdb
+
+import (
+	"sort"
+	"sync"
+)
+
+// Upgrade represents a compactly encoded key along with the memory it would use once redis converts it
+// to a heavyweight encoding, when it crosses a threshold of Thresholds.
+type Upgrade struct {
+	Key       Key
+	Encoding  string // current encoding
+	Upgraded  string // encoding the key is converted to
+	Memory    uint64 // memory used by the value with current encoding
+	Estimated uint64 // estimated memory used by the value with upgraded encoding, elements unchanged
+
+	// Headroom is the number of elements the key can grow by before crossing the entries threshold,
+	// 0 if it already crossed it, e.g. since the threshold was lowered after the key was written.
+	Headroom int
+}
+
+// Cost reports the estimated memory the conversion adds.
+func (u Upgrade) Cost() uint64 {
+	if u.Memory > u.Estimated {
+		return 0
+	}
+	return u.Estimated - u.Memory
+}
+
+// UpgradeEstimator estimates the memory compactly encoded keys would use with heavyweight encodings,
+// to model the growth of a dataset from a snapshot. Lists are ignored, quicklists are never converted.
+//
+// Values must be decoded, keys parsed with SkipValue strategy are ignored.
+// UpgradeEstimator is safe for concurrent use, its methods can be called directly from Filter's callbacks.
+type UpgradeEstimator struct {
+	Thresholds Thresholds
+
+	mu       sync.Mutex
+	upgrades []Upgrade
+}
+
+// NewUpgradeEstimator returns an UpgradeEstimator using t to compute headrooms.
+func NewUpgradeEstimator(t Thresholds) *UpgradeEstimator {
+	return &UpgradeEstimator{Thresholds: t}
+}
+
+// Hash estimates hash h.
+func (u *UpgradeEstimator) Hash(h *Hash) {
+	if h.Key.Encoding != EncodingHashZip && h.Key.Encoding != EncodingZipmap || len(h.Values) == 0 {
+		return
+	}
+	estimated := _overhead.hash(len(h.Values))
+	for k, v := range h.Values {
+		estimated += _overhead.str(k) + _overhead.str(v) + _overhead.hashEntry() + 2*_overhead.root()
+	}
+	u.add(Upgrade{
+		Key:       h.Key,
+		Encoding:  Encoding2String(h.Key.Encoding),
+		Upgraded:  "hashtable",
+		Memory:    h.memory,
+		Estimated: estimated,
+		Headroom:  headroom(u.Thresholds.HashEntries, len(h.Values)),
+	})
+}
+
+// Set estimates set s.
+func (u *UpgradeEstimator) Set(s *Set) {
+	if s.Key.Encoding != EncodingIntset || len(s.Values) == 0 {
+		return
+	}
+	// members become strings, integers are shared or embedded objects
+	estimated := _overhead.hash(len(s.Values)) + uint64(len(s.Values))*(8+_overhead.hashEntry()+_overhead.root())
+	u.add(Upgrade{
+		Key:       s.Key,
+		Encoding:  Encoding2String(s.Key.Encoding),
+		Upgraded:  "hashtable",
+		Memory:    s.memory,
+		Estimated: estimated,
+		Headroom:  headroom(u.Thresholds.SetEntries, len(s.Values)),
+	})
+}
+
+// SortedSet estimates sorted set ss.
+func (u *UpgradeEstimator) SortedSet(ss *SortedSet) {
+	if ss.Key.Encoding != EncodingSortedSetZip || len(ss.Values) == 0 {
+		return
+	}
+	estimated := _overhead.skiplist(len(ss.Values))
+	for member := range ss.Values {
+		estimated += _overhead.str(member) + 8 + _overhead.root() + _overhead.skiplistEntry()
+	}
+	u.add(Upgrade{
+		Key:       ss.Key,
+		Encoding:  Encoding2String(ss.Key.Encoding),
+		Upgraded:  "skiplist",
+		Memory:    ss.memory,
+		Estimated: estimated,
+		Headroom:  headroom(u.Thresholds.SortedSetEntries, len(ss.Values)),
+	})
+}
+
+func headroom(threshold, n int) int {
+	if n >= threshold {
+		return 0
+	}
+	return threshold - n
+}
+
+func (u *UpgradeEstimator) add(upgrade Upgrade) {
+	u.mu.Lock()
+	u.upgrades = append(u.upgrades, upgrade)
+	u.mu.Unlock()
+}
+
+// Upgrades returns estimated keys, ordered by cost descending.
+func (u *UpgradeEstimator) Upgrades() []Upgrade {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	upgrades := make([]Upgrade, len(u.upgrades))
+	copy(upgrades, u.upgrades)
+	sort.Slice(upgrades, func(i, j int) bool {
+		if upgrades[i].Cost() != upgrades[j].Cost() {
+			return upgrades[i].Cost() > upgrades[j].Cost()
+		}
+		return upgrades[i].Key.Key < upgrades[j].Key.Key
+	})
+	return upgrades
+}
+
+// Total reports the memory used by estimated keys, and the one they would use if they were all converted.
+func (u *UpgradeEstimator) Total() (memory, estimated uint64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, upgrade := range u.upgrades {
+		memory += upgrade.Memory
+		estimated += upgrade.Estimated
+	}
+	return memory, estimated
+}
@@ -0,0 +1,58 @@
+package rdb
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestUpgradeEstimator(t *testing.T) {
+	u := NewUpgradeEstimator(DefaultThresholds)
+
+	zl := &Hash{Key: Key{Key: "zl", Encoding: EncodingHashZip}, Values: map[string]string{}, memory: 200}
+	for i := 0; i < 10; i++ {
+		zl.Values[strconv.Itoa(i)] = "value"
+	}
+	u.Hash(zl)
+	table := &Hash{Key: Key{Key: "table", Encoding: EncodingHash}, Values: map[string]string{"a": "b"}}
+	u.Hash(table)
+
+	ints := &Set{Key: Key{Key: "ints", Encoding: EncodingIntset}, Values: map[interface{}]struct{}{1: {}, 2: {}}, memory: 12}
+	u.Set(ints)
+
+	zset := &SortedSet{Key: Key{Key: "zset", Encoding: EncodingSortedSetZip}, Values: map[string]float64{"a": 1, "b": 2}, memory: 30}
+	u.SortedSet(zset)
+
+	upgrades := u.Upgrades()
+	if len(upgrades) != 3 {
+		t.Fatalf("want: 3 upgrades, got: %+v", upgrades)
+	}
+	byKey := make(map[string]Upgrade)
+	for i, upgrade := range upgrades {
+		if i > 0 && upgrade.Cost() > upgrades[i-1].Cost() {
+			t.Fatalf("not ordered by cost: %+v", upgrades)
+		}
+		byKey[upgrade.Key.Key] = upgrade
+	}
+
+	// hashtable of 16 buckets, 10 integer fields and 10 5-bytes values
+	h := byKey["zl"]
+	want := _overhead.hash(10) + 10*(8+_overhead.alloc(5)+_overhead.hashEntry()+2*_overhead.root())
+	if h.Upgraded != "hashtable" || h.Estimated != want || h.Cost() != want-200 || h.Headroom != 502 {
+		t.Fatalf("want: %v, got: %+v", want, h)
+	}
+	if s := byKey["ints"]; s.Upgraded != "hashtable" || s.Headroom != 510 || s.Estimated <= s.Memory {
+		t.Fatalf("got: %+v", s)
+	}
+	if z := byKey["zset"]; z.Upgraded != "skiplist" || z.Headroom != 126 || z.Estimated <= z.Memory {
+		t.Fatalf("got: %+v", z)
+	}
+	if memory, estimated := u.Total(); memory != 242 || estimated != h.Estimated+byKey["ints"].Estimated+byKey["zset"].Estimated {
+		t.Fatalf("got: %v %v", memory, estimated)
+	}
+
+	u.Thresholds.Set("hash-max-ziplist-entries", 8)
+	u.Hash(zl)
+	if got := u.Upgrades(); len(got) != 4 || got[0].Key.Key != "zl" || got[0].Headroom+got[1].Headroom != 502 {
+		t.Fatalf("got: %+v", got)
+	}
+}
@@ -0,0 +1,154 @@
+package rdb
+
+import (
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// UTF8Count counts strings which are valid UTF-8, and binary ones.
+type UTF8Count struct {
+	Text   int
+	Binary int
+}
+
+// UTF8Sample represents a key whose name or value isn't valid UTF-8.
+type UTF8Sample struct {
+	Key   Key
+	Field string // hash field, list index or set member holding the binary string, empty for strings and key names
+	Value string // the binary string, truncated to 64 bytes
+}
+
+// UTF8Report is the result of an UTF8Audit.
+type UTF8Report struct {
+	Keys   UTF8Count // key names
+	Values UTF8Count // values, a value is binary if any of its elements, fields or members is
+
+	KeySamples   []UTF8Sample
+	ValueSamples []UTF8Sample
+}
+
+// UTF8Audit counts keys and values which are valid UTF-8 and binary ones, and keeps samples of binary ones,
+// e.g. to migrate to systems which require text keys.
+//
+// Key names are audited by Key, which works with the SkipValue strategy, values by the other methods,
+// which audit key names too.
+// UTF8Audit is safe for concurrent use, its methods can be called directly from Filter's callbacks.
+type UTF8Audit struct {
+	samples int
+
+	mu     sync.Mutex
+	report UTF8Report
+}
+
+// NewUTF8Audit returns an UTF8Audit which keeps at most samples binary key names and values.
+func NewUTF8Audit(samples int) *UTF8Audit {
+	return &UTF8Audit{samples: samples}
+}
+
+// utf8SampleLen is the maximum length of the binary strings of samples.
+const utf8SampleLen = 64
+
+// Key audits the name of key.
+func (a *UTF8Audit) Key(key Key) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.key(key)
+}
+
+func (a *UTF8Audit) key(key Key) {
+	if utf8.ValidString(key.Key) {
+		a.report.Keys.Text++
+		return
+	}
+	a.report.Keys.Binary++
+	if len(a.report.KeySamples) < a.samples {
+		a.report.KeySamples = append(a.report.KeySamples, UTF8Sample{Key: key, Value: truncate(key.Key)})
+	}
+}
+
+// value audits the name of key and its value, binary is its first binary string and field where it's found.
+func (a *UTF8Audit) value(key Key, field, binary string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.key(key)
+	if ok {
+		a.report.Values.Text++
+		return
+	}
+	a.report.Values.Binary++
+	if len(a.report.ValueSamples) < a.samples {
+		a.report.ValueSamples = append(a.report.ValueSamples, UTF8Sample{Key: key, Field: truncate(field), Value: truncate(binary)})
+	}
+}
+
+// String audits s.
+func (a *UTF8Audit) String(s *String) {
+	a.value(s.Key, "", s.Value, utf8.ValidString(s.Value))
+}
+
+// List audits l.
+func (a *UTF8Audit) List(l *List) {
+	for i, v := range l.Values {
+		if !utf8.ValidString(v) {
+			a.value(l.Key, strconv.Itoa(i), v, false)
+			return
+		}
+	}
+	a.value(l.Key, "", "", true)
+}
+
+// Set audits set s, integer members are text.
+func (a *UTF8Audit) Set(s *Set) {
+	for m := range s.Values {
+		if v, ok := m.(string); ok && !utf8.ValidString(v) {
+			a.value(s.Key, v, v, false)
+			return
+		}
+	}
+	a.value(s.Key, "", "", true)
+}
+
+// Hash audits h.
+func (a *UTF8Audit) Hash(h *Hash) {
+	for field, v := range h.Values {
+		switch {
+		case !utf8.ValidString(field):
+			a.value(h.Key, field, field, false)
+			return
+		case !utf8.ValidString(v):
+			a.value(h.Key, field, v, false)
+			return
+		}
+	}
+	a.value(h.Key, "", "", true)
+}
+
+// SortedSet audits ss.
+func (a *UTF8Audit) SortedSet(ss *SortedSet) {
+	for m := range ss.Values {
+		if !utf8.ValidString(m) {
+			a.value(ss.Key, m, m, false)
+			return
+		}
+	}
+	a.value(ss.Key, "", "", true)
+}
+
+// Report returns the counts and samples so far.
+func (a *UTF8Audit) Report() UTF8Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := a.report
+	r.KeySamples = append([]UTF8Sample(nil), r.KeySamples...)
+	r.ValueSamples = append([]UTF8Sample(nil), r.ValueSamples...)
+	return r
+}
+
+// truncate returns a copy of the first utf8SampleLen bytes of s, since the strings of values may be reused.
+func truncate(s string) string {
+	if len(s) > utf8SampleLen {
+		s = s[:utf8SampleLen]
+	}
+	return string([]byte(s))
+}
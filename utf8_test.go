@@ -0,0 +1,36 @@
+package rdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUTF8Audit(t *testing.T) {
+	a := NewUTF8Audit(1)
+	a.String(&String{Key: Key{Key: "text"}, Value: "héllo"})
+	a.String(&String{Key: Key{Key: "bin\xff"}, Value: "\xfe" + strings.Repeat("x", 100)})
+	a.List(&List{Key: Key{Key: "list"}, Values: []string{"a", "b\xff"}})
+	a.Set(&Set{Key: Key{Key: "set"}, Values: map[interface{}]struct{}{1: {}, "a": {}}})
+	a.Hash(&Hash{Key: Key{Key: "hash\xc3"}, Values: map[string]string{"f": "v"}})
+	a.SortedSet(&SortedSet{Key: Key{Key: "zset"}, Values: map[string]float64{"\xff": 1}})
+	a.Key(Key{Key: "skipped"})
+
+	r := a.Report()
+	if r.Keys != (UTF8Count{Text: 5, Binary: 2}) || r.Values != (UTF8Count{Text: 3, Binary: 3}) {
+		t.Fatalf("got: %+v %+v", r.Keys, r.Values)
+	}
+	if len(r.KeySamples) != 1 || len(r.ValueSamples) != 1 {
+		t.Fatalf("got: %+v %+v", r.KeySamples, r.ValueSamples)
+	}
+	if s := r.ValueSamples[0]; s.Key.Key != "bin\xff" || len(s.Value) != 64 {
+		t.Fatalf("got: %+v", s)
+	}
+
+	a = NewUTF8Audit(10)
+	a.List(&List{Key: Key{Key: "list"}, Values: []string{"a", "b\xff"}})
+	a.Hash(&Hash{Key: Key{Key: "hash"}, Values: map[string]string{"f": "v\xff"}})
+	r = a.Report()
+	if len(r.ValueSamples) != 2 || r.ValueSamples[0].Field != "1" || r.ValueSamples[1].Field != "f" || r.ValueSamples[1].Value != "v\xff" {
+		t.Fatalf("got: %+v", r.ValueSamples)
+	}
+}
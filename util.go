@@ -1,73 +1,86 @@
 package rdb
 
 import (
+	"encoding/binary"
 	"math/rand"
 	"sort"
+	"strconv"
 	"time"
 	"unsafe"
 
 	"github.com/pkg/errors"
 )
 
-// Encoding2Type returns the actual redis type of encoding.
-func Encoding2Type(encoding byte) string {
-	switch encoding {
-	case EncodingString:
-		return TypeString
-	case EncodingList, EncodingZiplist, EncodingQuicklist:
-		return TypeList
-	case EncodingSet, EncodingIntset:
-		return TypeSet
-	case EncodingSortedSet, EncodingSortedSet2, EncodingSortedSetZip:
-		return TypeSortedSet
-	case EncodingHash, EncodingZipmap, EncodingHashZip:
-		return TypeHash
-	}
-	return "unknown"
+// Encoding2Type returns the actual redis type of encoding, as encoding.Type.
+func Encoding2Type(encoding Encoding) ValueType {
+	return encoding.Type()
 }
 
-// Encoding2String returns the string format of encoding.
-func Encoding2String(encoding byte) string {
-	switch encoding {
-	case EncodingString:
-		return "string"
-	case EncodingList:
-		return "linkedlist"
-	case EncodingZiplist:
-		return "ziplist"
-	case EncodingQuicklist:
-		return "quicklist"
-	case EncodingSet:
-		return "hashtable"
-	case EncodingIntset:
-		return "intset"
-	case EncodingSortedSet:
-		return "skiplist"
-	case EncodingSortedSet2:
-		return "skiplist"
-	case EncodingSortedSetZip:
-		return "ziplist"
-	case EncodingHash:
-		return "hashtable"
-	case EncodingZipmap:
-		return "zipmap"
-	case EncodingHashZip:
-		return "ziplist"
+// TokenName returns the name redis gives to opcode b, e.g. "RESIZEDB" for TokenResize, or "" if b isn't an opcode.
+func TokenName(b byte) string {
+	switch b {
+	case TokenSlotInfo:
+		return "SLOT_INFO"
+	case TokenFunction2:
+		return "FUNCTION2"
+	case TokenFunctionPreGA:
+		return "FUNCTION_PRE_GA"
+	case TokenModuleAUX:
+		return "MODULE_AUX"
+	case TokenIdle:
+		return "IDLE"
+	case TokenFreq:
+		return "FREQ"
+	case TokenAUX:
+		return "AUX"
+	case TokenResize:
+		return "RESIZEDB"
+	case TokenExpMSec:
+		return "EXPIRETIME_MS"
+	case TokenExpSec:
+		return "EXPIRETIME"
+	case TokenDB:
+		return "SELECTDB"
+	case TokenEOF:
+		return "EOF"
 	}
-	return "unknown"
+	return ""
+}
+
+// Encoding2String returns the string format of encoding, as encoding.String.
+func Encoding2String(encoding Encoding) string {
+	return encoding.String()
 }
 
 func bytes2string(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b))
 }
 
-func readLZF(buf []byte, clen, ulen int) ([]byte, error) {
+// intLen returns the length of the decimal representation of i.
+func intLen(i int) int {
+	n := 1
+	if i < 0 {
+		n++
+		i = -i
+	}
+	for ; i >= 10; i /= 10 {
+		n++
+	}
+	return n
+}
+
+func readLZF(buf []byte, clen, ulen int, s *scratch) ([]byte, error) {
 	if clen > len(buf) {
 		return nil, nil
 	}
 
+	// a back-reference of 3 bytes expands to at most 264 bytes
+	if ulen < 0 || ulen > clen*88 {
+		return nil, errors.WithStack(ErrInvalidCompressedData)
+	}
+
 	ip, op := 0, 0
-	out := make([]byte, ulen)
+	out := s.alloc(ulen)
 	for ip < clen {
 		ctrl := int(buf[ip])
 		ip++
@@ -88,14 +101,16 @@ func readLZF(buf []byte, clen, ulen int) ([]byte, error) {
 		ref := op - ((ctrl & 0x1f) << 8) - 1
 
 		if length == 7 {
-			length += int(buf[ip])
-			ip++
-
 			if ip >= clen {
 				return nil, errors.WithStack(ErrInvalidCompressedData)
 			}
+			length += int(buf[ip])
+			ip++
 		}
 
+		if ip >= clen {
+			return nil, errors.WithStack(ErrInvalidCompressedData)
+		}
 		ref -= int(buf[ip])
 		ip++
 		length += 2
@@ -103,8 +118,14 @@ func readLZF(buf []byte, clen, ulen int) ([]byte, error) {
 			return nil, errors.WithStack(ErrInvalidCompressedData)
 		}
 
-		for i := 0; i < length; i++ {
-			out[op+i] = out[ref+i]
+		if op-ref >= length {
+			copy(out[op:op+length], out[ref:])
+		} else {
+			// an overlapping run repeats the last op-ref bytes,
+			// it's copied in chunks which double in size since they are repeated too
+			for n := 0; n < length; {
+				n += copy(out[op+n:op+length], out[ref:op+n])
+			}
 		}
 		op += length
 	}
@@ -112,42 +133,142 @@ func readLZF(buf []byte, clen, ulen int) ([]byte, error) {
 	return out[:op], nil
 }
 
-func readZipmapEntry(r *MemReader, value bool) (string, error) {
+// readLZFHead decompresses the first n bytes of LZF compressed buf, or fewer if buf is shorter or corrupt.
+func readLZFHead(buf []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for ip := 0; ip < len(buf) && len(out) < n; {
+		ctrl := int(buf[ip])
+		ip++
+
+		if ctrl < (1 << 5) {
+			ctrl++
+			if ctrl+ip > len(buf) {
+				break
+			}
+			out = append(out, buf[ip:ip+ctrl]...)
+			ip += ctrl
+			continue
+		}
+
+		length := ctrl >> 5
+		ref := len(out) - ((ctrl & 0x1f) << 8) - 1
+		if length == 7 {
+			if ip >= len(buf) {
+				break
+			}
+			length += int(buf[ip])
+			ip++
+		}
+		if ip >= len(buf) {
+			break
+		}
+		ref -= int(buf[ip])
+		ip++
+		if ref < 0 {
+			break
+		}
+		// an overlapping run repeats bytes as they are copied
+		for i := 0; i < length+2 && len(out) < n; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// saturated reports whether the header head of a ziplist or zipmap value of encoding can't count its entries:
+// zllen is 65535 for ziplists of 65535 entries or more, zmlen is 254 for zipmaps of 254 entries or more.
+func saturated(encoding Encoding, head []byte) bool {
+	switch encoding {
+	case EncodingZipmap:
+		return len(head) >= 1 && head[0] >= 254
+	case EncodingZiplist, EncodingHashZip, EncodingSortedSetZip:
+		return len(head) >= 10 && binary.LittleEndian.Uint16(head[8:]) == 65535
+	}
+	return false
+}
+
+// countElements returns the number of elements of a ziplist, zipmap or intset value of encoding from its header.
+// If the header is saturated, b must be the whole value, whose entries are walked then.
+func countElements(encoding Encoding, b []byte) int {
+	var n int
+	switch encoding {
+	case EncodingZipmap:
+		if len(b) >= 1 {
+			n = int(b[0])
+		}
+	case EncodingIntset:
+		if len(b) >= 8 {
+			return int(binary.LittleEndian.Uint32(b[4:]))
+		}
+	case EncodingZiplist, EncodingHashZip, EncodingSortedSetZip:
+		if len(b) >= 10 {
+			n = int(binary.LittleEndian.Uint16(b[8:]))
+		}
+	}
+	if saturated(encoding, b) {
+		v := &value{b: b}
+		walked := 0
+		if encoding == EncodingZipmap {
+			// zmlen counts fields
+			values, err := v.readZipmap(nil)
+			if err == nil {
+				walked = len(values) / 2
+			}
+		} else if values, err := v.readZiplist(nil); err == nil {
+			walked = len(values)
+		}
+		// the header is a lower bound of malformed values
+		if walked > n {
+			n = walked
+		}
+	}
+	if encoding == EncodingHashZip || encoding == EncodingSortedSetZip {
+		// fields and values, members and scores
+		n /= 2
+	}
+	return n
+}
+
+// readZipmapEntry reads a key, or a value and the free bytes following it. Strictly, free bytes must exist
+// before zmend and be fewer than 5, as redis keeps them.
+func readZipmapEntry(r *MemReader, value, strict bool) (string, error) {
 	b, err := r.ReadByte()
 	if err != nil {
 		return "", err
 	}
 
+	var l int
 	switch {
 	case b < 254:
-		if value {
-			n, err := r.ReadByte()
-			if err != nil {
-				return "", err
-			}
-			if n > 0 {
-				r.Discard(int(n))
-			}
-		}
-		return r.readString(int(b))
+		l = int(b)
 	case b == 254:
-		l, err := r.little32()
+		l, err = r.little32()
 		if err != nil {
 			return "", err
 		}
-		if value {
-			n, err := r.ReadByte()
-			if err != nil {
-				return "", err
-			}
-			if n > 0 {
-				r.Discard(int(n))
-			}
-		}
-		return r.readString(l)
 	default:
 		return "", errors.WithStack(ErrInvalidZipmapEntry)
 	}
+	if !value {
+		return r.readString(l)
+	}
+
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	str, err := r.readString(l)
+	if err != nil {
+		return "", err
+	}
+	if strict && (n > 4 || int(n) >= len(r.b)-r.i) {
+		return "", errors.Wrapf(ErrInvalidZipmapEntry, "%d free bytes", n)
+	}
+	r.Discard(int(n))
+	return str, nil
 }
 
 type overhead struct{}
@@ -167,6 +288,14 @@ func (o overhead) alloc(l int) uint64 {
 	}
 }
 
+// str returns the memory used by s as a string object, integers are stored as such.
+func (o overhead) str(s string) uint64 {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(i, 10) == s {
+		return 8
+	}
+	return o.alloc(len(s))
+}
+
 func (o overhead) top(expiry int) uint64 {
 	// Each top level object is an entry in a dictionary, and so we have to include
 	// the overhead of a dictionary entry
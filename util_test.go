@@ -0,0 +1,127 @@
+package rdb
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// lzfStream returns random LZF compressed data of about n bytes uncompressed, and its length.
+func lzfStream(r *rand.Rand, n int) ([]byte, int) {
+	var buf []byte
+	ulen := 0
+	for ulen < n {
+		if ulen == 0 || r.Intn(3) == 0 {
+			l := 1 + r.Intn(32)
+			buf = append(buf, byte(l-1))
+			for i := 0; i < l; i++ {
+				buf = append(buf, byte('a'+r.Intn(4)))
+			}
+			ulen += l
+			continue
+		}
+		d := 1 + r.Intn(ulen)
+		if d > 8192 {
+			d = 8192
+		}
+		if r.Intn(2) == 0 {
+			// overlapping run
+			d = 1 + r.Intn(4)
+			if d > ulen {
+				d = ulen
+			}
+		}
+		l := 3 + r.Intn(262)
+		if l-2 < 7 {
+			buf = append(buf, byte((l-2)<<5|(d-1)>>8), byte(d-1))
+		} else {
+			buf = append(buf, byte(7<<5|(d-1)>>8), byte(l-2-7), byte(d-1))
+		}
+		ulen += l
+	}
+	return buf, ulen
+}
+
+// naiveLZF decompresses buf one byte at a time.
+func naiveLZF(buf []byte, ulen int) []byte {
+	out := make([]byte, 0, ulen)
+	for ip := 0; ip < len(buf); {
+		ctrl := int(buf[ip])
+		ip++
+		if ctrl < 1<<5 {
+			out = append(out, buf[ip:ip+ctrl+1]...)
+			ip += ctrl + 1
+			continue
+		}
+		length := ctrl >> 5
+		ref := len(out) - (ctrl&0x1f)<<8 - 1
+		if length == 7 {
+			length += int(buf[ip])
+			ip++
+		}
+		ref -= int(buf[ip])
+		ip++
+		for i := 0; i < length+2; i++ {
+			out = append(out, out[ref+i])
+		}
+	}
+	return out
+}
+
+func TestReadLZF(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		buf, ulen := lzfStream(r, 1+r.Intn(10000))
+		got, err := readLZF(buf, len(buf), ulen, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := naiveLZF(buf, ulen); !bytes.Equal(got, want) {
+			t.Fatalf("stream %v: got %q, want %q", i, got, want)
+		}
+	}
+	if _, err := readLZF([]byte{0x20, 0x00}, 2, 3, nil); err == nil {
+		t.Fatal("want error of a reference before the output")
+	}
+}
+
+func TestReadLZFHead(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		buf, ulen := lzfStream(r, 1+r.Intn(1000))
+		want := naiveLZF(buf, ulen)
+		n := r.Intn(20)
+		if n < len(want) {
+			want = want[:n]
+		}
+		if got := readLZFHead(buf, n); !bytes.Equal(got, want) {
+			t.Fatalf("stream %v: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestTokenName(t *testing.T) {
+	for b, want := range map[byte]string{TokenResize: "RESIZEDB", TokenExpMSec: "EXPIRETIME_MS", TokenModuleAUX: "MODULE_AUX", TokenEOF: "EOF"} {
+		if got := TokenName(b); got != want {
+			t.Fatalf("%#x: got %q, want %q", b, got, want)
+		}
+	}
+	for b := 0; b < TokenSlotInfo; b++ {
+		if got := TokenName(byte(b)); got != "" {
+			t.Fatalf("%#x: got %q, want none", b, got)
+		}
+	}
+}
+
+func BenchmarkReadLZF(b *testing.B) {
+	buf, ulen := lzfStream(rand.New(rand.NewSource(1)), 1<<20)
+	s := &scratch{buffers: true}
+	b.SetBytes(int64(ulen))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.reset()
+		if _, err := readLZF(buf, len(buf), ulen, s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
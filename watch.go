@@ -0,0 +1,88 @@
+package rdb
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher polls rdb files and reports when they are replaced, e.g. by redis once a BGSAVE completes,
+// so that a snapshot is analysed as soon as it's written.
+//
+// A change is reported once the file is stable over a poll, so that files copied in place aren't reported
+// half written; redis itself writes a temporary file which it renames once complete.
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+
+	once sync.Once
+	stop chan struct{}
+}
+
+// NewWatcher returns a Watcher polling paths every interval, 1s if interval isn't positive.
+func NewWatcher(interval time.Duration, paths ...string) *Watcher {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Watcher{
+		paths:    paths,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Watch calls fn once every watched file exists, then every time one of them changes, until Stop is called
+// or fn returns an error. Changes made while fn runs are reported once it returns.
+// It returns the error of fn, or of os.Stat other than a file not existing yet.
+func (w *Watcher) Watch(fn func() error) error {
+	seen := make([]os.FileInfo, len(w.paths))    // files analysed last
+	pending := make([]os.FileInfo, len(w.paths)) // files seen by the last poll
+	first := true
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		changed, stable := false, true
+		for i, path := range w.paths {
+			fi, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				fi, stable = nil, false
+			} else if err != nil {
+				return err
+			}
+			if !sameFile(fi, seen[i]) {
+				changed = true
+				// files being written are left until the next poll, but the ones found on start are assumed complete
+				if !first && !sameFile(fi, pending[i]) {
+					stable = false
+				}
+			}
+			pending[i] = fi
+		}
+		if changed && stable {
+			copy(seen, pending)
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+		first = false
+		select {
+		case <-w.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops Watch, once fn returns if it's running.
+func (w *Watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// sameFile reports whether a and b are the same file, unchanged since a file replaced by a rename is
+// another file, and a file written in place changes its size or modification time.
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
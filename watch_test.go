@@ -0,0 +1,63 @@
+package rdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.rdb")
+	if err := ioutil.WriteFile(path, []byte("first"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWatcher(10*time.Millisecond, path)
+	calls := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(func() error {
+			b, err := ioutil.ReadFile(path)
+			calls <- string(b)
+			return err
+		})
+	}()
+	wait := func(want string) {
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Fatalf("want: %q, got: %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("want: %q, got no call", want)
+		}
+	}
+	wait("first")
+
+	// redis renames a temporary file once it's written
+	tmp := filepath.Join(dir, "temp.rdb")
+	if err := ioutil.WriteFile(tmp, []byte("second"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	wait("second")
+
+	select {
+	case got := <-calls:
+		t.Fatalf("want: no call, got: %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+	w.Stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}